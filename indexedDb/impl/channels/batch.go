@@ -0,0 +1,245 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+)
+
+// ReceiveBatch stores the received messages in a single transaction and
+// returns the UUID of each, in order. A message with the same message ID as a
+// stored message, or as an earlier message in the batch, updates it instead.
+// The UUID of a message that could not be stored is 0; the rest of the batch is
+// still stored.
+//
+// A MessageReceived event is sent for each stored message, in order.
+func (w *wasmModel) ReceiveBatch(
+	entries []wChannels.ReceiveBatchEntry) []uint64 {
+	uuids := make([]uint64, len(entries))
+
+	msgs := make([]*Message, 0, len(entries))
+	positions := make([]int, 0, len(entries))
+	plaintexts := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		text := string(entry.Content)
+		plaintext := text
+
+		// Handle encryption, if it is present
+		if w.cipher != nil {
+			var err error
+			text, err = w.cipher.Encrypt(entry.Content)
+			if err != nil {
+				jww.ERROR.Printf("Failed to encrypt Message: %+v", err)
+				continue
+			}
+		}
+
+		var parentID []byte
+		if entry.Tag != wChannels.ReceiveMessageTag {
+			parentID = entry.ReactionTo.Bytes()
+		}
+
+		msgs = append(msgs, buildMessage(entry.ChannelID.Marshal(),
+			entry.MessageID.Bytes(), parentID, entry.Nickname, text,
+			entry.PubKey, entry.DmToken, entry.CodesetVersion, entry.Timestamp,
+			entry.Lease, entry.Round, entry.Type, false, entry.Hidden,
+			entry.Status))
+		positions = append(positions, i)
+		plaintexts = append(plaintexts, plaintext)
+	}
+
+	stored, updated, err := w.putMessages(msgs)
+	if err != nil {
+		jww.ERROR.Printf("Failed to receive %d messages: %+v", len(msgs), err)
+		return uuids
+	}
+
+	texts := make(map[uint64]string, len(msgs))
+	storedMsgs := make([]*Message, 0, len(msgs))
+	for j, uuid := range stored {
+		if uuid == 0 {
+			continue
+		}
+		uuids[positions[j]] = uuid
+		msgs[j].ID = uuid
+		storedMsgs = append(storedMsgs, msgs[j])
+		// Updated messages were indexed when first stored
+		if !updated[j] && entries[positions[j]].Type != channels.Reaction {
+			texts[uuid] = plaintexts[j]
+		}
+	}
+	if err = w.search.IndexAll(texts); err != nil {
+		jww.ERROR.Printf("Failed to index %d messages: %+v", len(texts), err)
+	}
+	w.messagesStored(storedMsgs)
+
+	go func() {
+		for j, uuid := range stored {
+			if uuid == 0 {
+				continue
+			}
+			w.eventCallback(bindings.MessageReceived,
+				bindings.MessageReceivedJSON{
+					UUID:      int64(uuid),
+					ChannelID: entries[positions[j]].ChannelID,
+					Update:    updated[j],
+				})
+		}
+	}()
+
+	return uuids
+}
+
+// putMessages stores the messages in a single transaction. A message with the
+// same message ID as a stored message is merged into it, as in
+// wasmModel.updateMessage. Returns the UUID of each message and whether it
+// updated a stored message.
+//
+// A message that cannot be put is dropped, with a UUID of 0, and the rest are
+// put again in a new transaction, so that one bad message does not lose the
+// batch. An error is only returned if the transaction itself fails.
+func (w *wasmModel) putMessages(msgs []*Message) ([]uint64, []bool, error) {
+	uuids := make([]uint64, len(msgs))
+	updated := make([]bool, len(msgs))
+
+	pending := make([]int, len(msgs))
+	for i := range pending {
+		pending[i] = i
+	}
+	for len(pending) > 0 {
+		stored, storedUpdated, failed, err := w.putMessagesTxn(msgs, pending)
+		if err == nil {
+			for j, i := range pending {
+				uuids[i], updated[i] = stored[j], storedUpdated[j]
+			}
+			break
+		} else if failed < 0 {
+			return nil, nil, err
+		}
+
+		jww.ERROR.Printf("Failed to store Message %X of batch; storing the "+
+			"other %d: %+v", msgs[pending[failed]].MessageID,
+			len(pending)-1, err)
+		pending = append(pending[:failed], pending[failed+1:]...)
+	}
+
+	return uuids, updated, nil
+}
+
+// putMessagesTxn puts the messages at the pending positions in a single
+// transaction. Returns the UUID of each and whether it updated a stored
+// message. If a message cannot be put, the transaction is aborted and its
+// position in pending is returned with the error. Otherwise, the position is
+// -1.
+func (w *wasmModel) putMessagesTxn(msgs []*Message, pending []int) (
+	[]uint64, []bool, int, error) {
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadWrite, messageStoreName)
+	if err != nil {
+		return nil, nil, -1,
+			errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, nil, -1,
+			errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreMessageIndex)
+	if err != nil {
+		return nil, nil, -1, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	uuids := make([]uint64, len(pending))
+	updated := make([]bool, len(pending))
+	for j, i := range pending {
+		uuids[j], updated[j], err = putMessage(store, index, msgs[i])
+		if err != nil {
+			// Do not commit the messages already put
+			if abortErr := txn.Abort(); abortErr != nil {
+				jww.ERROR.Printf("Failed to abort Transaction: %+v", abortErr)
+			}
+			return nil, nil, j, err
+		}
+	}
+
+	// Wait for the writes to be committed
+	ctx, cancel := impl.NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return nil, nil, -1,
+			errors.Errorf("Storing Messages failed: %+v", err)
+	}
+
+	jww.DEBUG.Printf("Successfully stored %d messages", len(pending))
+	return uuids, updated, -1, nil
+}
+
+// putMessage puts the message in the object store, merging it into the stored
+// message with the same message ID, if there is one. Returns the UUID of the
+// message and whether it updated a stored message.
+func putMessage(
+	store *idb.ObjectStore, index *idb.Index, msg *Message) (uint64, bool, error) {
+	getRequest, err := index.Get(impl.EncodeBytes(msg.MessageID))
+	if err != nil {
+		return 0, false, errors.Errorf("Unable to Get from Index: %+v", err)
+	}
+	currentObj, err := impl.SendRequest(getRequest)
+	if err != nil {
+		return 0, false, errors.Errorf("Unable to Get from Index: %+v", err)
+	}
+
+	updated := !currentObj.IsUndefined() && !currentObj.IsNull()
+	if updated {
+		currentMsg, err := valueToMessage(currentObj)
+		if err != nil {
+			return 0, false, errors.Errorf(
+				"Unable to unmarshal stored Message: %+v", err)
+		}
+		currentMsg.Status = msg.Status
+		currentMsg.MessageID = msg.MessageID
+		currentMsg.Round = msg.Round
+		currentMsg.Timestamp = msg.Timestamp
+		currentMsg.Pinned = msg.Pinned
+		currentMsg.Hidden = msg.Hidden
+		msg = currentMsg
+	}
+
+	msg.setIndexKeys()
+
+	// Convert to jsObject
+	msgJson, err := json.Marshal(msg)
+	if err != nil {
+		return 0, false, errors.Errorf("Unable to marshal Message: %+v", err)
+	}
+	msgObj, err := utils.JsonToJS(msgJson)
+	if err != nil {
+		return 0, false, errors.Errorf("Unable to marshal Message: %+v", err)
+	}
+
+	putRequest, err := store.Put(msgObj)
+	if err != nil {
+		return 0, false, errors.Errorf("Unable to Put Message: %+v", err)
+	}
+	key, err := impl.SendRequest(putRequest)
+	if err != nil {
+		return 0, false, errors.Errorf("Unable to Put Message: %+v", err)
+	}
+	return uint64(key.Int()), updated, nil
+}
@@ -23,19 +23,21 @@ import (
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
 )
 
-var zeroUUID = []byte{0, 0, 0, 0, 0, 0, 0, 0}
-
 // manager handles the event model and the message callbacks, which is used to
 // send information between the event model and the main thread.
 type manager struct {
 	wtm   *worker.ThreadManager
-	model channels.EventModel
+	model *wasmModel
+
+	// stopSweepers stop the sweepers started for model.
+	stopSweepers []func()
 }
 
 // registerCallbacks registers all the reception callbacks to manage messages
@@ -44,14 +46,28 @@ func (m *manager) registerCallbacks() {
 	m.wtm.RegisterCallback(wChannels.NewWASMEventModelTag, m.newWASMEventModelCB)
 	m.wtm.RegisterCallback(wChannels.JoinChannelTag, m.joinChannelCB)
 	m.wtm.RegisterCallback(wChannels.LeaveChannelTag, m.leaveChannelCB)
-	m.wtm.RegisterCallback(wChannels.ReceiveMessageTag, m.receiveMessageCB)
-	m.wtm.RegisterCallback(wChannels.ReceiveReplyTag, m.receiveReplyCB)
-	m.wtm.RegisterCallback(wChannels.ReceiveReactionTag, m.receiveReactionCB)
+	m.wtm.RegisterCallback(wChannels.ReceiveBatchTag, m.receiveBatchCB)
 	m.wtm.RegisterCallback(wChannels.UpdateFromUUIDTag, m.updateFromUuidCB)
 	m.wtm.RegisterCallback(wChannels.UpdateFromMessageIDTag, m.updateFromMessageIdCB)
 	m.wtm.RegisterCallback(wChannels.GetMessageTag, m.getMessageCB)
 	m.wtm.RegisterCallback(wChannels.DeleteMessageTag, m.deleteMessageCB)
 	m.wtm.RegisterCallback(wChannels.MuteUserTag, m.muteUserCB)
+	m.wtm.RegisterCallback(wChannels.QueryMessagesTag, m.queryMessagesCB)
+	m.wtm.RegisterCallback(wChannels.SearchMessagesTag, m.searchMessagesCB)
+	m.wtm.RegisterCallback(
+		wChannels.SetRetentionPolicyTag, m.setRetentionPolicyCB)
+	m.wtm.RegisterCallback(
+		wChannels.RotateDatabaseKeyTag, m.rotateDatabaseKeyCB)
+	m.wtm.RegisterCallback(
+		wChannels.ExportChannelHistoryTag, m.exportChannelHistoryCB)
+	m.wtm.RegisterCallback(wChannels.ImportHistoryTag, m.importHistoryCB)
+	m.wtm.RegisterCallback(wChannels.MarkReadTag, m.markReadCB)
+	m.wtm.RegisterCallback(wChannels.GetUnreadCountsTag, m.getUnreadCountsCB)
+	m.wtm.RegisterCallback(wChannels.SaveDraftTag, m.saveDraftCB)
+	m.wtm.RegisterCallback(wChannels.GetDraftTag, m.getDraftCB)
+	m.wtm.RegisterCallback(wChannels.ClearDraftTag, m.clearDraftCB)
+	m.wtm.RegisterCallback(wChannels.LockCipherTag, m.lockCipherCB)
+	m.wtm.RegisterCallback(wChannels.UnlockCipherTag, m.unlockCipherCB)
 }
 
 // newWASMEventModelCB is the callback for NewWASMEventModel. Returns an empty
@@ -67,7 +83,7 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 
 	// Create new encryption cipher
 	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
-	encryption, err := idbCrypto.NewCipherFromJSON(
+	encryption, err := impl.NewCipherFromJSON(
 		[]byte(msg.EncryptionJSON), rng.GetStream())
 	if err != nil {
 		reply([]byte(errors.Wrap(err,
@@ -75,13 +91,41 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 		return
 	}
 
-	m.model, err = NewWASMEventModel(
+	model, err := newWASMModel(
 		msg.DatabaseName, encryption, m.eventUpdateCallback)
 	if err != nil {
 		reply([]byte(err.Error()))
 		return
 	}
 
+	// The stored encryption status of databases created by older versions or
+	// with an interrupted migration cannot be trusted, so it is checked
+	// against the rows, with both ciphers if the migration is unfinished
+	if msg.ProbeEncryption {
+		err = impl.ProbeEncryption(model.db, model.cipher, encryptedStores)
+		if err != nil {
+			if closeErr := model.db.Close(); closeErr != nil {
+				jww.ERROR.Printf(
+					"[CH] Failed to close database: %+v", closeErr)
+			}
+			reply([]byte(errors.Wrap(err, "cannot load database with "+
+				"different encryption status").Error()))
+			return
+		}
+	}
+
+	// Stop the sweepers of the model being replaced
+	for _, stop := range m.stopSweepers {
+		stop()
+	}
+	m.model = model
+	m.stopSweepers = []func(){
+		impl.StartSweeper(msg.DatabaseName, impl.RetentionSweepInterval,
+			m.model.PruneMessages),
+		impl.StartSweeper(
+			msg.DatabaseName, leaseSweepInterval, m.model.ExpireMessages),
+	}
+
 	reply(nil)
 }
 
@@ -140,79 +184,25 @@ func (m *manager) leaveChannelCB(message []byte, _ func([]byte)) {
 	m.model.LeaveChannel(channelID)
 }
 
-// receiveMessageCB is the callback for wasmModel.ReceiveMessage. Returns a UUID
-// of 0 on error or the JSON marshalled UUID (uint64) on success.
-func (m *manager) receiveMessageCB(message []byte, reply func(message []byte)) {
-	var msg channels.ModelMessage
-	err := json.Unmarshal(message, &msg)
-	if err != nil {
-		jww.ERROR.Printf("[CH] Could not JSON unmarshal payload for "+
-			"ReceiveMessage from main thread: %+v", err)
-		reply(zeroUUID)
-		return
-	}
-
-	uuid := m.model.ReceiveMessage(msg.ChannelID, msg.MessageID, msg.Nickname,
-		string(msg.Content), msg.PubKey, msg.DmToken, msg.CodesetVersion,
-		msg.Timestamp, msg.Lease, rounds.Round{ID: msg.Round}, msg.Type,
-		msg.Status, msg.Hidden)
-
-	replyMsg, err := json.Marshal(uuid)
-	if err != nil {
-		exception.Throwf(
-			"[CH] Could not JSON marshal UUID for ReceiveMessage: %+v", err)
-	}
-
-	reply(replyMsg)
-}
-
-// receiveReplyCB is the callback for wasmModel.ReceiveReply. Returns a UUID of
-// 0 on error or the JSON marshalled UUID (uint64) on success.
-func (m *manager) receiveReplyCB(message []byte, reply func(message []byte)) {
-	var msg wChannels.ReceiveReplyMessage
-	err := json.Unmarshal(message, &msg)
-	if err != nil {
-		jww.ERROR.Printf("[CH] Could not JSON unmarshal payload for "+
-			"ReceiveReply from main thread: %+v", err)
-		reply(zeroUUID)
-		return
-	}
-
-	uuid := m.model.ReceiveReply(msg.ChannelID, msg.MessageID, msg.ReactionTo,
-		msg.Nickname, string(msg.Content), msg.PubKey, msg.DmToken,
-		msg.CodesetVersion, msg.Timestamp, msg.Lease,
-		rounds.Round{ID: msg.Round}, msg.Type, msg.Status, msg.Hidden)
-
-	replyMsg, err := json.Marshal(uuid)
-	if err != nil {
-		exception.Throwf(
-			"[CH] Could not JSON marshal UUID for ReceiveReply: %+v", err)
-	}
-
-	reply(replyMsg)
-}
-
-// receiveReactionCB is the callback for wasmModel.ReceiveReaction. Returns a
-// UUID of 0 on error or the JSON marshalled UUID (uint64) on success.
-func (m *manager) receiveReactionCB(message []byte, reply func(message []byte)) {
-	var msg wChannels.ReceiveReplyMessage
+// receiveBatchCB is the callback for wasmModel.ReceiveBatch. Returns the JSON
+// marshalled UUID (uint64) of each message, in order, with 0 for messages that
+// could not be stored. Returns an empty list if the batch cannot be read.
+func (m *manager) receiveBatchCB(message []byte, reply func(message []byte)) {
+	var msg wChannels.ReceiveBatchMessage
 	err := json.Unmarshal(message, &msg)
 	if err != nil {
 		jww.ERROR.Printf("[CH] Could not JSON unmarshal payload for "+
-			"ReceiveReaction from main thread: %+v", err)
-		reply(zeroUUID)
+			"ReceiveBatch from main thread: %+v", err)
+		reply([]byte("[]"))
 		return
 	}
 
-	uuid := m.model.ReceiveReaction(msg.ChannelID, msg.MessageID,
-		msg.ReactionTo, msg.Nickname, string(msg.Content), msg.PubKey,
-		msg.DmToken, msg.CodesetVersion, msg.Timestamp, msg.Lease,
-		rounds.Round{ID: msg.Round}, msg.Type, msg.Status, msg.Hidden)
+	uuids := m.model.ReceiveBatch(msg.Messages)
 
-	replyMsg, err := json.Marshal(uuid)
+	replyMsg, err := json.Marshal(uuids)
 	if err != nil {
 		exception.Throwf(
-			"[CH] Could not JSON marshal UUID for ReceiveReaction: %+v", err)
+			"[CH] Could not JSON marshal UUIDs for ReceiveBatch: %+v", err)
 	}
 
 	reply(replyMsg)
@@ -371,3 +361,329 @@ func (m *manager) muteUserCB(message []byte, _ func([]byte)) {
 	}
 	m.model.MuteUser(msg.ChannelID, msg.PubKey, msg.Unmute)
 }
+
+// queryMessagesCB is the callback for wasmModel.QueryMessages. Returns JSON
+// marshalled wChannels.MessageQueryResult. If an error occurs, then Error will
+// be set with the error message.
+func (m *manager) queryMessagesCB(messageData []byte, reply func(message []byte)) {
+	var result wChannels.MessageQueryResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"QueryMessages: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var query wChannels.MessageQuery
+	err := json.Unmarshal(messageData, &query)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", query, err).Error()
+		return
+	}
+
+	result, err = m.model.QueryMessages(query)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// searchMessagesCB is the callback for wasmModel.SearchMessages. Returns JSON
+// marshalled wChannels.SearchMessagesResult. If an error occurs, then Error
+// will be set with the error message.
+func (m *manager) searchMessagesCB(messageData []byte, reply func(message []byte)) {
+	var result wChannels.SearchMessagesResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"SearchMessages: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.SearchMessagesMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	result.Messages, err = m.model.SearchMessages(
+		msg.Query, msg.ChannelID, msg.Limit)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// setRetentionPolicyCB is the callback for wasmModel.SetRetentionPolicy.
+// Returns nothing on success or an error message on failure.
+func (m *manager) setRetentionPolicyCB(
+	messageData []byte, reply func(message []byte)) {
+	var msg wChannels.SetRetentionPolicyMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	err = m.model.SetRetentionPolicy(msg.ChannelID, msg.Policy)
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// rotateDatabaseKeyCB is the callback for wasmModel.RotateDatabaseKey. Returns
+// JSON marshalled wChannels.RotateDatabaseKeyResult. If an error occurs, then
+// Error will be set with the error message.
+func (m *manager) rotateDatabaseKeyCB(
+	messageData []byte, reply func(message []byte)) {
+	var result wChannels.RotateDatabaseKeyResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"RotateDatabaseKey: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.RotateDatabaseKeyMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+	encryption, err := impl.NewCipherFromJSON(
+		[]byte(msg.EncryptionJSON), rng.GetStream())
+	if err != nil {
+		result.Error = errors.Wrap(err,
+			"failed to JSON unmarshal Cipher from main thread").Error()
+		return
+	}
+
+	result.Progress, err = m.model.RotateDatabaseKey(encryption, msg.Resume)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// exportChannelHistoryCB is the callback for wasmModel.ExportChannelHistory.
+// Returns JSON marshalled wChannels.ExportChannelHistoryResult with the next
+// chunk. If an error occurs, then Error will be set with the error message.
+func (m *manager) exportChannelHistoryCB(
+	messageData []byte, reply func(message []byte)) {
+	var result wChannels.ExportChannelHistoryResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"ExportChannelHistory: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.ExportChannelHistoryMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	result, err = m.model.ExportChannelHistory(msg)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// importHistoryCB is the callback for wasmModel.ImportHistory. Returns JSON
+// marshalled wChannels.ImportHistoryResult with the progress of the batch. If
+// an error occurs, then Error will be set with the error message.
+func (m *manager) importHistoryCB(
+	messageData []byte, reply func(message []byte)) {
+	var result wChannels.ImportHistoryResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"ImportHistory: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.ImportHistoryMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	result.Progress, err = m.model.ImportHistory(msg)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// markReadCB is the callback for wasmModel.MarkRead. Returns an empty slice on
+// success or an error message on failure.
+func (m *manager) markReadCB(messageData []byte, reply func(message []byte)) {
+	var msg wChannels.MarkReadMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	if err = m.model.MarkRead(msg.ChannelID, msg.UUID); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getUnreadCountsCB is the callback for wasmModel.GetUnreadCounts. Returns
+// JSON marshalled wChannels.GetUnreadCountsResult. If an error occurs, then
+// Error will be set with the error message.
+func (m *manager) getUnreadCountsCB(_ []byte, reply func(message []byte)) {
+	var result wChannels.GetUnreadCountsResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetUnreadCounts: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var err error
+	result.UnreadCounts, err = m.model.GetUnreadCounts()
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// saveDraftCB is the callback for wasmModel.SaveDraft. Returns an empty slice
+// on success or an error message on failure.
+func (m *manager) saveDraftCB(messageData []byte, reply func(message []byte)) {
+	var msg wChannels.SaveDraftMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	if err = m.model.SaveDraft(msg.ChannelID, msg.Draft); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getDraftCB is the callback for wasmModel.GetDraft. Returns JSON marshalled
+// wChannels.GetDraftResult. If an error occurs, then Error will be set with
+// the error message.
+func (m *manager) getDraftCB(messageData []byte, reply func(message []byte)) {
+	var result wChannels.GetDraftResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetDraft: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	channelID, err := id.Unmarshal(messageData)
+	if err != nil {
+		result.Error = errors.Errorf("failed to unmarshal channel ID from "+
+			"main thread: %+v", err).Error()
+		return
+	}
+
+	result.Draft, err = m.model.GetDraft(channelID)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// clearDraftCB is the callback for wasmModel.ClearDraft. Returns an empty
+// slice on success or an error message on failure.
+func (m *manager) clearDraftCB(messageData []byte, reply func(message []byte)) {
+	channelID, err := id.Unmarshal(messageData)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to unmarshal channel ID from "+
+			"main thread: %+v", err).Error()))
+		return
+	}
+
+	if err = m.model.ClearDraft(channelID); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// lockCipherCB is the callback for the session handler locking the worker.
+// Always returns an empty slice.
+func (m *manager) lockCipherCB(_ []byte, reply func(message []byte)) {
+	m.model.LockCipher()
+	reply(nil)
+}
+
+// unlockCipherCB is the callback for the session handler unlocking the worker.
+// Returns an empty slice on success or an error message on failure.
+func (m *manager) unlockCipherCB(
+	messageData []byte, reply func(message []byte)) {
+	var msg wChannels.UnlockCipherMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Wrapf(err,
+			"failed to JSON unmarshal %T from main thread", msg).Error()))
+		return
+	}
+
+	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+	encryption, err := impl.NewCipherFromJSON(
+		[]byte(msg.EncryptionJSON), rng.GetStream())
+	if err != nil {
+		reply([]byte(errors.Wrap(err,
+			"failed to JSON unmarshal Cipher from main thread").Error()))
+		return
+	}
+	var rotation idbCrypto.Cipher
+	if msg.Rotating {
+		rotation, err = impl.NewCipherFromJSON(
+			[]byte(msg.RotationJSON), rng.GetStream())
+		if err != nil {
+			reply([]byte(errors.Wrap(err,
+				"failed to JSON unmarshal Cipher from main thread").Error()))
+			return
+		}
+	}
+
+	err = m.model.UnlockCipher(
+		encryption, msg.Rotating, rotation, rng.GetStream())
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
@@ -0,0 +1,56 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// SaveDraft stores the draft of the channel, encrypted with the cipher of the
+// database, replacing any stored draft. A zero draft clears the stored draft.
+func (w *wasmModel) SaveDraft(channelID *id.ID, draft impl.Draft) error {
+	parentErr := errors.New("failed to SaveDraft")
+
+	if channelID == nil {
+		return errors.WithMessage(parentErr, "missing channel ID")
+	}
+	err := impl.PutDraft(
+		w.db, w.cipher, channelID.Marshal(), draft, netTime.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+	return nil
+}
+
+// GetDraft returns the draft of the channel. Returns a zero draft if none is
+// stored.
+func (w *wasmModel) GetDraft(channelID *id.ID) (impl.Draft, error) {
+	parentErr := errors.New("failed to GetDraft")
+
+	draft, err := impl.GetDraft(w.db, w.cipher, channelID.Marshal())
+	if err != nil {
+		return impl.Draft{}, errors.WithMessage(parentErr, err.Error())
+	}
+	return draft, nil
+}
+
+// ClearDraft removes the draft of the channel, if one is stored.
+func (w *wasmModel) ClearDraft(channelID *id.ID) error {
+	parentErr := errors.New("failed to ClearDraft")
+
+	if err := impl.DeleteDraft(w.db, channelID.Marshal()); err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/client/v4/channelsFileTransfer"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// exportPageSize is the number of messages read for each chunk of
+// wasmModel.ExportChannelHistory.
+const exportPageSize = 100
+
+// exportCursor is the position of the last chunk of
+// wasmModel.ExportChannelHistory. It is base 64 encoded JSON in the result so
+// that Javascript can treat it as opaque.
+type exportCursor struct {
+	// Query is the cursor of the next page of wasmModel.QueryMessages.
+	Query string `json:"query"`
+
+	// Written is the number of messages written in earlier chunks.
+	Written int `json:"written"`
+}
+
+// ExportChannelHistory returns the next chunk of the export of the channel
+// history. The first chunk starts with the header of the format and the last
+// chunk, which has no next cursor, ends with its footer. Each chunk holds up to
+// exportPageSize messages, in timestamp order, with their content decrypted.
+func (w *wasmModel) ExportChannelHistory(
+	msg wChannels.ExportChannelHistoryMessage) (
+	wChannels.ExportChannelHistoryResult, error) {
+	parentErr := errors.New("failed to ExportChannelHistory")
+	var result wChannels.ExportChannelHistoryResult
+
+	if msg.ChannelID == nil {
+		return result, errors.WithMessage(parentErr, "missing channel ID")
+	}
+	hw, err := newHistoryWriter(msg.Format)
+	if err != nil {
+		return result, errors.WithMessage(parentErr, err.Error())
+	}
+
+	var buf bytes.Buffer
+	var cursor exportCursor
+	if msg.Cursor == "" {
+		channel, err := w.exportChannel(msg.ChannelID)
+		if err != nil {
+			return result, errors.WithMessage(parentErr, err.Error())
+		}
+		err = hw.writeHeader(&buf, wChannels.ChannelHistory{
+			Version:    wChannels.ExportVersion,
+			Channel:    channel,
+			Range:      msg.Range,
+			ExportedAt: netTime.Now().UTC(),
+		})
+		if err != nil {
+			return result, errors.WithMessage(parentErr, err.Error())
+		}
+	} else if err = decodeExportCursor(msg.Cursor, &cursor); err != nil {
+		return result, errors.WithMessagef(parentErr,
+			"Invalid cursor: %+v", err)
+	}
+
+	page, err := w.QueryMessages(wChannels.MessageQuery{
+		ChannelID: msg.ChannelID,
+		Start:     msg.Range.Start,
+		End:       msg.Range.End,
+		Limit:     exportPageSize,
+		Cursor:    cursor.Query,
+	})
+	if err != nil {
+		return result, errors.WithMessage(parentErr, err.Error())
+	}
+
+	for _, modelMsg := range page.Messages {
+		// Reactions are written with the message they react to
+		if modelMsg.Type == channels.Reaction {
+			continue
+		}
+
+		exported, parent, err := w.exportMessageWithContext(modelMsg)
+		if err != nil {
+			return result, errors.WithMessage(parentErr, err.Error())
+		}
+		err = hw.writeMessage(&buf, exported, parent, cursor.Written == 0)
+		if err != nil {
+			return result, errors.WithMessage(parentErr, err.Error())
+		}
+		cursor.Written++
+	}
+
+	if page.NextCursor == "" {
+		hw.writeFooter(&buf)
+	} else {
+		cursor.Query = page.NextCursor
+		if result.NextCursor, err = encodeExportCursor(cursor); err != nil {
+			return result, errors.WithMessage(parentErr, err.Error())
+		}
+	}
+
+	result.Chunk = buf.Bytes()
+	return result, nil
+}
+
+// exportChannel returns the stored channel with the ID. Only the ID is set if
+// the channel is no longer joined.
+func (w *wasmModel) exportChannel(
+	channelID *id.ID) (wChannels.ExportedChannel, error) {
+	exported := wChannels.ExportedChannel{ID: channelID}
+
+	channelObj, err := impl.Get(w.db, channelStoreName,
+		impl.EncodeBytes(channelID.Marshal()))
+	if err != nil {
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return exported, nil
+		}
+		return exported, err
+	}
+
+	var channel Channel
+	err = json.Unmarshal([]byte(utils.JsToJson(channelObj)), &channel)
+	if err != nil {
+		return exported, errors.Errorf("Unable to unmarshal Channel: %+v", err)
+	}
+	exported.Name = channel.Name
+	exported.Description = channel.Description
+	return exported, nil
+}
+
+// exportMessageWithContext returns the exported message with its reactions and
+// the message it replies to, if it is stored.
+func (w *wasmModel) exportMessageWithContext(modelMsg channels.ModelMessage) (
+	wChannels.ExportedMessage, *wChannels.ExportedMessage, error) {
+	exported := exportMessage(modelMsg)
+
+	// Get the reactions to the message
+	values, err := impl.GetAllIndex(w.db, messageStoreName,
+		messageStoreParentIndex, impl.EncodeBytes(modelMsg.MessageID.Marshal()))
+	if err != nil {
+		return exported, nil, err
+	}
+	for _, value := range values {
+		msg, err := valueToMessage(value)
+		if err != nil {
+			return exported, nil, err
+		} else if channels.MessageType(msg.Type) != channels.Reaction {
+			continue
+		}
+		reaction, err := w.decryptModelMessage(msg)
+		if err != nil {
+			return exported, nil, err
+		}
+		exported.Reactions = append(exported.Reactions, exportMessage(reaction))
+	}
+	sort.SliceStable(exported.Reactions, func(i, j int) bool {
+		return exported.Reactions[i].Timestamp.Before(
+			exported.Reactions[j].Timestamp)
+	})
+
+	if exported.ReplyTo == nil {
+		return exported, nil, nil
+	}
+
+	// Get the message it replies to
+	parentObj, err := impl.GetIndex(w.db, messageStoreName,
+		messageStoreMessageIndex, impl.EncodeBytes(exported.ReplyTo.Marshal()))
+	if err != nil {
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return exported, nil, nil
+		}
+		return exported, nil, err
+	}
+	msg, err := valueToMessage(parentObj)
+	if err != nil {
+		return exported, nil, err
+	}
+	parentMsg, err := w.decryptModelMessage(msg)
+	if err != nil {
+		return exported, nil, err
+	}
+	parent := exportMessage(parentMsg)
+	return exported, &parent, nil
+}
+
+// exportMessage converts the decrypted message into a
+// [wChannels.ExportedMessage]. The content of a file message is replaced with a
+// reference to the file.
+func exportMessage(modelMsg channels.ModelMessage) wChannels.ExportedMessage {
+	exported := wChannels.ExportedMessage{
+		MessageID:      modelMsg.MessageID,
+		Type:           modelMsg.Type,
+		Nickname:       modelMsg.Nickname,
+		PubKey:         modelMsg.PubKey,
+		DmToken:        modelMsg.DmToken,
+		CodesetVersion: modelMsg.CodesetVersion,
+		Timestamp:      modelMsg.Timestamp.UTC(),
+		Lease:          modelMsg.Lease,
+		Round:          modelMsg.Round,
+		Status:         modelMsg.Status,
+		Pinned:         modelMsg.Pinned,
+		Hidden:         modelMsg.Hidden,
+	}
+	if modelMsg.ParentMessageID != (message.ID{}) {
+		parentID := modelMsg.ParentMessageID
+		exported.ReplyTo = &parentID
+	}
+
+	if modelMsg.Type == channels.FileTransfer {
+		var fi channelsFileTransfer.FileInfo
+		if err := json.Unmarshal(modelMsg.Content, &fi); err == nil {
+			exported.File = &wChannels.ExportedFile{
+				FileID: fi.FileID,
+				Name:   fi.Name,
+				Type:   fi.Type,
+				Size:   fi.Size,
+			}
+			return exported
+		}
+	}
+
+	exported.Text = string(modelMsg.Content)
+	return exported
+}
+
+// encodeExportCursor returns the cursor as base 64 encoded JSON.
+func encodeExportCursor(ec exportCursor) (string, error) {
+	data, err := json.Marshal(ec)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// decodeExportCursor decodes a cursor encoded with encodeExportCursor.
+func decodeExportCursor(s string, ec *exportCursor) error {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, ec)
+}
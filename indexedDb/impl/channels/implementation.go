@@ -40,6 +40,11 @@ type wasmModel struct {
 	db            *idb.Database
 	cipher        idbCrypto.Cipher
 	eventCallback eventUpdate
+	search        *impl.SearchIndex
+
+	// rotation is the unfinished key rotation started by RotateDatabaseKey.
+	// While it is set, cipher is its [impl.RotationCipher].
+	rotation *impl.KeyRotation
 }
 
 // JoinChannel is called whenever a channel is joined locally.
@@ -53,6 +58,14 @@ func (w *wasmModel) JoinChannel(channel *cryptoBroadcast.Channel) {
 		Description: channel.Description,
 	}
 
+	// Keep the read marker of a channel that is already stored
+	if stored, err := w.getChannel(newChannel.ID); err == nil {
+		newChannel.LastReadUUID = stored.LastReadUUID
+		newChannel.LastReadTimestamp = stored.LastReadTimestamp
+		newChannel.UnreadCount = stored.UnreadCount
+		newChannel.LastCountedUUID = stored.LastCountedUUID
+	}
+
 	// Convert to jsObject
 	newChannelJson, err := json.Marshal(&newChannel)
 	if err != nil {
@@ -87,6 +100,19 @@ func (w *wasmModel) LeaveChannel(channelID *id.ID) {
 	}
 
 	// Clean up lingering data
+	err = impl.PutRetentionPolicy(
+		w.db, channelID.Marshal(), impl.RetentionPolicy{})
+	if err != nil {
+		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
+			"Unable to delete retention policy: %+v", err))
+		return
+	}
+	err = impl.DeleteDraft(w.db, channelID.Marshal())
+	if err != nil {
+		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
+			"Unable to delete draft: %+v", err))
+		return
+	}
 	err = w.deleteMsgByChannel(channelID)
 	if err != nil {
 		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
@@ -130,8 +156,14 @@ func (w *wasmModel) deleteMsgByChannel(channelID *id.ID) error {
 	}
 
 	// Perform the operation
+	var deleted []*Message
 	err = impl.SendCursorRequest(cursorRequest,
 		func(cursor *idb.CursorWithValue) error {
+			if value, err := cursor.Value(); err == nil {
+				if msg, err := valueToMessage(value); err == nil {
+					deleted = append(deleted, msg)
+				}
+			}
 			_, err := cursor.Delete()
 			return err
 		})
@@ -139,6 +171,11 @@ func (w *wasmModel) deleteMsgByChannel(channelID *id.ID) error {
 		return errors.WithMessagef(parentErr,
 			"Unable to delete Message data: %+v", err)
 	}
+
+	// Remove the deleted messages from the search index
+	for _, msg := range deleted {
+		w.unindexMessage(msg)
+	}
 	return nil
 }
 
@@ -151,6 +188,7 @@ func (w *wasmModel) ReceiveMessage(channelID *id.ID, messageID message.ID,
 	codeset uint8, timestamp time.Time, lease time.Duration, round rounds.Round,
 	mType channels.MessageType, status channels.SentStatus, hidden bool) uint64 {
 	var err error
+	plaintext := text
 
 	// Handle encryption, if it is present
 	if w.cipher != nil {
@@ -173,6 +211,9 @@ func (w *wasmModel) ReceiveMessage(channelID *id.ID, messageID message.ID,
 		jww.ERROR.Printf("Failed to receive Message: %+v", err)
 		return 0
 	}
+	w.indexMessage(uuid, mType, plaintext)
+	msgToInsert.ID = uuid
+	w.messagesStored([]*Message{msgToInsert})
 
 	go w.eventCallback(bindings.MessageReceived, bindings.MessageReceivedJSON{
 		UUID:      int64(uuid),
@@ -194,6 +235,7 @@ func (w *wasmModel) ReceiveReply(channelID *id.ID, messageID,
 	round rounds.Round, mType channels.MessageType, status channels.SentStatus,
 	hidden bool) uint64 {
 	var err error
+	plaintext := text
 
 	// Handle encryption, if it is present
 	if w.cipher != nil {
@@ -215,6 +257,9 @@ func (w *wasmModel) ReceiveReply(channelID *id.ID, messageID,
 		jww.ERROR.Printf("Failed to receive reply: %+v", err)
 		return 0
 	}
+	w.indexMessage(uuid, mType, plaintext)
+	msgToInsert.ID = uuid
+	w.messagesStored([]*Message{msgToInsert})
 
 	go w.eventCallback(bindings.MessageReceived, bindings.MessageReceivedJSON{
 		UUID:      int64(uuid),
@@ -257,6 +302,8 @@ func (w *wasmModel) ReceiveReaction(channelID *id.ID, messageID,
 		jww.ERROR.Printf("Failed to receive reaction: %+v", err)
 		return 0
 	}
+	msgToInsert.ID = uuid
+	w.messagesStored([]*Message{msgToInsert})
 
 	go w.eventCallback(bindings.MessageReceived, bindings.MessageReceivedJSON{
 		UUID:      int64(uuid),
@@ -380,6 +427,7 @@ func buildMessage(channelID, messageID, parentID []byte, nickname,
 func (w *wasmModel) updateMessage(currentMsg *Message, messageID *message.ID,
 	timestamp *time.Time, round *rounds.Round, pinned, hidden *bool,
 	status *channels.SentStatus) (uint64, error) {
+	previous := *currentMsg
 
 	if status != nil {
 		currentMsg.Status = uint8(*status)
@@ -409,6 +457,9 @@ func (w *wasmModel) updateMessage(currentMsg *Message, messageID *message.ID,
 	if err != nil {
 		return 0, err
 	}
+	if hidden != nil || timestamp != nil {
+		w.messageUpdated(&previous, currentMsg)
+	}
 
 	channelID, err := id.Unmarshal(currentMsg.ChannelID)
 	if err != nil {
@@ -427,6 +478,8 @@ func (w *wasmModel) updateMessage(currentMsg *Message, messageID *message.ID,
 // upsertMessage is a helper function that will update an existing record
 // if Message.ID is specified. Otherwise, it will perform an insert.
 func (w *wasmModel) upsertMessage(msg *Message) (uint64, error) {
+	msg.setIndexKeys()
+
 	// Convert to jsObject
 	newMessageJson, err := json.Marshal(msg)
 	if err != nil {
@@ -485,6 +538,21 @@ func (w *wasmModel) GetMessage(
 		return channels.ModelMessage{}, err
 	}
 
+	return buildModelMessage(lookupResult)
+}
+
+// buildModelMessage is a private helper that converts a stored Message into a
+// [channels.ModelMessage]. The content is returned as stored.
+func buildModelMessage(lookupResult *Message) (channels.ModelMessage, error) {
+	var err error
+	var messageID message.ID
+	if lookupResult.MessageID != nil {
+		messageID, err = message.UnmarshalID(lookupResult.MessageID)
+		if err != nil {
+			return channels.ModelMessage{}, err
+		}
+	}
+
 	var channelId *id.ID
 	if lookupResult.ChannelID != nil {
 		channelId, err = id.Unmarshal(lookupResult.ChannelID)
@@ -526,17 +594,29 @@ func (w *wasmModel) GetMessage(
 		Round:           id.Round(lookupResult.Round),
 		PubKey:          lookupResult.Pubkey,
 		CodesetVersion:  lookupResult.CodesetVersion,
+		DmToken:         lookupResult.DmToken,
 	}, nil
 }
 
 // DeleteMessage removes a message with the given messageID from storage.
 func (w *wasmModel) DeleteMessage(messageID message.ID) error {
-	err := impl.DeleteIndex(w.db, messageStoreName,
-		messageStoreMessageIndex, pkeyName, impl.EncodeBytes(messageID.Marshal()))
+	msgIDStr := impl.EncodeBytes(messageID.Marshal())
+	msgObj, err := impl.GetIndex(
+		w.db, messageStoreName, messageStoreMessageIndex, msgIDStr)
 	if err != nil {
 		return err
 	}
 
+	err = impl.Delete(w.db, messageStoreName, msgObj.Get(pkeyName))
+	if err != nil {
+		return err
+	}
+
+	if msg, err := valueToMessage(msgObj); err == nil {
+		w.unindexMessage(msg)
+		w.messageRemoved(msg)
+	}
+
 	go w.eventCallback(bindings.MessageDeleted, bindings.MessageDeletedJSON{
 		MessageID: messageID,
 	})
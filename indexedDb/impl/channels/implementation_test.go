@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -23,6 +24,7 @@ import (
 	jww "github.com/spf13/jwalterweatherman"
 	"github.com/stretchr/testify/require"
 
+	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/channels"
 	cft "gitlab.com/elixxir/client/v4/channelsFileTransfer"
 	"gitlab.com/elixxir/client/v4/cmix/rounds"
@@ -31,7 +33,10 @@ import (
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/elixxir/xxdk-wasm/worker"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/netTime"
@@ -494,6 +499,829 @@ func Test_wasmModel_deleteMsgByChannel(t *testing.T) {
 	}
 }
 
+// Tests that wasmModel.QueryMessages pages through the messages of a channel
+// in order with decrypted content and applies the filters.
+func Test_wasmModel_QueryMessages(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_QueryMessages" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, dummyEU)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			channelA := id.NewIdFromString("channelA", id.Generic, t)
+			channelB := id.NewIdFromString("channelB", id.Generic, t)
+			start := netTime.Now().UTC().Round(time.Second)
+
+			// Store interleaved messages in two channels
+			var expected []string
+			for i := 0; i < 10; i++ {
+				testStr := testString + strconv.Itoa(i)
+				thisChannel, mType := channelA, channels.Text
+				if i%2 == 1 {
+					thisChannel, mType = channelB, channels.Reaction
+				} else {
+					expected = append(expected, testStr)
+				}
+
+				testMsgId := message.DeriveChannelMessageID(
+					&id.ID{byte(i)}, 0, []byte(testStr))
+				eventModel.ReceiveMessage(thisChannel, testMsgId, testStr,
+					testStr, []byte{8, 6, 7, 5}, 0, 0,
+					start.Add(time.Duration(i)*time.Second), time.Second,
+					rounds.Round{ID: id.Round(0)}, mType, channels.Sent, false)
+			}
+
+			// Page through channel A two messages at a time
+			var received []string
+			query := wChannels.MessageQuery{ChannelID: channelA, Limit: 2}
+			for pages := 0; ; pages++ {
+				if pages > len(expected) {
+					t.Fatalf("Too many pages returned.")
+				}
+				result, err := eventModel.QueryMessages(query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, msg := range result.Messages {
+					if !msg.ChannelID.Cmp(channelA) {
+						t.Errorf("Message from wrong channel: %s", msg.ChannelID)
+					}
+					received = append(received, string(msg.Content))
+				}
+				if result.NextCursor == "" {
+					break
+				}
+				query.Cursor = result.NextCursor
+			}
+			require.Equal(t, expected, received)
+
+			// Get the newest reactions before the last message
+			result, err := eventModel.QueryMessages(wChannels.MessageQuery{
+				Types:      []channels.MessageType{channels.Reaction},
+				End:        start.Add(9 * time.Second),
+				Limit:      2,
+				Descending: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.Len(t, result.Messages, 2)
+			require.Equal(t, testString+"7", string(result.Messages[0].Content))
+			require.Equal(t, testString+"5", string(result.Messages[1].Content))
+			require.NotEmpty(t, result.NextCursor)
+		})
+	}
+}
+
+// Tests that a database at v2, with messages stored the way v2 stored them, is
+// upgraded to the current version with every message in the v3 indexes. The
+// messages of the channel are queried in time order, including messages in the
+// same second whose v2 timestamps did not sort in time order, and the pinned
+// message is found through its pinned_key.
+func Test_newWASMModel_V2Migration(t *testing.T) {
+	testString := "Test_newWASMModel_V2Migration"
+	storage.GetLocalStorage().Clear()
+
+	db, err := impl.OpenDatabase(testString, 2, migrations[:2])
+	require.NoError(t, err)
+
+	// Stored out of time order, with timestamps as v2 marshalled them
+	channelID := id.NewIdFromString("channel", id.Generic, t)
+	timestamps := []string{
+		"2023-06-06T19:39:27.5Z",
+		"2023-06-06T19:39:27Z",
+		"2023-06-06T21:39:27.25+02:00",
+		"2023-06-06T19:39:26.999999999Z",
+	}
+	for i, timestamp := range timestamps {
+		msgID := message.DeriveChannelMessageID(
+			channelID, uint64(i), []byte(testString))
+		msgJson := fmt.Sprintf(`{"message_id":%q,"channel_id":%q,`+
+			`"parent_message_id":null,"timestamp":%q,"lease_v2":"0",`+
+			`"pinned":%t,"text":"%d","type":%d}`,
+			impl.EncodeBytes(msgID.Bytes()).String(),
+			impl.EncodeBytes(channelID.Marshal()).String(), timestamp, i == 2,
+			i, channels.Text)
+		msgObj, err := utils.JsonToJS([]byte(msgJson))
+		require.NoError(t, err)
+		_, err = impl.Put(db, messageStoreName, msgObj)
+		require.NoError(t, err)
+	}
+	db.Close()
+
+	eventModel, err := newWASMModel(testString, nil, dummyEU)
+	require.NoError(t, err)
+
+	result, err := eventModel.QueryMessages(
+		wChannels.MessageQuery{ChannelID: channelID})
+	require.NoError(t, err)
+	var received []string
+	for _, msg := range result.Messages {
+		received = append(received, string(msg.Content))
+	}
+	require.Equal(t, []string{"3", "1", "2", "0"}, received)
+
+	pinned := true
+	result, err = eventModel.QueryMessages(
+		wChannels.MessageQuery{ChannelID: channelID, Pinned: &pinned})
+	require.NoError(t, err)
+	require.Len(t, result.Messages, 1)
+	require.Equal(t, "2", string(result.Messages[0].Content))
+}
+
+// Tests that Message.MarshalJSON stores the timestamp in UTC with a fixed
+// width, so that stored timestamps sort in time order.
+func TestMessage_MarshalJSON(t *testing.T) {
+	start := time.Date(2023, 6, 6, 19, 39, 27, 0, time.UTC)
+	offsets := []time.Duration{0, 250 * time.Millisecond,
+		500 * time.Millisecond, time.Second - 1, time.Second}
+	zone := time.FixedZone("", 2*60*60)
+
+	var previous string
+	for i, offset := range offsets {
+		msg := &Message{Timestamp: start.Add(offset).In(zone)}
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		var stored struct {
+			Timestamp string `json:"timestamp"`
+		}
+		require.NoError(t, json.Unmarshal(data, &stored))
+
+		require.Len(t, stored.Timestamp, len(timestampLayout)-len("07:00"))
+		require.Less(t, previous, stored.Timestamp, i)
+		previous = stored.Timestamp
+
+		var unmarshalled Message
+		require.NoError(t, json.Unmarshal(data, &unmarshalled))
+		require.True(t, unmarshalled.Timestamp.Equal(start.Add(offset)), i)
+	}
+}
+
+// Tests that wasmModel.SearchMessages finds received messages by their
+// decrypted text and stops finding them once they are deleted.
+func Test_wasmModel_SearchMessages(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_SearchMessages" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, dummyEU)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			channelA := id.NewIdFromString("channelA", id.Generic, t)
+			channelB := id.NewIdFromString("channelB", id.Generic, t)
+			texts := []struct {
+				channelID *id.ID
+				text      string
+				mType     channels.MessageType
+			}{
+				{channelA, "Lunch at noon?", channels.Text},
+				{channelB, "lunch is at NOON today", channels.Text},
+				{channelA, "noon", channels.Reaction},
+				{channelA, "Dinner instead", channels.Text},
+			}
+			msgIDs := make([]message.ID, len(texts))
+			for i, tt := range texts {
+				msgIDs[i] = message.DeriveChannelMessageID(
+					&id.ID{byte(i)}, 0, []byte(tt.text))
+				eventModel.ReceiveMessage(tt.channelID, msgIDs[i], testString,
+					tt.text, []byte{8, 6, 7, 5}, 0, 0, netTime.Now(),
+					time.Second, rounds.Round{ID: id.Round(0)}, tt.mType,
+					channels.Sent, false)
+			}
+
+			contents := func(msgs []channels.ModelMessage) []string {
+				var received []string
+				for _, msg := range msgs {
+					received = append(received, string(msg.Content))
+				}
+				return received
+			}
+
+			results, err := eventModel.SearchMessages("NOON lunch", nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.Equal(t,
+				[]string{texts[1].text, texts[0].text}, contents(results))
+
+			results, err = eventModel.SearchMessages("noon", channelA, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.Equal(t, []string{texts[0].text}, contents(results))
+
+			results, err = eventModel.SearchMessages("lunch", nil, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.Equal(t, []string{texts[1].text}, contents(results))
+
+			// Deleted messages must no longer be found
+			if err = eventModel.DeleteMessage(msgIDs[1]); err != nil {
+				t.Fatal(err)
+			}
+			results, err = eventModel.SearchMessages("lunch", nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.Equal(t, []string{texts[0].text}, contents(results))
+		})
+	}
+}
+
+// Tests that wasmModel.SetRetentionPolicy deletes the messages of only that
+// channel that the policy does not keep, keeps pinned messages, and sends a
+// MessageDeleted event for each deleted message.
+func Test_wasmModel_SetRetentionPolicy(t *testing.T) {
+	testString := "Test_wasmModel_SetRetentionPolicy"
+	storage.GetLocalStorage().Clear()
+	deletedEvents := make(chan any, 10)
+	eventModel, err := newWASMModel(testString, nil,
+		func(eventType int64, data any) {
+			if eventType == bindings.MessageDeleted {
+				deletedEvents <- data
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelA := id.NewIdFromString("channelA", id.Generic, t)
+	channelB := id.NewIdFromString("channelB", id.Generic, t)
+	now := netTime.Now()
+
+	// Store five messages in channel A, oldest first, and two in channel B
+	msgIDs := make([]message.ID, 7)
+	for i := range msgIDs {
+		thisChannel := channelA
+		if i >= 5 {
+			thisChannel = channelB
+		}
+		testStr := testString + strconv.Itoa(i)
+		msgIDs[i] = message.DeriveChannelMessageID(
+			&id.ID{byte(i)}, 0, []byte(testStr))
+		eventModel.ReceiveMessage(thisChannel, msgIDs[i], testStr, testStr,
+			[]byte{8, 6, 7, 5}, 0, 0,
+			now.Add(time.Duration(i-10)*time.Hour), time.Second,
+			rounds.Round{ID: id.Round(0)}, channels.Text, channels.Sent, false)
+	}
+
+	// Pin the oldest message
+	pinned := true
+	_, err = eventModel.UpdateFromMessageID(
+		msgIDs[0], nil, nil, &pinned, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := func() []message.ID {
+		values, err := impl.GetAll(eventModel.db, messageStoreName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []message.ID
+		for _, value := range values {
+			msg, err := valueToMessage(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgID, err := message.UnmarshalID(msg.MessageID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, msgID)
+		}
+		return ids
+	}
+
+	err = eventModel.SetRetentionPolicy(
+		channelA, impl.RetentionPolicy{MaxCount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, []message.ID{
+		msgIDs[0], msgIDs[3], msgIDs[4], msgIDs[5], msgIDs[6]}, remaining())
+
+	err = eventModel.SetRetentionPolicy(
+		channelA, impl.RetentionPolicy{PinnedOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t,
+		[]message.ID{msgIDs[0], msgIDs[5], msgIDs[6]}, remaining())
+
+	// The sweep enforces the stored policies
+	eventModel.ReceiveMessage(channelA, msgIDs[1], testString, testString,
+		[]byte{8, 6, 7, 5}, 0, 0, now, time.Second,
+		rounds.Round{ID: id.Round(0)}, channels.Text, channels.Sent, false)
+	if err = eventModel.PruneMessages(); err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t,
+		[]message.ID{msgIDs[0], msgIDs[5], msgIDs[6]}, remaining())
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-deletedEvents:
+		case <-time.After(time.Second):
+			t.Fatalf("Received %d of %d MessageDeleted events.", i, 5)
+		}
+	}
+}
+
+// Tests that wasmModel.ExpireMessages deletes the messages whose lease has
+// ended and the reactions to them, but not replies or unexpired messages.
+func Test_wasmModel_ExpireMessages(t *testing.T) {
+	testString := "Test_wasmModel_ExpireMessages"
+	storage.GetLocalStorage().Clear()
+	var deleted int32
+	eventModel, err := newWASMModel(testString, nil,
+		func(eventType int64, _ any) {
+			if eventType == bindings.MessageDeleted {
+				atomic.AddInt32(&deleted, 1)
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelID := id.NewIdFromString("channel", id.Generic, t)
+	now := netTime.Now()
+	msgIDs := make([]message.ID, 6)
+	for i := range msgIDs {
+		msgIDs[i] = message.DeriveChannelMessageID(
+			channelID, 0, []byte(testString+strconv.Itoa(i)))
+	}
+	receive := func(i int, timestamp time.Time, lease time.Duration) {
+		eventModel.ReceiveMessage(channelID, msgIDs[i], testString,
+			testString, []byte{8, 6, 7, 5}, 0, 0, timestamp, lease,
+			rounds.Round{ID: id.Round(0)}, channels.Text, channels.Sent, false)
+	}
+
+	receive(0, now.Add(-2*time.Hour), time.Hour)
+	receive(1, now.Add(-2*time.Hour), 3*time.Hour)
+	receive(2, now.Add(-2*time.Hour), channels.ValidForever)
+	receive(3, now.Add(-2*time.Hour), 0)
+	eventModel.ReceiveReaction(channelID, msgIDs[4], msgIDs[0], testString,
+		"👍", []byte{8, 6, 7, 5}, 0, 0, now, channels.ValidForever,
+		rounds.Round{ID: id.Round(0)}, channels.Reaction, channels.Sent, false)
+	eventModel.ReceiveReply(channelID, msgIDs[5], msgIDs[0], testString,
+		testString, []byte{8, 6, 7, 5}, 0, 0, now, channels.ValidForever,
+		rounds.Round{ID: id.Round(0)}, channels.Text, channels.Sent, false)
+
+	if err = eventModel.ExpireMessages(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, msgID := range msgIDs {
+		_, err = eventModel.GetMessage(msgID)
+		if expired := i == 0 || i == 4; expired && err == nil {
+			t.Errorf("Message %d was not deleted.", i)
+		} else if !expired && err != nil {
+			t.Errorf("Message %d was deleted: %+v", i, err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&deleted); n != 2 {
+		t.Errorf("Unexpected number of MessageDeleted events."+
+			"\nexpected: %d\nreceived: %d", 2, n)
+	}
+}
+
+// Tests that wasmModel.ReceiveBatch returns the UUIDs of the messages in order,
+// merges a duplicate into the earlier message, and sends the MessageReceived
+// events in order.
+func Test_wasmModel_ReceiveBatch(t *testing.T) {
+	testString := "Test_wasmModel_ReceiveBatch"
+	storage.GetLocalStorage().Clear()
+	events := make(chan bindings.MessageReceivedJSON, 10)
+	eventModel, err := newWASMModel(testString, nil,
+		func(eventType int64, jsonMarshallable any) {
+			if eventType == bindings.MessageReceived {
+				events <- jsonMarshallable.(bindings.MessageReceivedJSON)
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelID := id.NewIdFromString("channel", id.Generic, t)
+	msgIDs := make([]message.ID, 3)
+	for i := range msgIDs {
+		msgIDs[i] = message.DeriveChannelMessageID(
+			channelID, 0, []byte(testString+strconv.Itoa(i)))
+	}
+	entry := func(tag worker.Tag, msgID, replyTo message.ID,
+		mType channels.MessageType) wChannels.ReceiveBatchEntry {
+		return wChannels.ReceiveBatchEntry{Tag: tag,
+			ReceiveReplyMessage: wChannels.ReceiveReplyMessage{
+				ReactionTo: replyTo,
+				ModelMessage: channels.ModelMessage{
+					Nickname:  testString,
+					MessageID: msgID,
+					ChannelID: channelID,
+					Timestamp: netTime.Now(),
+					Lease:     channels.ValidForever,
+					Status:    channels.Sent,
+					Type:      mType,
+					Content:   []byte(testString),
+					PubKey:    []byte{8, 6, 7, 5},
+				},
+			}}
+	}
+	entries := []wChannels.ReceiveBatchEntry{
+		entry(wChannels.ReceiveMessageTag, msgIDs[0], message.ID{}, channels.Text),
+		entry(wChannels.ReceiveReplyTag, msgIDs[1], msgIDs[0], channels.Text),
+		entry(wChannels.ReceiveReactionTag, msgIDs[2], msgIDs[0],
+			channels.Reaction),
+		entry(wChannels.ReceiveMessageTag, msgIDs[0], message.ID{}, channels.Text),
+	}
+	entries[3].Status = channels.Delivered
+
+	uuids := eventModel.ReceiveBatch(entries)
+	if len(uuids) != len(entries) {
+		t.Fatalf("Unexpected number of UUIDs.\nexpected: %d\nreceived: %d",
+			len(entries), len(uuids))
+	}
+	for i := 1; i < 3; i++ {
+		if uuids[i] <= uuids[i-1] {
+			t.Errorf("UUID %d (%d) is not after UUID %d (%d).",
+				i, uuids[i], i-1, uuids[i-1])
+		}
+	}
+	if uuids[3] != uuids[0] {
+		t.Errorf("Duplicate was not merged.\nexpected: %d\nreceived: %d",
+			uuids[0], uuids[3])
+	}
+
+	msg, err := eventModel.GetMessage(msgIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Status != channels.Delivered {
+		t.Errorf("Duplicate did not update the message.\nexpected: %s"+
+			"\nreceived: %s", channels.Delivered, msg.Status)
+	}
+	reply, err := eventModel.GetMessage(msgIDs[1])
+	if err != nil {
+		t.Fatal(err)
+	} else if reply.ParentMessageID != msgIDs[0] {
+		t.Errorf("Unexpected parent of reply.\nexpected: %s\nreceived: %s",
+			msgIDs[0], reply.ParentMessageID)
+	}
+
+	for i := range entries {
+		select {
+		case event := <-events:
+			if event.UUID != int64(uuids[i]) || event.Update != (i == 3) {
+				t.Errorf("Unexpected event %d.\nexpected: UUID %d, update %t"+
+					"\nreceived: UUID %d, update %t",
+					i, uuids[i], i == 3, event.UUID, event.Update)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d.", i)
+		}
+	}
+}
+
+// Tests that wasmModel.ExportChannelHistory exports every message of the
+// channel with its reply, reactions, and file in each format.
+func Test_wasmModel_ExportChannelHistory(t *testing.T) {
+	testString := "Test_wasmModel_ExportChannelHistory"
+	storage.GetLocalStorage().Clear()
+	eventModel, err := newWASMModel(testString, nil, dummyEU)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelID := id.NewIdFromString("channel", id.Generic, t)
+	msgIDs := make([]message.ID, 4)
+	for i := range msgIDs {
+		msgIDs[i] = message.DeriveChannelMessageID(
+			channelID, 0, []byte(testString+strconv.Itoa(i)))
+	}
+	fileInfo, err := json.Marshal(cft.FileInfo{Name: "notes.txt",
+		Type: "text", FileLink: cft.FileLink{Size: 42}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := netTime.Now().Add(-time.Hour)
+	entry := func(tag worker.Tag, i int, replyTo message.ID,
+		mType channels.MessageType, content string) wChannels.ReceiveBatchEntry {
+		return wChannels.ReceiveBatchEntry{Tag: tag,
+			ReceiveReplyMessage: wChannels.ReceiveReplyMessage{
+				ReactionTo: replyTo,
+				ModelMessage: channels.ModelMessage{
+					Nickname:  "nick" + strconv.Itoa(i),
+					MessageID: msgIDs[i],
+					ChannelID: channelID,
+					Timestamp: start.Add(time.Duration(i) * time.Minute),
+					Lease:     channels.ValidForever,
+					Status:    channels.Delivered,
+					Type:      mType,
+					Content:   []byte(content),
+					PubKey:    []byte{8, 6, 7, 5},
+				},
+			}}
+	}
+	eventModel.ReceiveBatch([]wChannels.ReceiveBatchEntry{
+		entry(wChannels.ReceiveMessageTag, 0, message.ID{}, channels.Text,
+			"Hello <world>"),
+		entry(wChannels.ReceiveReplyTag, 1, msgIDs[0], channels.Text, "Hi"),
+		entry(wChannels.ReceiveReactionTag, 2, msgIDs[0], channels.Reaction,
+			"👍"),
+		entry(wChannels.ReceiveMessageTag, 3, message.ID{},
+			channels.FileTransfer, string(fileInfo)),
+	})
+
+	export := func(format wChannels.ExportFormat) []byte {
+		var output []byte
+		msg := wChannels.ExportChannelHistoryMessage{
+			ChannelID: channelID, Format: format}
+		for {
+			result, err := eventModel.ExportChannelHistory(msg)
+			if err != nil {
+				t.Fatalf("Failed to export %s: %+v", format, err)
+			}
+			output = append(output, result.Chunk...)
+			if result.NextCursor == "" {
+				return output
+			}
+			msg.Cursor = result.NextCursor
+		}
+	}
+
+	var history wChannels.ChannelHistory
+	if err = json.Unmarshal(export(wChannels.ExportJSON), &history); err != nil {
+		t.Fatalf("Failed to unmarshal JSON export: %+v", err)
+	}
+	if history.Version != wChannels.ExportVersion ||
+		!history.Channel.ID.Cmp(channelID) {
+		t.Errorf("Unexpected header: %+v", history)
+	}
+	require.Len(t, history.Messages, 3)
+	require.Len(t, history.Messages[0].Reactions, 1)
+	require.Equal(t, "👍", history.Messages[0].Reactions[0].Text)
+	require.Equal(t, "Hello <world>", history.Messages[0].Text)
+	require.NotNil(t, history.Messages[1].ReplyTo)
+	require.Equal(t, msgIDs[0], *history.Messages[1].ReplyTo)
+	require.NotNil(t, history.Messages[2].File)
+	require.Equal(t, "notes.txt", history.Messages[2].File.Name)
+	require.Equal(t, uint32(42), history.Messages[2].File.Size)
+
+	markdown := export(wChannels.ExportMarkdown)
+	for _, expected := range []string{"**nick0**", "> ↪ **nick0**: Hello",
+		"Hello \\<world\\>\n", "👍 nick2", "📎 **notes.txt**"} {
+		require.Contains(t, string(markdown), expected)
+	}
+
+	page := export(wChannels.ExportHTML)
+	for _, expected := range []string{"<!DOCTYPE html>", "Hello &lt;world&gt;",
+		"href=\"#" + messageAnchor(msgIDs[0]) + "\"", "</html>"} {
+		require.Contains(t, string(page), expected)
+	}
+
+	_, err = eventModel.ExportChannelHistory(wChannels.ExportChannelHistoryMessage{
+		ChannelID: channelID, Format: "pdf"})
+	require.Error(t, err)
+}
+
+// Tests that escapeMarkdownText escapes inline Markdown and the Markdown that
+// starts a block, and keeps line breaks.
+func Test_escapeMarkdownText(t *testing.T) {
+	tests := map[string]string{
+		"Hello <world>":    "Hello \\<world\\>",
+		"*bold* _it_ `c`":  "\\*bold\\* \\_it\\_ \\`c\\`",
+		"[x](javascript:)": "\\[x\\](javascript:)",
+		"# not a heading":  "\\# not a heading",
+		"- item\n+ item":   "\\- item  \n\\+ item",
+		"1. one\r\n2) two": "1\\. one  \n2\\) two",
+		"    code":         "\u00a0\u00a0\u00a0\u00a0code",
+		"a\n\nb":           "a  \n  \nb",
+		"a & b ~c~":        "a \\& b \\~c\\~",
+	}
+	for text, expected := range tests {
+		require.Equal(t, expected, escapeMarkdownText(text), text)
+	}
+}
+
+// Tests that wasmModel.ImportHistory stores the messages of an exported history
+// encrypted with the cipher of the database, creates the channel, and skips
+// duplicates and messages stored in another channel on a second import.
+func Test_wasmModel_ImportHistory(t *testing.T) {
+	testString := "Test_wasmModel_ImportHistory"
+	storage.GetLocalStorage().Clear()
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	eventModel, err := newWASMModel(testString, cipher, dummyEU)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelID := id.NewIdFromString("channel", id.Generic, t)
+	msgIDs := make([]message.ID, 3)
+	for i := range msgIDs {
+		msgIDs[i] = message.DeriveChannelMessageID(
+			channelID, 0, []byte(testString+strconv.Itoa(i)))
+	}
+	timestamp := netTime.Now().Add(-time.Hour).UTC().Round(time.Millisecond)
+	msg := wChannels.ImportHistoryMessage{
+		Channel: wChannels.ExportedChannel{ID: channelID, Name: "Dev"},
+		Messages: []wChannels.ExportedMessage{
+			{MessageID: msgIDs[0], Type: channels.Text, Nickname: "alice",
+				Timestamp: timestamp, Status: channels.Delivered,
+				Text: "Hello"},
+			{MessageID: msgIDs[1], ReplyTo: &msgIDs[0],
+				Type: channels.Reaction, Timestamp: timestamp,
+				Status: channels.Delivered, Text: "👍"},
+			{MessageID: msgIDs[2], Type: channels.FileTransfer,
+				Timestamp: timestamp, Status: channels.Failed,
+				File: &wChannels.ExportedFile{Name: "notes.txt", Size: 42}},
+		},
+	}
+
+	progress, err := eventModel.ImportHistory(msg)
+	if err != nil {
+		t.Fatalf("Failed to import history: %+v", err)
+	}
+	require.Equal(t, impl.ImportProgress{Processed: 3, Imported: 3}, progress)
+
+	channel, err := eventModel.exportChannel(channelID)
+	require.NoError(t, err)
+	require.Equal(t, "Dev", channel.Name)
+
+	values, err := impl.GetAll(eventModel.db, messageStoreName)
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	for _, value := range values {
+		stored, err := valueToMessage(value)
+		require.NoError(t, err)
+		require.NotEqual(t, "Hello", stored.Text)
+		modelMsg, err := eventModel.decryptModelMessage(stored)
+		require.NoError(t, err)
+		require.True(t, modelMsg.Timestamp.Equal(timestamp))
+		if modelMsg.MessageID == msgIDs[2] {
+			require.Equal(t, channels.Failed, modelMsg.Status)
+			require.Equal(t, "notes.txt", exportMessage(modelMsg).File.Name)
+		}
+	}
+
+	// Importing again skips every message
+	progress, err = eventModel.ImportHistory(msg)
+	require.NoError(t, err)
+	require.Equal(t, impl.ImportProgress{Processed: 3, Duplicates: 3}, progress)
+
+	// A message stored in another channel is a conflict
+	otherChannelID := id.NewIdFromString("other", id.Generic, t)
+	progress, err = eventModel.ImportHistory(wChannels.ImportHistoryMessage{
+		Channel:  wChannels.ExportedChannel{ID: otherChannelID},
+		Messages: msg.Messages[:1],
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, progress.Conflicts)
+	require.Equal(t, impl.ImportConflictOtherChat,
+		progress.ConflictDetails[0].Reason)
+}
+
+// Tests that wasmModel.MarkRead moves the read marker of a channel and that
+// the unread count is kept up to date as messages are received and deleted.
+func Test_wasmModel_MarkRead(t *testing.T) {
+	testString := "Test_wasmModel_MarkRead"
+	storage.GetLocalStorage().Clear()
+	eventModel, err := newWASMModel(testString, nil, dummyEU)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelID := id.NewIdFromString("channel", id.Generic, t)
+	eventModel.JoinChannel(&cryptoBroadcast.Channel{ReceptionID: channelID})
+	unreadCount := func() wChannels.UnreadCount {
+		counts, err := eventModel.GetUnreadCounts()
+		require.NoError(t, err)
+		require.Len(t, counts, 1)
+		require.Equal(t, channelID, counts[0].ChannelID)
+		return counts[0]
+	}
+	require.Zero(t, unreadCount().UnreadCount)
+
+	// Every received message except for reactions is unread
+	msgIDs := make([]message.ID, 4)
+	uuids := make([]uint64, len(msgIDs))
+	for i := range msgIDs {
+		msgIDs[i] = message.DeriveChannelMessageID(
+			channelID, 0, []byte(testString+strconv.Itoa(i)))
+		mType := channels.Text
+		if i == len(msgIDs)-1 {
+			mType = channels.Reaction
+		}
+		uuids[i] = eventModel.ReceiveMessage(channelID, msgIDs[i], "alice",
+			testString, []byte{8, 6, 7, 5}, 0, 0,
+			netTime.Now().Add(time.Duration(i-len(msgIDs))*time.Minute),
+			time.Hour, rounds.Round{ID: 42}, mType, channels.Delivered, false)
+	}
+	require.Equal(t, 3, unreadCount().UnreadCount)
+
+	require.NoError(t, eventModel.MarkRead(channelID, uuids[0]))
+	count := unreadCount()
+	require.Equal(t, 2, count.UnreadCount)
+	require.Equal(t, uuids[0], count.LastReadUUID)
+
+	require.NoError(t, eventModel.DeleteMessage(msgIDs[2]))
+	require.Equal(t, 1, unreadCount().UnreadCount)
+
+	// Moving the marker back marks the messages as unread again
+	require.NoError(t, eventModel.MarkRead(channelID, 0))
+	require.Zero(t, unreadCount().UnreadCount)
+	require.NoError(t, eventModel.MarkRead(channelID, uuids[0]))
+	require.Equal(t, 1, unreadCount().UnreadCount)
+
+	// A message sent by the user marks the channel as read
+	sentID := message.DeriveChannelMessageID(
+		channelID, 0, []byte(testString+"sent"))
+	sentUUID := eventModel.ReceiveMessage(channelID, sentID, "bob",
+		testString, []byte{3, 0, 9}, 0, 0, netTime.Now(), time.Hour,
+		rounds.Round{ID: 42}, channels.Text, channels.Unsent, false)
+	count = unreadCount()
+	require.Zero(t, count.UnreadCount)
+	require.Equal(t, sentUUID, count.LastReadUUID)
+
+	// A message in another channel cannot be the read marker
+	otherID := id.NewIdFromString("other", id.Generic, t)
+	eventModel.JoinChannel(&cryptoBroadcast.Channel{ReceptionID: otherID})
+	require.Error(t, eventModel.MarkRead(otherID, uuids[0]))
+}
+
+// Tests that wasmModel.SaveDraft stores an encrypted draft that is returned by
+// wasmModel.GetDraft and removed by wasmModel.ClearDraft and LeaveChannel.
+func Test_wasmModel_SaveDraft(t *testing.T) {
+	testString := "Test_wasmModel_SaveDraft"
+	storage.GetLocalStorage().Clear()
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	eventModel, err := newWASMModel(testString, cipher, dummyEU)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelID := id.NewIdFromString("channel", id.Generic, t)
+	replyTo := message.DeriveChannelMessageID(channelID, 0, []byte(testString))
+	draft := impl.Draft{
+		Text:    "Here are the notes",
+		ReplyTo: replyTo.Bytes(),
+		Files:   []impl.DraftFile{{FileID: []byte{1}, Name: "notes.txt"}},
+	}
+	require.NoError(t, eventModel.SaveDraft(channelID, draft))
+
+	stored, err := eventModel.GetDraft(channelID)
+	require.NoError(t, err)
+	require.False(t, stored.Updated.IsZero())
+	stored.Updated = time.Time{}
+	require.Equal(t, draft, stored)
+
+	require.NoError(t, eventModel.ClearDraft(channelID))
+	stored, err = eventModel.GetDraft(channelID)
+	require.NoError(t, err)
+	require.True(t, stored.IsZero())
+
+	// Leaving the channel removes its draft
+	eventModel.JoinChannel(&cryptoBroadcast.Channel{ReceptionID: channelID})
+	require.NoError(t, eventModel.SaveDraft(channelID, draft))
+	eventModel.LeaveChannel(channelID)
+	n, err := impl.Count(eventModel.db, impl.DraftStoreName)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
 // This test is designed to prove the behavior of unique indexes.
 // Inserts will not fail, they simply will not happen.
 func TestWasmModel_receiveHelper_UniqueIndex(t *testing.T) {
@@ -0,0 +1,248 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/client/v4/channelsFileTransfer"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// ImportHistory stores a batch of messages of an imported channel history in a
+// single transaction, encrypted with the cipher of the database. The original
+// timestamps and statuses are kept. The channel is created if it is not
+// stored, with every imported message marked as read; otherwise, its unread
+// messages are counted again.
+//
+// A message with the same message ID as a stored message in the same channel
+// is a duplicate and is skipped. One stored in another channel is skipped as a
+// conflict. No events are sent for imported messages.
+func (w *wasmModel) ImportHistory(
+	msg wChannels.ImportHistoryMessage) (impl.ImportProgress, error) {
+	parentErr := errors.New("failed to ImportHistory")
+	progress := impl.ImportProgress{Processed: len(msg.Messages)}
+
+	if msg.Channel.ID == nil {
+		return progress, errors.WithMessage(parentErr, "missing channel ID")
+	}
+	if err := w.importChannel(msg.Channel); err != nil {
+		return progress, errors.WithMessage(parentErr, err.Error())
+	}
+	channelID := msg.Channel.ID.Marshal()
+
+	msgs := make([]*Message, 0, len(msg.Messages))
+	plaintexts := make([]string, 0, len(msg.Messages))
+	for _, exported := range msg.Messages {
+		if exported.MessageID == (message.ID{}) {
+			progress.AddConflict(
+				exported.MessageID.Bytes(), impl.ImportConflictInvalid)
+			continue
+		}
+
+		plaintext, err := importContent(exported)
+		if err != nil {
+			progress.AddConflict(
+				exported.MessageID.Bytes(), impl.ImportConflictInvalid)
+			continue
+		}
+		text := plaintext
+
+		// Handle encryption, if it is present
+		if w.cipher != nil {
+			text, err = w.cipher.Encrypt([]byte(plaintext))
+			if err != nil {
+				return progress, errors.WithMessagef(parentErr,
+					"Failed to encrypt Message: %+v", err)
+			}
+		}
+
+		var parentID []byte
+		if exported.ReplyTo != nil {
+			parentID = exported.ReplyTo.Bytes()
+		}
+
+		msgs = append(msgs, buildMessage(channelID, exported.MessageID.Bytes(),
+			parentID, exported.Nickname, text, exported.PubKey,
+			exported.DmToken, exported.CodesetVersion, exported.Timestamp,
+			exported.Lease, exported.Round, exported.Type, exported.Pinned,
+			exported.Hidden, exported.Status))
+		plaintexts = append(plaintexts, plaintext)
+	}
+
+	uuids, err := w.importMessages(channelID, msgs, &progress)
+	if err != nil {
+		return progress, errors.WithMessage(parentErr, err.Error())
+	}
+
+	texts := make(map[uint64]string, len(msgs))
+	var newestUUID uint64
+	for i, uuid := range uuids {
+		if uuid > newestUUID {
+			newestUUID = uuid
+		}
+		isReaction := channels.MessageType(msgs[i].Type) == channels.Reaction
+		if uuid != 0 && !isReaction {
+			texts[uuid] = plaintexts[i]
+		}
+	}
+	if err = w.search.IndexAll(texts); err != nil {
+		jww.ERROR.Printf("Failed to index %d messages: %+v", len(texts), err)
+	}
+	if newestUUID > 0 {
+		w.recountUnread(channelID, newestUUID)
+	}
+
+	return progress, nil
+}
+
+// importChannel stores the channel, marked as read up to now, if it is not
+// already stored.
+func (w *wasmModel) importChannel(exported wChannels.ExportedChannel) error {
+	key := impl.EncodeBytes(exported.ID.Marshal())
+	_, err := impl.Get(w.db, channelStoreName, key)
+	if err == nil {
+		return nil
+	} else if !strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+		return err
+	}
+
+	// Imported messages of a new channel are read
+	return w.putChannel(&Channel{
+		ID:                exported.ID.Marshal(),
+		Name:              exported.Name,
+		Description:       exported.Description,
+		LastReadTimestamp: netTime.Now().UTC(),
+	})
+}
+
+// importMessages stores the messages in the channel in a single transaction.
+// Messages that are already stored are counted as duplicates or conflicts in
+// the progress. Returns the UUID of each message, which is 0 for messages that
+// were not stored.
+func (w *wasmModel) importMessages(channelID []byte, msgs []*Message,
+	progress *impl.ImportProgress) ([]uint64, error) {
+	uuids := make([]uint64, len(msgs))
+	if len(msgs) == 0 {
+		return uuids, nil
+	}
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadWrite, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreMessageIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	abort := func(err error) ([]uint64, error) {
+		// Do not commit the messages already put
+		if abortErr := txn.Abort(); abortErr != nil {
+			jww.ERROR.Printf("Failed to abort Transaction: %+v", abortErr)
+		}
+		return nil, err
+	}
+
+	var batch impl.ImportProgress
+	for i, msg := range msgs {
+		getRequest, err := index.Get(impl.EncodeBytes(msg.MessageID))
+		if err != nil {
+			return abort(errors.Errorf("Unable to Get from Index: %+v", err))
+		}
+		currentObj, err := impl.SendRequest(getRequest)
+		if err != nil {
+			return abort(errors.Errorf("Unable to Get from Index: %+v", err))
+		}
+
+		if !currentObj.IsUndefined() && !currentObj.IsNull() {
+			currentMsg, err := valueToMessage(currentObj)
+			if err != nil {
+				return abort(errors.Errorf(
+					"Unable to unmarshal stored Message: %+v", err))
+			}
+			if bytes.Equal(currentMsg.ChannelID, channelID) {
+				batch.Duplicates++
+			} else {
+				batch.AddConflict(msg.MessageID, impl.ImportConflictOtherChat)
+			}
+			continue
+		}
+
+		msg.setIndexKeys()
+		msgJson, err := json.Marshal(msg)
+		if err != nil {
+			return abort(errors.Errorf("Unable to marshal Message: %+v", err))
+		}
+		msgObj, err := utils.JsonToJS(msgJson)
+		if err != nil {
+			return abort(errors.Errorf("Unable to marshal Message: %+v", err))
+		}
+		putRequest, err := store.Put(msgObj)
+		if err != nil {
+			return abort(errors.Errorf("Unable to Put Message: %+v", err))
+		}
+		key, err := impl.SendRequest(putRequest)
+		if err != nil {
+			return abort(errors.Errorf("Unable to Put Message: %+v", err))
+		}
+		uuids[i] = uint64(key.Int())
+		batch.Imported++
+	}
+
+	// Wait for the writes to be committed
+	ctx, cancel := impl.NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return nil, errors.Errorf("Storing Messages failed: %+v", err)
+	}
+
+	progress.Add(batch)
+
+	jww.DEBUG.Printf("Successfully imported %d messages", batch.Imported)
+	return uuids, nil
+}
+
+// importContent returns the content of the exported message to store. The
+// content of a file message is the file information, which does not include
+// the key needed to download the file.
+func importContent(exported wChannels.ExportedMessage) (string, error) {
+	if exported.File == nil {
+		return exported.Text, nil
+	}
+
+	fi := channelsFileTransfer.FileInfo{
+		Name: exported.File.Name,
+		Type: exported.File.Type,
+	}
+	fi.FileID = exported.File.FileID
+	fi.Size = exported.File.Size
+	content, err := json.Marshal(fi)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
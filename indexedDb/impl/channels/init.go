@@ -10,19 +10,24 @@
 package main
 
 import (
+	"encoding/json"
 	"syscall/js"
 
 	"github.com/hack-pad/go-indexeddb/idb"
-	jww "github.com/spf13/jwalterweatherman"
+	"github.com/pkg/errors"
 
 	"gitlab.com/elixxir/client/v4/channels"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/netTime"
 )
 
 // currentVersion is the current version of the IndexedDb runtime. Used for
 // migration purposes.
-const currentVersion uint = 1
+const currentVersion = wChannels.DatabaseVersion
 
 // eventUpdate takes an event type and JSON object from
 // bindings/channelsCallbacks.go.
@@ -36,51 +41,56 @@ func NewWASMEventModel(databaseName string, encryption idbCrypto.Cipher,
 	return newWASMModel(databaseName, encryption, eventCallback)
 }
 
+// migrations is the schema history of the database. The last migration must
+// be for currentVersion.
+var migrations = impl.Migrations{
+	{Version: 1, Upgrade: v1Upgrade},
+	{Version: 2, Upgrade: v2Upgrade},
+	{Version: 3, Upgrade: v3Upgrade, Backfill: v3Backfill},
+	{Version: 4, Upgrade: v4Upgrade},
+	{Version: 5, Upgrade: v5Upgrade, Backfill: v5Backfill},
+	{Version: 6, Upgrade: v6Upgrade},
+	{Version: 7, Upgrade: v7Upgrade, Backfill: v7Backfill},
+	{Version: 8, Upgrade: v8Upgrade},
+}
+
 // newWASMModel creates the given [idb.Database] and returns a wasmModel.
 func newWASMModel(databaseName string, encryption idbCrypto.Cipher,
 	eventCallback eventUpdate) (*wasmModel, error) {
-	// Attempt to open database object
-	ctx, cancel := impl.NewContext()
-	defer cancel()
-	openRequest, err := idb.Global().Open(ctx, databaseName, currentVersion,
-		func(db *idb.Database, oldVersion, newVersion uint) error {
-			if oldVersion == newVersion {
-				jww.INFO.Printf("IndexDb version for %s is current: v%d",
-					databaseName, newVersion)
-				return nil
-			}
-
-			jww.INFO.Printf("IndexDb upgrade required for %s: v%d -> v%d",
-				databaseName, oldVersion, newVersion)
-
-			if oldVersion == 0 && newVersion >= 1 {
-				err := v1Upgrade(db)
-				if err != nil {
-					return err
-				}
-				oldVersion = 1
-			}
+	db, err := impl.OpenDatabase(databaseName, currentVersion, migrations)
+	if err != nil {
+		return nil, err
+	}
 
-			// if oldVersion == 1 && newVersion >= 2 { v2Upgrade(), oldVersion = 2 }
-			return nil
-		})
+	// A database with an unfinished key rotation reads with both ciphers
+	cipher, err := impl.OpenCipher(db, encryption, csprng.NewSystemRNG())
 	if err != nil {
 		return nil, err
 	}
 
-	// Wait for database open to finish
-	db, err := openRequest.Await(ctx)
+	// The search index is keyed on the old cipher until the rotation is done
+	searchCipher := cipher
+	if rc, ok := cipher.(*impl.RotationCipher); ok {
+		searchCipher = rc.From()
+	}
+	search, err := impl.NewSearchIndex(db, searchCipher)
 	if err != nil {
 		return nil, err
-	} else if ctx.Err() != nil {
-		return nil, ctx.Err()
 	}
 
 	wrapper := &wasmModel{
 		db:            db,
-		cipher:        encryption,
+		cipher:        cipher,
 		eventCallback: eventCallback,
+		search:        search,
 	}
+
+	// Index messages stored before the search index was added
+	err = search.Backfill(messageStoreName, wrapper.searchText)
+	if err != nil {
+		return nil, err
+	}
+
 	return wrapper, nil
 }
 
@@ -88,7 +98,7 @@ func newWASMModel(databaseName string, encryption idbCrypto.Cipher,
 //
 // This can never be changed without permanently breaking backwards
 // compatibility.
-func v1Upgrade(db *idb.Database) error {
+func v1Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
 	storeOpts := idb.ObjectStoreOptions{
 		KeyPath:       js.ValueOf(pkeyName),
 		AutoIncrement: true,
@@ -146,3 +156,155 @@ func v1Upgrade(db *idb.Database) error {
 	})
 	return err
 }
+
+// v2Upgrade performs the v1 -> v2 database upgrade, which adds the search
+// index.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v2Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateSearchStore(db)
+}
+
+// v3Upgrade performs the v2 -> v3 database upgrade, which adds the compound
+// [channel_id, timestamp] and [channel_id, pinned_key] indexes so that
+// per-channel queries do not scan the messages of every channel.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v3Upgrade(_ *idb.Database, txn *impl.UpgradeTransaction) error {
+	indexOpts := idb.IndexOptions{
+		Unique:     false,
+		MultiEntry: false,
+	}
+	err := txn.CreateIndex(messageStoreName, messageStoreChannelTimestampIndex,
+		js.ValueOf([]any{messageStoreChannel, messageStoreTimestamp}),
+		indexOpts)
+	if err != nil {
+		return err
+	}
+	return txn.CreateIndex(messageStoreName, messageStoreChannelPinnedIndex,
+		js.ValueOf([]any{messageStoreChannel, messageStorePinnedKey}),
+		indexOpts)
+}
+
+// v3Backfill rewrites every message stored before v3 so that it has a
+// pinned_key and a UTC timestamp, which the v3 indexes require.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v3Backfill(db *idb.Database) error {
+	return rewriteMessages(db)
+}
+
+// v4Upgrade performs the v3 -> v4 database upgrade, which adds the retention
+// policy store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v4Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateRetentionStore(db)
+}
+
+// v5Upgrade performs the v4 -> v5 database upgrade, which adds the index of
+// the time each message lease ends.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v5Upgrade(_ *idb.Database, txn *impl.UpgradeTransaction) error {
+	return txn.CreateIndex(messageStoreName, messageStoreExpiryIndex,
+		js.ValueOf(messageStoreExpiry), idb.IndexOptions{
+			Unique:     false,
+			MultiEntry: false,
+		})
+}
+
+// v5Backfill rewrites every message stored before v5 so that messages with a
+// lease have an expiry, which the v5 index requires.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v5Backfill(db *idb.Database) error {
+	return rewriteMessages(db)
+}
+
+// v6Upgrade performs the v5 -> v6 database upgrade, which adds the key
+// rotation store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v6Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateKeyRotationStore(db)
+}
+
+// v7Upgrade performs the v6 -> v7 database upgrade, which adds the read marker
+// to each channel. The schema is unchanged; the marker is set by v7Backfill.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v7Upgrade(*idb.Database, *impl.UpgradeTransaction) error {
+	return nil
+}
+
+// v7Backfill marks every message stored before v7 as read, so that the unread
+// count of each channel starts at zero.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v7Backfill(db *idb.Database) error {
+	return impl.MarkAllRead(db, channelStoreName, netTime.Now())
+}
+
+// v8Upgrade performs the v7 -> v8 database upgrade, which adds the draft
+// store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v8Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateDraftStore(db)
+}
+
+// rewriteMessages stores every message again with its index keys set by
+// Message.setIndexKeys.
+func rewriteMessages(db *idb.Database) error {
+	txn, err := db.Transaction(idb.TransactionReadWrite, messageStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return err
+			}
+			msg.setIndexKeys()
+
+			msgJson, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			msgObj, err := utils.JsonToJS(msgJson)
+			if err != nil {
+				return err
+			}
+			_, err = cursor.Update(msgObj)
+			return err
+		})
+	if err != nil {
+		return errors.Errorf("Unable to update Message data: %+v", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// leaseSweepInterval is how often the messages with ended leases are deleted.
+const leaseSweepInterval = time.Minute
+
+// ExpireMessages deletes every message whose lease has ended, along with the
+// reactions to it, using messageStoreExpiryIndex. Messages leased forever are
+// never deleted.
+func (w *wasmModel) ExpireMessages() error {
+	parentErr := errors.New("failed to ExpireMessages")
+
+	keyRange, err := idb.NewKeyRangeUpperBound(
+		js.ValueOf(netTime.Now().UnixMilli()), false)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeUpperBound: %+v", err)
+	}
+
+	var expired []js.Value
+	n, err := impl.PruneIndex(w.db, messageStoreName, messageStoreExpiryIndex,
+		keyRange, func(js.Value) (bool, error) { return false, nil },
+		func(value js.Value) {
+			expired = append(expired, value)
+			w.messagePruned(value)
+		})
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	for _, value := range expired {
+		if err = w.deleteReactions(value.Get(messageStoreMessage)); err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+	}
+
+	if n > 0 {
+		jww.INFO.Printf("Deleted %d messages with ended leases", n)
+	}
+	return nil
+}
+
+// deleteReactions deletes the reactions to the message with the given encoded
+// message ID using messageStoreParentIndex.
+func (w *wasmModel) deleteReactions(messageID js.Value) error {
+	if messageID.IsNull() || messageID.IsUndefined() {
+		return nil
+	}
+
+	keyRange, err := idb.NewKeyRangeOnly(messageID)
+	if err != nil {
+		return errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+
+	_, err = impl.PruneIndex(w.db, messageStoreName, messageStoreParentIndex,
+		keyRange, func(value js.Value) (bool, error) {
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return false, err
+			}
+			return channels.MessageType(msg.Type) != channels.Reaction, nil
+		}, w.messagePruned)
+	return err
+}
@@ -10,7 +10,11 @@
 package main
 
 import (
+	"encoding/json"
+	"strconv"
 	"time"
+
+	"gitlab.com/elixxir/client/v4/channels"
 )
 
 const (
@@ -28,6 +32,11 @@ const (
 	messageStoreParentIndex    = "parent_message_id_index"
 	messageStoreTimestampIndex = "timestamp_index"
 	messageStorePinnedIndex    = "pinned_index"
+	messageStoreExpiryIndex    = "expiry_index"
+
+	// Compound message index names.
+	messageStoreChannelTimestampIndex = "channel_id_timestamp_index"
+	messageStoreChannelPinnedIndex    = "channel_id_pinned_index"
 
 	// Message keyPath names (must match json struct tags).
 	messageStoreMessage   = "message_id"
@@ -35,8 +44,16 @@ const (
 	messageStoreParent    = "parent_message_id"
 	messageStoreTimestamp = "timestamp"
 	messageStorePinned    = "pinned"
+	messageStorePinnedKey = "pinned_key"
+	messageStoreExpiry    = "expiry"
 )
 
+// timestampLayout is the layout of the stored timestamp of a message. Unlike
+// RFC 3339 with nanoseconds, which drops trailing zeros, it has a fixed width,
+// so stored timestamps in UTC sort in time order, as the timestamp indexes
+// require. It is still parsed as RFC 3339 when unmarshalled.
+const timestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
 // Message defines the IndexedDb representation of a single Message.
 //
 // A Message belongs to one Channel.
@@ -53,9 +70,11 @@ type Message struct {
 	ParentMessageID []byte    `json:"parent_message_id"` // Index
 	Timestamp       time.Time `json:"timestamp"`         // Index
 	Lease           string    `json:"lease_v2"`
+	Expiry          int64     `json:"expiry,omitempty"` // Index
 	Status          uint8     `json:"status"`
 	Hidden          bool      `json:"hidden"`
-	Pinned          bool      `json:"pinned"` // Index
+	Pinned          bool      `json:"pinned"`     // Index
+	PinnedKey       uint8     `json:"pinned_key"` // Index
 	Text            string    `json:"text"`
 	Type            uint16    `json:"type"`
 	Round           uint64    `json:"round"`
@@ -66,6 +85,39 @@ type Message struct {
 	CodesetVersion uint8  `json:"codeset_version"`
 }
 
+// setIndexKeys sets the fields used only as index keys. PinnedKey mirrors
+// Pinned as a number, since booleans are not valid IndexedDb keys. The
+// timestamp is stored in UTC so that timestamps sort in time order. Expiry is
+// the time, in Unix milliseconds, that the lease of the message ends, or zero
+// if it never ends.
+func (m *Message) setIndexKeys() {
+	m.PinnedKey = 0
+	if m.Pinned {
+		m.PinnedKey = 1
+	}
+	m.Timestamp = m.Timestamp.UTC()
+
+	m.Expiry = 0
+	lease, err := strconv.ParseInt(m.Lease, 10, 64)
+	if err == nil && lease > 0 &&
+		time.Duration(lease) < channels.ValidForever {
+		expiry := m.Timestamp.Add(time.Duration(lease))
+		if expiry.After(m.Timestamp) {
+			m.Expiry = expiry.UnixMilli()
+		}
+	}
+}
+
+// MarshalJSON marshals the message with its timestamp in UTC in
+// timestampLayout.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return json.Marshal(struct {
+		message
+		Timestamp string `json:"timestamp"`
+	}{message(m), m.Timestamp.UTC().Format(timestampLayout)})
+}
+
 // Channel defines the IndexedDb representation of a single Channel.
 //
 // A Channel has many Message.
@@ -73,6 +125,19 @@ type Channel struct {
 	ID          []byte `json:"id"` // Matches pkeyName
 	Name        string `json:"name"`
 	Description string `json:"description"`
+
+	// LastReadUUID and LastReadTimestamp are the read marker. Messages with a
+	// later timestamp, other than the marked message, are unread.
+	LastReadUUID      uint64    `json:"last_read_uuid"`
+	LastReadTimestamp time.Time `json:"last_read_timestamp"`
+
+	// UnreadCount is the number of unread messages. It is updated as messages
+	// are stored and deleted.
+	UnreadCount int `json:"unread_count"`
+
+	// LastCountedUUID is the UUID of the newest message counted in
+	// UnreadCount, so that updates to stored messages are not counted again.
+	LastCountedUUID uint64 `json:"last_counted_uuid"`
 }
 
 // File defines the IndexedDb representation of a single File.
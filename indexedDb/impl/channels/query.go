@@ -0,0 +1,358 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+)
+
+// defaultQueryLimit is the number of messages returned by
+// wasmModel.QueryMessages when the query has no limit.
+const defaultQueryLimit = 100
+
+// timestampPrefix is timestampLayout up to the second. Every stored timestamp
+// within the same second starts with the same prefix.
+const timestampPrefix = "2006-01-02T15:04:05"
+
+// queryCursor is the position of the last message returned in a page of
+// wasmModel.QueryMessages. It is base 64 encoded JSON in the query so that
+// Javascript can treat it as opaque.
+type queryCursor struct {
+	// Key is the index key of the message.
+	Key string `json:"key"`
+
+	// UUID is the primary key of the message.
+	UUID uint64 `json:"uuid"`
+}
+
+// QueryMessages returns a page of messages matching the query. Messages are
+// read with a cursor over the index chosen by newQueryIndex, limited to the
+// channel, pinned status, and time range of the query where the index allows.
+// All filters are applied to each message read. The message content is
+// decrypted.
+func (w *wasmModel) QueryMessages(
+	query wChannels.MessageQuery) (wChannels.MessageQueryResult, error) {
+	parentErr := errors.New("failed to QueryMessages")
+	var result wChannels.MessageQueryResult
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+
+	var after *queryCursor
+	if query.Cursor != "" {
+		var err error
+		if after, err = decodeQueryCursor(query.Cursor); err != nil {
+			return result, errors.WithMessagef(parentErr,
+				"Invalid cursor: %+v", err)
+		}
+	}
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return result, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return result, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	qi, err := newQueryIndex(query)
+	if err != nil {
+		return result, errors.WithMessagef(parentErr,
+			"Unable to build key range: %+v", err)
+	}
+	index, err := store.Index(qi.name)
+	if err != nil {
+		return result, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	direction := idb.CursorNext
+	if query.Descending {
+		direction = idb.CursorPrevious
+	}
+	cursorRequest, err := index.OpenCursorRange(qi.keyRange, direction)
+	if err != nil {
+		return result, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	var last queryCursor
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			pos, err := qi.position(cursor)
+			if err != nil {
+				return err
+			}
+
+			// Skip to the message after the one the previous page ended on
+			if after != nil {
+				if !after.before(pos, query.Descending) {
+					return cursor.ContinuePrimaryKey(qi.indexKey(after.Key),
+						js.ValueOf(after.next(query.Descending)))
+				}
+				after = nil
+			}
+
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return err
+			}
+			if !matchesQuery(msg, query) {
+				return nil
+			}
+
+			// A match beyond the limit means there is another page
+			if len(result.Messages) == limit {
+				result.NextCursor, err = encodeQueryCursor(last)
+				if err != nil {
+					return err
+				}
+				return idb.ErrCursorStopIter
+			}
+
+			modelMsg, err := w.decryptModelMessage(msg)
+			if err != nil {
+				return err
+			}
+			result.Messages = append(result.Messages, modelMsg)
+			last = pos
+			return nil
+		})
+	if err != nil {
+		return wChannels.MessageQueryResult{}, errors.WithMessagef(parentErr,
+			"Unable to read Message data: %+v", err)
+	}
+
+	return result, nil
+}
+
+// decryptModelMessage converts the stored Message into a
+// [channels.ModelMessage] and decrypts its content, if encryption is enabled.
+func (w *wasmModel) decryptModelMessage(
+	msg *Message) (channels.ModelMessage, error) {
+	modelMsg, err := buildModelMessage(msg)
+	if err != nil {
+		return channels.ModelMessage{}, err
+	}
+
+	if w.cipher != nil {
+		modelMsg.Content, err = w.cipher.Decrypt(msg.Text)
+		if err != nil {
+			return channels.ModelMessage{}, errors.Wrapf(err,
+				"failed to decrypt message %d", msg.ID)
+		}
+	}
+
+	return modelMsg, nil
+}
+
+// matchesQuery returns true if the message matches every filter in the query
+// except the channel, which is matched by the key range.
+func matchesQuery(msg *Message, query wChannels.MessageQuery) bool {
+	if query.PubKey != nil && !bytes.Equal(query.PubKey, msg.Pubkey) {
+		return false
+	}
+	if query.Pinned != nil && *query.Pinned != msg.Pinned {
+		return false
+	}
+	if !query.Start.IsZero() && msg.Timestamp.Before(query.Start) {
+		return false
+	}
+	if !query.End.IsZero() && !msg.Timestamp.Before(query.End) {
+		return false
+	}
+	if len(query.Types) > 0 {
+		for _, mt := range query.Types {
+			if channels.MessageType(msg.Type) == mt {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// queryIndex is the index and key range read by wasmModel.QueryMessages.
+type queryIndex struct {
+	name     string
+	keyRange *idb.KeyRange
+
+	// channelKey is the encoded channel ID of a compound index. It is empty
+	// for messageStoreTimestampIndex.
+	channelKey string
+
+	// pinnedKey is the second key of messageStoreChannelPinnedIndex. Set to -1
+	// for other indexes.
+	pinnedKey int
+}
+
+// newQueryIndex returns the index that reads the fewest messages for the
+// query:
+//   - messageStoreChannelPinnedIndex for a channel and pinned status, ordered
+//     in the order the messages were stored.
+//   - messageStoreChannelTimestampIndex for a channel, ordered by timestamp.
+//   - messageStoreTimestampIndex otherwise, ordered by timestamp.
+//
+// Timestamps are stored in UTC in timestampLayout, which sorts in time order.
+// Time ranges are widened to whole seconds; the exact range is checked by
+// matchesQuery.
+func newQueryIndex(query wChannels.MessageQuery) (*queryIndex, error) {
+	lower, upper := "", ""
+	if !query.Start.IsZero() {
+		lower = query.Start.UTC().Truncate(time.Second).Format(timestampPrefix)
+	}
+	if !query.End.IsZero() {
+		upper = query.End.UTC().Truncate(time.Second).Add(time.Second).
+			Format(timestampPrefix)
+	}
+
+	if query.ChannelID == nil {
+		qi := &queryIndex{name: messageStoreTimestampIndex, pinnedKey: -1}
+		var err error
+		switch {
+		case lower != "" && upper != "":
+			qi.keyRange, err = idb.NewKeyRangeBound(
+				js.ValueOf(lower), js.ValueOf(upper), false, true)
+		case lower != "":
+			qi.keyRange, err = idb.NewKeyRangeLowerBound(js.ValueOf(lower), false)
+		case upper != "":
+			qi.keyRange, err = idb.NewKeyRangeUpperBound(js.ValueOf(upper), true)
+		default:
+			// Every timestamp is a string, so it sorts after the empty string
+			qi.keyRange, err = idb.NewKeyRangeLowerBound(js.ValueOf(""), false)
+		}
+		return qi, err
+	}
+
+	channelKey := impl.EncodeBytes(query.ChannelID.Marshal()).String()
+	if query.Pinned != nil {
+		qi := &queryIndex{name: messageStoreChannelPinnedIndex,
+			channelKey: channelKey}
+		if *query.Pinned {
+			qi.pinnedKey = 1
+		}
+		var err error
+		qi.keyRange, err = idb.NewKeyRangeOnly(qi.indexKey(""))
+		return qi, err
+	}
+
+	qi := &queryIndex{name: messageStoreChannelTimestampIndex,
+		channelKey: channelKey, pinnedKey: -1}
+	upperKey := qi.indexKey(upper)
+	if upper == "" {
+		// Arrays sort after strings, so this is after every timestamp
+		upperKey = js.ValueOf([]any{channelKey, []any{}})
+	}
+	var err error
+	qi.keyRange, err = idb.NewKeyRangeBound(
+		qi.indexKey(lower), upperKey, false, true)
+	return qi, err
+}
+
+// indexKey returns the full index key for the part of the key returned by
+// position.
+func (qi *queryIndex) indexKey(key string) js.Value {
+	switch {
+	case qi.channelKey == "":
+		return js.ValueOf(key)
+	case qi.pinnedKey >= 0:
+		return js.ValueOf([]any{qi.channelKey, qi.pinnedKey})
+	default:
+		return js.ValueOf([]any{qi.channelKey, key})
+	}
+}
+
+// position returns the part of the index key of the cursor that orders
+// messages and the primary key of the cursor.
+func (qi *queryIndex) position(cursor *idb.CursorWithValue) (queryCursor, error) {
+	key, err := cursor.Key()
+	if err != nil {
+		return queryCursor{}, err
+	}
+	primaryKey, err := cursor.PrimaryKey()
+	if err != nil {
+		return queryCursor{}, err
+	}
+
+	pos := queryCursor{UUID: uint64(primaryKey.Int())}
+	switch {
+	case qi.channelKey == "":
+		pos.Key = key.String()
+	case qi.pinnedKey < 0:
+		pos.Key = key.Index(1).String()
+	}
+	return pos, nil
+}
+
+// before returns true if the cursor comes before pos in the direction of
+// iteration. Messages with the same index key are ordered by primary key.
+func (qc *queryCursor) before(pos queryCursor, descending bool) bool {
+	if qc.Key == pos.Key {
+		if descending {
+			return pos.UUID < qc.UUID
+		}
+		return pos.UUID > qc.UUID
+	}
+	if descending {
+		return pos.Key < qc.Key
+	}
+	return pos.Key > qc.Key
+}
+
+// next returns the primary key immediately after the cursor in the direction
+// of iteration.
+func (qc *queryCursor) next(descending bool) uint64 {
+	if descending {
+		return qc.UUID - 1
+	}
+	return qc.UUID + 1
+}
+
+// encodeQueryCursor returns the cursor as base 64 encoded JSON.
+func encodeQueryCursor(qc queryCursor) (string, error) {
+	data, err := json.Marshal(qc)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// decodeQueryCursor decodes a cursor encoded with encodeQueryCursor.
+func decodeQueryCursor(s string) (*queryCursor, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var qc queryCursor
+	return &qc, json.Unmarshal(data, &qc)
+}
@@ -0,0 +1,128 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// SetRetentionPolicy stores the retention policy of the channel and deletes
+// the messages that it does not keep. A zero policy keeps every message.
+func (w *wasmModel) SetRetentionPolicy(
+	channelID *id.ID, policy impl.RetentionPolicy) error {
+	parentErr := errors.New("failed to SetRetentionPolicy")
+
+	if err := policy.Validate(); err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	err := impl.PutRetentionPolicy(w.db, channelID.Marshal(), policy)
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	if !policy.IsZero() {
+		if err = w.pruneChannel(channelID, policy, netTime.Now()); err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+	}
+	return nil
+}
+
+// PruneMessages deletes the messages of every channel that its retention
+// policy does not keep.
+func (w *wasmModel) PruneMessages() error {
+	parentErr := errors.New("failed to PruneMessages")
+
+	rules, err := impl.GetRetentionRules(w.db)
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	now := netTime.Now()
+	for _, rule := range rules {
+		channelID, err := id.Unmarshal(rule.ID)
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Invalid channel ID in retention policy: %+v", err)
+		}
+		err = w.pruneChannel(channelID, rule.RetentionPolicy, now)
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+	}
+	return nil
+}
+
+// pruneChannel deletes the messages of the channel that the policy does not
+// keep, newest first, using messageStoreChannelTimestampIndex.
+func (w *wasmModel) pruneChannel(
+	channelID *id.ID, policy impl.RetentionPolicy, now time.Time) error {
+	channelKey := impl.EncodeBytes(channelID.Marshal())
+
+	// Arrays sort after strings, so this covers every timestamp
+	keyRange, err := idb.NewKeyRangeBound(
+		js.ValueOf([]any{channelKey, ""}),
+		js.ValueOf([]any{channelKey, []any{}}), false, false)
+	if err != nil {
+		return errors.Errorf("Unable to NewKeyRangeBound: %+v", err)
+	}
+
+	keep := policy.Keeper(now)
+	n, err := impl.PruneIndex(w.db, messageStoreName,
+		messageStoreChannelTimestampIndex, keyRange,
+		func(value js.Value) (bool, error) {
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return false, err
+			}
+			return keep(msg.Timestamp, msg.Pinned), nil
+		}, w.messagePruned)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		jww.INFO.Printf("Pruned %d messages from channel %s", n, channelID)
+	}
+	return nil
+}
+
+// messagePruned removes the deleted message from the search index and the
+// unread count and notifies the UI that it was deleted.
+func (w *wasmModel) messagePruned(value js.Value) {
+	msg, err := valueToMessage(value)
+	if err != nil {
+		jww.ERROR.Printf("Failed to unmarshal pruned Message: %+v", err)
+		return
+	}
+	w.unindexMessage(msg)
+	w.messageRemoved(msg)
+
+	messageID, err := message.UnmarshalID(msg.MessageID)
+	if err != nil {
+		jww.ERROR.Printf("Invalid ID of pruned Message %d: %+v", msg.ID, err)
+		return
+	}
+	go w.eventCallback(bindings.MessageDeleted, bindings.MessageDeletedJSON{
+		MessageID: messageID,
+	})
+}
@@ -0,0 +1,394 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the output formats of channel history exports.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/crypto/message"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+)
+
+const (
+	// transcriptTimeLayout is the layout of timestamps in Markdown and HTML
+	// transcripts.
+	transcriptTimeLayout = "2006-01-02 15:04:05 MST"
+
+	// excerptLength is the maximum number of characters of the message quoted
+	// by a reply in Markdown and HTML transcripts.
+	excerptLength = 80
+)
+
+// Error messages.
+const (
+	// newHistoryWriter
+	unknownExportFormatErr = "unknown export format %q"
+)
+
+// historyWriter writes a channel history export in a single format. The
+// header, each message, and the footer are written in order, possibly to
+// different buffers.
+type historyWriter interface {
+	// writeHeader writes the start of the export. The history has no
+	// messages.
+	writeHeader(buf *bytes.Buffer, history wChannels.ChannelHistory) error
+
+	// writeMessage writes the message. parent is the message it replies to, if
+	// it is stored. first is true for the first message of the export.
+	writeMessage(buf *bytes.Buffer, msg wChannels.ExportedMessage,
+		parent *wChannels.ExportedMessage, first bool) error
+
+	// writeFooter writes the end of the export.
+	writeFooter(buf *bytes.Buffer)
+}
+
+// newHistoryWriter returns the historyWriter for the format.
+func newHistoryWriter(format wChannels.ExportFormat) (historyWriter, error) {
+	switch format {
+	case wChannels.ExportJSON:
+		return jsonHistoryWriter{}, nil
+	case wChannels.ExportMarkdown:
+		return markdownHistoryWriter{}, nil
+	case wChannels.ExportHTML:
+		return htmlHistoryWriter{}, nil
+	default:
+		return nil, errors.Errorf(unknownExportFormatErr, format)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JSON                                                                       //
+////////////////////////////////////////////////////////////////////////////////
+
+// jsonHistoryWriter writes the JSON of a [wChannels.ChannelHistory], with one
+// message per line.
+type jsonHistoryWriter struct{}
+
+// writeHeader writes the history up to the start of the messages array.
+func (jsonHistoryWriter) writeHeader(
+	buf *bytes.Buffer, history wChannels.ChannelHistory) error {
+	history.Messages = []wChannels.ExportedMessage{}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return errors.Errorf("Unable to marshal ChannelHistory: %+v", err)
+	}
+
+	// Messages is the last field, so the JSON ends with "[]}"
+	buf.Write(data[:len(data)-len("]}")])
+	return nil
+}
+
+func (jsonHistoryWriter) writeMessage(buf *bytes.Buffer,
+	msg wChannels.ExportedMessage, _ *wChannels.ExportedMessage,
+	first bool) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf("Unable to marshal ExportedMessage: %+v", err)
+	}
+
+	if !first {
+		buf.WriteByte(',')
+	}
+	buf.WriteByte('\n')
+	buf.Write(data)
+	return nil
+}
+
+func (jsonHistoryWriter) writeFooter(buf *bytes.Buffer) {
+	buf.WriteString("\n]}\n")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Markdown                                                                   //
+////////////////////////////////////////////////////////////////////////////////
+
+// markdownHistoryWriter writes a Markdown transcript. All user text is
+// escaped so that it is shown as it was sent; line breaks in message text are
+// kept.
+type markdownHistoryWriter struct{}
+
+func (markdownHistoryWriter) writeHeader(
+	buf *bytes.Buffer, history wChannels.ChannelHistory) error {
+	fmt.Fprintf(buf, "# %s\n\n", escapeMarkdown(channelTitle(history.Channel)))
+	if history.Channel.Description != "" {
+		fmt.Fprintf(buf, "%s\n\n", escapeMarkdown(history.Channel.Description))
+	}
+	fmt.Fprintf(buf, "- Channel ID: `%s`\n", history.Channel.ID)
+	fmt.Fprintf(buf, "- Exported: %s\n",
+		history.ExportedAt.Format(transcriptTimeLayout))
+	if r := exportRangeText(history.Range); r != "" {
+		fmt.Fprintf(buf, "- Range: %s\n", r)
+	}
+	buf.WriteString("\n---\n")
+	return nil
+}
+
+func (markdownHistoryWriter) writeMessage(buf *bytes.Buffer,
+	msg wChannels.ExportedMessage, parent *wChannels.ExportedMessage,
+	_ bool) error {
+	fmt.Fprintf(buf, "\n**%s** · %s", escapeMarkdown(msg.Nickname),
+		msg.Timestamp.Format(transcriptTimeLayout))
+	if msg.Pinned {
+		buf.WriteString(" · pinned")
+	}
+	buf.WriteString("\n\n")
+
+	if msg.ReplyTo != nil {
+		if parent != nil {
+			fmt.Fprintf(buf, "> ↪ **%s**: %s\n\n", escapeMarkdown(
+				parent.Nickname), escapeMarkdown(excerpt(*parent)))
+		} else {
+			buf.WriteString("> ↪ *message not available*\n\n")
+		}
+	}
+
+	if msg.File != nil {
+		fmt.Fprintf(buf, "📎 **%s** (%s, %d bytes) `%s`\n",
+			escapeMarkdown(msg.File.Name), escapeMarkdown(msg.File.Type),
+			msg.File.Size, msg.File.FileID)
+	} else {
+		fmt.Fprintf(buf, "%s\n", escapeMarkdownText(msg.Text))
+	}
+
+	if len(msg.Reactions) > 0 {
+		groups := groupReactions(msg.Reactions)
+		parts := make([]string, len(groups))
+		for i, g := range groups {
+			nicknames := make([]string, len(g.nicknames))
+			for j, nickname := range g.nicknames {
+				nicknames[j] = escapeMarkdown(nickname)
+			}
+			parts[i] = g.reaction + " " + strings.Join(nicknames, ", ")
+		}
+		fmt.Fprintf(buf, "\n%s\n", strings.Join(parts, " · "))
+	}
+	return nil
+}
+
+func (markdownHistoryWriter) writeFooter(*bytes.Buffer) {}
+
+// markdownEscaper escapes the characters with meaning in inline Markdown.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `\<`, `>`, `\>`, `#`, `\#`, `|`, `\|`, `~`, `\~`, `&`, `\&`,
+	"\n", " ")
+
+// escapeMarkdown escapes the text so that it is shown as is, on a single line,
+// in Markdown.
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// escapeMarkdownText escapes the multi-line text so that it is shown as is in
+// Markdown. Each line is escaped, a leading list or heading marker is escaped,
+// and leading spaces are made non-breaking so they are not read as a code
+// block. Lines end with a hard line break.
+func escapeMarkdownText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := strings.Repeat("\u00a0", len(line)-len(trimmed))
+
+		line = escapeMarkdown(trimmed)
+		if loc := markdownBlockMarker.FindStringIndex(line); loc != nil {
+			// Escape the last character of the marker
+			line = line[:loc[1]-1] + `\` + line[loc[1]-1:]
+		}
+		lines[i] = indent + line
+	}
+	return strings.Join(lines, "  \n")
+}
+
+// markdownBlockMarker matches the start of a line that Markdown reads as a
+// list item, a thematic break, or a setext heading underline.
+var markdownBlockMarker = regexp.MustCompile(`^([-+=]|\d{1,9}[.)])`)
+
+////////////////////////////////////////////////////////////////////////////////
+// HTML                                                                       //
+////////////////////////////////////////////////////////////////////////////////
+
+// htmlHistoryStyle is the style sheet embedded in HTML transcripts so that they
+// are self-contained.
+const htmlHistoryStyle = "" +
+	"body{font-family:system-ui,sans-serif;max-width:48rem;margin:2rem auto;" +
+	"padding:0 1rem;color:#222}" +
+	"header.channel{border-bottom:1px solid #ddd;margin-bottom:1rem}" +
+	".meta{color:#666;font-size:.9em}" +
+	"article{padding:.5rem 0;border-bottom:1px solid #f0f0f0}" +
+	".nickname{font-weight:bold}" +
+	"time{color:#666;font-size:.85em;margin-left:.5em}" +
+	".pinned{margin-left:.5em}" +
+	"blockquote{margin:.25rem 0;padding-left:.5rem;" +
+	"border-left:3px solid #ccc;color:#555}" +
+	"blockquote a{color:inherit}" +
+	".text{white-space:pre-wrap;margin:.25rem 0}" +
+	".file code{font-size:.85em}" +
+	".reactions{list-style:none;padding:0;margin:.25rem 0}" +
+	".reactions li{display:inline-block;margin-right:.75em;font-size:.9em}"
+
+// htmlHistoryWriter writes a self-contained HTML transcript. Each message is
+// an article that replies link to.
+type htmlHistoryWriter struct{}
+
+func (htmlHistoryWriter) writeHeader(
+	buf *bytes.Buffer, history wChannels.ChannelHistory) error {
+	title := html.EscapeString(channelTitle(history.Channel))
+	fmt.Fprintf(buf, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n"+
+		"<meta charset=\"utf-8\">\n<title>%s</title>\n<style>%s</style>\n"+
+		"</head>\n<body>\n<header class=\"channel\">\n<h1>%s</h1>\n",
+		title, htmlHistoryStyle, title)
+	if history.Channel.Description != "" {
+		fmt.Fprintf(buf, "<p>%s</p>\n",
+			html.EscapeString(history.Channel.Description))
+	}
+	fmt.Fprintf(buf, "<p class=\"meta\">Channel ID: <code>%s</code><br>"+
+		"Exported: %s", html.EscapeString(history.Channel.ID.String()),
+		history.ExportedAt.Format(transcriptTimeLayout))
+	if r := exportRangeText(history.Range); r != "" {
+		fmt.Fprintf(buf, "<br>Range: %s", html.EscapeString(r))
+	}
+	buf.WriteString("</p>\n</header>\n<main>\n")
+	return nil
+}
+
+func (htmlHistoryWriter) writeMessage(buf *bytes.Buffer,
+	msg wChannels.ExportedMessage, parent *wChannels.ExportedMessage,
+	_ bool) error {
+	fmt.Fprintf(buf, "<article id=\"%s\">\n<div><span class=\"nickname\">"+
+		"%s</span><time datetime=\"%s\">%s</time>", messageAnchor(msg.MessageID),
+		html.EscapeString(msg.Nickname), msg.Timestamp.Format(time.RFC3339),
+		msg.Timestamp.Format(transcriptTimeLayout))
+	if msg.Pinned {
+		buf.WriteString("<span class=\"pinned\">📌</span>")
+	}
+	buf.WriteString("</div>\n")
+
+	if msg.ReplyTo != nil {
+		if parent != nil {
+			fmt.Fprintf(buf, "<blockquote><a href=\"#%s\">↪ %s</a>: %s"+
+				"</blockquote>\n", messageAnchor(*msg.ReplyTo),
+				html.EscapeString(parent.Nickname),
+				html.EscapeString(excerpt(*parent)))
+		} else {
+			buf.WriteString(
+				"<blockquote>↪ <em>message not available</em></blockquote>\n")
+		}
+	}
+
+	if msg.File != nil {
+		fmt.Fprintf(buf, "<p class=\"file\">📎 <strong>%s</strong> (%s, %d "+
+			"bytes) <code>%s</code></p>\n", html.EscapeString(msg.File.Name),
+			html.EscapeString(msg.File.Type), msg.File.Size,
+			html.EscapeString(msg.File.FileID.String()))
+	} else {
+		fmt.Fprintf(buf, "<p class=\"text\">%s</p>\n",
+			html.EscapeString(msg.Text))
+	}
+
+	if len(msg.Reactions) > 0 {
+		buf.WriteString("<ul class=\"reactions\">")
+		for _, g := range groupReactions(msg.Reactions) {
+			fmt.Fprintf(buf, "<li>%s %s</li>", html.EscapeString(g.reaction),
+				html.EscapeString(strings.Join(g.nicknames, ", ")))
+		}
+		buf.WriteString("</ul>\n")
+	}
+
+	buf.WriteString("</article>\n")
+	return nil
+}
+
+func (htmlHistoryWriter) writeFooter(buf *bytes.Buffer) {
+	buf.WriteString("</main>\n</body>\n</html>\n")
+}
+
+// messageAnchor returns the ID of the HTML element of the message.
+func messageAnchor(messageID message.ID) string {
+	return "msg-" + base64.RawURLEncoding.EncodeToString(messageID.Marshal())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helpers                                                                    //
+////////////////////////////////////////////////////////////////////////////////
+
+// channelTitle returns the name of the channel or its ID if it has no name.
+func channelTitle(channel wChannels.ExportedChannel) string {
+	if channel.Name != "" {
+		return channel.Name
+	}
+	return channel.ID.String()
+}
+
+// exportRangeText returns the range in words or an empty string if it is
+// open.
+func exportRangeText(r wChannels.ExportRange) string {
+	switch {
+	case !r.Start.IsZero() && !r.End.IsZero():
+		return "from " + r.Start.UTC().Format(transcriptTimeLayout) +
+			" until " + r.End.UTC().Format(transcriptTimeLayout)
+	case !r.Start.IsZero():
+		return "from " + r.Start.UTC().Format(transcriptTimeLayout)
+	case !r.End.IsZero():
+		return "until " + r.End.UTC().Format(transcriptTimeLayout)
+	default:
+		return ""
+	}
+}
+
+// excerpt returns the start of the text of the message, or the name of its
+// file, on a single line.
+func excerpt(msg wChannels.ExportedMessage) string {
+	text := msg.Text
+	if msg.File != nil {
+		text = "📎 " + msg.File.Name
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) > excerptLength {
+		return string(runes[:excerptLength]) + "…"
+	}
+	return text
+}
+
+// reactionGroup is the nicknames of everyone who reacted with the same
+// reaction.
+type reactionGroup struct {
+	reaction  string
+	nicknames []string
+}
+
+// groupReactions groups the reactions by reaction, in the order each reaction
+// was first used.
+func groupReactions(reactions []wChannels.ExportedMessage) []reactionGroup {
+	var groups []reactionGroup
+	positions := make(map[string]int)
+	for _, r := range reactions {
+		i, exists := positions[r.Text]
+		if !exists {
+			i = len(groups)
+			positions[r.Text] = i
+			groups = append(groups, reactionGroup{reaction: r.Text})
+		}
+		groups[i].nicknames = append(groups[i].nicknames, r.Nickname)
+	}
+	return groups
+}
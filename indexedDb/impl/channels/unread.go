@@ -0,0 +1,347 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// MarkRead moves the read marker of the channel to the message with the UUID
+// and recounts the unread messages. If the UUID is 0, every message with a
+// timestamp up to now is marked as read. The marker can be moved backwards to
+// mark messages as unread again.
+func (w *wasmModel) MarkRead(channelID *id.ID, uuid uint64) error {
+	parentErr := errors.New("failed to MarkRead")
+
+	if channelID == nil {
+		return errors.WithMessage(parentErr, "missing channel ID")
+	}
+
+	timestamp := netTime.Now().UTC()
+	if uuid != 0 {
+		msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+		msg, err := valueToMessage(msgObj)
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		} else if !bytes.Equal(msg.ChannelID, channelID.Marshal()) {
+			return errors.WithMessagef(parentErr,
+				"message %d is not in channel %s", uuid, channelID)
+		}
+		timestamp = msg.Timestamp
+	}
+
+	channel, _, err := w.updateChannel(channelID.Marshal(),
+		func(txn *idb.Transaction, channel *Channel) (bool, error) {
+			channel.LastReadUUID = uuid
+			channel.LastReadTimestamp = timestamp
+			count, err := w.countUnread(txn, channel)
+			channel.UnreadCount = count
+			return err == nil, err
+		})
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	w.unreadCountChanged(channel)
+	return nil
+}
+
+// GetUnreadCounts returns the read marker and the number of unread messages of
+// every stored channel.
+func (w *wasmModel) GetUnreadCounts() ([]wChannels.UnreadCount, error) {
+	parentErr := errors.New("failed to GetUnreadCounts")
+
+	values, err := impl.GetAll(w.db, channelStoreName)
+	if err != nil {
+		return nil, errors.WithMessage(parentErr, err.Error())
+	}
+
+	counts := make([]wChannels.UnreadCount, 0, len(values))
+	for _, value := range values {
+		channel, err := valueToChannel(value)
+		if err != nil {
+			return nil, errors.WithMessage(parentErr, err.Error())
+		}
+		count, err := channel.unreadCount()
+		if err != nil {
+			return nil, errors.WithMessage(parentErr, err.Error())
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+// messagesStored updates the unread count of the channels of the newly stored
+// messages, which must have their UUID set. A message stored as
+// channels.Unsent was sent by the user, so the channel is marked as read up to
+// it. Errors are logged since they do not affect the stored messages.
+func (w *wasmModel) messagesStored(msgs []*Message) {
+	byChannel := make(map[string][]*Message)
+	var order []string
+	for _, msg := range msgs {
+		key := string(msg.ChannelID)
+		if _, exists := byChannel[key]; !exists {
+			order = append(order, key)
+		}
+		byChannel[key] = append(byChannel[key], msg)
+	}
+
+	for _, key := range order {
+		w.updateUnread([]byte(key), func(
+			_ *idb.Transaction, channel *Channel) (bool, error) {
+			changed := false
+			for _, msg := range byChannel[key] {
+				// Updates to messages already counted are not counted again
+				if msg.ID <= channel.LastCountedUUID {
+					continue
+				}
+
+				if channels.SentStatus(msg.Status) == channels.Unsent {
+					channel.LastReadUUID = msg.ID
+					channel.LastReadTimestamp = msg.Timestamp
+					channel.UnreadCount = 0
+				} else if channel.isUnread(msg) {
+					channel.UnreadCount++
+				} else {
+					continue
+				}
+				channel.LastCountedUUID = msg.ID
+				changed = true
+			}
+			return changed, nil
+		})
+	}
+}
+
+// messageUpdated updates the unread count of the channel of the stored message
+// if the update changed whether it is unread.
+func (w *wasmModel) messageUpdated(previous, msg *Message) {
+	w.updateUnread(msg.ChannelID, func(
+		_ *idb.Transaction, channel *Channel) (bool, error) {
+		wasUnread, isUnread := channel.isUnread(previous), channel.isUnread(msg)
+		switch {
+		case wasUnread && !isUnread && channel.UnreadCount > 0:
+			channel.UnreadCount--
+		case !wasUnread && isUnread:
+			channel.UnreadCount++
+		default:
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// messageRemoved updates the unread count of the channel of the deleted
+// message.
+func (w *wasmModel) messageRemoved(msg *Message) {
+	w.updateUnread(msg.ChannelID, func(
+		_ *idb.Transaction, channel *Channel) (bool, error) {
+		if !channel.isUnread(msg) || channel.UnreadCount == 0 {
+			return false, nil
+		}
+		channel.UnreadCount--
+		return true, nil
+	})
+}
+
+// recountUnread counts the unread messages of the channel again and records
+// that every message up to newestUUID was counted.
+func (w *wasmModel) recountUnread(channelID []byte, newestUUID uint64) {
+	w.updateUnread(channelID, func(
+		txn *idb.Transaction, channel *Channel) (bool, error) {
+		count, err := w.countUnread(txn, channel)
+		if err != nil {
+			return false, err
+		}
+		changed := count != channel.UnreadCount
+		channel.UnreadCount = count
+		if newestUUID > channel.LastCountedUUID {
+			channel.LastCountedUUID = newestUUID
+			changed = true
+		}
+		return changed, nil
+	})
+}
+
+// updateUnread calls update with the stored channel and stores it if update
+// returns true. An UnreadCountChanged event is sent if the unread count
+// changed. Channels that are not stored are skipped. Errors are logged since
+// they do not affect the stored messages.
+func (w *wasmModel) updateUnread(channelID []byte,
+	update func(txn *idb.Transaction, channel *Channel) (bool, error)) {
+	channel, unreadCount, err := w.updateChannel(channelID, update)
+	if err != nil {
+		if !strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			jww.ERROR.Printf("Failed to update unread count: %+v", err)
+		}
+		return
+	}
+	if channel.UnreadCount != unreadCount {
+		w.unreadCountChanged(channel)
+	}
+}
+
+// updateChannel calls update with the stored channel and stores it if update
+// returns true. The channel is read and stored in a single transaction, which
+// also includes the message object store for update to read, so concurrent
+// updates of the channel are not lost. Returns the channel and its unread count
+// before the update.
+func (w *wasmModel) updateChannel(channelID []byte,
+	update func(txn *idb.Transaction, channel *Channel) (bool, error)) (
+	*Channel, int, error) {
+	var channel *Channel
+	var unreadCount int
+	err := impl.Update(w.db, channelStoreName, impl.EncodeBytes(channelID),
+		[]string{messageStoreName},
+		func(txn *idb.Transaction, value js.Value) (js.Value, bool, error) {
+			var err error
+			if channel, err = valueToChannel(value); err != nil {
+				return js.Undefined(), false, err
+			}
+			unreadCount = channel.UnreadCount
+
+			if changed, err := update(txn, channel); err != nil || !changed {
+				return js.Undefined(), false, err
+			}
+			value, err = channelToValue(channel)
+			return value, err == nil, err
+		})
+	if err != nil {
+		return nil, 0, err
+	}
+	return channel, unreadCount, nil
+}
+
+// countUnread returns the number of unread messages in the channel, reading
+// only the messages after the read marker, using
+// messageStoreChannelTimestampIndex within the transaction.
+func (w *wasmModel) countUnread(
+	txn *idb.Transaction, channel *Channel) (int, error) {
+	channelKey := impl.EncodeBytes(channel.ID)
+
+	// Timestamps are compared to the second by the index and exactly by
+	// isUnread. Arrays sort after strings, so this is after every timestamp.
+	lower := channel.LastReadTimestamp.UTC().Truncate(time.Second).
+		Format(timestampPrefix)
+	keyRange, err := idb.NewKeyRangeBound(js.ValueOf([]any{channelKey, lower}),
+		js.ValueOf([]any{channelKey, []any{}}), false, true)
+	if err != nil {
+		return 0, errors.Errorf("Unable to NewKeyRangeBound: %+v", err)
+	}
+
+	return impl.CountIndexTxn(txn, messageStoreName,
+		messageStoreChannelTimestampIndex, keyRange,
+		func(value js.Value) (bool, error) {
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return false, err
+			}
+			return channel.isUnread(msg), nil
+		})
+}
+
+// unreadCountChanged sends an UnreadCountChanged event for the channel.
+func (w *wasmModel) unreadCountChanged(channel *Channel) {
+	count, err := channel.unreadCount()
+	if err != nil {
+		jww.ERROR.Printf("Invalid ID of Channel: %+v", err)
+		return
+	}
+	go w.eventCallback(wChannels.UnreadCountChanged, count)
+}
+
+// isUnread returns true if the message is unread in the channel. Reactions,
+// hidden messages, and the message at the read marker are never unread.
+func (c *Channel) isUnread(msg *Message) bool {
+	return msg.ID != c.LastReadUUID && !msg.Hidden &&
+		channels.MessageType(msg.Type) != channels.Reaction &&
+		msg.Timestamp.After(c.LastReadTimestamp)
+}
+
+// unreadCount returns the read marker and unread count of the channel.
+func (c *Channel) unreadCount() (wChannels.UnreadCount, error) {
+	channelID, err := id.Unmarshal(c.ID)
+	if err != nil {
+		return wChannels.UnreadCount{}, err
+	}
+	return wChannels.UnreadCount{
+		ChannelID:         channelID,
+		UnreadCount:       c.UnreadCount,
+		LastReadUUID:      c.LastReadUUID,
+		LastReadTimestamp: c.LastReadTimestamp,
+	}, nil
+}
+
+// getChannel returns the stored channel with the marshalled ID. Returns an
+// error containing impl.ErrDoesNotExist if it is not stored.
+func (w *wasmModel) getChannel(channelID []byte) (*Channel, error) {
+	channelObj, err :=
+		impl.Get(w.db, channelStoreName, impl.EncodeBytes(channelID))
+	if err != nil {
+		return nil, err
+	}
+	return valueToChannel(channelObj)
+}
+
+// putChannel stores the channel.
+func (w *wasmModel) putChannel(channel *Channel) error {
+	channelObj, err := channelToValue(channel)
+	if err != nil {
+		return err
+	}
+
+	if _, err = impl.Put(w.db, channelStoreName, channelObj); err != nil {
+		return errors.Errorf("Unable to put Channel: %+v", err)
+	}
+	return nil
+}
+
+// channelToValue is a helper for converting a Channel to a js.Value.
+func channelToValue(channel *Channel) (js.Value, error) {
+	channelJson, err := json.Marshal(channel)
+	if err != nil {
+		return js.Undefined(),
+			errors.Errorf("Unable to marshal Channel: %+v", err)
+	}
+	channelObj, err := utils.JsonToJS(channelJson)
+	if err != nil {
+		return js.Undefined(),
+			errors.Errorf("Unable to marshal Channel: %+v", err)
+	}
+	return channelObj, nil
+}
+
+// valueToChannel is a helper for converting a js.Value to a Channel.
+func valueToChannel(channelObj js.Value) (*Channel, error) {
+	resultChannel := &Channel{}
+	err := json.Unmarshal([]byte(utils.JsToJson(channelObj)), resultChannel)
+	if err != nil {
+		return nil, errors.Errorf("Unable to unmarshal Channel: %+v", err)
+	}
+	return resultChannel, nil
+}
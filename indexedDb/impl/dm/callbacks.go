@@ -15,10 +15,11 @@ import (
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 
-	"gitlab.com/elixxir/client/v4/dm"
 	"gitlab.com/elixxir/crypto/fastRNG"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 	"gitlab.com/xx_network/crypto/csprng"
@@ -30,7 +31,10 @@ var zeroUUID = []byte{0, 0, 0, 0, 0, 0, 0, 0}
 // send information between the event model and the main thread.
 type manager struct {
 	wtm   *worker.ThreadManager
-	model dm.EventModel
+	model *wasmModel
+
+	// stopSweepers stop the sweepers started for model.
+	stopSweepers []func()
 }
 
 // registerCallbacks registers all the reception callbacks to manage messages
@@ -45,6 +49,20 @@ func (m *manager) registerCallbacks() {
 	m.wtm.RegisterCallback(wDm.DeleteMessageTag, m.deleteMessageCB)
 	m.wtm.RegisterCallback(wDm.GetConversationTag, m.getConversationCB)
 	m.wtm.RegisterCallback(wDm.GetConversationsTag, m.getConversationsCB)
+	m.wtm.RegisterCallback(
+		wDm.GetConversationMessagesTag, m.getConversationMessagesCB)
+	m.wtm.RegisterCallback(wDm.GetMessageByIDTag, m.getMessageByIDCB)
+	m.wtm.RegisterCallback(wDm.SearchMessagesTag, m.searchMessagesCB)
+	m.wtm.RegisterCallback(wDm.SetRetentionPolicyTag, m.setRetentionPolicyCB)
+	m.wtm.RegisterCallback(wDm.RotateDatabaseKeyTag, m.rotateDatabaseKeyCB)
+	m.wtm.RegisterCallback(wDm.ImportHistoryTag, m.importHistoryCB)
+	m.wtm.RegisterCallback(wDm.MarkReadTag, m.markReadCB)
+	m.wtm.RegisterCallback(wDm.GetUnreadCountsTag, m.getUnreadCountsCB)
+	m.wtm.RegisterCallback(wDm.SaveDraftTag, m.saveDraftCB)
+	m.wtm.RegisterCallback(wDm.GetDraftTag, m.getDraftCB)
+	m.wtm.RegisterCallback(wDm.ClearDraftTag, m.clearDraftCB)
+	m.wtm.RegisterCallback(wDm.LockCipherTag, m.lockCipherCB)
+	m.wtm.RegisterCallback(wDm.UnlockCipherTag, m.unlockCipherCB)
 }
 
 // newWASMEventModelCB is the callback for NewWASMEventModel. Returns an empty
@@ -60,7 +78,7 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 
 	// Create new encryption cipher
 	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
-	encryption, err := idbCrypto.NewCipherFromJSON(
+	encryption, err := impl.NewCipherFromJSON(
 		[]byte(msg.EncryptionJSON), rng.GetStream())
 	if err != nil {
 		reply([]byte(errors.Wrap(err,
@@ -68,13 +86,37 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 		return
 	}
 
-	m.model, err = NewWASMEventModel(
+	model, err := newWASMModel(
 		msg.DatabaseName, encryption, m.eventUpdateCallback)
 	if err != nil {
 		reply([]byte(err.Error()))
 		return
 	}
 
+	// The stored encryption status of databases created by older versions or
+	// with an interrupted migration cannot be trusted, so it is checked
+	// against the rows, with both ciphers if the migration is unfinished
+	if msg.ProbeEncryption {
+		err = impl.ProbeEncryption(model.db, model.cipher, encryptedStores)
+		if err != nil {
+			if closeErr := model.db.Close(); closeErr != nil {
+				jww.ERROR.Printf(
+					"[DM] Failed to close database: %+v", closeErr)
+			}
+			reply([]byte(errors.Wrap(err, "cannot load database with "+
+				"different encryption status").Error()))
+			return
+		}
+	}
+
+	// Stop the sweepers of the model being replaced
+	for _, stop := range m.stopSweepers {
+		stop()
+	}
+	m.model = model
+	m.stopSweepers = []func(){impl.StartSweeper(msg.DatabaseName,
+		impl.RetentionSweepInterval, m.model.PruneMessages)}
+
 	reply(nil)
 }
 
@@ -265,3 +307,321 @@ func (m *manager) getConversationsCB(_ []byte, reply func(message []byte)) {
 	}
 	reply(replyMessage)
 }
+
+// getConversationMessagesCB is the callback for
+// wasmModel.GetConversationMessages. Returns JSON marshalled
+// wDm.MessagesResult. If an error occurs, then Error will be set with the
+// error message.
+func (m *manager) getConversationMessagesCB(
+	message []byte, reply func(message []byte)) {
+	var result wDm.MessagesResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[DM] Could not JSON marshal %T for "+
+				"GetConversationMessages: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.GetConversationMessagesMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	result.Messages, err = m.model.GetConversationMessages(
+		msg.PartnerPubKey, msg.Before, msg.Limit)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// getMessageByIDCB is the callback for wasmModel.GetMessageByID. Returns JSON
+// marshalled wDm.GetMessageMessage. If an error occurs, then Error will be set
+// with the error message. Otherwise, Message will be set. Only one field will
+// be set.
+func (m *manager) getMessageByIDCB(
+	messageData []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetMessageMessage
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Could not JSON marshal %T for "+
+				"GetMessageByID: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	messageID, err := message.UnmarshalID(messageData)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to unmarshal %T from "+
+			"main thread: %+v", messageID, err).Error()
+		return
+	}
+
+	msg, err := m.model.GetMessageByID(messageID)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Message = msg
+	}
+}
+
+// searchMessagesCB is the callback for wasmModel.SearchMessages. Returns JSON
+// marshalled wDm.SearchMessagesResult. If an error occurs, then Error will be
+// set with the error message.
+func (m *manager) searchMessagesCB(message []byte, reply func(message []byte)) {
+	var result wDm.SearchMessagesResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[DM] Could not JSON marshal %T for "+
+				"SearchMessages: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.SearchMessagesMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	result.Messages, err = m.model.SearchMessages(
+		msg.Query, msg.PartnerPubKey, msg.Limit)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// setRetentionPolicyCB is the callback for wasmModel.SetRetentionPolicy.
+// Returns nothing on success or an error message on failure.
+func (m *manager) setRetentionPolicyCB(
+	messageData []byte, reply func(message []byte)) {
+	var msg wDm.SetRetentionPolicyMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	err = m.model.SetRetentionPolicy(msg.PartnerPubKey, msg.Policy)
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// rotateDatabaseKeyCB is the callback for wasmModel.RotateDatabaseKey. Returns
+// JSON marshalled wDm.RotateDatabaseKeyResult. If an error occurs, then Error
+// will be set with the error message.
+func (m *manager) rotateDatabaseKeyCB(
+	messageData []byte, reply func(message []byte)) {
+	var result wDm.RotateDatabaseKeyResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[DM] Could not JSON marshal %T for "+
+				"RotateDatabaseKey: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.RotateDatabaseKeyMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+	encryption, err := impl.NewCipherFromJSON(
+		[]byte(msg.EncryptionJSON), rng.GetStream())
+	if err != nil {
+		result.Error = errors.Wrap(err,
+			"failed to JSON unmarshal Cipher from main thread").Error()
+		return
+	}
+
+	result.Progress, err = m.model.RotateDatabaseKey(encryption, msg.Resume)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// importHistoryCB is the callback for wasmModel.ImportHistory. Returns JSON
+// marshalled wDm.ImportHistoryResult with the progress of the batch. If an
+// error occurs, then Error will be set with the error message.
+func (m *manager) importHistoryCB(
+	messageData []byte, reply func(message []byte)) {
+	var result wDm.ImportHistoryResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[DM] Could not JSON marshal %T for "+
+				"ImportHistory: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.ImportHistoryMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		result.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	result.Progress, err = m.model.ImportHistory(msg)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// markReadCB is the callback for wasmModel.MarkRead. Returns an empty slice on
+// success or an error message on failure.
+func (m *manager) markReadCB(messageData []byte, reply func(message []byte)) {
+	var msg wDm.MarkReadMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	if err = m.model.MarkRead(msg.PubKey, msg.UUID); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getUnreadCountsCB is the callback for wasmModel.GetUnreadCounts. Returns
+// JSON marshalled wDm.GetUnreadCountsResult. If an error occurs, then Error
+// will be set with the error message.
+func (m *manager) getUnreadCountsCB(_ []byte, reply func(message []byte)) {
+	var result wDm.GetUnreadCountsResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[DM] Could not JSON marshal %T for "+
+				"GetUnreadCounts: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var err error
+	result.UnreadCounts, err = m.model.GetUnreadCounts()
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// saveDraftCB is the callback for wasmModel.SaveDraft. Returns an empty slice
+// on success or an error message on failure.
+func (m *manager) saveDraftCB(messageData []byte, reply func(message []byte)) {
+	var msg wDm.SaveDraftMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	if err = m.model.SaveDraft(msg.PubKey, msg.Draft); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getDraftCB is the callback for wasmModel.GetDraft. Returns JSON marshalled
+// wDm.GetDraftResult. If an error occurs, then Error will be set with the
+// error message.
+func (m *manager) getDraftCB(messageData []byte, reply func(message []byte)) {
+	var result wDm.GetDraftResult
+	defer func() {
+		if replyMessage, err := json.Marshal(result); err != nil {
+			exception.Throwf("[DM] Could not JSON marshal %T for "+
+				"GetDraft: %+v", result, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var err error
+	result.Draft, err = m.model.GetDraft(messageData)
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// clearDraftCB is the callback for wasmModel.ClearDraft. Returns an empty
+// slice on success or an error message on failure.
+func (m *manager) clearDraftCB(messageData []byte, reply func(message []byte)) {
+	if err := m.model.ClearDraft(messageData); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// lockCipherCB is the callback for the session handler locking the worker.
+// Always returns an empty slice.
+func (m *manager) lockCipherCB(_ []byte, reply func(message []byte)) {
+	m.model.LockCipher()
+	reply(nil)
+}
+
+// unlockCipherCB is the callback for the session handler unlocking the worker.
+// Returns an empty slice on success or an error message on failure.
+func (m *manager) unlockCipherCB(
+	messageData []byte, reply func(message []byte)) {
+	var msg wDm.UnlockCipherMessage
+	err := json.Unmarshal(messageData, &msg)
+	if err != nil {
+		reply([]byte(errors.Wrapf(err,
+			"failed to JSON unmarshal %T from main thread", msg).Error()))
+		return
+	}
+
+	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+	encryption, err := impl.NewCipherFromJSON(
+		[]byte(msg.EncryptionJSON), rng.GetStream())
+	if err != nil {
+		reply([]byte(errors.Wrap(err,
+			"failed to JSON unmarshal Cipher from main thread").Error()))
+		return
+	}
+	var rotation idbCrypto.Cipher
+	if msg.Rotating {
+		rotation, err = impl.NewCipherFromJSON(
+			[]byte(msg.RotationJSON), rng.GetStream())
+		if err != nil {
+			reply([]byte(errors.Wrap(err,
+				"failed to JSON unmarshal Cipher from main thread").Error()))
+			return
+		}
+	}
+
+	err = m.model.UnlockCipher(
+		encryption, msg.Rotating, rotation, rng.GetStream())
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
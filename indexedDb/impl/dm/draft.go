@@ -0,0 +1,61 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"crypto/ed25519"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// SaveDraft stores the draft of the conversation with the partner, encrypted
+// with the cipher of the database, replacing any stored draft. A zero draft
+// clears the stored draft.
+func (w *wasmModel) SaveDraft(
+	partnerPubKey ed25519.PublicKey, draft impl.Draft) error {
+	parentErr := errors.New("[DM indexedDB] failed to SaveDraft")
+
+	if len(partnerPubKey) == 0 {
+		return errors.WithMessage(parentErr, "missing partner key")
+	}
+	err := impl.PutDraft(
+		w.db, w.cipher, partnerPubKey, draft, netTime.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+	return nil
+}
+
+// GetDraft returns the draft of the conversation with the partner. Returns a
+// zero draft if none is stored.
+func (w *wasmModel) GetDraft(
+	partnerPubKey ed25519.PublicKey) (impl.Draft, error) {
+	parentErr := errors.New("[DM indexedDB] failed to GetDraft")
+
+	draft, err := impl.GetDraft(w.db, w.cipher, partnerPubKey)
+	if err != nil {
+		return impl.Draft{}, errors.WithMessage(parentErr, err.Error())
+	}
+	return draft, nil
+}
+
+// ClearDraft removes the draft of the conversation with the partner, if one is
+// stored.
+func (w *wasmModel) ClearDraft(partnerPubKey ed25519.PublicKey) error {
+	parentErr := errors.New("[DM indexedDB] failed to ClearDraft")
+
+	if err := impl.DeleteDraft(w.db, partnerPubKey); err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+	return nil
+}
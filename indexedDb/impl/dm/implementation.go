@@ -28,10 +28,16 @@ import (
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/netTime"
 )
 
+// defaultMessageLimit is the number of messages returned by
+// wasmModel.GetConversationMessages and wasmModel.SearchMessages when no limit
+// is given.
+const defaultMessageLimit = 100
+
 // wasmModel implements dm.EventModel interface backed by IndexedDb.
 // NOTE: This model is NOT thread safe - it is the responsibility of the
 // caller to ensure that its methods are called sequentially.
@@ -39,6 +45,11 @@ type wasmModel struct {
 	db            *idb.Database
 	cipher        idbCrypto.Cipher
 	eventCallback eventUpdate
+	search        *impl.SearchIndex
+
+	// rotation is the unfinished key rotation started by RotateDatabaseKey.
+	// While it is set, cipher is its [impl.RotationCipher].
+	rotation *impl.KeyRotation
 }
 
 // upsertConversation is used for joining or updating a Conversation.
@@ -48,7 +59,7 @@ func (w *wasmModel) upsertConversation(nickname string,
 	parentErr := errors.New("[DM indexedDB] failed to upsertConversation")
 
 	// Build object
-	newConvo := Conversation{
+	newConvo := &Conversation{
 		Pubkey:           pubKey,
 		Nickname:         nickname,
 		Token:            partnerToken,
@@ -56,22 +67,18 @@ func (w *wasmModel) upsertConversation(nickname string,
 		BlockedTimestamp: blockedTimestamp,
 	}
 
-	// Convert to jsObject
-	newConvoJson, err := json.Marshal(&newConvo)
-	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to marshal Conversation: %+v", err)
-	}
-	convoObj, err := utils.JsonToJS(newConvoJson)
-	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to marshal Conversation: %+v", err)
+	// Keep the read marker of a stored Conversation
+	storedConvo, err := w.getConversation(pubKey)
+	if err == nil {
+		newConvo.LastReadUUID = storedConvo.LastReadUUID
+		newConvo.LastReadTimestamp = storedConvo.LastReadTimestamp
+		newConvo.UnreadCount = storedConvo.UnreadCount
+	} else if !strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+		return errors.WithMessage(parentErr, err.Error())
 	}
 
-	_, err = impl.Put(w.db, conversationStoreName, convoObj)
-	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to put Conversation: %+v", err)
+	if err = w.putConversation(newConvo); err != nil {
+		return errors.WithMessage(parentErr, err.Error())
 	}
 	return nil
 }
@@ -286,6 +293,7 @@ func (w *wasmModel) receiveWrapper(messageID message.ID, parentID *message.ID, n
 	}
 
 	// Handle encryption, if it is present
+	plaintext := data
 	if w.cipher != nil {
 		data, err = w.cipher.Encrypt([]byte(data))
 		if err != nil {
@@ -305,6 +313,9 @@ func (w *wasmModel) receiveWrapper(messageID message.ID, parentID *message.ID, n
 	if err != nil {
 		return 0, err
 	}
+	w.indexMessage(uuid, mType, plaintext)
+	msgToInsert.ID = uuid
+	w.messageStored(msgToInsert)
 
 	jww.TRACE.Printf("[DM indexedDB] Calling ReceiveMessageCB(%v, %v, f, %t)",
 		uuid, partnerKey, conversationUpdated)
@@ -416,6 +427,8 @@ func (w *wasmModel) DeleteMessage(messageID message.ID, senderPubKey ed25519.Pub
 		jww.ERROR.Printf("%s: %+v", parentErr, err)
 		return false
 	}
+	w.unindexMessage(msgObj)
+	w.messageRemoved(msgObj)
 
 	go w.eventCallback(bindings.DmMessageDeleted, bindings.DmMessageDeletedJSON{
 		MessageID: messageID,
@@ -447,13 +460,7 @@ func (w *wasmModel) getConversation(senderPubKey ed25519.PublicKey) (*Conversati
 	if err != nil {
 		return nil, err
 	}
-
-	resultConvo := &Conversation{}
-	err = json.Unmarshal([]byte(utils.JsToJson(resultObj)), resultConvo)
-	if err != nil {
-		return nil, err
-	}
-	return resultConvo, nil
+	return valueToConversation(resultObj)
 }
 
 // GetConversations returns any conversations held by the model (receiver).
@@ -485,6 +492,155 @@ func (w *wasmModel) GetConversations() []dm.ModelConversation {
 	return conversations
 }
 
+// GetConversationMessages returns up to limit messages in the conversation
+// with the partner, newest first, with their content decrypted. Messages are
+// ordered by the order in which they were stored. If before is set, only
+// messages stored before the message with that UUID are returned, so the UUID
+// of the last message of a page gets the next page. If limit is zero,
+// defaultMessageLimit is used.
+func (w *wasmModel) GetConversationMessages(partnerPubKey ed25519.PublicKey,
+	before uint64, limit int) ([]wDm.ModelMessage, error) {
+	parentErr := errors.New("failed to GetConversationMessages")
+
+	if limit <= 0 {
+		limit = defaultMessageLimit
+	}
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreConversationIndex)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	convoKey := impl.EncodeBytes(partnerPubKey)
+	keyRange, err := idb.NewKeyRangeOnly(convoKey)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorPrevious)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	results := make([]wDm.ModelMessage, 0, limit)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			// Skip to the message before the one the previous page ended on
+			if before != 0 {
+				primaryKey, err := cursor.PrimaryKey()
+				if err != nil {
+					return err
+				}
+				if uint64(primaryKey.Int()) >= before {
+					return cursor.ContinuePrimaryKey(
+						convoKey, js.ValueOf(before-1))
+				}
+			}
+
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return err
+			}
+			modelMsg, err := w.decryptModelMessage(msg)
+			if err != nil {
+				return err
+			}
+			results = append(results, modelMsg)
+			if len(results) == limit {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to read Message data: %+v", err)
+	}
+
+	return results, nil
+}
+
+// GetMessageByID returns the message with the given [message.ID] with its
+// content decrypted.
+func (w *wasmModel) GetMessageByID(
+	messageID message.ID) (wDm.ModelMessage, error) {
+	msgObj, err := impl.GetIndex(w.db, messageStoreName,
+		messageStoreMessageIndex, impl.EncodeBytes(messageID.Marshal()))
+	if err != nil {
+		return wDm.ModelMessage{}, err
+	}
+
+	msg, err := valueToMessage(msgObj)
+	if err != nil {
+		return wDm.ModelMessage{}, err
+	}
+
+	return w.decryptModelMessage(msg)
+}
+
+// decryptModelMessage converts the stored Message into a [wDm.ModelMessage]
+// and decrypts its content, if encryption is enabled.
+func (w *wasmModel) decryptModelMessage(
+	msg *Message) (wDm.ModelMessage, error) {
+	var err error
+	var messageID message.ID
+	if msg.MessageID != nil {
+		messageID, err = message.UnmarshalID(msg.MessageID)
+		if err != nil {
+			return wDm.ModelMessage{}, err
+		}
+	}
+
+	var parentMsgID message.ID
+	if msg.ParentMessageID != nil {
+		parentMsgID, err = message.UnmarshalID(msg.ParentMessageID)
+		if err != nil {
+			return wDm.ModelMessage{}, err
+		}
+	}
+
+	content := []byte(msg.Text)
+	if w.cipher != nil {
+		content, err = w.cipher.Decrypt(msg.Text)
+		if err != nil {
+			return wDm.ModelMessage{}, errors.Wrapf(err,
+				"failed to decrypt message %d", msg.ID)
+		}
+	}
+
+	return wDm.ModelMessage{
+		UUID:               msg.ID,
+		MessageID:          messageID,
+		ConversationPubKey: msg.ConversationPubKey,
+		ParentMessageID:    parentMsgID,
+		Timestamp:          msg.Timestamp,
+		SenderPubKey:       msg.SenderPubKey,
+		CodesetVersion:     msg.CodesetVersion,
+		Status:             dm.Status(msg.Status),
+		Content:            content,
+		Type:               dm.MessageType(msg.Type),
+		Round:              id.Round(msg.Round),
+	}, nil
+}
+
 // valueToMessage is a helper for converting js.Value to Message.
 func valueToMessage(msgObj js.Value) (*Message, error) {
 	resultMsg := &Message{}
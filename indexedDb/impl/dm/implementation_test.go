@@ -20,6 +20,7 @@ import (
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
 	"gitlab.com/xx_network/primitives/id"
 	"os"
 	"syscall/js"
@@ -190,3 +191,209 @@ func TestWasmModel_DeleteMessage(t *testing.T) {
 	// Correct pub key, should have deleted
 	require.True(t, m.DeleteMessage(testMsgId, testBytes))
 }
+
+// Tests that wasmModel.GetConversationMessages pages through the messages of
+// a single conversation, newest first, and that wasmModel.GetMessageByID
+// returns a single message.
+func TestWasmModel_GetConversationMessages(t *testing.T) {
+	m, err := newWASMModel(
+		"TestWasmModel_GetConversationMessages", nil, dummyEU)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	partnerA := ed25519.PublicKey("partnerA")
+	partnerB := ed25519.PublicKey("partnerB")
+
+	// Receive interleaved messages from two partners
+	var expected []string
+	var msgIDs []message.ID
+	for i := 0; i < 7; i++ {
+		text := fmt.Sprintf("message%d", i)
+		partner := partnerA
+		if i%2 == 1 {
+			partner = partnerB
+		} else {
+			expected = append([]string{text}, expected...)
+		}
+		msgID := message.DeriveChannelMessageID(
+			&id.ID{byte(i)}, uint64(i), []byte(text))
+		msgIDs = append(msgIDs, msgID)
+		uuid := m.ReceiveText(msgID, "nickname", text, partner, partner, 0, 0,
+			time.Now(), rounds.Round{ID: id.Round(i)}, dm.Received)
+		require.NotZero(t, uuid)
+	}
+
+	// Page through partner A's conversation two messages at a time
+	var received []string
+	var before uint64
+	for pages := 0; ; pages++ {
+		require.LessOrEqual(t, pages, len(expected), "Too many pages returned.")
+		msgs, err := m.GetConversationMessages(partnerA, before, 2)
+		require.NoError(t, err)
+		for _, msg := range msgs {
+			require.Equal(t, partnerA, msg.ConversationPubKey)
+			received = append(received, string(msg.Content))
+		}
+		if len(msgs) < 2 {
+			break
+		}
+		before = msgs[len(msgs)-1].UUID
+	}
+	require.Equal(t, expected, received)
+
+	msg, err := m.GetMessageByID(msgIDs[3])
+	require.NoError(t, err)
+	require.Equal(t, "message3", string(msg.Content))
+	require.Equal(t, msgIDs[3], msg.MessageID)
+	require.Equal(t, dm.TextType, msg.Type)
+
+	_, err = m.GetMessageByID(message.ID{})
+	require.Error(t, err)
+}
+
+// Tests that wasmModel.ImportHistory stores the messages of an archived
+// conversation with their original status, creates the conversation, and skips
+// duplicates and messages stored in another conversation.
+func TestWasmModel_ImportHistory(t *testing.T) {
+	m, err := newWASMModel("TestWasmModel_ImportHistory", nil, dummyEU)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	partner := ed25519.PublicKey("partnerA")
+	msgIDs := make([]message.ID, 2)
+	for i := range msgIDs {
+		msgIDs[i] = message.DeriveChannelMessageID(
+			&id.ID{byte(i)}, uint64(i), []byte("import"))
+	}
+	msg := wDm.ImportHistoryMessage{
+		Conversation: wDm.ExportedConversation{
+			PubKey: partner, Nickname: "alice"},
+		Messages: []wDm.ExportedMessage{
+			{MessageID: msgIDs[0], Type: dm.TextType, SenderPubKey: partner,
+				Timestamp: time.Now(), Status: dm.Received, Text: "Hello"},
+			{MessageID: msgIDs[1], ReplyTo: &msgIDs[0], Type: dm.ReactionType,
+				SenderPubKey: partner, Timestamp: time.Now(),
+				Status: dm.Failed, Text: "👍"},
+		},
+	}
+
+	progress, err := m.ImportHistory(msg)
+	require.NoError(t, err)
+	require.Equal(t, impl.ImportProgress{Processed: 2, Imported: 2}, progress)
+
+	convo := m.GetConversation(partner)
+	require.NotNil(t, convo)
+	require.Equal(t, "alice", convo.Nickname)
+
+	stored, err := m.GetMessageByID(msgIDs[1])
+	require.NoError(t, err)
+	require.Equal(t, dm.Failed, stored.Status)
+	require.Equal(t, msgIDs[0], stored.ParentMessageID)
+
+	// Importing again skips every message
+	progress, err = m.ImportHistory(msg)
+	require.NoError(t, err)
+	require.Equal(t, impl.ImportProgress{Processed: 2, Duplicates: 2}, progress)
+
+	// A message stored in another conversation is a conflict
+	msg.Conversation.PubKey = ed25519.PublicKey("partnerB")
+	progress, err = m.ImportHistory(msg)
+	require.NoError(t, err)
+	require.Equal(t, 2, progress.Conflicts)
+	require.Equal(t, impl.ImportConflictOtherChat,
+		progress.ConflictDetails[0].Reason)
+}
+
+// Tests that wasmModel.MarkRead moves the read marker of a conversation and
+// that the unread count is kept up to date as messages are received and
+// deleted.
+func TestWasmModel_MarkRead(t *testing.T) {
+	m, err := newWASMModel("TestWasmModel_MarkRead", nil, dummyEU)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	partner, self := ed25519.PublicKey("partner"), ed25519.PublicKey("self")
+	unreadCount := func() wDm.UnreadCount {
+		counts, err := m.GetUnreadCounts()
+		require.NoError(t, err)
+		require.Len(t, counts, 1)
+		require.Equal(t, partner, counts[0].PubKey)
+		return counts[0]
+	}
+
+	// Every message from the partner except for reactions is unread
+	msgIDs := make([]message.ID, 4)
+	uuids := make([]uint64, len(msgIDs))
+	for i := range msgIDs {
+		msgIDs[i] = message.DeriveChannelMessageID(
+			&id.ID{1}, uint64(i), []byte("TestWasmModel_MarkRead"))
+		mType := dm.TextType
+		if i == len(msgIDs)-1 {
+			mType = dm.ReactionType
+		}
+		uuids[i] = m.Receive(msgIDs[i], "alice", []byte("hello"), partner,
+			partner, 0, 0,
+			time.Now().Add(time.Duration(i-len(msgIDs))*time.Minute),
+			rounds.Round{ID: 42}, mType, dm.Received)
+	}
+	require.Equal(t, 3, unreadCount().UnreadCount)
+
+	require.NoError(t, m.MarkRead(partner, uuids[0]))
+	count := unreadCount()
+	require.Equal(t, 2, count.UnreadCount)
+	require.Equal(t, uuids[0], count.LastReadUUID)
+
+	require.True(t, m.DeleteMessage(msgIDs[2], partner))
+	require.Equal(t, 1, unreadCount().UnreadCount)
+
+	// A message sent by the user marks the conversation as read and is never
+	// unread
+	sentID := message.DeriveChannelMessageID(&id.ID{2}, 0, []byte("sent"))
+	sentUUID := m.Receive(sentID, "bob", []byte("hi"), partner, self, 0, 0,
+		time.Now(), rounds.Round{ID: 42}, dm.TextType, dm.Sent)
+	count = unreadCount()
+	require.Zero(t, count.UnreadCount)
+	require.Equal(t, sentUUID, count.LastReadUUID)
+
+	// Moving the marker back marks the messages as unread again
+	require.NoError(t, m.MarkRead(partner, uuids[0]))
+	require.Equal(t, 1, unreadCount().UnreadCount)
+	require.NoError(t, m.MarkRead(partner, 0))
+	require.Zero(t, unreadCount().UnreadCount)
+
+	require.Error(t, m.MarkRead(ed25519.PublicKey("unknown"), 0))
+}
+
+// Tests that wasmModel.SaveDraft stores a draft that is returned by
+// wasmModel.GetDraft and removed by wasmModel.ClearDraft.
+func TestWasmModel_SaveDraft(t *testing.T) {
+	m, err := newWASMModel("TestWasmModel_SaveDraft", nil, dummyEU)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	partner := ed25519.PublicKey("partner")
+	draft := impl.Draft{Text: "See you", ReplyTo: []byte{1, 2, 3}}
+	require.NoError(t, m.SaveDraft(partner, draft))
+
+	stored, err := m.GetDraft(partner)
+	require.NoError(t, err)
+	require.False(t, stored.Updated.IsZero())
+	stored.Updated = time.Time{}
+	require.Equal(t, draft, stored)
+
+	// A zero draft clears the stored draft
+	require.NoError(t, m.SaveDraft(partner, impl.Draft{}))
+	stored, err = m.GetDraft(partner)
+	require.NoError(t, err)
+	require.True(t, stored.IsZero())
+
+	require.NoError(t, m.SaveDraft(partner, draft))
+	require.NoError(t, m.ClearDraft(partner))
+	stored, err = m.GetDraft(partner)
+	require.NoError(t, err)
+	require.True(t, stored.IsZero())
+}
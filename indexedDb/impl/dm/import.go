@@ -0,0 +1,213 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// ImportHistory stores a batch of messages of an imported conversation history
+// in a single transaction, encrypted with the cipher of the database. The
+// original timestamps and statuses are kept. The conversation is created if it
+// is not stored, with every imported message marked as read; otherwise, its
+// unread messages are counted again.
+//
+// A message with the same message ID as a stored message in the same
+// conversation is a duplicate and is skipped. One stored in another
+// conversation is skipped as a conflict. No events are sent for imported
+// messages.
+func (w *wasmModel) ImportHistory(
+	msg wDm.ImportHistoryMessage) (impl.ImportProgress, error) {
+	parentErr := errors.New("[DM indexedDB] failed to ImportHistory")
+	progress := impl.ImportProgress{Processed: len(msg.Messages)}
+	partnerKey := msg.Conversation.PubKey
+
+	if len(partnerKey) == 0 {
+		return progress, errors.WithMessage(parentErr, "missing partner key")
+	}
+	_, err := w.getConversation(partnerKey)
+	if err != nil {
+		if !strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return progress, errors.WithMessage(parentErr, err.Error())
+		}
+
+		// Imported messages of a new conversation are read
+		err = w.putConversation(&Conversation{
+			Pubkey:            partnerKey,
+			Nickname:          msg.Conversation.Nickname,
+			Token:             msg.Conversation.Token,
+			CodesetVersion:    msg.Conversation.CodesetVersion,
+			LastReadTimestamp: netTime.Now().UTC(),
+		})
+		if err != nil {
+			return progress, errors.WithMessage(parentErr, err.Error())
+		}
+	}
+
+	msgs := make([]*Message, 0, len(msg.Messages))
+	plaintexts := make([]string, 0, len(msg.Messages))
+	for _, exported := range msg.Messages {
+		if exported.MessageID == (message.ID{}) {
+			progress.AddConflict(
+				exported.MessageID.Bytes(), impl.ImportConflictInvalid)
+			continue
+		}
+
+		// Handle encryption, if it is present
+		text := exported.Text
+		if w.cipher != nil {
+			text, err = w.cipher.Encrypt([]byte(exported.Text))
+			if err != nil {
+				return progress, errors.WithMessagef(parentErr,
+					"Failed to encrypt Message: %+v", err)
+			}
+		}
+
+		var parentID []byte
+		if exported.ReplyTo != nil {
+			parentID = exported.ReplyTo.Marshal()
+		}
+
+		msgs = append(msgs, buildMessage(exported.MessageID.Bytes(), parentID,
+			text, partnerKey, exported.SenderPubKey, exported.Timestamp,
+			exported.Round, exported.Type, exported.CodesetVersion,
+			exported.Status))
+		plaintexts = append(plaintexts, exported.Text)
+	}
+
+	uuids, err := w.importMessages(partnerKey, msgs, &progress)
+	if err != nil {
+		return progress, errors.WithMessage(parentErr, err.Error())
+	}
+
+	texts := make(map[uint64]string, len(msgs))
+	imported := false
+	for i, uuid := range uuids {
+		imported = imported || uuid != 0
+		if uuid != 0 && dm.MessageType(msgs[i].Type) != dm.ReactionType {
+			texts[uuid] = plaintexts[i]
+		}
+	}
+	if err = w.search.IndexAll(texts); err != nil {
+		jww.ERROR.Printf("[DM indexedDB] Failed to index %d messages: %+v",
+			len(texts), err)
+	}
+	if imported {
+		w.recountUnread(partnerKey)
+	}
+
+	return progress, nil
+}
+
+// importMessages stores the messages in the conversation in a single
+// transaction. Messages that are already stored are counted as duplicates or
+// conflicts in the progress. Returns the UUID of each message, which is 0 for
+// messages that were not stored.
+func (w *wasmModel) importMessages(partnerKey []byte, msgs []*Message,
+	progress *impl.ImportProgress) ([]uint64, error) {
+	uuids := make([]uint64, len(msgs))
+	if len(msgs) == 0 {
+		return uuids, nil
+	}
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadWrite, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreMessageIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	abort := func(err error) ([]uint64, error) {
+		// Do not commit the messages already put
+		if abortErr := txn.Abort(); abortErr != nil {
+			jww.ERROR.Printf(
+				"[DM indexedDB] Failed to abort Transaction: %+v", abortErr)
+		}
+		return nil, err
+	}
+
+	var batch impl.ImportProgress
+	for i, msg := range msgs {
+		getRequest, err := index.Get(impl.EncodeBytes(msg.MessageID))
+		if err != nil {
+			return abort(errors.Errorf("Unable to Get from Index: %+v", err))
+		}
+		currentObj, err := impl.SendRequest(getRequest)
+		if err != nil {
+			return abort(errors.Errorf("Unable to Get from Index: %+v", err))
+		}
+
+		if !currentObj.IsUndefined() && !currentObj.IsNull() {
+			currentMsg, err := valueToMessage(currentObj)
+			if err != nil {
+				return abort(errors.Errorf(
+					"Unable to unmarshal stored Message: %+v", err))
+			}
+			if bytes.Equal(currentMsg.ConversationPubKey, partnerKey) {
+				batch.Duplicates++
+			} else {
+				batch.AddConflict(msg.MessageID, impl.ImportConflictOtherChat)
+			}
+			continue
+		}
+
+		msgJson, err := json.Marshal(msg)
+		if err != nil {
+			return abort(errors.Errorf("Unable to marshal Message: %+v", err))
+		}
+		msgObj, err := utils.JsonToJS(msgJson)
+		if err != nil {
+			return abort(errors.Errorf("Unable to marshal Message: %+v", err))
+		}
+		putRequest, err := store.Put(msgObj)
+		if err != nil {
+			return abort(errors.Errorf("Unable to Put Message: %+v", err))
+		}
+		key, err := impl.SendRequest(putRequest)
+		if err != nil {
+			return abort(errors.Errorf("Unable to Put Message: %+v", err))
+		}
+		uuids[i] = uint64(key.Int())
+		batch.Imported++
+	}
+
+	// Wait for the writes to be committed
+	ctx, cancel := impl.NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return nil, errors.Errorf("Storing Messages failed: %+v", err)
+	}
+
+	progress.Add(batch)
+
+	jww.DEBUG.Printf(
+		"[DM indexedDB] Successfully imported %d messages", batch.Imported)
+	return uuids, nil
+}
@@ -13,16 +13,18 @@ import (
 	"syscall/js"
 
 	"github.com/hack-pad/go-indexeddb/idb"
-	jww "github.com/spf13/jwalterweatherman"
 
 	"gitlab.com/elixxir/client/v4/dm"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/netTime"
 )
 
 // currentVersion is the current version of the IndexedDb runtime. Used for
 // migration purposes.
-const currentVersion uint = 1
+const currentVersion = wDm.DatabaseVersion
 
 // eventUpdate takes an event type and JSON object from bindings/dm.go.
 type eventUpdate func(eventType int64, jsonMarshallable any)
@@ -35,51 +37,54 @@ func NewWASMEventModel(databaseName string, encryption idbCrypto.Cipher,
 	return newWASMModel(databaseName, encryption, eventCallback)
 }
 
+// migrations is the schema history of the database. The last migration must
+// be for currentVersion.
+var migrations = impl.Migrations{
+	{Version: 1, Upgrade: v1Upgrade},
+	{Version: 2, Upgrade: v2Upgrade},
+	{Version: 3, Upgrade: v3Upgrade},
+	{Version: 4, Upgrade: v4Upgrade},
+	{Version: 5, Upgrade: v5Upgrade, Backfill: v5Backfill},
+	{Version: 6, Upgrade: v6Upgrade},
+}
+
 // newWASMModel creates the given [idb.Database] and returns a wasmModel.
 func newWASMModel(databaseName string, encryption idbCrypto.Cipher,
 	eventCallback eventUpdate) (*wasmModel, error) {
-	// Attempt to open database object
-	ctx, cancel := impl.NewContext()
-	defer cancel()
-	openRequest, err := idb.Global().Open(ctx, databaseName, currentVersion,
-		func(db *idb.Database, oldVersion, newVersion uint) error {
-			if oldVersion == newVersion {
-				jww.INFO.Printf("IndexDb version for %s is current: v%d",
-					databaseName, newVersion)
-				return nil
-			}
-
-			jww.INFO.Printf("IndexDb upgrade required for %s: v%d -> v%d",
-				databaseName, oldVersion, newVersion)
-
-			if oldVersion == 0 && newVersion >= 1 {
-				err := v1Upgrade(db)
-				if err != nil {
-					return err
-				}
-				oldVersion = 1
-			}
-
-			// if oldVersion == 1 && newVersion >= 2 { v2Upgrade(), oldVersion = 2 }
-			return nil
-		})
+	db, err := impl.OpenDatabase(databaseName, currentVersion, migrations)
 	if err != nil {
 		return nil, err
 	}
 
-	// Wait for database open to finish
-	db, err := openRequest.Await(ctx)
+	// A database with an unfinished key rotation reads with both ciphers
+	cipher, err := impl.OpenCipher(db, encryption, csprng.NewSystemRNG())
+	if err != nil {
+		return nil, err
+	}
+
+	// The search index is keyed on the old cipher until the rotation is done
+	searchCipher := cipher
+	if rc, ok := cipher.(*impl.RotationCipher); ok {
+		searchCipher = rc.From()
+	}
+	search, err := impl.NewSearchIndex(db, searchCipher)
 	if err != nil {
 		return nil, err
-	} else if ctx.Err() != nil {
-		return nil, ctx.Err()
 	}
 
 	wrapper := &wasmModel{
 		db:            db,
-		cipher:        encryption,
+		cipher:        cipher,
 		eventCallback: eventCallback,
+		search:        search,
+	}
+
+	// Index messages stored before the search index was added
+	err = search.Backfill(messageStoreName, wrapper.searchText)
+	if err != nil {
+		return nil, err
 	}
+
 	return wrapper, nil
 }
 
@@ -87,7 +92,7 @@ func newWASMModel(databaseName string, encryption idbCrypto.Cipher,
 //
 // This can never be changed without permanently breaking backwards
 // compatibility.
-func v1Upgrade(db *idb.Database) error {
+func v1Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
 	indexOpts := idb.IndexOptions{
 		Unique:     false,
 		MultiEntry: false,
@@ -134,3 +139,58 @@ func v1Upgrade(db *idb.Database) error {
 
 	return nil
 }
+
+// v2Upgrade performs the v1 -> v2 database upgrade, which adds the search
+// index.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v2Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateSearchStore(db)
+}
+
+// v3Upgrade performs the v2 -> v3 database upgrade, which adds the retention
+// policy store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v3Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateRetentionStore(db)
+}
+
+// v4Upgrade performs the v3 -> v4 database upgrade, which adds the key
+// rotation store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v4Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateKeyRotationStore(db)
+}
+
+// v5Upgrade performs the v4 -> v5 database upgrade, which adds the read marker
+// to each conversation. The schema is unchanged; the marker is set by
+// v5Backfill.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v5Upgrade(*idb.Database, *impl.UpgradeTransaction) error {
+	return nil
+}
+
+// v5Backfill marks every message stored before v5 as read, so that the unread
+// count of each conversation starts at zero.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v5Backfill(db *idb.Database) error {
+	return impl.MarkAllRead(db, conversationStoreName, netTime.Now())
+}
+
+// v6Upgrade performs the v5 -> v6 database upgrade, which adds the draft
+// store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v6Upgrade(db *idb.Database, _ *impl.UpgradeTransaction) error {
+	return impl.CreateDraftStore(db)
+}
@@ -60,4 +60,14 @@ type Conversation struct {
 	Token            uint32     `json:"token"`
 	CodesetVersion   uint8      `json:"codeset_version"`
 	BlockedTimestamp *time.Time `json:"blocked_timestamp"`
+
+	// LastReadUUID is the UUID of the message the conversation is marked as
+	// read up to, or 0 if it is marked as read up to LastReadTimestamp.
+	LastReadUUID uint64 `json:"last_read_uuid"`
+
+	// LastReadTimestamp is the time up to which messages are read.
+	LastReadTimestamp time.Time `json:"last_read_timestamp"`
+
+	// UnreadCount is the number of unread messages from the partner.
+	UnreadCount int `json:"unread_count"`
 }
@@ -0,0 +1,123 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"crypto/ed25519"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// SetRetentionPolicy stores the retention policy of the conversation with the
+// partner and deletes the messages that it does not keep. A zero policy keeps
+// every message. DMs cannot be pinned, so PinnedOnly deletes every message.
+func (w *wasmModel) SetRetentionPolicy(
+	partnerPubKey ed25519.PublicKey, policy impl.RetentionPolicy) error {
+	parentErr := errors.New("[DM indexedDB] failed to SetRetentionPolicy")
+
+	if err := policy.Validate(); err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	err := impl.PutRetentionPolicy(w.db, partnerPubKey, policy)
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	if !policy.IsZero() {
+		err = w.pruneConversation(partnerPubKey, policy, netTime.Now())
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+	}
+	return nil
+}
+
+// PruneMessages deletes the messages of every conversation that its retention
+// policy does not keep.
+func (w *wasmModel) PruneMessages() error {
+	parentErr := errors.New("[DM indexedDB] failed to PruneMessages")
+
+	rules, err := impl.GetRetentionRules(w.db)
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	now := netTime.Now()
+	for _, rule := range rules {
+		err = w.pruneConversation(rule.ID, rule.RetentionPolicy, now)
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+	}
+	return nil
+}
+
+// pruneConversation deletes the messages of the conversation that the policy
+// does not keep, newest first, using messageStoreConversationIndex.
+func (w *wasmModel) pruneConversation(partnerPubKey ed25519.PublicKey,
+	policy impl.RetentionPolicy, now time.Time) error {
+	keyRange, err := idb.NewKeyRangeOnly(impl.EncodeBytes(partnerPubKey))
+	if err != nil {
+		return errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+
+	keep := policy.Keeper(now)
+	n, err := impl.PruneIndex(w.db, messageStoreName,
+		messageStoreConversationIndex, keyRange,
+		func(value js.Value) (bool, error) {
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return false, err
+			}
+			return keep(msg.Timestamp, false), nil
+		}, w.messagePruned)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		jww.INFO.Printf("[DM indexedDB] Pruned %d messages from "+
+			"conversation %X", n, partnerPubKey)
+	}
+	return nil
+}
+
+// messagePruned removes the deleted message from the search index and the
+// unread count and notifies the UI that it was deleted.
+func (w *wasmModel) messagePruned(value js.Value) {
+	msg, err := valueToMessage(value)
+	if err != nil {
+		jww.ERROR.Printf(
+			"[DM indexedDB] Failed to unmarshal pruned Message: %+v", err)
+		return
+	}
+	w.unindexMessage(msg)
+	w.messageRemoved(msg)
+
+	messageID, err := message.UnmarshalID(msg.MessageID)
+	if err != nil {
+		jww.ERROR.Printf("[DM indexedDB] Invalid ID of pruned Message %d: "+
+			"%+v", msg.ID, err)
+		return
+	}
+	go w.eventCallback(bindings.DmMessageDeleted, bindings.DmMessageDeletedJSON{
+		MessageID: messageID,
+	})
+}
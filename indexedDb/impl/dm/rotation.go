@@ -0,0 +1,133 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+)
+
+// encryptedStores are the object stores with fields encrypted by the database
+// cipher. The fields must match the json struct tags.
+var encryptedStores = []impl.EncryptedStore{
+	{Name: messageStoreName, Fields: []string{"text"}},
+	{Name: impl.DraftStoreName, Fields: []string{"text"}},
+}
+
+// RotateDatabaseKey re-encrypts the next batch of messages with the new cipher
+// and returns the progress of the rotation. It must be called until the
+// progress is done; until then, messages are read and written with an
+// [impl.RotationCipher]. An unfinished rotation from an earlier session is
+// resumed if the cipher is the same. If resume is true, returns an error if
+// there is no unfinished rotation.
+func (w *wasmModel) RotateDatabaseKey(encryption idbCrypto.Cipher,
+	resume bool) (impl.KeyRotationProgress, error) {
+	parentErr := errors.New("failed to RotateDatabaseKey")
+
+	if w.rotation == nil {
+		if resume {
+			if pending, err := impl.HasKeyRotation(w.db); err != nil {
+				return impl.KeyRotationProgress{},
+					errors.WithMessage(parentErr, err.Error())
+			} else if !pending {
+				return impl.KeyRotationProgress{}, errors.WithMessage(
+					parentErr, "there is no unfinished key rotation")
+			}
+		}
+		rotation, err := impl.NewKeyRotation(
+			w.db, w.cipher, encryption, encryptedStores)
+		if err != nil {
+			return impl.KeyRotationProgress{},
+				errors.WithMessage(parentErr, err.Error())
+		}
+		w.rotation = rotation
+		w.cipher = rotation.Cipher()
+	} else if !w.rotation.Matches(encryption) {
+		return impl.KeyRotationProgress{}, errors.WithMessage(parentErr,
+			"a key rotation to a different key is in progress")
+	}
+
+	progress, err := w.rotation.Next()
+	if err != nil {
+		return impl.KeyRotationProgress{},
+			errors.WithMessage(parentErr, err.Error())
+	}
+
+	if progress.Done {
+		w.cipher = encryption
+		w.rotation = nil
+
+		// The search index was cleared since its tokens are keyed on the old
+		// cipher
+		w.search, err = impl.NewSearchIndex(w.db, encryption)
+		if err != nil {
+			return progress, errors.WithMessage(parentErr, err.Error())
+		}
+		err = w.search.Backfill(messageStoreName, w.searchText)
+		if err != nil {
+			return progress, errors.WithMessage(parentErr, err.Error())
+		}
+
+		jww.INFO.Printf("[DM indexedDB] Rotated the key of the database")
+	}
+
+	return progress, nil
+}
+
+// LockCipher drops the cipher of the database, and of any unfinished key
+// rotation, when the session is locked. Until UnlockCipher is called, reading
+// or writing encrypted text returns an error. Does nothing if the database is
+// not encrypted.
+func (w *wasmModel) LockCipher() {
+	if w.cipher == nil {
+		return
+	}
+	w.cipher = impl.LockedCipher{}
+	w.rotation = nil
+}
+
+// UnlockCipher sets the cipher of the database when the session is unlocked.
+// If rotating, the unfinished key rotation to the rotation cipher is resumed.
+func (w *wasmModel) UnlockCipher(encryption idbCrypto.Cipher, rotating bool,
+	rotation idbCrypto.Cipher, csprng io.Reader) error {
+	if !rotating {
+		// A database opened during an unfinished rotation reads with both
+		// ciphers
+		cipher, err := impl.OpenCipher(w.db, encryption, csprng)
+		if err != nil {
+			return errors.Wrap(err, "failed to unlock cipher")
+		}
+		w.cipher = cipher
+		return nil
+	}
+
+	// A database opened with the new cipher during an unfinished rotation
+	// reads with the old cipher stored by the rotation
+	from := encryption
+	if rotation != nil {
+		cipher, err := impl.OpenCipher(w.db, rotation, csprng)
+		if rc, ok := cipher.(*impl.RotationCipher); err == nil && ok {
+			from = rc
+		}
+	}
+
+	kr, err := impl.NewKeyRotation(w.db, from, rotation, encryptedStores)
+	if err != nil {
+		return errors.Wrap(err, "failed to resume key rotation")
+	}
+	w.rotation = kr
+	w.cipher = kr.Cipher()
+	return nil
+}
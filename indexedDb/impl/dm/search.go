@@ -0,0 +1,133 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+	"syscall/js"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+)
+
+// SearchMessages returns the messages containing every term in the query,
+// newest first, with their content decrypted. If partnerPubKey is set, only
+// messages in the conversation with that partner are returned. At most limit
+// messages are returned; if limit is zero, defaultMessageLimit is used.
+func (w *wasmModel) SearchMessages(query string,
+	partnerPubKey ed25519.PublicKey, limit int) ([]wDm.ModelMessage, error) {
+	parentErr := errors.New("failed to SearchMessages")
+
+	if limit <= 0 {
+		limit = defaultMessageLimit
+	}
+
+	uuids, err := w.search.Search(query)
+	if err != nil {
+		return nil, errors.WithMessage(parentErr, err.Error())
+	}
+
+	results := make([]wDm.ModelMessage, 0, len(uuids))
+	for _, uuid := range uuids {
+		if len(results) == limit {
+			break
+		}
+
+		msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+		if err != nil {
+			// The message was deleted after it was indexed
+			if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+				continue
+			}
+			return nil, errors.WithMessage(parentErr, err.Error())
+		}
+		msg, err := valueToMessage(msgObj)
+		if err != nil {
+			return nil, errors.WithMessage(parentErr, err.Error())
+		}
+		if partnerPubKey != nil &&
+			!bytes.Equal(msg.ConversationPubKey, partnerPubKey) {
+			continue
+		}
+
+		modelMsg, err := w.decryptModelMessage(msg)
+		if err != nil {
+			return nil, errors.WithMessage(parentErr, err.Error())
+		}
+		results = append(results, modelMsg)
+	}
+
+	return results, nil
+}
+
+// indexMessage adds the plaintext of the message to the search index.
+// Reactions are not indexed. Errors are logged since they do not affect the
+// stored message.
+func (w *wasmModel) indexMessage(
+	uuid uint64, mType dm.MessageType, plaintext string) {
+	if mType == dm.ReactionType {
+		return
+	}
+	if err := w.search.Index(uuid, plaintext); err != nil {
+		jww.ERROR.Printf("[DM indexedDB] Failed to index Message %d: %+v",
+			uuid, err)
+	}
+}
+
+// unindexMessage removes the stored message from the search index. Errors are
+// logged since they do not affect the deletion of the message.
+func (w *wasmModel) unindexMessage(msg *Message) {
+	uuid, plaintext, ok, err := w.messageText(msg)
+	if err != nil {
+		jww.ERROR.Printf("[DM indexedDB] Failed to unindex Message %d: %+v",
+			msg.ID, err)
+	} else if ok {
+		if err = w.search.Unindex(uuid, plaintext); err != nil {
+			jww.ERROR.Printf("[DM indexedDB] Failed to unindex "+
+				"Message %d: %+v", uuid, err)
+		}
+	}
+}
+
+// searchText returns the UUID and plaintext of the stored message for
+// [impl.SearchIndex.Backfill]. Returns false for messages that are not
+// indexed.
+func (w *wasmModel) searchText(value js.Value) (uint64, string, bool, error) {
+	msg, err := valueToMessage(value)
+	if err != nil {
+		return 0, "", false, err
+	}
+	return w.messageText(msg)
+}
+
+// messageText returns the UUID and plaintext of the message. Returns false for
+// messages that are not indexed.
+func (w *wasmModel) messageText(msg *Message) (uint64, string, bool, error) {
+	if dm.MessageType(msg.Type) == dm.ReactionType {
+		return 0, "", false, nil
+	}
+
+	if w.cipher == nil {
+		return msg.ID, msg.Text, true, nil
+	}
+
+	plaintext, err := w.cipher.Decrypt(msg.Text)
+	if err != nil {
+		return 0, "", false, errors.Wrapf(err,
+			"failed to decrypt message %d", msg.ID)
+	}
+	return msg.ID, string(plaintext), true, nil
+}
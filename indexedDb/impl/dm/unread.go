@@ -0,0 +1,281 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// MarkRead moves the read marker of the conversation with the partner to the
+// message with the UUID and recounts the unread messages. If the UUID is 0,
+// every message with a timestamp up to now is marked as read. The marker can
+// be moved backwards to mark messages as unread again.
+func (w *wasmModel) MarkRead(
+	partnerPubKey ed25519.PublicKey, uuid uint64) error {
+	parentErr := errors.New("[DM indexedDB] failed to MarkRead")
+
+	if len(partnerPubKey) == 0 {
+		return errors.WithMessage(parentErr, "missing partner key")
+	}
+
+	timestamp := netTime.Now().UTC()
+	if uuid != 0 {
+		msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+		msg, err := valueToMessage(msgObj)
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		} else if !bytes.Equal(msg.ConversationPubKey, partnerPubKey) {
+			return errors.WithMessagef(parentErr,
+				"message %d is not in conversation %X", uuid, partnerPubKey)
+		}
+		timestamp = msg.Timestamp
+	}
+
+	convo, _, err := w.updateConversation(partnerPubKey,
+		func(txn *idb.Transaction, convo *Conversation) (bool, error) {
+			convo.LastReadUUID = uuid
+			convo.LastReadTimestamp = timestamp
+			count, err := w.countUnread(txn, convo)
+			convo.UnreadCount = count
+			return err == nil, err
+		})
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	w.unreadCountChanged(convo)
+	return nil
+}
+
+// GetUnreadCounts returns the read marker and the number of unread messages of
+// every stored conversation.
+func (w *wasmModel) GetUnreadCounts() ([]wDm.UnreadCount, error) {
+	parentErr := errors.New("[DM indexedDB] failed to GetUnreadCounts")
+
+	values, err := impl.GetAll(w.db, conversationStoreName)
+	if err != nil {
+		return nil, errors.WithMessage(parentErr, err.Error())
+	}
+
+	counts := make([]wDm.UnreadCount, 0, len(values))
+	for _, value := range values {
+		convo, err := valueToConversation(value)
+		if err != nil {
+			return nil, errors.WithMessage(parentErr, err.Error())
+		}
+		counts = append(counts, convo.unreadCount())
+	}
+	return counts, nil
+}
+
+// messageStored updates the unread count of the conversation of the newly
+// stored message, which must have its UUID set. A message sent by the user
+// marks the conversation as read up to it. Errors are logged since they do not
+// affect the stored message.
+func (w *wasmModel) messageStored(msg *Message) {
+	key := msg.ConversationPubKey
+	w.updateUnread(key, func(
+		_ *idb.Transaction, convo *Conversation) (bool, error) {
+		if isOwnMessage(msg) || dm.Status(msg.Status) == dm.Unsent {
+			convo.LastReadUUID = msg.ID
+			convo.LastReadTimestamp = msg.Timestamp
+			convo.UnreadCount = 0
+			return true, nil
+		} else if convo.isUnread(msg) {
+			convo.UnreadCount++
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// messageRemoved updates the unread count of the conversation of the deleted
+// message.
+func (w *wasmModel) messageRemoved(msg *Message) {
+	key := msg.ConversationPubKey
+	w.updateUnread(key, func(
+		_ *idb.Transaction, convo *Conversation) (bool, error) {
+		if !convo.isUnread(msg) || convo.UnreadCount == 0 {
+			return false, nil
+		}
+		convo.UnreadCount--
+		return true, nil
+	})
+}
+
+// recountUnread counts the unread messages of the conversation with the
+// partner again.
+func (w *wasmModel) recountUnread(partnerKey []byte) {
+	w.updateUnread(partnerKey, func(
+		txn *idb.Transaction, convo *Conversation) (bool, error) {
+		count, err := w.countUnread(txn, convo)
+		if err != nil {
+			return false, err
+		}
+		changed := count != convo.UnreadCount
+		convo.UnreadCount = count
+		return changed, nil
+	})
+}
+
+// updateUnread calls update with the stored conversation and stores it if
+// update returns true. An UnreadCountChanged event is sent if the unread count
+// changed. Conversations that are not stored are skipped. Errors are logged
+// since they do not affect the stored messages.
+func (w *wasmModel) updateUnread(partnerKey []byte,
+	update func(txn *idb.Transaction, convo *Conversation) (bool, error)) {
+	convo, unreadCount, err := w.updateConversation(partnerKey, update)
+	if err != nil {
+		if !strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			jww.ERROR.Printf(
+				"[DM indexedDB] Failed to update unread count: %+v", err)
+		}
+		return
+	}
+	if convo.UnreadCount != unreadCount {
+		w.unreadCountChanged(convo)
+	}
+}
+
+// updateConversation calls update with the stored conversation and stores it
+// if update returns true. The conversation is read and stored in a single
+// transaction, which also includes the message object store for update to
+// read, so concurrent updates of the conversation are not lost. Returns the
+// conversation and its unread count before the update.
+func (w *wasmModel) updateConversation(partnerKey []byte,
+	update func(txn *idb.Transaction, convo *Conversation) (bool, error)) (
+	*Conversation, int, error) {
+	var convo *Conversation
+	var unreadCount int
+	err := impl.Update(w.db, conversationStoreName,
+		impl.EncodeBytes(partnerKey), []string{messageStoreName},
+		func(txn *idb.Transaction, value js.Value) (js.Value, bool, error) {
+			var err error
+			if convo, err = valueToConversation(value); err != nil {
+				return js.Undefined(), false, err
+			}
+			unreadCount = convo.UnreadCount
+
+			if changed, err := update(txn, convo); err != nil || !changed {
+				return js.Undefined(), false, err
+			}
+			value, err = conversationToValue(convo)
+			return value, err == nil, err
+		})
+	if err != nil {
+		return nil, 0, err
+	}
+	return convo, unreadCount, nil
+}
+
+// countUnread returns the number of unread messages in the conversation, using
+// messageStoreConversationIndex within the transaction.
+func (w *wasmModel) countUnread(
+	txn *idb.Transaction, convo *Conversation) (int, error) {
+	keyRange, err := idb.NewKeyRangeOnly(impl.EncodeBytes(convo.Pubkey))
+	if err != nil {
+		return 0, errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+
+	return impl.CountIndexTxn(txn, messageStoreName,
+		messageStoreConversationIndex, keyRange,
+		func(value js.Value) (bool, error) {
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return false, err
+			}
+			return convo.isUnread(msg), nil
+		})
+}
+
+// unreadCountChanged sends an UnreadCountChanged event for the conversation.
+func (w *wasmModel) unreadCountChanged(convo *Conversation) {
+	go w.eventCallback(wDm.UnreadCountChanged, convo.unreadCount())
+}
+
+// isUnread returns true if the message is unread in the conversation.
+// Reactions, messages sent by the user, and the message at the read marker are
+// never unread.
+func (c *Conversation) isUnread(msg *Message) bool {
+	return msg.ID != c.LastReadUUID && !isOwnMessage(msg) &&
+		dm.MessageType(msg.Type) != dm.ReactionType &&
+		msg.Timestamp.After(c.LastReadTimestamp)
+}
+
+// unreadCount returns the read marker and unread count of the conversation.
+func (c *Conversation) unreadCount() wDm.UnreadCount {
+	return wDm.UnreadCount{
+		PubKey:            c.Pubkey,
+		UnreadCount:       c.UnreadCount,
+		LastReadUUID:      c.LastReadUUID,
+		LastReadTimestamp: c.LastReadTimestamp,
+	}
+}
+
+// isOwnMessage returns true if the message was sent by the user, in which case
+// the sender is not the partner of the conversation.
+func isOwnMessage(msg *Message) bool {
+	return !bytes.Equal(msg.SenderPubKey, msg.ConversationPubKey)
+}
+
+// putConversation stores the conversation.
+func (w *wasmModel) putConversation(convo *Conversation) error {
+	convoObj, err := conversationToValue(convo)
+	if err != nil {
+		return err
+	}
+
+	if _, err = impl.Put(w.db, conversationStoreName, convoObj); err != nil {
+		return errors.Errorf("Unable to put Conversation: %+v", err)
+	}
+	return nil
+}
+
+// conversationToValue is a helper for converting a Conversation to a js.Value.
+func conversationToValue(convo *Conversation) (js.Value, error) {
+	convoJson, err := json.Marshal(convo)
+	if err != nil {
+		return js.Undefined(),
+			errors.Errorf("Unable to marshal Conversation: %+v", err)
+	}
+	convoObj, err := utils.JsonToJS(convoJson)
+	if err != nil {
+		return js.Undefined(),
+			errors.Errorf("Unable to marshal Conversation: %+v", err)
+	}
+	return convoObj, nil
+}
+
+// valueToConversation is a helper for converting a js.Value to a Conversation.
+func valueToConversation(convoObj js.Value) (*Conversation, error) {
+	resultConvo := &Conversation{}
+	err := json.Unmarshal([]byte(utils.JsToJson(convoObj)), resultConvo)
+	if err != nil {
+		return nil, errors.Errorf("Unable to unmarshal Conversation: %+v", err)
+	}
+	return resultConvo, nil
+}
@@ -0,0 +1,175 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the drafts of unsent messages of each channel or
+// conversation.
+
+package impl
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+const (
+	// DraftStoreName is the name of the [idb.ObjectStore] that holds the draft
+	// of each channel or conversation.
+	DraftStoreName = "drafts"
+
+	// draftPkeyName is the key path of the draft object store.
+	draftPkeyName = "id"
+)
+
+// Draft is a message that is being written in a channel or conversation. Its
+// text is stored encrypted with the database cipher.
+//
+// Example JSON:
+//
+//	{
+//	  "text": "Here are the notes from",
+//	  "replyTo": "M7Yh8SJ3CP6fuNGP1UV5VhN8c5kqL5iG8Kx+q9zkmGE=",
+//	  "files": [
+//	    {
+//	      "fileID": "TfXPB5ZpvUJ+wSVzDbKQdKMmEOJMqu8RKCAZXNvyMuU=",
+//	      "name": "notes.txt",
+//	      "type": "txt",
+//	      "size": 2048
+//	    }
+//	  ],
+//	  "updated": "2023-05-12T15:03:42.197Z"
+//	}
+type Draft struct {
+	Text string `json:"text"`
+
+	// ReplyTo is the marshalled [message.ID] of the message the draft replies
+	// to, if any.
+	ReplyTo []byte `json:"replyTo,omitempty"`
+
+	// Files are the files attached to the draft.
+	Files []DraftFile `json:"files,omitempty"`
+
+	// Updated is when the draft was last saved. It is set by PutDraft.
+	Updated time.Time `json:"updated"`
+}
+
+// DraftFile is a reference to a file attached to a draft. The file itself is
+// not stored with the draft.
+type DraftFile struct {
+	FileID []byte `json:"fileID"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Size   int    `json:"size"`
+}
+
+// draftRow is a draft as stored in the draft object store. Only the text is
+// encrypted, as with the text of a stored message, so that any draft with text
+// that fits in a message can be stored.
+type draftRow struct {
+	// ID is the channel ID or partner public key that the draft belongs to.
+	ID []byte `json:"id"` // Matches draftPkeyName
+
+	// Text is the text of the Draft, encrypted with the database cipher.
+	Text string `json:"text"`
+
+	ReplyTo []byte      `json:"replyTo,omitempty"`
+	Files   []DraftFile `json:"files,omitempty"`
+	Updated time.Time   `json:"updated"`
+}
+
+// IsZero returns true if the draft has no text, reply target, or files.
+func (d Draft) IsZero() bool {
+	return d.Text == "" && len(d.ReplyTo) == 0 && len(d.Files) == 0
+}
+
+// CreateDraftStore creates the draft object store. It must be called from a
+// database upgrade.
+func CreateDraftStore(db *idb.Database) error {
+	_, err := db.CreateObjectStore(DraftStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(draftPkeyName),
+			AutoIncrement: false,
+		})
+	return err
+}
+
+// PutDraft stores the draft for the channel or conversation with the given ID,
+// encrypted with the cipher, with its update time set to updated. A zero draft
+// removes the stored draft.
+func PutDraft(db *idb.Database, c idbCrypto.Cipher, id []byte, draft Draft,
+	updated time.Time) error {
+	if draft.IsZero() {
+		return DeleteDraft(db, id)
+	}
+
+	text, err := encryptText(c, []byte(draft.Text))
+	if err != nil {
+		return errors.Errorf("Unable to encrypt Draft: %+v", err)
+	}
+
+	rowJson, err := json.Marshal(draftRow{
+		ID:      id,
+		Text:    text,
+		ReplyTo: draft.ReplyTo,
+		Files:   draft.Files,
+		Updated: updated,
+	})
+	if err != nil {
+		return errors.Errorf("Unable to marshal Draft: %+v", err)
+	}
+	rowObj, err := utils.JsonToJS(rowJson)
+	if err != nil {
+		return errors.Errorf("Unable to marshal Draft: %+v", err)
+	}
+
+	_, err = Put(db, DraftStoreName, rowObj)
+	return err
+}
+
+// GetDraft returns the draft of the channel or conversation with the given ID,
+// decrypted with the cipher. Returns a zero draft if none is stored.
+func GetDraft(db *idb.Database, c idbCrypto.Cipher, id []byte) (Draft, error) {
+	rowObj, err := Get(db, DraftStoreName, EncodeBytes(id))
+	if err != nil {
+		if strings.Contains(err.Error(), ErrDoesNotExist) {
+			return Draft{}, nil
+		}
+		return Draft{}, err
+	}
+
+	var row draftRow
+	err = json.Unmarshal([]byte(utils.JsToJson(rowObj)), &row)
+	if err != nil {
+		return Draft{}, errors.Errorf("Unable to unmarshal Draft: %+v", err)
+	}
+	text, err := decryptText(c, row.Text)
+	if err != nil {
+		return Draft{}, errors.Errorf("Unable to decrypt Draft: %+v", err)
+	}
+
+	return Draft{
+		Text:    string(text),
+		ReplyTo: row.ReplyTo,
+		Files:   row.Files,
+		Updated: row.Updated,
+	}, nil
+}
+
+// DeleteDraft removes the draft of the channel or conversation with the given
+// ID, if one is stored.
+func DeleteDraft(db *idb.Database, id []byte) error {
+	return Delete(db, DraftStoreName, EncodeBytes(id))
+}
@@ -0,0 +1,126 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that Draft.IsZero is only true for a draft without text, reply target,
+// or files.
+func TestDraft_IsZero(t *testing.T) {
+	tests := []struct {
+		draft    Draft
+		expected bool
+	}{
+		{Draft{}, true},
+		{Draft{Updated: time.Unix(1, 0)}, true},
+		{Draft{Text: "hello"}, false},
+		{Draft{ReplyTo: []byte{1}}, false},
+		{Draft{Files: []DraftFile{{Name: "notes.txt"}}}, false},
+	}
+	for i, tt := range tests {
+		if isZero := tt.draft.IsZero(); isZero != tt.expected {
+			t.Errorf("Unexpected IsZero for %+v (%d).\nexpected: %t"+
+				"\nreceived: %t", tt.draft, i, tt.expected, isZero)
+		}
+	}
+}
+
+// Tests that PutDraft stores a draft encrypted with the cipher, that GetDraft
+// decrypts it, and that a zero draft removes it.
+func TestPutDraft(t *testing.T) {
+	db := newTestDB("TestPutDraft", "messages", "index", CreateDraftStore, t)
+	cipher := newTestCipher("testPass", t)
+	id := []byte("channel")
+
+	draft, err := GetDraft(db, cipher, id)
+	if err != nil {
+		t.Fatalf("Failed to get missing draft: %+v", err)
+	} else if !draft.IsZero() {
+		t.Errorf("Expected no draft, received %+v", draft)
+	}
+
+	expected := Draft{
+		Text:    "Here are the notes",
+		ReplyTo: []byte{1, 2, 3},
+		Files:   []DraftFile{{FileID: []byte{4}, Name: "notes.txt", Size: 42}},
+		Updated: time.Unix(1700000000, 0).UTC(),
+	}
+	err = PutDraft(db, cipher, id, Draft{
+		Text: expected.Text, ReplyTo: expected.ReplyTo, Files: expected.Files},
+		expected.Updated)
+	if err != nil {
+		t.Fatalf("Failed to put draft: %+v", err)
+	}
+
+	rowObj, err := Get(db, DraftStoreName, EncodeBytes(id))
+	if err != nil {
+		t.Fatalf("Failed to get stored draft: %+v", err)
+	} else if strings.Contains(rowObj.Get("text").String(), expected.Text) {
+		t.Errorf("Draft is not encrypted: %s", rowObj.Get("text").String())
+	}
+
+	draft, err = GetDraft(db, cipher, id)
+	if err != nil {
+		t.Fatalf("Failed to get draft: %+v", err)
+	} else if !reflect.DeepEqual(expected, draft) {
+		t.Errorf("Unexpected draft.\nexpected: %+v\nreceived: %+v",
+			expected, draft)
+	}
+
+	if err = PutDraft(db, cipher, id, Draft{}, time.Now()); err != nil {
+		t.Fatalf("Failed to put zero draft: %+v", err)
+	}
+	n, err := Count(db, DraftStoreName)
+	if err != nil {
+		t.Fatalf("Failed to count drafts: %+v", err)
+	} else if n != 0 {
+		t.Errorf("Expected the draft to be removed, %d are stored", n)
+	}
+}
+
+// Tests that PutDraft stores a draft with text of the block size of the cipher,
+// with characters that are escaped in JSON, along with a reply target and
+// files.
+func TestPutDraft_BlockSize(t *testing.T) {
+	db := newTestDB("TestPutDraft_BlockSize", "messages", "index",
+		CreateDraftStore, t)
+	cipher := newTestCipher("testPass", t)
+	id := []byte("channel")
+
+	// The cipher made by newTestCipher has a block size of 128 bytes
+	expected := Draft{
+		Text:    strings.Repeat("<&>", 42) + "<>",
+		ReplyTo: bytes.Repeat([]byte{1}, 32),
+		Files: []DraftFile{{FileID: bytes.Repeat([]byte{2}, 32),
+			Name: "notes.txt", Type: "txt", Size: 2048}},
+		Updated: time.Unix(1700000000, 0).UTC(),
+	}
+	if len(expected.Text) != 128 {
+		t.Fatalf("Text is %d bytes", len(expected.Text))
+	}
+
+	err := PutDraft(db, cipher, id, expected, expected.Updated)
+	if err != nil {
+		t.Fatalf("Failed to put draft: %+v", err)
+	}
+	draft, err := GetDraft(db, cipher, id)
+	if err != nil {
+		t.Fatalf("Failed to get draft: %+v", err)
+	} else if !reflect.DeepEqual(expected, draft) {
+		t.Errorf("Unexpected draft.\nexpected: %+v\nreceived: %+v",
+			expected, draft)
+	}
+}
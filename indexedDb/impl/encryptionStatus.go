@@ -0,0 +1,123 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the check of the encryption status of a database against
+// its rows, for databases whose stored status cannot be trusted.
+
+package impl
+
+import (
+	"syscall/js"
+
+	"github.com/Max-Sum/base32768"
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+)
+
+// probeRows is the maximum number of rows of each store read by
+// ProbeEncryption.
+const probeRows = 10
+
+// Error messages.
+const (
+	// ProbeEncryption
+	probeNotEncryptedErr = "rows of %s are not encrypted with the cipher: %+v"
+	probeEncryptedErr    = "rows of %s are encrypted but no cipher was given"
+)
+
+// ProbeEncryption returns an error if the first rows of the stores cannot be
+// decrypted with the cipher or, if the cipher is nil, if all of them are
+// encrypted. A store without rows matches any cipher.
+//
+// It is used to confirm the encryption status of a database that was stored
+// by an older version, which recorded every database as encrypted.
+func ProbeEncryption(
+	db *idb.Database, c idbCrypto.Cipher, stores []EncryptedStore) error {
+	for _, es := range stores {
+		texts, err := probeTexts(db, es)
+		if err != nil {
+			return err
+		}
+
+		encrypted := 0
+		for _, text := range texts {
+			if c != nil {
+				if _, err = c.Decrypt(text); err != nil {
+					return errors.Errorf(probeNotEncryptedErr, es.Name, err)
+				}
+			} else if looksEncrypted(text) {
+				encrypted++
+			}
+		}
+		if c == nil && len(texts) > 0 && encrypted == len(texts) {
+			return errors.Errorf(probeEncryptedErr, es.Name)
+		}
+	}
+
+	return nil
+}
+
+// probeTexts returns the encrypted fields of up to probeRows rows of the
+// store.
+func probeTexts(db *idb.Database, es EncryptedStore) ([]string, error) {
+	parentErr := errors.Errorf("failed to probe %s", es.Name)
+
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadOnly, es.Name)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(es.Name)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	var texts []string
+	rows := 0
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			for _, field := range es.Fields {
+				text := value.Get(field)
+				if text.Type() == js.TypeString && text.String() != "" {
+					texts = append(texts, text.String())
+				}
+			}
+			if rows++; rows == probeRows {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessage(parentErr, err.Error())
+	}
+	return texts, nil
+}
+
+// looksEncrypted returns true if the text has the encoding and minimum length
+// of text encrypted by an [idbCrypto.Cipher].
+func looksEncrypted(text string) bool {
+	decoded, err := base32768.SafeEncoding.DecodeString(text)
+	return err == nil &&
+		len(decoded) > chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead
+}
@@ -0,0 +1,122 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"syscall/js"
+	"testing"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that looksEncrypted is true for text encrypted by a cipher and false
+// for plaintext.
+func Test_looksEncrypted(t *testing.T) {
+	text, err := newTestCipher("testPass", t).Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	if !looksEncrypted(text) {
+		t.Errorf("Encrypted text does not look encrypted: %q", text)
+	}
+
+	for _, text := range []string{"", "hello", "aGVsbG8gd29ybGQ=", "你好"} {
+		if looksEncrypted(text) {
+			t.Errorf("Plaintext looks encrypted: %q", text)
+		}
+	}
+}
+
+// Tests that ProbeEncryption only accepts the cipher that the rows of a
+// database of messages encrypted by an older version were encrypted with, and
+// only accepts no cipher for plaintext rows.
+func TestProbeEncryption(t *testing.T) {
+	cipher := newTestCipher("testPass", t)
+	stores := []EncryptedStore{{Name: "messages", Fields: []string{"text"}}}
+
+	tests := []struct {
+		name      string
+		encrypted bool
+		cipher    idbCrypto.Cipher
+		valid     bool
+	}{
+		{"TestProbeEncryption_Encrypted", true, cipher, true},
+		{"TestProbeEncryption_EncryptedNil", true, nil, false},
+		{"TestProbeEncryption_EncryptedOther", true,
+			newTestCipher("otherPass", t), false},
+		{"TestProbeEncryption_Plaintext", false, nil, true},
+		{"TestProbeEncryption_PlaintextCipher", false, cipher, false},
+	}
+	for _, tt := range tests {
+		db := newTestDB(tt.name, "messages", "index", createRotationStores, t)
+		if err := ProbeEncryption(db, tt.cipher, stores); err != nil {
+			t.Errorf("Empty database not accepted (%s): %+v", tt.name, err)
+		}
+
+		for i := 0; i < probeRows+1; i++ {
+			text := "message"
+			if tt.encrypted {
+				var err error
+				if text, err = cipher.Encrypt([]byte(text)); err != nil {
+					t.Fatalf("Failed to encrypt (%s): %+v", tt.name, err)
+				}
+			}
+			row := js.ValueOf(map[string]any{"text": text})
+			if _, err := Put(db, "messages", row); err != nil {
+				t.Fatalf("Failed to put message (%s): %+v", tt.name, err)
+			}
+		}
+
+		err := ProbeEncryption(db, tt.cipher, stores)
+		if tt.valid && err != nil {
+			t.Errorf("Cipher not accepted (%s): %+v", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("Cipher accepted (%s).", tt.name)
+		}
+	}
+}
+
+// Tests that a database whose encryption was interrupted after its first
+// batch, before its new encryption status was recorded, can only be opened
+// with the new cipher and that its rows then match it.
+func TestProbeEncryption_InterruptedEncryption(t *testing.T) {
+	cipher := newTestCipher("testPass", t)
+	stores := []EncryptedStore{{Name: "messages", Fields: []string{"text"}}}
+	db := newTestDB("TestProbeEncryption_InterruptedEncryption", "messages",
+		"index", createRotationStores, t)
+	for i := 0; i < keyRotationBatchSize+1; i++ {
+		row := js.ValueOf(map[string]any{"text": "message"})
+		if _, err := Put(db, "messages", row); err != nil {
+			t.Fatalf("Failed to put message: %+v", err)
+		}
+	}
+
+	kr, err := NewKeyRotation(db, nil, cipher, stores)
+	if err != nil {
+		t.Fatalf("Failed to create key rotation: %+v", err)
+	}
+	if progress, err := kr.Next(); err != nil {
+		t.Fatalf("Failed to encrypt first batch: %+v", err)
+	} else if progress.Done {
+		t.Fatalf("Encryption done after first batch.")
+	}
+
+	if _, err = OpenCipher(db, nil, csprng.NewSystemRNG()); err == nil {
+		t.Errorf("Opened without the cipher.")
+	}
+	opened, err := OpenCipher(db, cipher, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to open with the cipher: %+v", err)
+	}
+	if err = ProbeEncryption(db, opened, stores); err != nil {
+		t.Errorf("Rows do not match the opened cipher: %+v", err)
+	}
+}
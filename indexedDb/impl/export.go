@@ -0,0 +1,309 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains helpers to copy an entire IndexedDB database, including
+// its schema, to and from JSON.
+
+package impl
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// DatabaseDump is the schema and contents of an [idb.Database].
+type DatabaseDump struct {
+	Name    string      `json:"name"`
+	Version uint        `json:"version"`
+	Stores  []StoreDump `json:"stores"`
+}
+
+// StoreDump is the schema and contents of an [idb.ObjectStore].
+type StoreDump struct {
+	Name          string          `json:"name"`
+	KeyPath       json.RawMessage `json:"keyPath"`
+	AutoIncrement bool            `json:"autoIncrement"`
+	Indexes       []IndexDump     `json:"indexes"`
+	Rows          []RowDump       `json:"rows"`
+}
+
+// IndexDump is the schema of an [idb.Index].
+type IndexDump struct {
+	Name       string          `json:"name"`
+	KeyPath    json.RawMessage `json:"keyPath"`
+	Unique     bool            `json:"unique"`
+	MultiEntry bool            `json:"multiEntry"`
+}
+
+// RowDump is a single row of an [idb.ObjectStore]. The key is only set for
+// object stores without a key path.
+type RowDump struct {
+	Key   json.RawMessage `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// DumpDatabase opens the database with the given name at its current version
+// and returns its schema and the contents of every object store. The database
+// is closed before returning.
+func DumpDatabase(databaseName string) (DatabaseDump, error) {
+	dump := DatabaseDump{Name: databaseName}
+	parentErr := errors.Errorf("failed to DumpDatabase %s", databaseName)
+
+	ctx, cancel := NewContext()
+	defer cancel()
+	openRequest, err := idb.Global().Open(ctx, databaseName, 0,
+		func(*idb.Database, uint, uint) error { return nil })
+	if err != nil {
+		return dump, errors.WithMessage(parentErr, err.Error())
+	}
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		return dump, errors.WithMessage(parentErr, err.Error())
+	}
+	defer closeDatabase(db, databaseName)
+
+	if dump.Version, err = db.Version(); err != nil {
+		return dump, errors.WithMessage(parentErr, err.Error())
+	}
+
+	objectStoreNames, err := db.ObjectStoreNames()
+	if err != nil {
+		return dump, errors.WithMessage(parentErr, err.Error())
+	}
+
+	dump.Stores = make([]StoreDump, len(objectStoreNames))
+	for i, objectStoreName := range objectStoreNames {
+		dump.Stores[i], err = dumpStore(db, objectStoreName)
+		if err != nil {
+			return dump, errors.WithMessage(parentErr, err.Error())
+		}
+	}
+
+	return dump, nil
+}
+
+// RestoreDatabase creates the database described by the dump, including its
+// object stores and indexes, and writes every row to it. It returns an error
+// if the database already exists.
+func RestoreDatabase(dump DatabaseDump) error {
+	parentErr := errors.Errorf("failed to RestoreDatabase %s", dump.Name)
+
+	var created bool
+	ctx, cancel := NewContext()
+	defer cancel()
+	openRequest, err := idb.Global().Open(ctx, dump.Name, dump.Version,
+		func(db *idb.Database, oldVersion, _ uint) error {
+			if oldVersion != 0 {
+				return nil
+			}
+			created = true
+			return createSchema(db, dump.Stores)
+		})
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+	defer closeDatabase(db, dump.Name)
+
+	if !created {
+		return errors.WithMessage(parentErr, "database already exists")
+	}
+
+	for _, store := range dump.Stores {
+		if err = restoreRows(db, store); err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// dumpStore returns the schema and rows of the object store.
+func dumpStore(db *idb.Database, objectStoreName string) (StoreDump, error) {
+	dump := StoreDump{Name: objectStoreName}
+
+	txn, err := db.Transaction(idb.TransactionReadOnly, objectStoreName)
+	if err != nil {
+		return dump, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return dump, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+
+	keyPath, err := store.KeyPath()
+	if err != nil {
+		return dump, err
+	}
+	dump.KeyPath = json.RawMessage(utils.JsToJson(keyPath))
+	if dump.AutoIncrement, err = store.AutoIncrement(); err != nil {
+		return dump, err
+	}
+
+	indexNames, err := store.IndexNames()
+	if err != nil {
+		return dump, err
+	}
+	dump.Indexes = make([]IndexDump, len(indexNames))
+	for i, indexName := range indexNames {
+		index, err := store.Index(indexName)
+		if err != nil {
+			return dump, err
+		}
+		indexKeyPath, err := index.KeyPath()
+		if err != nil {
+			return dump, err
+		}
+		dump.Indexes[i] = IndexDump{
+			Name:    indexName,
+			KeyPath: json.RawMessage(utils.JsToJson(indexKeyPath)),
+		}
+		if dump.Indexes[i].Unique, err = index.Unique(); err != nil {
+			return dump, err
+		}
+		if dump.Indexes[i].MultiEntry, err = index.MultiEntry(); err != nil {
+			return dump, err
+		}
+	}
+
+	// Out-of-line keys must be saved with each row
+	inlineKeys := !keyPath.IsNull() && !keyPath.IsUndefined()
+
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return dump, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+	dump.Rows = make([]RowDump, 0)
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			row := RowDump{Value: json.RawMessage(utils.JsToJson(value))}
+			if !inlineKeys {
+				key, err := cursor.PrimaryKey()
+				if err != nil {
+					return err
+				}
+				row.Key = json.RawMessage(utils.JsToJson(key))
+			}
+			dump.Rows = append(dump.Rows, row)
+			return nil
+		})
+	if err != nil {
+		return dump, errors.Errorf("Unable to dump ObjectStore %s: %+v",
+			objectStoreName, err)
+	}
+
+	return dump, nil
+}
+
+// createSchema creates the object stores and indexes. It must be called from
+// an [idb.Upgrader].
+func createSchema(db *idb.Database, stores []StoreDump) error {
+	for _, s := range stores {
+		keyPath, err := parseJSON(s.KeyPath)
+		if err != nil {
+			return err
+		}
+		store, err := db.CreateObjectStore(s.Name, idb.ObjectStoreOptions{
+			KeyPath:       keyPath,
+			AutoIncrement: s.AutoIncrement,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, index := range s.Indexes {
+			indexKeyPath, err := parseJSON(index.KeyPath)
+			if err != nil {
+				return err
+			}
+			_, err = store.CreateIndex(index.Name, indexKeyPath,
+				idb.IndexOptions{
+					Unique:     index.Unique,
+					MultiEntry: index.MultiEntry,
+				})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreRows writes every row of the dump to its object store in a single
+// transaction.
+func restoreRows(db *idb.Database, dump StoreDump) error {
+	if len(dump.Rows) == 0 {
+		return nil
+	}
+
+	txn, err := db.Transaction(idb.TransactionReadWrite, dump.Name)
+	if err != nil {
+		return errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(dump.Name)
+	if err != nil {
+		return errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+
+	for _, row := range dump.Rows {
+		value, err := parseJSON(row.Value)
+		if err != nil {
+			return err
+		}
+		if len(row.Key) > 0 {
+			var key js.Value
+			if key, err = parseJSON(row.Key); err != nil {
+				return err
+			}
+			_, err = store.PutKey(key, value)
+		} else {
+			_, err = store.Put(value)
+		}
+		if err != nil {
+			return errors.Errorf("Unable to Put into %s: %+v", dump.Name, err)
+		}
+	}
+
+	ctx, cancel := NewContext()
+	defer cancel()
+	return txn.Await(ctx)
+}
+
+// closeDatabase closes the database and logs any error.
+func closeDatabase(db *idb.Database, databaseName string) {
+	if err := db.Close(); err != nil {
+		jww.WARN.Printf("Failed to close database %s: %+v", databaseName, err)
+	}
+}
+
+// parseJSON parses any JSON value, including strings, arrays, and null, into a
+// Javascript value.
+func parseJSON(data []byte) (value js.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("failed to parse JSON: %+v", r)
+		}
+	}()
+
+	return js.Global().Get("JSON").Call("parse", string(data)), nil
+}
@@ -0,0 +1,106 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the progress and conflict summary of history imports.
+
+package impl
+
+const (
+	// ImportBatchSize is the maximum number of messages imported in a single
+	// transaction.
+	ImportBatchSize = 250
+
+	// maxImportConflictDetails is the maximum number of conflicts listed in an
+	// ImportProgress. Every conflict is counted.
+	maxImportConflictDetails = 100
+)
+
+// Reasons a message is not imported.
+const (
+	// ImportConflictOtherChat is the reason for a message whose ID is stored
+	// in a different channel or conversation.
+	ImportConflictOtherChat = "stored in another channel or conversation"
+
+	// ImportConflictInvalid is the reason for a message that cannot be stored
+	// (e.g., it has no message ID).
+	ImportConflictInvalid = "invalid message"
+)
+
+// ImportProgress is the progress of a history import. Each message is either
+// imported, a duplicate of a stored message, or a conflict.
+//
+// Example JSON:
+//
+//	{
+//	  "total": 1200,
+//	  "processed": 500,
+//	  "imported": 480,
+//	  "duplicates": 19,
+//	  "conflicts": 1,
+//	  "conflictDetails": [
+//	    {
+//	      "messageID": "M7Yh8SJ3CP6fuNGP1UV5VhN8c5kqL5iG8Kx+q9zkmGE=",
+//	      "reason": "stored in another channel or conversation"
+//	    }
+//	  ],
+//	  "done": false
+//	}
+type ImportProgress struct {
+	// Total is the number of messages in the archive, including reactions.
+	Total int `json:"total"`
+
+	// Processed is the number of messages read so far.
+	Processed int `json:"processed"`
+
+	// Imported is the number of messages stored.
+	Imported int `json:"imported"`
+
+	// Duplicates is the number of messages skipped because a message with the
+	// same ID is already stored in the same channel or conversation.
+	Duplicates int `json:"duplicates"`
+
+	// Conflicts is the number of messages skipped for another reason.
+	Conflicts int `json:"conflicts"`
+
+	// ConflictDetails lists the first conflicts.
+	ConflictDetails []ImportConflict `json:"conflictDetails,omitempty"`
+
+	// Done is true once every message is processed.
+	Done bool `json:"done"`
+}
+
+// ImportConflict is a message that was not imported and the reason why.
+type ImportConflict struct {
+	MessageID []byte `json:"messageID"`
+	Reason    string `json:"reason"`
+}
+
+// AddConflict records a message that was not imported.
+func (ip *ImportProgress) AddConflict(messageID []byte, reason string) {
+	ip.Conflicts++
+	if len(ip.ConflictDetails) < maxImportConflictDetails {
+		ip.ConflictDetails = append(ip.ConflictDetails,
+			ImportConflict{MessageID: messageID, Reason: reason})
+	}
+}
+
+// Add adds the counts and conflicts of a batch to the progress. The total and
+// done status are not changed.
+func (ip *ImportProgress) Add(batch ImportProgress) {
+	ip.Processed += batch.Processed
+	ip.Imported += batch.Imported
+	ip.Duplicates += batch.Duplicates
+	ip.Conflicts += batch.Conflicts
+	for _, c := range batch.ConflictDetails {
+		if len(ip.ConflictDetails) == maxImportConflictDetails {
+			break
+		}
+		ip.ConflictDetails = append(ip.ConflictDetails, c)
+	}
+}
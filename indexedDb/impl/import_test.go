@@ -0,0 +1,47 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that ImportProgress.Add sums the counts of each batch and lists no
+// more than maxImportConflictDetails conflicts.
+func TestImportProgress_Add(t *testing.T) {
+	progress := ImportProgress{Total: 3 * maxImportConflictDetails}
+	for i := 0; i < 3; i++ {
+		var batch ImportProgress
+		for j := 0; j < maxImportConflictDetails/2; j++ {
+			batch.AddConflict([]byte{byte(i), byte(j)}, ImportConflictOtherChat)
+			batch.Duplicates++
+		}
+		batch.Processed = maxImportConflictDetails
+		progress.Add(batch)
+	}
+
+	expected := ImportProgress{
+		Total:      3 * maxImportConflictDetails,
+		Processed:  3 * maxImportConflictDetails,
+		Duplicates: 3 * maxImportConflictDetails / 2,
+		Conflicts:  3 * maxImportConflictDetails / 2,
+	}
+	if len(progress.ConflictDetails) != maxImportConflictDetails {
+		t.Errorf("Unexpected number of conflict details."+
+			"\nexpected: %d\nreceived: %d",
+			maxImportConflictDetails, len(progress.ConflictDetails))
+	}
+	progress.ConflictDetails = nil
+	if !reflect.DeepEqual(expected, progress) {
+		t.Errorf("Unexpected progress.\nexpected: %+v\nreceived: %+v",
+			expected, progress)
+	}
+}
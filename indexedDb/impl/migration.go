@@ -0,0 +1,318 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the schema migration runner shared by every database.
+
+package impl
+
+import (
+	"sort"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+)
+
+const (
+	// MigrationStoreName is the name of the [idb.ObjectStore] that records
+	// the migrations whose backfill has not yet completed.
+	MigrationStoreName = "migrations"
+
+	// migrationPkeyName is the key path of the migration object store.
+	migrationPkeyName = "version"
+)
+
+// Error messages.
+const (
+	// Migrations.validate
+	noMigrationsErr       = "no migrations"
+	migrationOrderErr     = "migration #%d has version %d; expected %d"
+	migrationNoUpgradeErr = "migration to v%d has no upgrade"
+
+	// OpenDatabase
+	migrationVersionErr = "latest migration is v%d but database version is v%d"
+	noOpenRequestErr    = "open request for %s was not captured"
+	noUpgradeTxnErr     = "open request for %s has no upgrade transaction"
+
+	// Migrations.upgrade
+	migrationUpgradeErr = "failed to upgrade %s to v%d: %+v"
+	recordBackfillErr   = "failed to record pending backfill for v%d: %+v"
+
+	// Migrations.backfill
+	unknownBackfillErr   = "no migration backfill for pending v%d"
+	migrationBackfillErr = "failed to backfill %s for v%d: %+v"
+)
+
+// Migration is a single step in the schema history of a database. Migrations
+// are run in order; a database at version n runs every migration with a
+// greater version when it is opened.
+//
+// A migration can never be changed once released without permanently breaking
+// backwards compatibility.
+type Migration struct {
+	// Version is the version of the database after the migration. The first
+	// migration is version 1, and each one after increments it by one.
+	Version uint
+
+	// Upgrade changes the schema. It is called during the database upgrade,
+	// when object stores and indexes can be created, and cannot read or write
+	// data.
+	Upgrade func(db *idb.Database, txn *UpgradeTransaction) error
+
+	// Backfill, if set, updates the existing data for the new schema. It is
+	// called after the database is opened and is retried on each open until it
+	// succeeds, so it must be safe to run more than once. It is not called for
+	// new databases.
+	Backfill func(db *idb.Database) error
+}
+
+// Migrations is the ordered schema history of a database.
+type Migrations []Migration
+
+// Version returns the version of the database after every migration.
+func (ms Migrations) Version() uint {
+	if len(ms) == 0 {
+		return 0
+	}
+	return ms[len(ms)-1].Version
+}
+
+// validate returns an error if the migrations are not numbered from 1 without
+// gaps or if one has no upgrade.
+func (ms Migrations) validate() error {
+	if len(ms) == 0 {
+		return errors.New(noMigrationsErr)
+	}
+	for i, m := range ms {
+		if m.Version != uint(i+1) {
+			return errors.Errorf(migrationOrderErr, i, m.Version, i+1)
+		} else if m.Upgrade == nil {
+			return errors.Errorf(migrationNoUpgradeErr, m.Version)
+		}
+	}
+	return nil
+}
+
+// OpenDatabase opens the database, upgrading it to the given version by
+// running the migrations it has not yet run, and then runs any pending
+// backfills. Returns an error if the last migration is not for the version.
+func OpenDatabase(databaseName string, version uint,
+	migrations Migrations) (*idb.Database, error) {
+	if err := migrations.validate(); err != nil {
+		return nil, err
+	} else if migrations.Version() != version {
+		return nil, errors.Errorf(
+			migrationVersionErr, migrations.Version(), version)
+	}
+
+	// The idb package does not expose the upgrade transaction, which is
+	// required to change existing object stores. It is reached through the
+	// open request, which is captured by wrapping the factory.
+	var openRequest js.Value
+	jsFactory := js.Global().Get("indexedDB")
+	open := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		openArgs := make([]any, len(args))
+		for i := range args {
+			openArgs[i] = args[i]
+		}
+		openRequest = jsFactory.Call("open", openArgs...)
+		return openRequest
+	})
+	defer open.Release()
+	wrapper := js.Global().Get("Object").New()
+	wrapper.Set("open", open)
+	factory, err := idb.WrapFactory(wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := NewContext()
+	defer cancel()
+	request, err := factory.Open(ctx, databaseName, version,
+		func(db *idb.Database, oldVersion, newVersion uint) error {
+			if oldVersion == newVersion {
+				jww.INFO.Printf("IndexDb version for %s is current: v%d",
+					databaseName, newVersion)
+				return nil
+			}
+
+			jww.INFO.Printf("IndexDb upgrade required for %s: v%d -> v%d",
+				databaseName, oldVersion, newVersion)
+
+			if openRequest.IsUndefined() {
+				return errors.Errorf(noOpenRequestErr, databaseName)
+			}
+			txn := &UpgradeTransaction{openRequest.Get("transaction")}
+			if txn.txn.IsNull() || txn.txn.IsUndefined() {
+				return errors.Errorf(noUpgradeTxnErr, databaseName)
+			}
+
+			return migrations.upgrade(db, txn, oldVersion, newVersion)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for database open to finish
+	db, err := request.Await(ctx)
+	if err != nil {
+		return nil, err
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if err = migrations.backfill(db, databaseName); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// upgrade runs every migration after oldVersion up to newVersion and records
+// their backfills as pending.
+func (ms Migrations) upgrade(db *idb.Database, txn *UpgradeTransaction,
+	oldVersion, newVersion uint) error {
+	name, err := db.Name()
+	if err != nil {
+		return err
+	}
+
+	exists, err := hasObjectStore(db, MigrationStoreName)
+	if err != nil {
+		return err
+	} else if !exists {
+		_, err = db.CreateObjectStore(MigrationStoreName,
+			idb.ObjectStoreOptions{
+				KeyPath:       js.ValueOf(migrationPkeyName),
+				AutoIncrement: false,
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range ms {
+		if m.Version <= oldVersion || m.Version > newVersion {
+			continue
+		}
+
+		if err = m.Upgrade(db, txn); err != nil {
+			return errors.Errorf(migrationUpgradeErr, name, m.Version, err)
+		}
+		jww.INFO.Printf("Upgraded %s to v%d", name, m.Version)
+
+		// New databases have no data to backfill
+		if m.Backfill != nil && oldVersion > 0 {
+			err = txn.put(MigrationStoreName,
+				js.ValueOf(map[string]any{migrationPkeyName: m.Version}))
+			if err != nil {
+				return errors.Errorf(recordBackfillErr, m.Version, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backfill runs every pending backfill in version order. Each is removed from
+// the pending list once it succeeds.
+func (ms Migrations) backfill(db *idb.Database, databaseName string) error {
+	// Databases not upgraded since migrations were introduced have no store
+	exists, err := hasObjectStore(db, MigrationStoreName)
+	if err != nil || !exists {
+		return err
+	}
+
+	pending, err := GetAll(db, MigrationStoreName)
+	if err != nil {
+		return err
+	}
+
+	versions := make([]uint, len(pending))
+	for i := range pending {
+		versions[i] = uint(pending[i].Get(migrationPkeyName).Int())
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, version := range versions {
+		if version == 0 || version > uint(len(ms)) ||
+			ms[version-1].Backfill == nil {
+			return errors.Errorf(unknownBackfillErr, version)
+		}
+
+		jww.INFO.Printf("Backfilling %s for v%d", databaseName, version)
+		if err = ms[version-1].Backfill(db); err != nil {
+			return errors.Errorf(
+				migrationBackfillErr, databaseName, version, err)
+		}
+
+		err = Delete(db, MigrationStoreName, js.ValueOf(version))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasObjectStore returns true if the database has the object store.
+func hasObjectStore(db *idb.Database, objectStoreName string) (bool, error) {
+	names, err := db.ObjectStoreNames()
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if name == objectStoreName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UpgradeTransaction is the transaction of a database upgrade. It allows
+// migrations to change object stores created by earlier migrations.
+type UpgradeTransaction struct {
+	txn js.Value
+}
+
+// CreateIndex creates an index on the existing object store.
+func (ut *UpgradeTransaction) CreateIndex(objectStoreName, indexName string,
+	keyPath js.Value, options idb.IndexOptions) error {
+	_, err := exception.RunAndCatch(func() js.Value {
+		return ut.txn.Call("objectStore", objectStoreName).Call("createIndex",
+			indexName, keyPath, map[string]any{
+				"unique":     options.Unique,
+				"multiEntry": options.MultiEntry,
+			})
+	})
+	return err
+}
+
+// DeleteIndex deletes an index from the existing object store.
+func (ut *UpgradeTransaction) DeleteIndex(
+	objectStoreName, indexName string) error {
+	_, err := exception.RunAndCatch(func() js.Value {
+		ut.txn.Call("objectStore", objectStoreName).Call("deleteIndex",
+			indexName)
+		return js.Undefined()
+	})
+	return err
+}
+
+// put puts the value in the object store. The write completes with the
+// upgrade.
+func (ut *UpgradeTransaction) put(objectStoreName string, value js.Value) error {
+	_, err := exception.RunAndCatch(func() js.Value {
+		return ut.txn.Call("objectStore", objectStoreName).Call("put", value)
+	})
+	return err
+}
@@ -0,0 +1,110 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"strings"
+	"syscall/js"
+	"testing"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+)
+
+// Tests that Migrations.validate accepts contiguous migrations and returns the
+// expected error for invalid ones.
+func TestMigrations_validate(t *testing.T) {
+	upgrade := func(*idb.Database, *UpgradeTransaction) error { return nil }
+
+	valid := Migrations{{1, upgrade, nil}, {2, upgrade, nil}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("Failed to validate migrations: %+v", err)
+	}
+	if valid.Version() != 2 {
+		t.Errorf("Unexpected version.\nexpected: %d\nreceived: %d",
+			2, valid.Version())
+	}
+
+	tests := map[string]Migrations{
+		noMigrationsErr:       {},
+		migrationOrderErr:     {{1, upgrade, nil}, {3, upgrade, nil}},
+		migrationNoUpgradeErr: {{1, upgrade, nil}, {2, nil, nil}},
+	}
+	for expectedErr, ms := range tests {
+		err := ms.validate()
+		if err == nil || !strings.Contains(
+			err.Error(), strings.Split(expectedErr, "%")[0]) {
+			t.Errorf("Unexpected error for %d migrations."+
+				"\nexpected: %s\nreceived: %+v", len(ms), expectedErr, err)
+		}
+	}
+}
+
+// Tests that OpenDatabase runs each upgrade once and runs a backfill only for
+// databases that existed before its migration.
+func TestOpenDatabase(t *testing.T) {
+	upgrades, backfills := 0, 0
+	v1 := Migration{Version: 1,
+		Upgrade: func(db *idb.Database, _ *UpgradeTransaction) error {
+			upgrades++
+			_, err := db.CreateObjectStore("messages", idb.ObjectStoreOptions{
+				KeyPath:       js.ValueOf("id"),
+				AutoIncrement: true,
+			})
+			return err
+		}}
+	v2 := Migration{Version: 2,
+		Upgrade: func(_ *idb.Database, txn *UpgradeTransaction) error {
+			upgrades++
+			return txn.CreateIndex("messages", "text_index",
+				js.ValueOf("text"), idb.IndexOptions{})
+		},
+		Backfill: func(*idb.Database) error {
+			backfills++
+			return nil
+		}}
+
+	// A new database does not need a backfill
+	db, err := OpenDatabase("TestOpenDatabase_new", 2, Migrations{v1, v2})
+	if err != nil {
+		t.Fatalf("Failed to open database: %+v", err)
+	}
+	db.Close()
+	if upgrades != 2 || backfills != 0 {
+		t.Errorf("Unexpected migrations for new database: "+
+			"%d upgrades, %d backfills", upgrades, backfills)
+	}
+
+	// An existing database is backfilled once
+	upgrades = 0
+	name := "TestOpenDatabase_existing"
+	if db, err = OpenDatabase(name, 1, Migrations{v1}); err != nil {
+		t.Fatalf("Failed to open database at v1: %+v", err)
+	}
+	db.Close()
+	for i := 0; i < 2; i++ {
+		db, err = OpenDatabase(name, 2, Migrations{v1, v2})
+		if err != nil {
+			t.Fatalf("Failed to open database at v2: %+v", err)
+		}
+		db.Close()
+	}
+	if upgrades != 2 || backfills != 1 {
+		t.Errorf("Unexpected migrations for existing database: "+
+			"%d upgrades, %d backfills", upgrades, backfills)
+	}
+
+	// The version must match the migrations
+	_, err = OpenDatabase(name, 3, Migrations{v1, v2})
+	if err == nil || !strings.Contains(
+		err.Error(), strings.Split(migrationVersionErr, "%")[0]) {
+		t.Errorf("Unexpected error for mismatched version."+
+			"\nexpected: %s\nreceived: %+v", migrationVersionErr, err)
+	}
+}
@@ -0,0 +1,320 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains message retention policies and the batched deletion of
+// the messages they no longer keep.
+
+package impl
+
+import (
+	"encoding/json"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+const (
+	// RetentionStoreName is the name of the [idb.ObjectStore] that holds the
+	// retention policy of each channel or conversation.
+	RetentionStoreName = "retention"
+
+	// retentionPkeyName is the key path of the retention object store.
+	retentionPkeyName = "id"
+
+	// RetentionSweepInterval is how often the database workers enforce the
+	// stored retention policies.
+	RetentionSweepInterval = 10 * time.Minute
+
+	// pruneBatchSize is the maximum number of messages deleted in a single
+	// transaction by PruneIndex.
+	pruneBatchSize = 250
+)
+
+// Error messages.
+const (
+	// RetentionPolicy.Validate
+	negativeMaxAgeErr   = "max age %s is negative"
+	negativeMaxCountErr = "max count %d is negative"
+)
+
+// RetentionPolicy limits which messages of a channel or conversation are
+// kept. Each rule is optional; a message is deleted if any rule does not keep
+// it. Pinned messages are always kept and do not count towards MaxCount.
+//
+// Example JSON (keep at most 500 messages from the last 30 days):
+//
+//	{
+//	  "maxAge": 2592000000000000,
+//	  "maxCount": 500
+//	}
+type RetentionPolicy struct {
+	// MaxAge deletes messages older than it. In JSON, it is in nanoseconds.
+	MaxAge time.Duration `json:"maxAge,omitempty"`
+
+	// MaxCount deletes all but the newest MaxCount messages.
+	MaxCount int `json:"maxCount,omitempty"`
+
+	// PinnedOnly deletes every message that is not pinned.
+	PinnedOnly bool `json:"pinnedOnly,omitempty"`
+}
+
+// IsZero returns true if the policy keeps every message.
+func (p RetentionPolicy) IsZero() bool {
+	return p == RetentionPolicy{}
+}
+
+// Validate returns an error if the policy has a negative limit.
+func (p RetentionPolicy) Validate() error {
+	if p.MaxAge < 0 {
+		return errors.Errorf(negativeMaxAgeErr, p.MaxAge)
+	} else if p.MaxCount < 0 {
+		return errors.Errorf(negativeMaxCountErr, p.MaxCount)
+	}
+	return nil
+}
+
+// Keeper returns a function that reports whether the policy keeps a message.
+// It counts the messages it keeps, so it must be called once for each message,
+// newest first.
+func (p RetentionPolicy) Keeper(
+	now time.Time) func(timestamp time.Time, pinned bool) bool {
+	kept := 0
+	return func(timestamp time.Time, pinned bool) bool {
+		switch {
+		case pinned:
+			return true
+		case p.PinnedOnly:
+			return false
+		case p.MaxAge > 0 && now.Sub(timestamp) > p.MaxAge:
+			return false
+		case p.MaxCount > 0 && kept >= p.MaxCount:
+			return false
+		}
+		kept++
+		return true
+	}
+}
+
+// RetentionRule is the retention policy of a single channel or conversation,
+// as stored in the retention object store.
+type RetentionRule struct {
+	// ID is the channel ID or partner public key that the policy applies to.
+	ID []byte `json:"id"` // Matches retentionPkeyName
+
+	RetentionPolicy
+}
+
+// CreateRetentionStore creates the retention object store. It must be called
+// from a database upgrade.
+func CreateRetentionStore(db *idb.Database) error {
+	_, err := db.CreateObjectStore(RetentionStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(retentionPkeyName),
+			AutoIncrement: false,
+		})
+	return err
+}
+
+// PutRetentionPolicy stores the retention policy for the channel or
+// conversation with the given ID. A zero policy removes the stored policy.
+func PutRetentionPolicy(
+	db *idb.Database, id []byte, policy RetentionPolicy) error {
+	if policy.IsZero() {
+		return Delete(db, RetentionStoreName, EncodeBytes(id))
+	}
+
+	ruleJson, err := json.Marshal(RetentionRule{ID: id, RetentionPolicy: policy})
+	if err != nil {
+		return errors.Errorf("Unable to marshal RetentionRule: %+v", err)
+	}
+	ruleObj, err := utils.JsonToJS(ruleJson)
+	if err != nil {
+		return errors.Errorf("Unable to marshal RetentionRule: %+v", err)
+	}
+
+	_, err = Put(db, RetentionStoreName, ruleObj)
+	return err
+}
+
+// GetRetentionRules returns every stored retention policy.
+func GetRetentionRules(db *idb.Database) ([]RetentionRule, error) {
+	values, err := GetAll(db, RetentionStoreName)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]RetentionRule, len(values))
+	for i, value := range values {
+		err = json.Unmarshal([]byte(utils.JsToJson(value)), &rules[i])
+		if err != nil {
+			return nil, errors.Errorf(
+				"Unable to unmarshal RetentionRule: %+v", err)
+		}
+	}
+	return rules, nil
+}
+
+// PruneIndex deletes every row in the key range of the index that keep
+// rejects. Rows are visited in descending index order and deleted in batches,
+// each in its own transaction, so that large deletions do not block other
+// writes. After each batch is committed, deleted is called with the value of
+// every row in it. Returns the number of deleted rows.
+func PruneIndex(db *idb.Database, objectStoreName, indexName string,
+	keyRange *idb.KeyRange, keep func(value js.Value) (bool, error),
+	deleted func(value js.Value)) (int, error) {
+	parentErr := errors.Errorf("failed to PruneIndex %s", indexName)
+
+	var total int
+	var resume *cursorPosition
+	for {
+		values, last, err := pruneBatch(
+			db, objectStoreName, indexName, keyRange, resume, keep)
+		if err != nil {
+			return total, errors.WithMessage(parentErr, err.Error())
+		}
+
+		for _, value := range values {
+			deleted(value)
+		}
+		total += len(values)
+
+		if len(values) < pruneBatchSize {
+			return total, nil
+		}
+		resume = last
+	}
+}
+
+// cursorPosition is the position of a cursor over an index.
+type cursorPosition struct {
+	key, primaryKey js.Value
+}
+
+// pruneBatch deletes up to pruneBatchSize rows rejected by keep in a single
+// transaction, starting after the resume position, if set. Returns the values
+// of the deleted rows and the position of the last one.
+func pruneBatch(db *idb.Database, objectStoreName, indexName string,
+	keyRange *idb.KeyRange, resume *cursorPosition,
+	keep func(value js.Value) (bool, error)) ([]js.Value, *cursorPosition, error) {
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadWrite, objectStoreName)
+	if err != nil {
+		return nil, nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return nil, nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(indexName)
+	if err != nil {
+		return nil, nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorPrevious)
+	if err != nil {
+		return nil, nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	var values []js.Value
+	var last *cursorPosition
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			key, err := cursor.Key()
+			if err != nil {
+				return err
+			}
+			primaryKey, err := cursor.PrimaryKey()
+			if err != nil {
+				return err
+			}
+
+			// Skip the rows visited by the previous batch
+			if resume != nil {
+				position := resume
+				resume = nil
+				if skip, err := position.before(key, primaryKey); err != nil {
+					return err
+				} else if skip {
+					return cursor.ContinuePrimaryKey(
+						position.key, position.primaryKey)
+				}
+			}
+
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			if ok, err := keep(value); err != nil || ok {
+				return err
+			}
+
+			if _, err = cursor.Delete(); err != nil {
+				return err
+			}
+			values = append(values, value)
+			last = &cursorPosition{key, primaryKey}
+			if len(values) == pruneBatchSize {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, nil, errors.Errorf("Unable to delete rows: %+v", err)
+	}
+
+	// Wait for the deletions to be committed
+	ctx, cancel := NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return nil, nil, errors.Errorf("Deleting rows failed: %+v", err)
+	}
+
+	return values, last, nil
+}
+
+// before returns true if the given index and primary key come before the
+// position in descending order.
+func (cp *cursorPosition) before(key, primaryKey js.Value) (bool, error) {
+	cmp, err := idb.Global().CompareKeys(key, cp.key)
+	if err != nil || cmp != 0 {
+		return cmp > 0, err
+	}
+	cmp, err = idb.Global().CompareKeys(primaryKey, cp.primaryKey)
+	return cmp > 0, err
+}
+
+// StartSweeper calls sweep now and then every interval in the background until
+// the returned function is called. Errors are logged.
+func StartSweeper(databaseName string, interval time.Duration,
+	sweep func() error) (stop func()) {
+	quit := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := sweep(); err != nil {
+				jww.ERROR.Printf("Failed to sweep %s: %+v", databaseName, err)
+			}
+			select {
+			case <-ticker.C:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(quit) }) }
+}
@@ -0,0 +1,202 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"strings"
+	"sync/atomic"
+	"syscall/js"
+	"testing"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+)
+
+// Tests that StartSweeper sweeps repeatedly until the returned function is
+// called and that calling it again does not panic.
+func TestStartSweeper(t *testing.T) {
+	var sweeps atomic.Int32
+	stop := StartSweeper("TestStartSweeper", time.Millisecond, func() error {
+		sweeps.Add(1)
+		return nil
+	})
+
+	for start := time.Now(); sweeps.Load() < 3; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Swept %d times before timeout.", sweeps.Load())
+		}
+	}
+	stop()
+	stop()
+
+	time.Sleep(10 * time.Millisecond)
+	stopped := sweeps.Load()
+	time.Sleep(10 * time.Millisecond)
+	if n := sweeps.Load(); n != stopped {
+		t.Errorf("Swept %d times after stopping.", n-stopped)
+	}
+}
+
+// Tests that the function returned by RetentionPolicy.Keeper keeps the
+// expected messages for each rule.
+func TestRetentionPolicy_Keeper(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	type msg struct {
+		age    time.Duration
+		pinned bool
+	}
+	msgs := []msg{
+		{time.Minute, false},
+		{time.Hour, true},
+		{2 * time.Hour, false},
+		{3 * time.Hour, false},
+		{48 * time.Hour, true},
+		{72 * time.Hour, false},
+	}
+
+	tests := []struct {
+		policy   RetentionPolicy
+		expected []bool
+	}{
+		{RetentionPolicy{},
+			[]bool{true, true, true, true, true, true}},
+		{RetentionPolicy{MaxAge: 24 * time.Hour},
+			[]bool{true, true, true, true, true, false}},
+		{RetentionPolicy{MaxCount: 2},
+			[]bool{true, true, true, false, true, false}},
+		{RetentionPolicy{MaxAge: 150 * time.Minute, MaxCount: 3},
+			[]bool{true, true, true, false, true, false}},
+		{RetentionPolicy{PinnedOnly: true},
+			[]bool{false, true, false, false, true, false}},
+	}
+
+	for i, tt := range tests {
+		keep := tt.policy.Keeper(now)
+		for j, m := range msgs {
+			if kept := keep(now.Add(-m.age), m.pinned); kept != tt.expected[j] {
+				t.Errorf("Unexpected result for message %d with policy #%d %+v."+
+					"\nexpected: %t\nreceived: %t",
+					j, i, tt.policy, tt.expected[j], kept)
+			}
+		}
+	}
+}
+
+// Tests that RetentionPolicy.Validate returns the expected error for negative
+// limits.
+func TestRetentionPolicy_Validate(t *testing.T) {
+	valid := RetentionPolicy{MaxAge: time.Hour, MaxCount: 5}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Failed to validate policy: %+v", err)
+	}
+
+	tests := map[string]RetentionPolicy{
+		negativeMaxAgeErr:   {MaxAge: -time.Hour},
+		negativeMaxCountErr: {MaxCount: -1},
+	}
+	for expectedErr, policy := range tests {
+		err := policy.Validate()
+		if err == nil || !strings.Contains(
+			err.Error(), strings.Split(expectedErr, "%")[0]) {
+			t.Errorf("Unexpected error for policy %+v."+
+				"\nexpected: %s\nreceived: %+v", policy, expectedErr, err)
+		}
+	}
+}
+
+// Tests that PruneIndex deletes every rejected row across several batches and
+// calls deleted once for each.
+func TestPruneIndex(t *testing.T) {
+	ctx, cancel := NewContext()
+	defer cancel()
+	openRequest, err := idb.Global().Open(ctx, "TestPruneIndex", 0,
+		func(db *idb.Database, _ uint, _ uint) error {
+			store, err := db.CreateObjectStore("messages",
+				idb.ObjectStoreOptions{
+					KeyPath:       js.ValueOf("id"),
+					AutoIncrement: true,
+				})
+			if err != nil {
+				return err
+			}
+			_, err = store.CreateIndex("group_index", js.ValueOf("group"),
+				idb.IndexOptions{})
+			return err
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages share a few index keys so that batches end mid-key
+	const n = 3*pruneBatchSize + 10
+	for i := 0; i < n; i++ {
+		_, err = Put(db, "messages", js.ValueOf(map[string]any{"group": i % 4}))
+		if err != nil {
+			t.Fatalf("Failed to put message %d: %+v", i, err)
+		}
+	}
+
+	keyRange, err := idb.NewKeyRangeBound(
+		js.ValueOf(1), js.ValueOf(3), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	visited := make(map[int]int)
+	deleted := make(map[int]bool)
+	count, err := PruneIndex(db, "messages", "group_index", keyRange,
+		func(value js.Value) (bool, error) {
+			visited[value.Get("id").Int()]++
+			return value.Get("id").Int()%3 == 0, nil
+		},
+		func(value js.Value) {
+			deleted[value.Get("id").Int()] = true
+		})
+	if err != nil {
+		t.Fatalf("Failed to prune: %+v", err)
+	}
+
+	expected := 0
+	for i := 1; i <= n; i++ {
+		group := (i - 1) % 4
+		if group < 1 || group > 3 {
+			if visited[i] != 0 {
+				t.Errorf("Message %d outside the key range was visited.", i)
+			}
+			continue
+		}
+		if visited[i] != 1 {
+			t.Errorf("Message %d visited %d times.", i, visited[i])
+		}
+		if i%3 != 0 {
+			expected++
+			if !deleted[i] {
+				t.Errorf("Message %d was not deleted.", i)
+			}
+		}
+	}
+	if count != expected || len(deleted) != expected {
+		t.Errorf("Unexpected number of deleted messages."+
+			"\nexpected: %d\nreceived: %d (%d deleted callbacks)",
+			expected, count, len(deleted))
+	}
+
+	rows, err := GetAll(db, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != n-expected {
+		t.Errorf("Unexpected number of remaining messages."+
+			"\nexpected: %d\nreceived: %d", n-expected, len(rows))
+	}
+}
@@ -0,0 +1,654 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the resumable re-encryption of a database with a new
+// cipher.
+
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+)
+
+const (
+	// KeyRotationStoreName is the name of the [idb.ObjectStore] that holds the
+	// checkpoint of an unfinished key rotation.
+	KeyRotationStoreName = "key_rotation"
+
+	// keyRotationPkeyName is the key path of the key rotation object store.
+	keyRotationPkeyName = "id"
+
+	// keyRotationCheckpointKey is the key of the checkpoint row.
+	keyRotationCheckpointKey = "checkpoint"
+
+	// keyRotationCanary is encrypted with the new cipher and stored in the
+	// checkpoint, so that an unfinished rotation is only resumed with the
+	// same cipher.
+	keyRotationCanary = "xxdkKeyRotationCanary"
+
+	// keyRotationBatchSize is the maximum number of rows re-encrypted in a
+	// single transaction.
+	keyRotationBatchSize = 250
+
+	// encryptedBlockSeparator separates the blocks of text encrypted by
+	// encryptBlocks. Text encrypted by an [idbCrypto.Cipher] is base32768
+	// encoded, which never contains it.
+	encryptedBlockSeparator = " "
+)
+
+// Error messages.
+const (
+	// NewKeyRotation
+	keyRotationMismatchErr = "an unfinished key rotation to a different " +
+		"key must be finished first"
+	keyRotationUnknownStoreErr = "unfinished key rotation is of unknown " +
+		"object store %q"
+	keyRotationSameKeyErr = "the new key is the same as the current key; " +
+		"it must be made from a new password"
+
+	// OpenCipher
+	openRotationErr = "database has an unfinished key rotation and must " +
+		"be opened with the key it is being rotated to"
+	openDecryptionErr = "database is being decrypted and must be opened " +
+		"with its old key until it is done"
+	openRotationFromErr = "failed to load the old key of the unfinished " +
+		"key rotation: %+v"
+
+	// RotationCipher.Decrypt
+	rotationDecryptErr = "text is not encrypted with either key: %+v"
+
+	// RotationCipher.MarshalJSON
+	rotationMarshalErr = "cannot marshal the cipher of a rotation to an " +
+		"unencrypted database"
+
+	// RotationCipher.UnmarshalJSON
+	rotationUnmarshalErr = "cannot unmarshal the cipher of a rotation"
+)
+
+// EncryptedStore is an [idb.ObjectStore] with rows that have fields encrypted
+// with the database cipher.
+type EncryptedStore struct {
+	// Name is the name of the object store.
+	Name string
+
+	// Fields are the keys of the string fields of each row that hold
+	// encrypted text.
+	Fields []string
+}
+
+// KeyRotationProgress is the progress of a key rotation, reported after each
+// batch.
+//
+// Example JSON:
+//
+//	{
+//	  "store": "messages",
+//	  "rotated": 500,
+//	  "total": 1234,
+//	  "done": false
+//	}
+type KeyRotationProgress struct {
+	// Store is the name of the object store being re-encrypted.
+	Store string `json:"store"`
+
+	// Rotated is the number of rows of the store that have been re-encrypted.
+	Rotated int `json:"rotated"`
+
+	// Total is the number of rows in the store.
+	Total int `json:"total"`
+
+	// Done is true once every store has been re-encrypted.
+	Done bool `json:"done"`
+}
+
+// KeyRotation re-encrypts the encrypted fields of every row of a database from
+// one cipher to another. Rows are re-encrypted in batches, each in its own
+// transaction with a checkpoint, so that a rotation that is interrupted can be
+// resumed by a new KeyRotation to the same cipher.
+//
+// Once every row is re-encrypted, the search index is cleared and marked for
+// [SearchIndex.Backfill], since its tokens are keyed on the old cipher.
+type KeyRotation struct {
+	db     *idb.Database
+	stores []EncryptedStore
+	cipher *RotationCipher
+	canary string
+
+	// from is the JSON of the old cipher encrypted with the new cipher by
+	// encryptBlocks, so that the database can be opened with the new cipher
+	// until the rotation is done (see OpenCipher). It is empty if the database
+	// is being decrypted.
+	from string
+
+	// store is the index of the store being re-encrypted, last is the primary
+	// key of its last re-encrypted row, and rotated is the number of its rows
+	// that have been re-encrypted.
+	store   int
+	last    js.Value
+	rotated int
+}
+
+// NewKeyRotation returns a KeyRotation of the stores from one cipher to
+// another. Either cipher is nil for an unencrypted database. If a rotation was
+// interrupted, it is resumed; returns an error if it was to a different
+// cipher. A new rotation must be to a different key than the current one.
+func NewKeyRotation(db *idb.Database, from, to idbCrypto.Cipher,
+	stores []EncryptedStore) (*KeyRotation, error) {
+	// A database opened during an unfinished rotation already reads with the
+	// old cipher
+	if rc, ok := from.(*RotationCipher); ok {
+		from = rc.from
+	}
+
+	kr := &KeyRotation{
+		db:     db,
+		stores: stores,
+		cipher: &RotationCipher{from: from, to: to},
+		last:   js.Undefined(),
+	}
+
+	checkpoint, exists, err := getCheckpoint(db)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		if from != nil && to != nil && sameKey(from, to) {
+			return nil, errors.New(keyRotationSameKeyErr)
+		}
+		kr.canary, err = encryptBlocks(to, []byte(keyRotationCanary))
+		if err != nil {
+			return nil, err
+		}
+		if to != nil {
+			fromJSON, err := json.Marshal(from)
+			if err != nil {
+				return nil, err
+			}
+			kr.from, err = encryptBlocks(to, fromJSON)
+			return kr, err
+		}
+		return kr, nil
+	}
+
+	// Resume the unfinished rotation
+	kr.canary = checkpoint.Get("canary").String()
+	if !kr.Matches(to) {
+		return nil, errors.New(keyRotationMismatchErr)
+	}
+	if fromText := checkpoint.Get("from"); fromText.Type() == js.TypeString {
+		kr.from = fromText.String()
+	}
+
+	storeName := checkpoint.Get("store").String()
+	kr.store = -1
+	for i := range stores {
+		if stores[i].Name == storeName {
+			kr.store = i
+		}
+	}
+	if kr.store < 0 {
+		return nil, errors.Errorf(keyRotationUnknownStoreErr, storeName)
+	}
+	kr.last = checkpoint.Get("last")
+	kr.rotated = checkpoint.Get("rotated").Int()
+
+	jww.INFO.Printf("Resuming key rotation of %s after %d rows",
+		storeName, kr.rotated)
+	return kr, nil
+}
+
+// Matches returns true if the rotation is to the cipher.
+func (kr *KeyRotation) Matches(to idbCrypto.Cipher) bool {
+	return canaryMatches(to, kr.canary)
+}
+
+// OpenCipher returns the cipher to use for a database opened with the cipher.
+// If the database has an unfinished key rotation, it must be opened with the
+// cipher it is being rotated to, or with the old cipher if it is being
+// decrypted. A [RotationCipher] of both is then returned, so that text
+// encrypted with either is read and new text is encrypted with the new cipher
+// until the rotation is resumed with [NewKeyRotation].
+func OpenCipher(db *idb.Database, c idbCrypto.Cipher,
+	csprng io.Reader) (idbCrypto.Cipher, error) {
+	checkpoint, exists, err := getCheckpoint(db)
+	if err != nil || !exists {
+		return c, err
+	}
+
+	canary := checkpoint.Get("canary").String()
+	if !canaryMatches(c, canary) {
+		// A database being decrypted is opened with its old cipher
+		if c != nil && canaryMatches(nil, canary) {
+			return &RotationCipher{from: c, to: nil}, nil
+		}
+		return nil, errors.New(openRotationErr)
+	} else if c == nil {
+		return nil, errors.New(openDecryptionErr)
+	}
+
+	from := checkpoint.Get("from")
+	if from.Type() != js.TypeString {
+		return nil, errors.Errorf(openRotationFromErr, "checkpoint has no key")
+	}
+	fromJSON, err := decryptBlocks(c, from.String())
+	if err != nil {
+		return nil, errors.Errorf(openRotationFromErr, err)
+	}
+	fromCipher, err := NewCipherFromJSON(fromJSON, csprng)
+	if err != nil {
+		return nil, errors.Errorf(openRotationFromErr, err)
+	}
+
+	jww.INFO.Printf("Opened database with an unfinished key rotation")
+	return &RotationCipher{from: fromCipher, to: c}, nil
+}
+
+// HasKeyRotation returns true if the database has an unfinished key rotation.
+func HasKeyRotation(db *idb.Database) (bool, error) {
+	_, exists, err := getCheckpoint(db)
+	return exists, err
+}
+
+// getCheckpoint returns the checkpoint of the unfinished key rotation of the
+// database. Returns false if there is none.
+func getCheckpoint(db *idb.Database) (js.Value, bool, error) {
+	checkpoint, err := Get(db, KeyRotationStoreName,
+		js.ValueOf(keyRotationCheckpointKey))
+	if err != nil {
+		if strings.Contains(err.Error(), ErrDoesNotExist) {
+			return js.Undefined(), false, nil
+		}
+		return js.Undefined(), false, err
+	}
+	return checkpoint, true, nil
+}
+
+// canaryMatches returns true if the canary was encrypted with the cipher.
+func canaryMatches(c idbCrypto.Cipher, canary string) bool {
+	plaintext, err := decryptBlocks(c, canary)
+	return err == nil && string(plaintext) == keyRotationCanary
+}
+
+// sameKey returns true if both ciphers have the same secret. Ciphers made from
+// the same password and salt have the same secret.
+func sameKey(a, b idbCrypto.Cipher) bool {
+	var secrets [2]struct {
+		Secret []byte `json:"secret"`
+	}
+	for i, c := range []idbCrypto.Cipher{a, b} {
+		cipherJSON, err := json.Marshal(c)
+		if err != nil {
+			return false
+		} else if err = json.Unmarshal(cipherJSON, &secrets[i]); err != nil {
+			return false
+		}
+	}
+	return len(secrets[0].Secret) > 0 &&
+		bytes.Equal(secrets[0].Secret, secrets[1].Secret)
+}
+
+// Cipher returns the cipher to use for the database until the rotation is
+// done.
+func (kr *KeyRotation) Cipher() *RotationCipher {
+	return kr.cipher
+}
+
+// Next re-encrypts the next batch of rows. Once the last batch is
+// re-encrypted, the returned progress is done.
+func (kr *KeyRotation) Next() (KeyRotationProgress, error) {
+	parentErr := errors.New("failed to rotate database key")
+
+	if kr.store == len(kr.stores) {
+		if err := kr.finish(); err != nil {
+			return KeyRotationProgress{}, errors.WithMessage(parentErr, err.Error())
+		}
+		return KeyRotationProgress{Done: true}, nil
+	}
+
+	store := kr.stores[kr.store]
+	n, err := kr.rotateBatch(store)
+	if err != nil {
+		return KeyRotationProgress{}, errors.WithMessage(parentErr, err.Error())
+	}
+	total, err := Count(kr.db, store.Name)
+	if err != nil {
+		return KeyRotationProgress{}, errors.WithMessage(parentErr, err.Error())
+	}
+	progress := KeyRotationProgress{
+		Store:   store.Name,
+		Rotated: kr.rotated,
+		Total:   int(total),
+	}
+
+	// Move on to the next store once this one is done
+	if n < keyRotationBatchSize {
+		kr.store++
+		kr.last = js.Undefined()
+		kr.rotated = 0
+
+		if kr.store == len(kr.stores) {
+			if err = kr.finish(); err != nil {
+				return progress, errors.WithMessage(parentErr, err.Error())
+			}
+			progress.Done = true
+		}
+	}
+
+	return progress, nil
+}
+
+// rotateBatch re-encrypts up to keyRotationBatchSize rows of the store after
+// the last re-encrypted row and saves the checkpoint in the same transaction.
+// Returns the number of re-encrypted rows.
+func (kr *KeyRotation) rotateBatch(es EncryptedStore) (int, error) {
+	// Prepare the Transaction
+	txn, err := kr.db.Transaction(
+		idb.TransactionReadWrite, es.Name, KeyRotationStoreName)
+	if err != nil {
+		return 0, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(es.Name)
+	if err != nil {
+		return 0, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	checkpointStore, err := txn.ObjectStore(KeyRotationStoreName)
+	if err != nil {
+		return 0, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+
+	var cursorRequest *idb.CursorWithValueRequest
+	if kr.last.IsUndefined() {
+		cursorRequest, err = store.OpenCursor(idb.CursorNext)
+	} else {
+		var keyRange *idb.KeyRange
+		keyRange, err = idb.NewKeyRangeLowerBound(kr.last, true)
+		if err != nil {
+			return 0, errors.Errorf("Unable to NewKeyRangeLowerBound: %+v", err)
+		}
+		cursorRequest, err = store.OpenCursorRange(keyRange, idb.CursorNext)
+	}
+	if err != nil {
+		return 0, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	n := 0
+	last := kr.last
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			for _, field := range es.Fields {
+				text := value.Get(field)
+				if text.Type() != js.TypeString {
+					continue
+				}
+				rotated, err := kr.cipher.reencrypt(text.String())
+				if err != nil {
+					return err
+				}
+				value.Set(field, rotated)
+			}
+			if _, err = cursor.Update(value); err != nil {
+				return err
+			}
+
+			if last, err = cursor.PrimaryKey(); err != nil {
+				return err
+			}
+			n++
+			if n == keyRotationBatchSize {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		if abortErr := txn.Abort(); abortErr != nil {
+			jww.ERROR.Printf("Failed to abort Transaction: %+v", abortErr)
+		}
+		return 0, errors.Errorf("Unable to re-encrypt rows: %+v", err)
+	}
+
+	if n > 0 {
+		_, err = checkpointStore.Put(js.ValueOf(map[string]any{
+			keyRotationPkeyName: keyRotationCheckpointKey,
+			"canary":            kr.canary,
+			"from":              kr.from,
+			"store":             es.Name,
+			"last":              last,
+			"rotated":           kr.rotated + n,
+		}))
+		if err != nil {
+			return 0, errors.Errorf("Unable to save checkpoint: %+v", err)
+		}
+	}
+
+	// Wait for the batch to be committed
+	ctx, cancel := NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return 0, errors.Errorf("Re-encrypting rows failed: %+v", err)
+	}
+
+	kr.last = last
+	kr.rotated += n
+	return n, nil
+}
+
+// finish clears the search index, marks it for backfill, and deletes the
+// checkpoint in a single transaction.
+func (kr *KeyRotation) finish() error {
+	txn, err := kr.db.Transaction(
+		idb.TransactionReadWrite, SearchStoreName, KeyRotationStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	searchStore, err := txn.ObjectStore(SearchStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	checkpointStore, err := txn.ObjectStore(KeyRotationStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+
+	if _, err = searchStore.Clear(); err != nil {
+		return errors.Errorf("Unable to clear search index: %+v", err)
+	}
+	_, err = searchStore.Put(js.ValueOf(map[string]any{
+		searchPkeyName: searchBackfillKey}))
+	if err != nil {
+		return errors.Errorf("Unable to mark search index: %+v", err)
+	}
+	_, err = checkpointStore.Delete(js.ValueOf(keyRotationCheckpointKey))
+	if err != nil {
+		return errors.Errorf("Unable to delete checkpoint: %+v", err)
+	}
+
+	ctx, cancel := NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return errors.Errorf("Finishing key rotation failed: %+v", err)
+	}
+	return nil
+}
+
+// CreateKeyRotationStore creates the key rotation object store. It must be
+// called from a database upgrade.
+func CreateKeyRotationStore(db *idb.Database) error {
+	_, err := db.CreateObjectStore(KeyRotationStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(keyRotationPkeyName),
+			AutoIncrement: false,
+		})
+	return err
+}
+
+// RotationCipher is the cipher of a database during a key rotation, when text
+// may be encrypted with either the old or the new cipher. It encrypts with the
+// new cipher and decrypts with whichever cipher the text was encrypted with.
+// It adheres to the [idbCrypto.Cipher] interface.
+type RotationCipher struct {
+	from, to idbCrypto.Cipher
+}
+
+// From returns the cipher that the database is being rotated from.
+func (rc *RotationCipher) From() idbCrypto.Cipher {
+	return rc.from
+}
+
+// To returns the cipher that the database is being rotated to.
+func (rc *RotationCipher) To() idbCrypto.Cipher {
+	return rc.to
+}
+
+// Encrypt encrypts the plaintext with the new cipher. If the database is
+// being rotated to unencrypted, the plaintext is returned as is.
+func (rc *RotationCipher) Encrypt(plaintext []byte) (string, error) {
+	return encryptText(rc.to, plaintext)
+}
+
+// Decrypt decrypts text encrypted with either cipher. If either cipher is nil,
+// text that neither can decrypt is returned as is.
+func (rc *RotationCipher) Decrypt(ciphertext string) ([]byte, error) {
+	var err error
+	for _, c := range []idbCrypto.Cipher{rc.to, rc.from} {
+		if c == nil {
+			continue
+		}
+		var plaintext []byte
+		if plaintext, err = c.Decrypt(ciphertext); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	// The text is not encrypted
+	if rc.to == nil || rc.from == nil {
+		return []byte(ciphertext), nil
+	}
+	return nil, errors.Errorf(rotationDecryptErr, err)
+}
+
+// MarshalJSON marshals the new cipher.
+func (rc *RotationCipher) MarshalJSON() ([]byte, error) {
+	if rc.to == nil {
+		return nil, errors.New(rotationMarshalErr)
+	}
+	return rc.to.MarshalJSON()
+}
+
+// UnmarshalJSON always returns an error; a RotationCipher is only made by
+// NewKeyRotation.
+func (rc *RotationCipher) UnmarshalJSON([]byte) error {
+	return errors.New(rotationUnmarshalErr)
+}
+
+// reencrypt decrypts the text with either cipher and encrypts it with the new
+// cipher.
+func (rc *RotationCipher) reencrypt(text string) (string, error) {
+	plaintext, err := rc.Decrypt(text)
+	if err != nil {
+		return "", err
+	}
+	return rc.Encrypt(plaintext)
+}
+
+// NewCipherFromJSON unmarshalls the cipher sent from the main thread. Unlike
+// [idbCrypto.NewCipherFromJSON], it returns a nil cipher for the JSON null of
+// an unencrypted database, so that the cipher can be compared to nil.
+func NewCipherFromJSON(
+	data []byte, csprng io.Reader) (idbCrypto.Cipher, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+	return idbCrypto.NewCipherFromJSON(data, csprng)
+}
+
+// encryptText encrypts the plaintext with the cipher. If the cipher is nil, the
+// plaintext is returned as is.
+func encryptText(c idbCrypto.Cipher, plaintext []byte) (string, error) {
+	if c == nil {
+		return string(plaintext), nil
+	}
+	return c.Encrypt(plaintext)
+}
+
+// decryptText decrypts the text with the cipher. If the cipher is nil, the text
+// is returned as is.
+func decryptText(c idbCrypto.Cipher, text string) ([]byte, error) {
+	if c == nil {
+		return []byte(text), nil
+	}
+	return c.Decrypt(text)
+}
+
+// encryptBlocks encrypts the plaintext with the cipher like encryptText, but
+// in blocks no larger than the block size of the cipher, so that plaintext of
+// any length can be encrypted.
+func encryptBlocks(c idbCrypto.Cipher, plaintext []byte) (string, error) {
+	blockSize := cipherBlockSize(c)
+	if c == nil || blockSize == 0 {
+		return encryptText(c, plaintext)
+	}
+
+	blocks := make([]string, 0, len(plaintext)/blockSize+1)
+	for len(blocks) == 0 || len(plaintext) > 0 {
+		n := min(blockSize, len(plaintext))
+		block, err := c.Encrypt(plaintext[:n])
+		if err != nil {
+			return "", err
+		}
+		blocks = append(blocks, block)
+		plaintext = plaintext[n:]
+	}
+	return strings.Join(blocks, encryptedBlockSeparator), nil
+}
+
+// decryptBlocks decrypts text encrypted by encryptBlocks.
+func decryptBlocks(c idbCrypto.Cipher, text string) ([]byte, error) {
+	if c == nil {
+		return decryptText(c, text)
+	}
+
+	var plaintext []byte
+	for _, block := range strings.Split(text, encryptedBlockSeparator) {
+		decrypted, err := c.Decrypt(block)
+		if err != nil {
+			return nil, err
+		}
+		plaintext = append(plaintext, decrypted...)
+	}
+	return plaintext, nil
+}
+
+// cipherBlockSize returns the largest plaintext that the cipher encrypts, read
+// from its JSON as in sameKey. Returns 0 if it is unknown.
+func cipherBlockSize(c idbCrypto.Cipher) int {
+	var params struct {
+		BlockSize int `json:"blockSize"`
+	}
+	cipherJSON, err := json.Marshal(c)
+	if err != nil {
+		return 0
+	} else if err = json.Unmarshal(cipherJSON, &params); err != nil {
+		return 0
+	}
+	return max(params.BlockSize, 0)
+}
@@ -0,0 +1,385 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"testing"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that RotationCipher.Decrypt decrypts text encrypted with either cipher
+// and that RotationCipher.Encrypt encrypts with the new cipher.
+func TestRotationCipher(t *testing.T) {
+	from := newTestCipher("fromPass", t)
+	to := newTestCipher("toPass", t)
+
+	tests := []struct{ from, to idbCrypto.Cipher }{
+		{from, to},
+		{nil, to},
+		{from, nil},
+	}
+	for i, tt := range tests {
+		rc := &RotationCipher{from: tt.from, to: tt.to}
+		for _, c := range []idbCrypto.Cipher{tt.from, tt.to} {
+			text, err := encryptText(c, []byte("hello"))
+			if err != nil {
+				t.Fatalf("Failed to encrypt (%d): %+v", i, err)
+			}
+			rotated, err := rc.reencrypt(text)
+			if err != nil {
+				t.Fatalf("Failed to re-encrypt (%d): %+v", i, err)
+			}
+			plaintext, err := decryptText(tt.to, rotated)
+			if err != nil {
+				t.Fatalf("Failed to decrypt with new cipher (%d): %+v", i, err)
+			} else if string(plaintext) != "hello" {
+				t.Errorf("Unexpected plaintext (%d).\nexpected: %q\nreceived: %q",
+					i, "hello", plaintext)
+			}
+		}
+	}
+
+	// Text encrypted with neither cipher cannot be decrypted
+	other, err := newTestCipher("otherPass", t).Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	_, err = (&RotationCipher{from: from, to: to}).Decrypt(other)
+	if err == nil || !strings.Contains(
+		err.Error(), strings.Split(rotationDecryptErr, "%")[0]) {
+		t.Errorf("Unexpected error for text of another cipher."+
+			"\nexpected: %s\nreceived: %+v", rotationDecryptErr, err)
+	}
+}
+
+// Tests that NewCipherFromJSON returns a nil cipher for JSON null and
+// unmarshalls any other cipher.
+func TestNewCipherFromJSON(t *testing.T) {
+	cipher, err := NewCipherFromJSON([]byte("null"), csprng.NewSystemRNG())
+	if err != nil {
+		t.Errorf("Failed to unmarshal null cipher: %+v", err)
+	} else if cipher != nil {
+		t.Errorf("Cipher of JSON null is not nil: %#v", cipher)
+	}
+
+	cipherJSON, err := newTestCipher("testPass", t).MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal cipher: %+v", err)
+	}
+	cipher, err = NewCipherFromJSON(cipherJSON, csprng.NewSystemRNG())
+	if err != nil {
+		t.Errorf("Failed to unmarshal cipher: %+v", err)
+	} else if cipher == nil {
+		t.Errorf("Cipher is nil.")
+	}
+}
+
+// Tests that KeyRotation re-encrypts every row in batches, that it is resumed
+// after being interrupted only with the same cipher, and that the search index
+// is marked for backfill once done.
+func TestKeyRotation(t *testing.T) {
+	db := newTestDB("TestKeyRotation", "messages", "index",
+		createRotationStores, t)
+	from := newTestCipher("fromPass", t)
+	to := newTestCipher("toPass", t)
+	stores := []EncryptedStore{{Name: "messages", Fields: []string{"text"}}}
+
+	const numRows = keyRotationBatchSize + 10
+	for i := 0; i < numRows; i++ {
+		text, err := from.Encrypt([]byte("message " + strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %+v", err)
+		}
+		_, err = Put(db, "messages", js.ValueOf(map[string]any{"text": text}))
+		if err != nil {
+			t.Fatalf("Failed to put message: %+v", err)
+		}
+	}
+
+	kr, err := NewKeyRotation(db, from, to, stores)
+	if err != nil {
+		t.Fatalf("Failed to create key rotation: %+v", err)
+	}
+	progress, err := kr.Next()
+	if err != nil {
+		t.Fatalf("Failed to rotate batch: %+v", err)
+	}
+	expected := KeyRotationProgress{
+		Store: "messages", Rotated: keyRotationBatchSize, Total: numRows}
+	if progress != expected {
+		t.Errorf("Unexpected progress.\nexpected: %+v\nreceived: %+v",
+			expected, progress)
+	}
+
+	// Resume the interrupted rotation
+	_, err = NewKeyRotation(db, from, newTestCipher("otherPass", t), stores)
+	if err == nil || err.Error() != keyRotationMismatchErr {
+		t.Errorf("Unexpected error resuming with another cipher."+
+			"\nexpected: %s\nreceived: %+v", keyRotationMismatchErr, err)
+	}
+	kr, err = NewKeyRotation(db, from, to, stores)
+	if err != nil {
+		t.Fatalf("Failed to resume key rotation: %+v", err)
+	}
+	for !progress.Done {
+		if progress, err = kr.Next(); err != nil {
+			t.Fatalf("Failed to rotate batch: %+v", err)
+		}
+	}
+
+	values, err := GetAll(db, "messages")
+	if err != nil {
+		t.Fatalf("Failed to get messages: %+v", err)
+	}
+	for i, value := range values {
+		plaintext, err := to.Decrypt(value.Get("text").String())
+		if err != nil {
+			t.Errorf("Failed to decrypt message %d with new cipher: %+v", i, err)
+			continue
+		}
+		expected := "message " + strconv.Itoa(i)
+		if string(plaintext) != expected {
+			t.Errorf("Unexpected message %d.\nexpected: %q\nreceived: %q",
+				i, expected, plaintext)
+		}
+	}
+
+	if _, err = Get(db, KeyRotationStoreName,
+		js.ValueOf(keyRotationCheckpointKey)); err == nil {
+		t.Errorf("Checkpoint not deleted after rotation.")
+	}
+	if _, err = Get(db, SearchStoreName,
+		js.ValueOf(searchBackfillKey)); err != nil {
+		t.Errorf("Search index not marked for backfill: %+v", err)
+	}
+}
+
+// Tests that NewKeyRotation returns an error for a new rotation to a cipher
+// with the same key as the current one.
+func TestNewKeyRotation_SameKey(t *testing.T) {
+	db := newTestDB("TestNewKeyRotation_SameKey", "messages", "index",
+		createRotationStores, t)
+	stores := []EncryptedStore{{Name: "messages", Fields: []string{"text"}}}
+
+	_, err := NewKeyRotation(db, newTestCipher("testPass", t),
+		newTestCipher("testPass", t), stores)
+	if err == nil || err.Error() != keyRotationSameKeyErr {
+		t.Errorf("Unexpected error for the same key."+
+			"\nexpected: %s\nreceived: %+v", keyRotationSameKeyErr, err)
+	}
+}
+
+// Tests that OpenCipher only opens a database with an unfinished key rotation
+// with the new cipher, or the old cipher if it is being decrypted, and that
+// the returned cipher reads text encrypted with either cipher.
+func TestOpenCipher(t *testing.T) {
+	from := newTestCipher("fromPass", t)
+	to := newTestCipher("toPass", t)
+
+	tests := []struct {
+		name     string
+		to, open idbCrypto.Cipher
+		valid    bool
+	}{
+		{"TestOpenCipher_New", to, to, true},
+		{"TestOpenCipher_Old", to, from, false},
+		{"TestOpenCipher_Nil", to, nil, false},
+		{"TestOpenCipher_DecryptOld", nil, from, true},
+		{"TestOpenCipher_DecryptNil", nil, nil, false},
+	}
+	for _, tt := range tests {
+		db := newTestDB(tt.name, "messages", "index", createRotationStores, t)
+		stores := []EncryptedStore{{Name: "messages", Fields: []string{"text"}}}
+		text, err := from.Encrypt([]byte("message"))
+		if err != nil {
+			t.Fatalf("Failed to encrypt (%s): %+v", tt.name, err)
+		}
+		for i := 0; i < keyRotationBatchSize+1; i++ {
+			row := js.ValueOf(map[string]any{"text": text})
+			if _, err = Put(db, "messages", row); err != nil {
+				t.Fatalf("Failed to put message (%s): %+v", tt.name, err)
+			}
+		}
+
+		// Interrupt the rotation after the first batch
+		kr, err := NewKeyRotation(db, from, tt.to, stores)
+		if err != nil {
+			t.Fatalf("Failed to create key rotation (%s): %+v", tt.name, err)
+		} else if _, err = kr.Next(); err != nil {
+			t.Fatalf("Failed to rotate batch (%s): %+v", tt.name, err)
+		}
+
+		c, err := OpenCipher(db, tt.open, csprng.NewSystemRNG())
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("Opened with the wrong cipher (%s).", tt.name)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Failed to open (%s): %+v", tt.name, err)
+			continue
+		}
+
+		rotated, err := encryptText(tt.to, []byte("message"))
+		if err != nil {
+			t.Fatalf("Failed to encrypt (%s): %+v", tt.name, err)
+		}
+		for _, ciphertext := range []string{text, rotated} {
+			plaintext, err := c.Decrypt(ciphertext)
+			if err != nil {
+				t.Errorf("Failed to decrypt (%s): %+v", tt.name, err)
+			} else if string(plaintext) != "message" {
+				t.Errorf("Unexpected plaintext (%s).\nexpected: %q"+
+					"\nreceived: %q", tt.name, "message", plaintext)
+			}
+		}
+	}
+}
+
+// Tests that OpenCipher returns the cipher as is for a database without an
+// unfinished key rotation.
+func TestOpenCipher_NoRotation(t *testing.T) {
+	db := newTestDB("TestOpenCipher_NoRotation", "messages", "index",
+		createRotationStores, t)
+	cipher := newTestCipher("testPass", t)
+
+	c, err := OpenCipher(db, cipher, csprng.NewSystemRNG())
+	if err != nil {
+		t.Errorf("Failed to open: %+v", err)
+	} else if c != cipher {
+		t.Errorf("Unexpected cipher.\nexpected: %#v\nreceived: %#v", cipher, c)
+	}
+}
+
+// Tests that a key rotation to a cipher with a block size smaller than the JSON
+// of the old cipher and the canary can be interrupted and opened with the new
+// cipher, which then reads text encrypted with either cipher.
+func TestOpenCipher_SmallBlockSize(t *testing.T) {
+	db := newTestDB("TestOpenCipher_SmallBlockSize", "messages", "index",
+		createRotationStores, t)
+	stores := []EncryptedStore{{Name: "messages", Fields: []string{"text"}}}
+	from := newTestCipher("fromPass", t)
+	to, err := idbCrypto.NewCipher(
+		[]byte("toPass"), []byte("testSalt"), 8, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	text, err := from.Encrypt([]byte("message"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	for i := 0; i < keyRotationBatchSize+1; i++ {
+		row := js.ValueOf(map[string]any{"text": text})
+		if _, err = Put(db, "messages", row); err != nil {
+			t.Fatalf("Failed to put message: %+v", err)
+		}
+	}
+
+	// Interrupt the rotation after the first batch
+	kr, err := NewKeyRotation(db, from, to, stores)
+	if err != nil {
+		t.Fatalf("Failed to create key rotation: %+v", err)
+	} else if _, err = kr.Next(); err != nil {
+		t.Fatalf("Failed to rotate batch: %+v", err)
+	}
+
+	c, err := OpenCipher(db, to, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to open: %+v", err)
+	}
+	rotated, err := to.Encrypt([]byte("message"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	for _, ciphertext := range []string{text, rotated} {
+		plaintext, err := c.Decrypt(ciphertext)
+		if err != nil {
+			t.Errorf("Failed to decrypt: %+v", err)
+		} else if string(plaintext) != "message" {
+			t.Errorf("Unexpected plaintext.\nexpected: %q\nreceived: %q",
+				"message", plaintext)
+		}
+	}
+
+	if _, err = NewKeyRotation(db, c, to, stores); err != nil {
+		t.Errorf("Failed to resume key rotation: %+v", err)
+	}
+}
+
+// Tests that decryptBlocks returns the plaintext of any length encrypted by
+// encryptBlocks in blocks of the block size of the cipher.
+func Test_encryptBlocks(t *testing.T) {
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 8, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	for _, n := range []int{0, 1, 8, 9, 16, 100} {
+		plaintext := []byte(strings.Repeat("a", n))
+		text, err := encryptBlocks(c, plaintext)
+		if err != nil {
+			t.Errorf("Failed to encrypt %d bytes: %+v", n, err)
+			continue
+		}
+		blocks := max(1, (n+7)/8)
+		count := strings.Count(text, encryptedBlockSeparator) + 1
+		if count != blocks {
+			t.Errorf("Unexpected number of blocks for %d bytes."+
+				"\nexpected: %d\nreceived: %d", n, blocks, count)
+		}
+
+		decrypted, err := decryptBlocks(c, text)
+		if err != nil {
+			t.Errorf("Failed to decrypt %d bytes: %+v", n, err)
+		} else if !bytes.Equal(plaintext, decrypted) {
+			t.Errorf("Unexpected plaintext.\nexpected: %q\nreceived: %q",
+				plaintext, decrypted)
+		}
+	}
+}
+
+// Tests that sameKey is true only for ciphers made from the same password.
+func Test_sameKey(t *testing.T) {
+	if !sameKey(newTestCipher("testPass", t), newTestCipher("testPass", t)) {
+		t.Errorf("Ciphers of the same password do not have the same key.")
+	}
+	if sameKey(newTestCipher("testPass", t), newTestCipher("otherPass", t)) {
+		t.Errorf("Ciphers of different passwords have the same key.")
+	}
+}
+
+// newTestCipher creates a new cipher with the given password.
+func newTestCipher(password string, t *testing.T) idbCrypto.Cipher {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte(password), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+	return cipher
+}
+
+// createRotationStores creates the search index and key rotation object stores
+// of a database made by newTestDB.
+func createRotationStores(db *idb.Database) error {
+	if err := CreateSearchStore(db); err != nil {
+		return err
+	}
+	return CreateKeyRotationStore(db)
+}
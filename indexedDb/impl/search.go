@@ -0,0 +1,353 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains a full-text search index for encrypted message text. Each
+// normalized term of a message is replaced by a blind token, the keyed HMAC of
+// the term, so that the index can be stored without revealing the text.
+
+package impl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"unicode"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+)
+
+const (
+	// SearchStoreName is the name of the [idb.ObjectStore] that holds the
+	// search index. Each row is keyed on "<token>/<uuid>", so the messages
+	// containing a term are found with a key range on its token.
+	SearchStoreName = "search_tokens"
+
+	// searchPkeyName is the key path of the search index object store.
+	searchPkeyName = "id"
+
+	// searchBackfillKey is the key of the row that marks that the messages
+	// stored before the search index existed still need to be indexed.
+	searchBackfillKey = "backfill"
+
+	// searchKeyLabel is the HMAC message used to derive the search index key
+	// from the database secret.
+	searchKeyLabel = "xxdkSearchIndexKey"
+
+	// searchTokenLen is the length, in bytes, of a truncated blind token.
+	searchTokenLen = 16
+
+	// Terms shorter than minSearchTermLen are not indexed or searched. Terms
+	// longer than maxSearchTermLen are truncated.
+	minSearchTermLen = 2
+	maxSearchTermLen = 64
+)
+
+// SearchIndex is an inverted index from blind tokens to message UUIDs. The
+// tokens are keyed on the database secret, so they cannot be matched to terms
+// without it. Plaintext is never written to the database.
+type SearchIndex struct {
+	db  *idb.Database
+	key []byte
+}
+
+// CreateSearchStore creates the search index object store and marks all
+// existing messages for indexing by [SearchIndex.Backfill]. It must be called
+// from a database upgrade.
+func CreateSearchStore(db *idb.Database) error {
+	store, err := db.CreateObjectStore(SearchStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(searchPkeyName),
+			AutoIncrement: false,
+		})
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Put(js.ValueOf(map[string]any{
+		searchPkeyName: searchBackfillKey}))
+	return err
+}
+
+// NewSearchIndex returns the search index of the database. The index key is
+// derived from the secret of the cipher. For unencrypted databases, where the
+// message text is already stored in plaintext, a fixed key is used.
+func NewSearchIndex(
+	db *idb.Database, encryption idbCrypto.Cipher) (*SearchIndex, error) {
+	var secret []byte
+	if encryption != nil {
+		cipherJSON, err := json.Marshal(encryption)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal cipher")
+		}
+		var disk struct {
+			Secret []byte `json:"secret"`
+		}
+		if err = json.Unmarshal(cipherJSON, &disk); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal cipher secret")
+		}
+		secret = disk.Secret
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(searchKeyLabel))
+	return &SearchIndex{db: db, key: mac.Sum(nil)}, nil
+}
+
+// Index adds the terms in the text to the index for the message.
+func (si *SearchIndex) Index(uuid uint64, text string) error {
+	return si.write(true, si.rowKeys(uuid, text))
+}
+
+// IndexAll adds the terms in the text of each message, keyed on its UUID, to
+// the index in a single transaction.
+func (si *SearchIndex) IndexAll(texts map[uint64]string) error {
+	var keys []string
+	for uuid, text := range texts {
+		keys = append(keys, si.rowKeys(uuid, text)...)
+	}
+	return si.write(true, keys)
+}
+
+// Unindex removes the terms in the text from the index for the message. The
+// text must be the same as was passed to Index.
+func (si *SearchIndex) Unindex(uuid uint64, text string) error {
+	return si.write(false, si.rowKeys(uuid, text))
+}
+
+// Search returns the UUIDs of every message containing all terms in the query,
+// newest first. Returns nothing if the query has no searchable terms.
+func (si *SearchIndex) Search(query string) ([]uint64, error) {
+	tokens := si.tokens(query)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	var matches map[uint64]struct{}
+	for _, token := range tokens {
+		uuids, err := si.lookup(token)
+		if err != nil {
+			return nil, err
+		}
+
+		// Intersect with the matches of the previous tokens
+		if matches != nil {
+			for uuid := range uuids {
+				if _, exists := matches[uuid]; !exists {
+					delete(uuids, uuid)
+				}
+			}
+		}
+		matches = uuids
+		if len(matches) == 0 {
+			return nil, nil
+		}
+	}
+
+	results := make([]uint64, 0, len(matches))
+	for uuid := range matches {
+		results = append(results, uuid)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i] > results[j] })
+	return results, nil
+}
+
+// Backfill indexes every message in the message store if the index was created
+// after messages were stored. textOf returns the UUID and plaintext of a
+// stored message and false if the message should not be indexed.
+func (si *SearchIndex) Backfill(messageStoreName string,
+	textOf func(value js.Value) (uint64, string, bool, error)) error {
+	parentErr := errors.New("failed to backfill search index")
+
+	_, err := Get(si.db, SearchStoreName, js.ValueOf(searchBackfillKey))
+	if err != nil {
+		if strings.Contains(err.Error(), ErrDoesNotExist) {
+			return nil
+		}
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	// Collect the terms of every message before writing, since the read
+	// transaction cannot wait on writes
+	txn, err := si.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "Unable to open Cursor: %+v", err)
+	}
+	var keys []string
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			uuid, text, ok, err := textOf(value)
+			if err != nil {
+				return err
+			} else if ok {
+				keys = append(keys, si.rowKeys(uuid, text)...)
+			}
+			return nil
+		})
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to read messages: %+v", err)
+	}
+
+	if err = si.write(true, keys); err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+	if err = Delete(si.db, SearchStoreName,
+		js.ValueOf(searchBackfillKey)); err != nil {
+		return errors.WithMessage(parentErr, err.Error())
+	}
+
+	jww.INFO.Printf("Indexed %d search terms of existing messages", len(keys))
+	return nil
+}
+
+// lookup returns the UUIDs of every message indexed under the token.
+func (si *SearchIndex) lookup(token string) (map[uint64]struct{}, error) {
+	// Every row key of the token sorts between "<token>/" and "<token>0"
+	keyRange, err := idb.NewKeyRangeBound(js.ValueOf(token+"/"),
+		js.ValueOf(token+"0"), false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := si.db.Transaction(idb.TransactionReadOnly, SearchStoreName)
+	if err != nil {
+		return nil, err
+	}
+	store, err := txn.ObjectStore(SearchStoreName)
+	if err != nil {
+		return nil, err
+	}
+	request, err := store.GetAllKeysRange(keyRange, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := NewContext()
+	defer cancel()
+	keys, err := request.Await(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uuids := make(map[uint64]struct{}, len(keys))
+	for _, key := range keys {
+		keyStr := key.String()
+		uuid, err := strconv.ParseUint(
+			keyStr[strings.LastIndexByte(keyStr, '/')+1:], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid search index key %q", keyStr)
+		}
+		uuids[uuid] = struct{}{}
+	}
+	return uuids, nil
+}
+
+// write puts or deletes the rows with the given keys in a single transaction.
+func (si *SearchIndex) write(put bool, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	txn, err := si.db.Transaction(idb.TransactionReadWrite, SearchStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(SearchStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+
+	for _, key := range keys {
+		if put {
+			_, err = store.Put(js.ValueOf(map[string]any{searchPkeyName: key}))
+		} else {
+			_, err = store.Delete(js.ValueOf(key))
+		}
+		if err != nil {
+			return errors.Errorf("Unable to update search index: %+v", err)
+		}
+	}
+
+	ctx, cancel := NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return errors.Errorf("Updating search index failed: %+v", err)
+	}
+	return nil
+}
+
+// rowKeys returns the key of the row for each token in the text.
+func (si *SearchIndex) rowKeys(uuid uint64, text string) []string {
+	tokens := si.tokens(text)
+	keys := make([]string, len(tokens))
+	uuidStr := strconv.FormatUint(uuid, 10)
+	for i, token := range tokens {
+		keys[i] = token + "/" + uuidStr
+	}
+	return keys
+}
+
+// tokens returns the blind token of each unique term in the text.
+func (si *SearchIndex) tokens(text string) []string {
+	terms := SearchTerms(text)
+	tokens := make([]string, len(terms))
+	for i, term := range terms {
+		mac := hmac.New(sha256.New, si.key)
+		mac.Write([]byte(term))
+		tokens[i] = base64.RawURLEncoding.EncodeToString(
+			mac.Sum(nil)[:searchTokenLen])
+	}
+	return tokens
+}
+
+// SearchTerms splits the text into unique, normalized search terms. Terms are
+// runs of letters and digits, lower-cased, in the order they first appear.
+func SearchTerms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]struct{}, len(fields))
+	terms := make([]string, 0, len(fields))
+	for _, term := range fields {
+		if runes := []rune(term); len(runes) < minSearchTermLen {
+			continue
+		} else if len(runes) > maxSearchTermLen {
+			term = string(runes[:maxSearchTermLen])
+		}
+		if _, exists := seen[term]; !exists {
+			seen[term] = struct{}{}
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,183 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"reflect"
+	"strings"
+	"syscall/js"
+	"testing"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that SearchTerms splits, normalizes, and deduplicates terms.
+func TestSearchTerms(t *testing.T) {
+	tests := map[string][]string{
+		"Hello, world!":            {"hello", "world"},
+		"hello HELLO Hello":        {"hello"},
+		"a b cd":                   {"cd"},
+		"naïve café, über-cool 42": {"naïve", "café", "über", "cool", "42"},
+		"":                         {},
+		strings.Repeat("x", 70):    {strings.Repeat("x", maxSearchTermLen)},
+	}
+
+	for text, expected := range tests {
+		terms := SearchTerms(text)
+		if !reflect.DeepEqual(expected, terms) {
+			t.Errorf("Unexpected terms for %q.\nexpected: %q\nreceived: %q",
+				text, expected, terms)
+		}
+	}
+}
+
+// Tests that SearchIndex.Search returns the messages containing every term,
+// newest first, and that SearchIndex.Unindex removes a message.
+func TestSearchIndex_Search(t *testing.T) {
+	db := newTestDB("TestSearchIndex_Search", "messages", "index",
+		CreateSearchStore, t)
+	si, err := NewSearchIndex(db, nil)
+	if err != nil {
+		t.Fatalf("Failed to create search index: %+v", err)
+	}
+
+	texts := map[uint64]string{
+		1: "Meet at the harbour tonight",
+		2: "The harbour is closed",
+		3: "see you TONIGHT at the harbour",
+	}
+	for uuid, text := range texts {
+		if err = si.Index(uuid, text); err != nil {
+			t.Fatalf("Failed to index message %d: %+v", uuid, err)
+		}
+	}
+
+	tests := map[string][]uint64{
+		"harbour":          {3, 2, 1},
+		"Harbour tonight":  {3, 1},
+		"closed":           {2},
+		"closed tonight":   nil,
+		"missing":          nil,
+		"a":                nil,
+		"harbour, TONIGHT": {3, 1},
+	}
+	for query, expected := range tests {
+		uuids, err := si.Search(query)
+		if err != nil {
+			t.Fatalf("Failed to search %q: %+v", query, err)
+		}
+		if !reflect.DeepEqual(expected, uuids) {
+			t.Errorf("Unexpected results for %q.\nexpected: %d\nreceived: %d",
+				query, expected, uuids)
+		}
+	}
+
+	if err = si.Unindex(3, texts[3]); err != nil {
+		t.Fatalf("Failed to unindex message: %+v", err)
+	}
+	uuids, err := si.Search("tonight")
+	if err != nil {
+		t.Fatalf("Failed to search: %+v", err)
+	}
+	if !reflect.DeepEqual([]uint64{1}, uuids) {
+		t.Errorf("Unexpected results after unindex.\nexpected: %d\nreceived: %d",
+			[]uint64{1}, uuids)
+	}
+}
+
+// Tests that the search index does not store terms in plaintext and that the
+// tokens depend on the database secret.
+func TestNewSearchIndex_Key(t *testing.T) {
+	db := newTestDB("TestNewSearchIndex_Key", "messages", "index",
+		CreateSearchStore, t)
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	plain, err := NewSearchIndex(db, nil)
+	if err != nil {
+		t.Fatalf("Failed to create search index: %+v", err)
+	}
+	encrypted, err := NewSearchIndex(db, cipher)
+	if err != nil {
+		t.Fatalf("Failed to create search index: %+v", err)
+	}
+
+	if err = encrypted.Index(5, "secret"); err != nil {
+		t.Fatalf("Failed to index message: %+v", err)
+	}
+
+	rows, err := Dump(db, SearchStoreName)
+	if err != nil {
+		t.Fatalf("Failed to dump search index: %+v", err)
+	}
+	for _, row := range rows {
+		if strings.Contains(row, "secret") {
+			t.Errorf("Search index contains plaintext term: %s", row)
+		}
+	}
+
+	if uuids, err := plain.Search("secret"); err != nil {
+		t.Fatalf("Failed to search: %+v", err)
+	} else if len(uuids) != 0 {
+		t.Errorf("Found message indexed with a different key: %d", uuids)
+	}
+	if uuids, err := encrypted.Search("secret"); err != nil {
+		t.Fatalf("Failed to search: %+v", err)
+	} else if !reflect.DeepEqual([]uint64{5}, uuids) {
+		t.Errorf("Unexpected results.\nexpected: %d\nreceived: %d",
+			[]uint64{5}, uuids)
+	}
+}
+
+// Tests that SearchIndex.Backfill indexes existing messages once.
+func TestSearchIndex_Backfill(t *testing.T) {
+	db := newTestDB("TestSearchIndex_Backfill", "messages", "index",
+		CreateSearchStore, t)
+	for _, text := range []string{"first message", "second message"} {
+		_, err := Put(db, "messages", js.ValueOf(map[string]any{"text": text}))
+		if err != nil {
+			t.Fatalf("Failed to put message: %+v", err)
+		}
+	}
+
+	si, err := NewSearchIndex(db, nil)
+	if err != nil {
+		t.Fatalf("Failed to create search index: %+v", err)
+	}
+	calls := 0
+	textOf := func(value js.Value) (uint64, string, bool, error) {
+		calls++
+		return uint64(value.Get("id").Int()), value.Get("text").String(),
+			true, nil
+	}
+
+	if err = si.Backfill("messages", textOf); err != nil {
+		t.Fatalf("Failed to backfill: %+v", err)
+	}
+	if err = si.Backfill("messages", textOf); err != nil {
+		t.Fatalf("Failed to backfill: %+v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Backfill ran more than once: %d messages read", calls)
+	}
+
+	uuids, err := si.Search("message")
+	if err != nil {
+		t.Fatalf("Failed to search: %+v", err)
+	}
+	if !reflect.DeepEqual([]uint64{2, 1}, uuids) {
+		t.Errorf("Unexpected results.\nexpected: %d\nreceived: %d",
+			[]uint64{2, 1}, uuids)
+	}
+}
@@ -0,0 +1,44 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"github.com/pkg/errors"
+)
+
+// sessionLockedErr is returned by every method of LockedCipher.
+const sessionLockedErr = "cannot use the database cipher while the session " +
+	"is locked"
+
+// LockedCipher is the cipher of an encrypted database while the session is
+// locked and the database cipher has been dropped. Every method returns an
+// error, so encrypted text can be neither read nor written until the cipher is
+// sent again. It adheres to the [idbCrypto.Cipher] interface.
+type LockedCipher struct{}
+
+// Encrypt always returns an error.
+func (LockedCipher) Encrypt([]byte) (string, error) {
+	return "", errors.New(sessionLockedErr)
+}
+
+// Decrypt always returns an error.
+func (LockedCipher) Decrypt(string) ([]byte, error) {
+	return nil, errors.New(sessionLockedErr)
+}
+
+// MarshalJSON always returns an error.
+func (LockedCipher) MarshalJSON() ([]byte, error) {
+	return nil, errors.New(sessionLockedErr)
+}
+
+// UnmarshalJSON always returns an error.
+func (LockedCipher) UnmarshalJSON([]byte) error {
+	return errors.New(sessionLockedErr)
+}
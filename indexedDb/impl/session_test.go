@@ -0,0 +1,32 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"testing"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+)
+
+// Tests that text can be neither encrypted nor decrypted with a LockedCipher,
+// even through encryptText and decryptText.
+func TestLockedCipher(t *testing.T) {
+	var c idbCrypto.Cipher = LockedCipher{}
+
+	if _, err := encryptText(c, []byte("text")); err == nil {
+		t.Errorf("Encrypted text with a LockedCipher.")
+	}
+	if _, err := decryptText(c, "text"); err == nil {
+		t.Errorf("Decrypted text with a LockedCipher.")
+	}
+	if _, err := c.MarshalJSON(); err == nil {
+		t.Errorf("Marshalled a LockedCipher.")
+	}
+}
@@ -0,0 +1,65 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the read marker shared by channels and conversations.
+
+package impl
+
+import (
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+)
+
+// Read marker keyPath names shared by the channel and conversation rows (must
+// match json struct tags).
+const (
+	readMarkerUUID        = "last_read_uuid"
+	readMarkerTimestamp   = "last_read_timestamp"
+	readMarkerUnreadCount = "unread_count"
+)
+
+// MarkAllRead sets the read marker of every row in the object store to the
+// time and the unread count to zero. It backfills the read markers of
+// databases created before they were added.
+func MarkAllRead(db *idb.Database, objectStoreName string, t time.Time) error {
+	txn, err := db.Transaction(idb.TransactionReadWrite, objectStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Timestamps are stored as they are JSON marshalled
+	timestamp := t.UTC().Format(time.RFC3339Nano)
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			row, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			row.Set(readMarkerUUID, 0)
+			row.Set(readMarkerTimestamp, js.ValueOf(timestamp))
+			row.Set(readMarkerUnreadCount, 0)
+			_, err = cursor.Update(row)
+			return err
+		})
+	if err != nil {
+		return errors.Errorf("Unable to update read markers: %+v", err)
+	}
+	return nil
+}
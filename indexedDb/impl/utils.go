@@ -153,6 +153,39 @@ func GetAll(db *idb.Database, objectStoreName string) ([]js.Value, error) {
 	return result, nil
 }
 
+// Count is a generic helper for getting the number of rows in the given
+// [idb.ObjectStore].
+func Count(db *idb.Database, objectStoreName string) (uint, error) {
+	parentErr := errors.Errorf("failed to Count %s", objectStoreName)
+
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadOnly, objectStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	// Perform the operation
+	request, err := store.Count()
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to Count: %+v", err)
+	}
+	ctx, cancel := NewContext()
+	defer cancel()
+	count, err := request.Await(ctx)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to Count: %+v", err)
+	}
+	return count, nil
+}
+
 // GetIndex is a generic helper for getting values from the given
 // [idb.ObjectStore] using the given [idb.Index].
 func GetIndex(db *idb.Database, objectStoreName,
@@ -200,6 +233,192 @@ func GetIndex(db *idb.Database, objectStoreName,
 	return resultObj, nil
 }
 
+// GetAllIndex is a generic helper for getting every value with the given key
+// from the given [idb.ObjectStore] using the given [idb.Index], in primary key
+// order.
+func GetAllIndex(db *idb.Database, objectStoreName,
+	indexName string, key js.Value) ([]js.Value, error) {
+	parentErr := errors.Errorf("failed to GetAllIndex %s/%s",
+		objectStoreName, indexName)
+
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadOnly, objectStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	idx, err := store.Index(indexName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(key)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := idx.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+	result := make([]js.Value, 0)
+
+	// Perform the operation
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			row, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			result = append(result, row)
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessage(parentErr, err.Error())
+	}
+	return result, nil
+}
+
+// CountIndex is a generic helper for counting the values in the key range of
+// the given [idb.Index] of the given [idb.ObjectStore] for which match returns
+// true.
+func CountIndex(db *idb.Database, objectStoreName, indexName string,
+	keyRange *idb.KeyRange,
+	match func(value js.Value) (bool, error)) (int, error) {
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadOnly, objectStoreName)
+	if err != nil {
+		return 0, errors.Errorf("failed to CountIndex %s/%s: Unable to "+
+			"create Transaction: %+v", objectStoreName, indexName, err)
+	}
+	return CountIndexTxn(txn, objectStoreName, indexName, keyRange, match)
+}
+
+// CountIndexTxn is CountIndex within the given [idb.Transaction], which must
+// include the [idb.ObjectStore].
+func CountIndexTxn(txn *idb.Transaction, objectStoreName, indexName string,
+	keyRange *idb.KeyRange,
+	match func(value js.Value) (bool, error)) (int, error) {
+	parentErr := errors.Errorf("failed to CountIndex %s/%s",
+		objectStoreName, indexName)
+
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	idx, err := store.Index(indexName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+	cursorRequest, err := idx.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	count := 0
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			row, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			if ok, err := match(row); err != nil {
+				return err
+			} else if ok {
+				count++
+			}
+			return nil
+		})
+	if err != nil {
+		return 0, errors.WithMessage(parentErr, err.Error())
+	}
+	return count, nil
+}
+
+// Update is a generic helper for changing the value with the given primary key
+// in the given [idb.ObjectStore]. The value is passed to update and the value
+// it returns is put if it also returns true. The get and the put are done in a
+// single read-write transaction, so no other write to the value can happen
+// between them. The transaction also includes the other object stores, so that
+// update can read them with txn. Returns an error containing ErrDoesNotExist if
+// there is no value with the key.
+func Update(db *idb.Database, objectStoreName string, key js.Value,
+	otherStoreNames []string, update func(txn *idb.Transaction,
+		value js.Value) (js.Value, bool, error)) error {
+	parentErr := errors.Errorf("failed to Update %s", objectStoreName)
+
+	// Prepare the Transaction
+	txn, err := db.Transaction(
+		idb.TransactionReadWrite, objectStoreName, otherStoreNames...)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	// Perform the operation
+	getRequest, err := store.Get(key)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to Get from ObjectStore: %+v", err)
+	}
+	value, err := SendRequest(getRequest)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get from ObjectStore: %+v", err)
+	} else if value.IsUndefined() {
+		return errors.WithMessagef(parentErr,
+			"Unable to get from ObjectStore: %s", ErrDoesNotExist)
+	}
+
+	value, changed, err := update(txn, value)
+	if err != nil || !changed {
+		if abortErr := txn.Abort(); abortErr != nil {
+			jww.ERROR.Printf("Failed to abort Transaction: %+v", abortErr)
+		}
+		if err != nil {
+			return errors.WithMessage(parentErr, err.Error())
+		}
+		return nil
+	}
+
+	putRequest, err := store.Put(value)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "Unable to Put: %+v", err)
+	}
+	if _, err = SendRequest(putRequest); err != nil {
+		return errors.WithMessagef(parentErr,
+			"Putting value failed: %+v", err)
+	}
+
+	// Wait for the write to be committed
+	ctx, cancel := NewContext()
+	defer cancel()
+	if err = txn.Await(ctx); err != nil {
+		return errors.WithMessagef(parentErr,
+			"Committing value failed: %+v", err)
+	}
+	jww.DEBUG.Printf("Successfully updated value in %s: %s",
+		objectStoreName, utils.JsToJson(value))
+	return nil
+}
+
 // Put is a generic helper for putting values into the given [idb.ObjectStore].
 // Equivalent to insert if not exists else update. Returns the primary key of
 // the stored object as a js.Value.
@@ -331,3 +550,94 @@ func Dump(db *idb.Database, objectStoreName string) ([]string, error) {
 	}
 	return results, nil
 }
+
+// StoreStats contains the estimated size of a single [idb.ObjectStore].
+type StoreStats struct {
+	Name string `json:"name"`
+
+	// Rows is the number of rows in the object store.
+	Rows uint `json:"rows"`
+
+	// Bytes is the total size of the JSON encoding of every row. It is an
+	// estimate; the browser's on-disk size will differ.
+	Bytes uint64 `json:"bytes"`
+}
+
+// GetStoreStats walks the given [idb.ObjectStore] with a cursor and returns the
+// number of rows and their estimated size.
+func GetStoreStats(db *idb.Database, objectStoreName string) (StoreStats, error) {
+	parentErr := errors.Errorf("failed to GetStoreStats %s", objectStoreName)
+	stats := StoreStats{Name: objectStoreName}
+
+	txn, err := db.Transaction(idb.TransactionReadOnly, objectStoreName)
+	if err != nil {
+		return stats, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return stats, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	// Set up the operation
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return stats, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			stats.Rows++
+			stats.Bytes += uint64(len(utils.JsToJson(value)))
+			return nil
+		})
+	if err != nil {
+		return stats, errors.WithMessagef(parentErr,
+			"Unable to walk ObjectStore: %+v", err)
+	}
+
+	return stats, nil
+}
+
+// GetDatabaseStats opens the database with the given name at its current
+// version and returns the StoreStats of each of its object stores. The
+// database is closed before returning.
+func GetDatabaseStats(databaseName string) ([]StoreStats, error) {
+	ctx, cancel := NewContext()
+	defer cancel()
+	openRequest, err := idb.Global().Open(ctx, databaseName, 0,
+		func(*idb.Database, uint, uint) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		return nil, err
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	defer closeDatabase(db, databaseName)
+
+	objectStoreNames, err := db.ObjectStoreNames()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]StoreStats, len(objectStoreNames))
+	for i, objectStoreName := range objectStoreNames {
+		stats[i], err = GetStoreStats(db, objectStoreName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/hack-pad/go-indexeddb/idb"
 	jww "github.com/spf13/jwalterweatherman"
 	"strings"
+	"sync"
 	"syscall/js"
 	"testing"
 	"time"
@@ -21,7 +22,7 @@ import (
 // Error path: Tests that Get returns an error when trying to get a message that
 // does not exist.
 func TestGet_NoMessageError(t *testing.T) {
-	db := newTestDB("messages", "index", t)
+	db := newTestDB("databaseName", "messages", "index", nil, t)
 
 	_, err := Get(db, "messages", js.ValueOf(5))
 	if err == nil || !strings.Contains(err.Error(), "undefined") {
@@ -33,7 +34,7 @@ func TestGet_NoMessageError(t *testing.T) {
 // Error path: Tests that GetIndex returns an error when trying to get a message
 // that does not exist.
 func TestGetIndex_NoMessageError(t *testing.T) {
-	db := newTestDB("messages", "index", t)
+	db := newTestDB("databaseName", "messages", "index", nil, t)
 
 	_, err := GetIndex(db, "messages", "index", js.ValueOf(5))
 	if err == nil || !strings.Contains(err.Error(), "undefined") {
@@ -45,7 +46,7 @@ func TestGetIndex_NoMessageError(t *testing.T) {
 // Test simple put on empty DB is successful
 func TestPut(t *testing.T) {
 	objectStoreName := "messages"
-	db := newTestDB(objectStoreName, "index", t)
+	db := newTestDB("databaseName", objectStoreName, "index", nil, t)
 	testValue := js.ValueOf(make(map[string]interface{}))
 	result, err := Put(db, objectStoreName, testValue)
 	if err != nil {
@@ -56,12 +57,105 @@ func TestPut(t *testing.T) {
 	}
 }
 
-// newTestDB creates a new idb.Database for testing.
-func newTestDB(name, index string, t *testing.T) *idb.Database {
+// Tests that Update stores the value returned by update only when it reports a
+// change, and that concurrent updates of the same value are not lost.
+func TestUpdate(t *testing.T) {
+	objectStoreName := "messages"
+	db := newTestDB("databaseName", objectStoreName, "index", nil, t)
+	key, err := Put(db, objectStoreName,
+		js.ValueOf(map[string]any{"count": 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Update(db, objectStoreName, key, nil,
+				func(_ *idb.Transaction, v js.Value) (js.Value, bool, error) {
+					v.Set("count", v.Get("count").Int()+1)
+					return v, true, nil
+				})
+			if err != nil {
+				t.Errorf("Failed to update: %+v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	err = Update(db, objectStoreName, key, nil,
+		func(_ *idb.Transaction, v js.Value) (js.Value, bool, error) {
+			v.Set("count", 0)
+			return v, false, nil
+		})
+	if err != nil {
+		t.Fatalf("Failed to update: %+v", err)
+	}
+
+	value, err := Get(db, objectStoreName, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := value.Get("count").Int(); count != n {
+		t.Errorf("Unexpected count.\nexpected: %d\nreceived: %d", n, count)
+	}
+
+	err = Update(db, objectStoreName, js.ValueOf(5), nil,
+		func(_ *idb.Transaction, v js.Value) (js.Value, bool, error) {
+			return v, true, nil
+		})
+	if err == nil || !strings.Contains(err.Error(), ErrDoesNotExist) {
+		t.Errorf("Did not get expected error when updating a value that "+
+			"does not exist: %+v", err)
+	}
+}
+
+// Tests that GetStoreStats counts each row added with Put and their size.
+func TestGetStoreStats(t *testing.T) {
+	objectStoreName := "messages"
+	db := newTestDB("databaseName", objectStoreName, "index", nil, t)
+
+	before, err := GetStoreStats(db, objectStoreName)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %+v", err)
+	}
+
+	testValue := js.ValueOf(map[string]any{"text": "hello"})
+	if _, err = Put(db, objectStoreName, testValue); err != nil {
+		t.Fatalf("Failed to put value: %+v", err)
+	}
+
+	after, err := GetStoreStats(db, objectStoreName)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %+v", err)
+	}
+
+	if after.Name != objectStoreName {
+		t.Errorf("Unexpected name.\nexpected: %s\nreceived: %s",
+			objectStoreName, after.Name)
+	}
+	if after.Rows != before.Rows+1 {
+		t.Errorf("Unexpected number of rows.\nexpected: %d\nreceived: %d",
+			before.Rows+1, after.Rows)
+	}
+	if after.Bytes <= before.Bytes {
+		t.Errorf("Size did not increase.\nbefore: %d\nafter: %d",
+			before.Bytes, after.Bytes)
+	}
+}
+
+// newTestDB creates a new idb.Database with the database name for testing. It
+// has an auto-incrementing object store with the name and index. If upgrade is
+// not nil, it is called to create the other object stores of the database.
+func newTestDB(databaseName, name, index string,
+	upgrade func(db *idb.Database) error, t *testing.T) *idb.Database {
 	// Attempt to open database object
 	ctx, cancel := NewContext()
 	defer cancel()
-	openRequest, err := idb.Global().Open(ctx, "databaseName", 0,
+	openRequest, err := idb.Global().Open(ctx, databaseName, 0,
 		func(db *idb.Database, _ uint, _ uint) error {
 			storeOpts := idb.ObjectStoreOptions{
 				KeyPath:       js.ValueOf("id"),
@@ -80,6 +174,9 @@ func newTestDB(name, index string, t *testing.T) *idb.Database {
 				return err
 			}
 
+			if upgrade != nil {
+				return upgrade(db)
+			}
 			return nil
 		})
 	if err != nil {
@@ -107,7 +204,7 @@ func benchmarkDb(n int, t *testing.T) {
 
 	objectStoreName := "test"
 	testValue := js.ValueOf(make(map[string]interface{}))
-	db := newTestDB(objectStoreName, "index", t)
+	db := newTestDB("databaseName", objectStoreName, "index", nil, t)
 
 	type metric struct {
 		didSucceed bool
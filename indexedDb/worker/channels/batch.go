@@ -0,0 +1,147 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package channels
+
+import (
+	"encoding/json"
+	"sync"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/xxdk-wasm/worker"
+)
+
+// maxReceiveBatchSize is the maximum number of messages in a batch.
+const maxReceiveBatchSize = 256
+
+// ReceiveBatchEntry is a single received message in a ReceiveBatchMessage.
+// Tag is the tag of the event model method that received it; one of
+// ReceiveMessageTag, ReceiveReplyTag, or ReceiveReactionTag.
+type ReceiveBatchEntry struct {
+	Tag worker.Tag `json:"tag"`
+	ReceiveReplyMessage
+}
+
+// ReceiveBatchMessage is JSON marshalled and sent to the worker for
+// ReceiveBatchTag. The worker stores every message in a single transaction
+// and replies with the JSON marshalled UUID (uint64) of each, in order.
+type ReceiveBatchMessage struct {
+	Messages []ReceiveBatchEntry `json:"messages"`
+}
+
+// receiveBatcher coalesces received messages into ReceiveBatchTag messages to
+// the worker. A message received while no batch is being sent is sent right
+// away. Messages received while a batch is being sent are gathered and sent as
+// the next batch once it is done, so batches grow only under load. Batches are
+// sent in the order they are gathered.
+type receiveBatcher struct {
+	wm      *worker.Manager
+	pending []pendingReceive
+
+	// sending is true while a goroutine is sending the pending batches.
+	sending bool
+	mux     sync.Mutex
+}
+
+// pendingReceive is a received message waiting to be sent. Its UUID is sent
+// on the channel once the worker has stored it.
+type pendingReceive struct {
+	entry ReceiveBatchEntry
+	uuid  chan uint64
+}
+
+// newReceiveBatcher returns a receiveBatcher that sends to the worker.
+func newReceiveBatcher(wm *worker.Manager) *receiveBatcher {
+	return &receiveBatcher{wm: wm}
+}
+
+// receive adds the message to the next batch and blocks until it is stored.
+// Returns the UUID of the stored message or 0 on error.
+func (rb *receiveBatcher) receive(entry ReceiveBatchEntry) uint64 {
+	p := pendingReceive{entry: entry, uuid: make(chan uint64, 1)}
+
+	rb.mux.Lock()
+	rb.pending = append(rb.pending, p)
+	if !rb.sending {
+		rb.sending = true
+		go rb.sendPending()
+	}
+	rb.mux.Unlock()
+
+	return <-p.uuid
+}
+
+// sendPending sends batches of the pending messages until there are none left.
+func (rb *receiveBatcher) sendPending() {
+	for {
+		rb.mux.Lock()
+		batch := rb.take()
+		if len(batch) == 0 {
+			rb.sending = false
+			rb.mux.Unlock()
+			return
+		}
+		rb.mux.Unlock()
+
+		rb.send(batch)
+	}
+}
+
+// take removes and returns up to maxReceiveBatchSize pending messages. It must
+// be called while holding mux.
+func (rb *receiveBatcher) take() []pendingReceive {
+	n := min(len(rb.pending), maxReceiveBatchSize)
+	batch := rb.pending[:n:n]
+	rb.pending = rb.pending[n:]
+	if len(rb.pending) == 0 {
+		rb.pending = nil
+	}
+	return batch
+}
+
+// send sends the batch to the worker and replies to each message with its
+// UUID.
+func (rb *receiveBatcher) send(batch []pendingReceive) {
+	uuids := make([]uint64, len(batch))
+	defer func() {
+		for i := range batch {
+			batch[i].uuid <- uuids[i]
+		}
+	}()
+
+	msg := ReceiveBatchMessage{Messages: make([]ReceiveBatchEntry, len(batch))}
+	for i := range batch {
+		msg.Messages[i] = batch[i].entry
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		jww.ERROR.Printf(
+			"[CH] Could not JSON marshal payload for ReceiveBatch: %+v", err)
+		return
+	}
+
+	response, err := rb.wm.SendMessage(ReceiveBatchTag, data)
+	if err != nil {
+		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", ReceiveBatchTag, err)
+	}
+
+	var received []uint64
+	if err = json.Unmarshal(response, &received); err != nil {
+		jww.ERROR.Printf("[CH] Failed to JSON unmarshal UUIDs from worker for "+
+			"%q: %+v", ReceiveBatchTag, err)
+		return
+	} else if len(received) != len(batch) {
+		jww.ERROR.Printf("[CH] Received %d UUIDs from worker for %q; "+
+			"expected %d", len(received), ReceiveBatchTag, len(batch))
+		return
+	}
+	copy(uuids, received)
+}
@@ -0,0 +1,85 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package channels
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// SaveDraftMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SaveDraft].
+type SaveDraftMessage struct {
+	ChannelID *id.ID     `json:"channelID"`
+	Draft     impl.Draft `json:"draft"`
+}
+
+// GetDraftResult is JSON marshalled and received from the worker for
+// [wasmModel.GetDraft].
+type GetDraftResult struct {
+	Draft impl.Draft `json:"draft"`
+	Error string     `json:"error,omitempty"`
+}
+
+// SaveDraft stores the draft of the channel, replacing any stored draft. A
+// zero draft clears the stored draft.
+func (w *wasmModel) SaveDraft(channelID *id.ID, draft impl.Draft) error {
+	data, err := json.Marshal(
+		SaveDraftMessage{ChannelID: channelID, Draft: draft})
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for SaveDraft: %+v", err)
+	}
+
+	response, err := w.wm.SendMessage(SaveDraftTag, data)
+	if err != nil {
+		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", SaveDraftTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// GetDraft returns the draft of the channel. Returns a zero draft if none is
+// stored.
+func (w *wasmModel) GetDraft(channelID *id.ID) (impl.Draft, error) {
+	response, err := w.wm.SendMessage(GetDraftTag, channelID.Marshal())
+	if err != nil {
+		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", GetDraftTag, err)
+	}
+
+	var result GetDraftResult
+	if err = json.Unmarshal(response, &result); err != nil {
+		return impl.Draft{}, errors.Wrapf(err, "[CH] Could not JSON "+
+			"unmarshal response to %q", GetDraftTag)
+	} else if result.Error != "" {
+		return impl.Draft{}, errors.New(result.Error)
+	}
+
+	return result.Draft, nil
+}
+
+// ClearDraft removes the draft of the channel, if one is stored.
+func (w *wasmModel) ClearDraft(channelID *id.ID) error {
+	response, err := w.wm.SendMessage(ClearDraftTag, channelID.Marshal())
+	if err != nil {
+		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", ClearDraftTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package channels
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/crypto/fileTransfer"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// ExportVersion is the version of the JSON schema of a channel history export
+// ([ChannelHistory]). It changes whenever the schema changes in a way that is
+// not backwards compatible.
+const ExportVersion = 1
+
+// ExportFormat is the output format of a channel history export.
+type ExportFormat string
+
+const (
+	// ExportJSON is the JSON of a [ChannelHistory].
+	ExportJSON ExportFormat = "json"
+
+	// ExportMarkdown is a Markdown transcript.
+	ExportMarkdown ExportFormat = "markdown"
+
+	// ExportHTML is a self-contained HTML transcript.
+	ExportHTML ExportFormat = "html"
+)
+
+// ExportRange restricts a channel history export to messages with a timestamp
+// in the range. Start is inclusive and End is exclusive. A zero time leaves
+// that end open.
+//
+// Example JSON:
+//
+//	{
+//	  "start": "2023-05-01T00:00:00Z",
+//	  "end": "2023-06-01T00:00:00Z"
+//	}
+type ExportRange struct {
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+}
+
+// ChannelHistory is the JSON schema of a channel history exported with
+// ExportJSON. Messages are in timestamp order. Reactions are not listed as
+// messages; they are listed on the message they react to.
+//
+// Example JSON:
+//
+//	{
+//	  "version": 1,
+//	  "channel": {
+//	    "id": "ouFTjrB6vJ8MDRrZ9KR3cVUbQY2cC0ek8gGW4jKTWPQD",
+//	    "name": "Dev",
+//	    "description": "Development channel"
+//	  },
+//	  "range": {},
+//	  "exportedAt": "2023-06-01T09:21:08.551Z",
+//	  "messages": [
+//	    {
+//	      "messageID": "M7Yh8SJ3CP6fuNGP1UV5VhN8c5kqL5iG8Kx+q9zkmGE=",
+//	      "type": 1,
+//	      "nickname": "alice",
+//	      "pubKey": "V93pXwmNqNdkTvS7XaC8RzvqJiyjdDlUk6G2tnd7Lss=",
+//	      "codesetVersion": 0,
+//	      "timestamp": "2023-05-12T15:03:42.197Z",
+//	      "lease": 0,
+//	      "round": 1234,
+//	      "status": 2,
+//	      "text": "Hello, world!",
+//	      "reactions": [
+//	        {
+//	          "messageID": "hOgzNUh4oBbGp2QXJPq6GLdHKTcz6C3XnUHdJQ6W4gk=",
+//	          "replyTo": "M7Yh8SJ3CP6fuNGP1UV5VhN8c5kqL5iG8Kx+q9zkmGE=",
+//	          "type": 3,
+//	          "nickname": "bob",
+//	          "pubKey": "KXZ6VDzxIzFdBy6nPjnCfD6wN5WnpSyEn4nrWDxtwNk=",
+//	          "codesetVersion": 0,
+//	          "timestamp": "2023-05-12T15:04:10.002Z",
+//	          "lease": 0,
+//	          "round": 1236,
+//	          "status": 2,
+//	          "text": "👍"
+//	        }
+//	      ]
+//	    }
+//	  ]
+//	}
+type ChannelHistory struct {
+	Version    int               `json:"version"`
+	Channel    ExportedChannel   `json:"channel"`
+	Range      ExportRange       `json:"range"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	Messages   []ExportedMessage `json:"messages"`
+}
+
+// ExportedChannel is the channel of a [ChannelHistory]. The name and
+// description are empty if the channel is no longer joined.
+type ExportedChannel struct {
+	ID          *id.ID `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ExportedMessage is a single decrypted message in a [ChannelHistory].
+type ExportedMessage struct {
+	MessageID message.ID `json:"messageID"`
+
+	// ReplyTo is the ID of the message that this message replies or reacts
+	// to, if any.
+	ReplyTo *message.ID `json:"replyTo,omitempty"`
+
+	Type           channels.MessageType `json:"type"`
+	Nickname       string               `json:"nickname"`
+	PubKey         ed25519.PublicKey    `json:"pubKey"`
+	DmToken        uint32               `json:"dmToken,omitempty"`
+	CodesetVersion uint8                `json:"codesetVersion"`
+	Timestamp      time.Time            `json:"timestamp"`
+	Lease          time.Duration        `json:"lease"`
+	Round          id.Round             `json:"round"`
+	Status         channels.SentStatus  `json:"status"`
+	Pinned         bool                 `json:"pinned,omitempty"`
+	Hidden         bool                 `json:"hidden,omitempty"`
+
+	// Text is the content of the message. It is empty for a file message.
+	Text string `json:"text,omitempty"`
+
+	// File is the file shared by a channels.FileTransfer message.
+	File *ExportedFile `json:"file,omitempty"`
+
+	// Reactions are the reactions to the message, in timestamp order.
+	Reactions []ExportedMessage `json:"reactions,omitempty"`
+}
+
+// ExportedFile is a reference to a file shared in a channel. It does not
+// include the key needed to download the file.
+type ExportedFile struct {
+	FileID fileTransfer.ID `json:"fileID"`
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Size   uint32          `json:"size"`
+}
+
+// ExportChannelHistoryMessage is JSON marshalled and sent to the worker for
+// each chunk of [wasmModel.ExportChannelHistory].
+type ExportChannelHistoryMessage struct {
+	ChannelID *id.ID       `json:"channelID"`
+	Format    ExportFormat `json:"format"`
+	Range     ExportRange  `json:"range"`
+
+	// Cursor is the NextCursor of the previous chunk. It is empty for the
+	// first chunk.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// ExportChannelHistoryResult is JSON marshalled and received from the worker
+// for each chunk of [wasmModel.ExportChannelHistory].
+type ExportChannelHistoryResult struct {
+	Chunk []byte `json:"chunk"`
+
+	// NextCursor is passed in ExportChannelHistoryMessage.Cursor to get the
+	// next chunk. It is empty after the last chunk.
+	NextCursor string `json:"nextCursor,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// ExportChannelHistory exports the decrypted messages of the channel in the
+// range in the given format. Each chunk is a separate message to the worker,
+// so other calls are handled between chunks, and chunk is called with each
+// part of the output, in order.
+func (w *wasmModel) ExportChannelHistory(channelID *id.ID, format ExportFormat,
+	r ExportRange, chunk func([]byte)) error {
+	msg := ExportChannelHistoryMessage{
+		ChannelID: channelID,
+		Format:    format,
+		Range:     r,
+	}
+
+	for {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return errors.Errorf("could not JSON marshal payload for "+
+				"ExportChannelHistory: %+v", err)
+		}
+
+		response, err := w.wm.SendMessage(ExportChannelHistoryTag, data)
+		if err != nil {
+			jww.FATAL.Panicf(
+				"[CH] Failed to send to %q: %+v", ExportChannelHistoryTag, err)
+		}
+
+		var result ExportChannelHistoryResult
+		if err = json.Unmarshal(response, &result); err != nil {
+			return errors.Wrapf(err, "[CH] Could not JSON unmarshal "+
+				"response to %q", ExportChannelHistoryTag)
+		} else if result.Error != "" {
+			return errors.New(result.Error)
+		}
+
+		chunk(result.Chunk)
+		if result.NextCursor == "" {
+			return nil
+		}
+		msg.Cursor = result.NextCursor
+	}
+}
@@ -12,6 +12,7 @@ package channels
 import (
 	"crypto/ed25519"
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,7 +21,9 @@ import (
 	"gitlab.com/elixxir/client/v4/channels"
 	"gitlab.com/elixxir/client/v4/cmix/rounds"
 	cryptoBroadcast "gitlab.com/elixxir/crypto/broadcast"
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 	"gitlab.com/xx_network/primitives/id"
 )
@@ -29,7 +32,21 @@ import (
 // system passed an object that adheres to in order to get events on the
 // channel.
 type wasmModel struct {
-	wm *worker.Manager
+	wm           *worker.Manager
+	receiver     *receiveBatcher
+	databaseName string
+
+	// encryption is the cipher of the database, sent to the worker again when
+	// the session is unlocked.
+	encryption idbCrypto.Cipher
+
+	// rotation is the cipher that an unfinished key rotation is moving the
+	// database to.
+	rotation idbCrypto.Cipher
+
+	// rotating is true while a key rotation is in progress.
+	rotating  bool
+	cipherMux sync.Mutex
 }
 
 // JoinChannel is called whenever a channel is joined locally.
@@ -79,27 +96,10 @@ func (w *wasmModel) ReceiveMessage(channelID *id.ID, messageID message.ID,
 		DmToken:        dmToken,
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		jww.ERROR.Printf(
-			"[CH] Could not JSON marshal payload for ReceiveMessage: %+v", err)
-		return 0
-	}
-
-	response, err := w.wm.SendMessage(ReceiveMessageTag, data)
-	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", ReceiveMessageTag, err)
-	}
-
-	var uuid uint64
-	if err = json.Unmarshal(response, &uuid); err != nil {
-		jww.ERROR.Printf("[CH] Failed to JSON unmarshal UUID from worker for "+
-			"%q: %+v", ReceiveMessageTag, err)
-		return 0
-	}
-
-	return uuid
+	return w.receiver.receive(ReceiveBatchEntry{
+		Tag:                 ReceiveMessageTag,
+		ReceiveReplyMessage: ReceiveReplyMessage{ModelMessage: msg},
+	})
 }
 
 // ReceiveReplyMessage is JSON marshalled and sent to the worker for
@@ -140,27 +140,8 @@ func (w *wasmModel) ReceiveReply(channelID *id.ID, messageID,
 		},
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		jww.ERROR.Printf(
-			"[CH] Could not JSON marshal payload for ReceiveReply: %+v", err)
-		return 0
-	}
-
-	response, err := w.wm.SendMessage(ReceiveReplyTag, data)
-	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", ReceiveReplyTag, err)
-	}
-
-	var uuid uint64
-	if err = json.Unmarshal(response, &uuid); err != nil {
-		jww.ERROR.Printf("[CH] Failed to JSON unmarshal UUID from worker for "+
-			"%q: %+v", ReceiveReplyTag, err)
-		return 0
-	}
-
-	return uuid
+	return w.receiver.receive(
+		ReceiveBatchEntry{Tag: ReceiveReplyTag, ReceiveReplyMessage: msg})
 }
 
 // ReceiveReaction is called whenever a reaction to a message is received on a
@@ -195,27 +176,8 @@ func (w *wasmModel) ReceiveReaction(channelID *id.ID, messageID,
 		},
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		jww.ERROR.Printf(
-			"[CH] Could not JSON marshal payload for ReceiveReaction: %+v", err)
-		return 0
-	}
-
-	response, err := w.wm.SendMessage(ReceiveReactionTag, data)
-	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", ReceiveReactionTag, err)
-	}
-
-	var uuid uint64
-	if err = json.Unmarshal(response, &uuid); err != nil {
-		jww.ERROR.Printf("[CH] Failed to JSON unmarshal UUID from worker for "+
-			"%q: %+v", ReceiveReactionTag, err)
-		return 0
-	}
-
-	return uuid
+	return w.receiver.receive(
+		ReceiveBatchEntry{Tag: ReceiveReactionTag, ReceiveReplyMessage: msg})
 }
 
 // MessageUpdateInfo is JSON marshalled and sent to the worker for
@@ -432,3 +394,240 @@ func (w *wasmModel) MuteUser(
 		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", MuteUserTag, err)
 	}
 }
+
+// MessageQuery is JSON marshalled and sent to the worker for
+// [wasmModel.QueryMessages]. All filters are optional; a zero value matches
+// every message.
+//
+// Example JSON:
+//
+//	{
+//	  "channelID": "ouFTjrB6vJ8MDRrZ9KR3cVUbQY2cC0ek8gGW4jKTWPQD",
+//	  "pubKey": "V93pXwmNqNdkTvS7XaC8RzvqJiyjdDlUk6G2tnd7Lss=",
+//	  "types": [1, 2],
+//	  "pinned": true,
+//	  "start": "2023-05-01T00:00:00Z",
+//	  "end": "2023-06-01T00:00:00Z",
+//	  "limit": 50,
+//	  "descending": true,
+//	  "cursor": "eyJrZXkiOiIyMDIzLTA1LTEyVDE1OjAzOjQyWiIsInV1aWQiOjQyfQ=="
+//	}
+type MessageQuery struct {
+	// ChannelID restricts results to a single channel. Results are ordered by
+	// timestamp, except that the pinned or unpinned messages of a channel are
+	// in the order they were stored.
+	ChannelID *id.ID `json:"channelID,omitempty"`
+
+	// PubKey restricts results to messages sent by this public key.
+	PubKey ed25519.PublicKey `json:"pubKey,omitempty"`
+
+	// Types restricts results to messages of these types.
+	Types []channels.MessageType `json:"types,omitempty"`
+
+	// Pinned, if set, restricts results to pinned or unpinned messages.
+	Pinned *bool `json:"pinned,omitempty"`
+
+	// Start (inclusive) and End (exclusive) restrict results to messages with
+	// a timestamp in the range. A zero time leaves that end open.
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+
+	// Limit is the maximum number of messages returned. Defaults to 100 if
+	// zero.
+	Limit int `json:"limit,omitempty"`
+
+	// Descending returns the newest messages first.
+	Descending bool `json:"descending,omitempty"`
+
+	// Cursor is the NextCursor of the previous page. Leave empty to get the
+	// first page.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// MessageQueryResult is JSON marshalled and received from the worker for
+// [wasmModel.QueryMessages].
+type MessageQueryResult struct {
+	// Messages are the matching messages with decrypted content.
+	Messages []channels.ModelMessage `json:"messages"`
+
+	// NextCursor is passed in MessageQuery.Cursor to get the next page. It is
+	// empty when there are no more results.
+	NextCursor string `json:"nextCursor"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// QueryMessages returns a page of messages matching the query with their
+// content decrypted.
+func (w *wasmModel) QueryMessages(
+	query MessageQuery) (MessageQueryResult, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return MessageQueryResult{}, errors.Errorf(
+			"could not JSON marshal payload for QueryMessages: %+v", err)
+	}
+
+	response, err := w.wm.SendMessage(QueryMessagesTag, data)
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[CH] Failed to send to %q: %+v", QueryMessagesTag, err)
+	}
+
+	var result MessageQueryResult
+	if err = json.Unmarshal(response, &result); err != nil {
+		return MessageQueryResult{}, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", QueryMessagesTag)
+	}
+
+	if result.Error != "" {
+		return MessageQueryResult{}, errors.New(result.Error)
+	}
+
+	return result, nil
+}
+
+// SearchMessagesMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SearchMessages].
+type SearchMessagesMessage struct {
+	// Query is the text to search for. Messages must contain every term.
+	Query string `json:"query"`
+
+	// ChannelID, if set, restricts results to a single channel.
+	ChannelID *id.ID `json:"channelID,omitempty"`
+
+	// Limit is the maximum number of messages returned. Defaults to 100 if
+	// zero.
+	Limit int `json:"limit,omitempty"`
+}
+
+// SearchMessagesResult is JSON marshalled and received from the worker for
+// [wasmModel.SearchMessages].
+type SearchMessagesResult struct {
+	// Messages are the matching messages with decrypted content, newest
+	// first.
+	Messages []channels.ModelMessage `json:"messages"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// SearchMessages returns the messages containing every term in the query with
+// their content decrypted.
+func (w *wasmModel) SearchMessages(
+	msg SearchMessagesMessage) ([]channels.ModelMessage, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"could not JSON marshal payload for SearchMessages: %+v", err)
+	}
+
+	response, err := w.wm.SendMessage(SearchMessagesTag, data)
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[CH] Failed to send to %q: %+v", SearchMessagesTag, err)
+	}
+
+	var result SearchMessagesResult
+	if err = json.Unmarshal(response, &result); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", SearchMessagesTag)
+	}
+
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return result.Messages, nil
+}
+
+// SetRetentionPolicyMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SetRetentionPolicy].
+type SetRetentionPolicyMessage struct {
+	ChannelID *id.ID               `json:"channelID"`
+	Policy    impl.RetentionPolicy `json:"policy"`
+}
+
+// SetRetentionPolicy sets the retention policy of the channel and deletes the
+// messages that it does not keep. A zero policy keeps every message.
+func (w *wasmModel) SetRetentionPolicy(
+	channelID *id.ID, policy impl.RetentionPolicy) error {
+	msg := SetRetentionPolicyMessage{
+		ChannelID: channelID,
+		Policy:    policy,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for SetRetentionPolicy: %+v", err)
+	}
+
+	response, err := w.wm.SendMessage(SetRetentionPolicyTag, data)
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[CH] Failed to send to %q: %+v", SetRetentionPolicyTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// RotateDatabaseKeyMessage is JSON marshalled and sent to the worker for each
+// batch of [wasmModel.RotateDatabaseKey].
+type RotateDatabaseKeyMessage struct {
+	EncryptionJSON string `json:"encryptionJSON"`
+
+	// Resume is true if only an unfinished rotation may be resumed.
+	Resume bool `json:"resume"`
+}
+
+// RotateDatabaseKeyResult is JSON marshalled and received from the worker for
+// each batch of [wasmModel.RotateDatabaseKey].
+type RotateDatabaseKeyResult struct {
+	Progress impl.KeyRotationProgress `json:"progress"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// RotateDatabaseKey re-encrypts every message with the new cipher. Each batch
+// is a separate message to the worker, so other calls are handled between
+// batches, and progress is called after each one. If resume is true, returns
+// an error if there is no unfinished rotation.
+func (w *wasmModel) RotateDatabaseKey(encryption idbCrypto.Cipher,
+	resume bool, progress func(impl.KeyRotationProgress)) error {
+	encryptionJSON, err := json.Marshal(encryption)
+	if err != nil {
+		return errors.Errorf("could not JSON marshal Cipher: %+v", err)
+	}
+	w.setRotation(encryption, true)
+	data, err := json.Marshal(RotateDatabaseKeyMessage{
+		EncryptionJSON: string(encryptionJSON),
+		Resume:         resume,
+	})
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for RotateDatabaseKey: %+v", err)
+	}
+
+	for {
+		response, err := w.wm.SendMessage(RotateDatabaseKeyTag, data)
+		if err != nil {
+			jww.FATAL.Panicf(
+				"[CH] Failed to send to %q: %+v", RotateDatabaseKeyTag, err)
+		}
+
+		var result RotateDatabaseKeyResult
+		if err = json.Unmarshal(response, &result); err != nil {
+			return errors.Wrapf(err, "[CH] Could not JSON unmarshal "+
+				"response to %q", RotateDatabaseKeyTag)
+		} else if result.Error != "" {
+			return errors.New(result.Error)
+		}
+
+		progress(result.Progress)
+		if result.Progress.Done {
+			w.cipherMux.Lock()
+			w.encryption, w.rotation, w.rotating = encryption, nil, false
+			w.cipherMux.Unlock()
+			return nil
+		}
+	}
+}
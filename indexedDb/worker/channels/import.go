@@ -0,0 +1,109 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package channels
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+)
+
+// ImportHistoryMessage is JSON marshalled and sent to the worker for each batch
+// of [wasmModel.ImportHistory].
+type ImportHistoryMessage struct {
+	Channel ExportedChannel `json:"channel"`
+
+	// Messages are the messages of the batch. Reactions are listed separately
+	// after the message they react to.
+	Messages []ExportedMessage `json:"messages"`
+}
+
+// ImportHistoryResult is JSON marshalled and received from the worker for each
+// batch of [wasmModel.ImportHistory].
+type ImportHistoryResult struct {
+	// Progress holds the counts and conflicts of the batch only.
+	Progress impl.ImportProgress `json:"progress"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// ImportHistory imports the messages of the channel history in batches of
+// impl.ImportBatchSize. Each batch is a separate message to the worker, so
+// other calls are handled between batches, and progress is called after each.
+// Messages already stored are skipped, so an interrupted import can be run
+// again.
+func (w *wasmModel) ImportHistory(history ChannelHistory,
+	progress func(impl.ImportProgress)) (impl.ImportProgress, error) {
+	messages := flattenHistory(history.Messages)
+	total := impl.ImportProgress{Total: len(messages)}
+
+	// At least one batch is sent so that the channel is created
+	for start := 0; start == 0 || start < len(messages); {
+		end := start + impl.ImportBatchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		data, err := json.Marshal(ImportHistoryMessage{
+			Channel:  history.Channel,
+			Messages: messages[start:end],
+		})
+		if err != nil {
+			return total, errors.Errorf(
+				"could not JSON marshal payload for ImportHistory: %+v", err)
+		}
+
+		response, err := w.wm.SendMessage(ImportHistoryTag, data)
+		if err != nil {
+			jww.FATAL.Panicf(
+				"[CH] Failed to send to %q: %+v", ImportHistoryTag, err)
+		}
+
+		var result ImportHistoryResult
+		if err = json.Unmarshal(response, &result); err != nil {
+			return total, errors.Wrapf(err, "[CH] Could not JSON unmarshal "+
+				"response to %q", ImportHistoryTag)
+		} else if result.Error != "" {
+			return total, errors.New(result.Error)
+		}
+
+		total.Add(result.Progress)
+		total.Done = end == len(messages)
+		progress(total)
+		if total.Done {
+			return total, nil
+		}
+		start = end
+	}
+
+	return total, nil
+}
+
+// flattenHistory returns the messages with the reactions of each listed after
+// it. Each reaction is given the ID of the message it reacts to, if missing.
+func flattenHistory(messages []ExportedMessage) []ExportedMessage {
+	flat := make([]ExportedMessage, 0, len(messages))
+	for _, msg := range messages {
+		reactions := msg.Reactions
+		msg.Reactions = nil
+		flat = append(flat, msg)
+		for _, reaction := range reactions {
+			if reaction.ReplyTo == nil {
+				parentID := msg.MessageID
+				reaction.ReplyTo = &parentID
+			}
+			reaction.Reactions = nil
+			flat = append(flat, reaction)
+		}
+	}
+	return flat
+}
@@ -11,6 +11,8 @@ package channels
 
 import (
 	"encoding/json"
+	"slices"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -18,14 +20,20 @@ import (
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/channels"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/logging"
 	"gitlab.com/elixxir/xxdk-wasm/storage"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
+	"gitlab.com/xx_network/primitives/id"
 )
 
 // databaseSuffix is the suffix to be appended to the name of the database.
 const databaseSuffix = "_speakeasy"
 
+// DatabaseVersion is the current schema version of the channel indexedDb
+// database. It is recorded in the database registry.
+const DatabaseVersion uint = 8
+
 // NewWASMEventModelBuilder returns an EventModelBuilder which allows
 // the channel manager to define the path but the callback is the same
 // across the board.
@@ -43,6 +51,10 @@ func NewWASMEventModelBuilder(wasmJsPath string, encryption idbCrypto.Cipher,
 type NewWASMEventModelMessage struct {
 	DatabaseName   string `json:"databaseName"`
 	EncryptionJSON string `json:"encryptionJSON"`
+
+	// ProbeEncryption is true if the stored encryption status of the database
+	// is unconfirmed and must be checked against its rows.
+	ProbeEncryption bool `json:"probeEncryption"`
 }
 
 // NewWASMEventModel returns a [channels.EventModel] backed by a wasmModel.
@@ -68,15 +80,21 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 			"between channel indexedDb worker and logger")
 	}
 
-	// Store the database name
-	err = storage.StoreIndexedDb(databaseName)
+	// Store the database in the registry
+	err = storage.RegisterIndexedDb(storage.DatabaseInfo{
+		Name:      databaseName,
+		Kind:      storage.ChannelsDatabase,
+		Identity:  path,
+		Version:   DatabaseVersion,
+		Encrypted: encryption != nil,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Check that the encryption status
 	encryptionStatus := encryption != nil
-	err = checkDbEncryptionStatus(databaseName, encryptionStatus)
+	confirmed, err := checkDbEncryptionStatus(databaseName, encryptionStatus)
 	if err != nil {
 		return nil, err
 	}
@@ -87,8 +105,9 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 	}
 
 	msg := NewWASMEventModelMessage{
-		DatabaseName:   databaseName,
-		EncryptionJSON: string(encryptionJSON),
+		DatabaseName:    databaseName,
+		EncryptionJSON:  string(encryptionJSON),
+		ProbeEncryption: !confirmed,
 	}
 
 	payload, err := json.Marshal(msg)
@@ -104,7 +123,330 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 		return nil, errors.New(string(response))
 	}
 
-	return &wasmModel{wm}, nil
+	// The worker found that the rows match the encryption status
+	if !confirmed {
+		err = storage.SetIndexedDbEncryptionStatus(
+			databaseName, encryptionStatus)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	model := &wasmModel{
+		wm:           wm,
+		receiver:     newReceiveBatcher(wm),
+		databaseName: databaseName,
+		encryption:   encryption,
+	}
+	models.Lock()
+	models.m[path] = model
+	models.Unlock()
+	wm.RegisterStopCallback(func() { removeModel(path, model) })
+
+	return model, nil
+}
+
+// models are the open event models keyed on their storage tag.
+var models = struct {
+	m map[string]*wasmModel
+	sync.Mutex
+}{m: make(map[string]*wasmModel)}
+
+// removeModel forgets the event model opened for the storage tag once its
+// worker is stopped, unless another event model has since been opened for it.
+func removeModel(path string, model *wasmModel) {
+	models.Lock()
+	defer models.Unlock()
+	if models.m[path] == model {
+		delete(models.m, path)
+	}
+}
+
+// PurgeHandler returns the function, for [storage.RegisterPurgeHandler], that
+// stops the worker of every open event model whose database is about to be
+// purged. This closes the database so that it can be deleted, and the event
+// model is forgotten.
+func PurgeHandler() func(databaseNames []string) {
+	return func(databaseNames []string) {
+		for _, model := range openModels() {
+			if !slices.Contains(databaseNames, model.databaseName) {
+				continue
+			}
+			if err := model.wm.Stop(); err != nil {
+				jww.ERROR.Printf("[CH] Failed to stop worker of purged "+
+					"database %q: %+v", model.databaseName, err)
+			}
+		}
+	}
+}
+
+// QueryMessages returns a page of messages matching the query from the event
+// model opened for the storage tag. The message content is decrypted.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func QueryMessages(
+	storageTag string, query MessageQuery) (MessageQueryResult, error) {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return MessageQueryResult{}, err
+	}
+
+	return model.QueryMessages(query)
+}
+
+// SearchMessages returns the messages containing every term in the query from
+// the event model opened for the storage tag, newest first. The message
+// content is decrypted.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func SearchMessages(storageTag string,
+	msg SearchMessagesMessage) ([]channels.ModelMessage, error) {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return model.SearchMessages(msg)
+}
+
+// SetRetentionPolicy sets the retention policy of the channel in the event
+// model opened for the storage tag and deletes the messages that it does not
+// keep.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func SetRetentionPolicy(
+	storageTag string, channelID *id.ID, policy impl.RetentionPolicy) error {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return err
+	}
+
+	return model.SetRetentionPolicy(channelID, policy)
+}
+
+// RotateDatabaseKey re-encrypts every message in the encrypted event model
+// opened for the storage tag with the new cipher. progress is called after each
+// batch. If the rotation is interrupted, the event model must be opened with
+// the new cipher, which reads messages encrypted with either cipher, and the
+// rotation resumes when called again with the same cipher.
+//
+// The new cipher must be made from a new password; a cipher with the same key
+// as the current one is rejected.
+//
+// Returns an error if no event model has been opened for the storage tag or the
+// database is not encrypted.
+func RotateDatabaseKey(storageTag string, encryption idbCrypto.Cipher,
+	progress func(impl.KeyRotationProgress)) error {
+	if encryption == nil {
+		return errors.New("cannot rotate to a nil cipher; use DecryptDatabase")
+	}
+	return migrateDatabase(storageTag, true, encryption, progress)
+}
+
+// EncryptDatabase encrypts every message in the unencrypted event model opened
+// for the storage tag with the cipher. progress is called after each batch.
+// If the migration is interrupted, the event model must be opened with the
+// cipher once the first batch is encrypted, and without it before then, and it
+// resumes when called again with the same cipher.
+//
+// Returns an error if no event model has been opened for the storage tag or the
+// database is already encrypted and has no unfinished migration.
+func EncryptDatabase(storageTag string, encryption idbCrypto.Cipher,
+	progress func(impl.KeyRotationProgress)) error {
+	if encryption == nil {
+		return errors.New("cannot encrypt with a nil cipher")
+	}
+	return migrateDatabase(storageTag, false, encryption, progress)
+}
+
+// DecryptDatabase decrypts every message in the encrypted event model opened
+// for the storage tag. progress is called after each batch. If the migration is
+// interrupted, the event model must be opened with the old cipher, and it
+// resumes when called again. Once done, the database is recorded as
+// unencrypted and must be opened without a cipher.
+//
+// Returns an error if no event model has been opened for the storage tag or the
+// database is not encrypted.
+func DecryptDatabase(
+	storageTag string, progress func(impl.KeyRotationProgress)) error {
+	return migrateDatabase(storageTag, true, nil, progress)
+}
+
+// ExportChannelHistory exports the messages of the channel in the range from
+// the event model opened for the storage tag in the given format. chunk is
+// called with each part of the output, in order.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func ExportChannelHistory(storageTag string, channelID *id.ID,
+	format ExportFormat, r ExportRange, chunk func([]byte)) error {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return err
+	}
+
+	return model.ExportChannelHistory(channelID, format, r, chunk)
+}
+
+// ImportHistory imports the messages of a channel history exported with
+// ExportJSON into the event model opened for the storage tag. progress is
+// called after each batch. Returns the final progress, which summarises the
+// duplicates and conflicts.
+//
+// Returns an error if no event model has been opened for the storage tag or the
+// archive is invalid.
+func ImportHistory(storageTag string, archive []byte,
+	progress func(impl.ImportProgress)) (impl.ImportProgress, error) {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return impl.ImportProgress{}, err
+	}
+
+	var history ChannelHistory
+	if err = json.Unmarshal(archive, &history); err != nil {
+		return impl.ImportProgress{},
+			errors.Wrap(err, "could not JSON unmarshal channel history")
+	} else if history.Version > ExportVersion {
+		return impl.ImportProgress{}, errors.Errorf("unsupported channel "+
+			"history version %d (maximum %d)", history.Version, ExportVersion)
+	} else if history.Channel.ID == nil {
+		return impl.ImportProgress{},
+			errors.New("channel history has no channel ID")
+	}
+
+	return model.ImportHistory(history, progress)
+}
+
+// MarkRead moves the read marker of the channel in the event model opened for
+// the storage tag to the message with the UUID, or past every message if the
+// UUID is 0.
+//
+// Returns an error if no event model has been opened for the storage tag or
+// the message is not in the channel.
+func MarkRead(storageTag string, channelID *id.ID, uuid uint64) error {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return err
+	}
+	return model.MarkRead(channelID, uuid)
+}
+
+// GetUnreadCounts returns the read marker and the number of unread messages of
+// every channel in the event model opened for the storage tag.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func GetUnreadCounts(storageTag string) ([]UnreadCount, error) {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return nil, err
+	}
+	return model.GetUnreadCounts()
+}
+
+// SaveDraft stores the draft of the channel in the event model opened for the
+// storage tag, with its text encrypted with the cipher of the event model. A
+// zero draft clears the stored draft.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func SaveDraft(storageTag string, channelID *id.ID, draft impl.Draft) error {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return err
+	}
+	return model.SaveDraft(channelID, draft)
+}
+
+// GetDraft returns the draft of the channel in the event model opened for the
+// storage tag, or a zero draft if none is stored.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func GetDraft(storageTag string, channelID *id.ID) (impl.Draft, error) {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return impl.Draft{}, err
+	}
+	return model.GetDraft(channelID)
+}
+
+// ClearDraft removes the draft of the channel in the event model opened for
+// the storage tag, if one is stored.
+//
+// Returns an error if no event model has been opened for the storage tag.
+func ClearDraft(storageTag string, channelID *id.ID) error {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return err
+	}
+	return model.ClearDraft(channelID)
+}
+
+// migrateDatabase re-encrypts every message in the event model opened for the
+// storage tag with the cipher, or decrypts them if it is nil, and then records
+// the new encryption status. Returns an error if the stored encryption status
+// of the database is not the expected one.
+func migrateDatabase(storageTag string, encrypted bool,
+	encryption idbCrypto.Cipher, progress func(impl.KeyRotationProgress)) error {
+	model, err := getModel(storageTag)
+	if err != nil {
+		return err
+	}
+
+	databaseName := storageTag + databaseSuffix
+	loadedEncryptionStatus, err := storedEncryptionStatus(databaseName, model)
+	if err != nil {
+		return err
+	}
+
+	// An encryption interrupted after its first batch is resumed in a database
+	// that was opened with the cipher and so is recorded as encrypted
+	resume := !encrypted && loadedEncryptionStatus
+	if loadedEncryptionStatus != encrypted && !resume {
+		return errors.Errorf("database encryption status is %t; expected %t",
+			loadedEncryptionStatus, encrypted)
+	}
+
+	// Until the migration is done, the rows may match either status, so the
+	// status is checked against the rows if the database is opened before then
+	if loadedEncryptionStatus != (encryption != nil) {
+		err = storage.UnconfirmIndexedDbEncryptionStatus(databaseName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = model.RotateDatabaseKey(encryption, resume, progress); err != nil {
+		return err
+	}
+
+	return storage.SetIndexedDbEncryptionStatus(databaseName, encryption != nil)
+}
+
+// storedEncryptionStatus returns the stored encryption status of the database
+// of the event model. A status that is unconfirmed while the event model is
+// open is of a migration that was interrupted since it was opened, so the
+// status of the event model is returned instead.
+func storedEncryptionStatus(
+	databaseName string, model *wasmModel) (bool, error) {
+	confirmed, err := storage.IndexedDbEncryptionStatusConfirmed(databaseName)
+	if err != nil {
+		return false, err
+	} else if !confirmed {
+		model.cipherMux.Lock()
+		defer model.cipherMux.Unlock()
+		return model.encryption != nil, nil
+	}
+	return storage.GetIndexedDbEncryptionStatus(databaseName)
+}
+
+// getModel returns the event model opened for the storage tag.
+func getModel(storageTag string) (*wasmModel, error) {
+	models.Lock()
+	defer models.Unlock()
+	model, exists := models.m[storageTag]
+	if !exists {
+		return nil, errors.Errorf(
+			"no channels event model open for storage tag %q", storageTag)
+	}
+	return model, nil
 }
 
 // EventUpdateCallbackMessage is JSON marshalled and received from the worker
@@ -145,23 +487,25 @@ type EncryptionStatusReply struct {
 }
 
 // checkDbEncryptionStatus returns an error if the encryption status provided
-// does not match the stored status for this database name.
-func checkDbEncryptionStatus(databaseName string, encryptionStatus bool) error {
-
+// does not match the stored status for this database name. Returns false if
+// the stored status was stored by an older version and is unconfirmed, in which
+// case the status provided must be checked against the rows of the database.
+func checkDbEncryptionStatus(
+	databaseName string, encryptionStatus bool) (bool, error) {
 	// Pass message values to storage
 	loadedEncryptionStatus, err := storage.StoreIndexedDbEncryptionStatus(
 		databaseName, encryptionStatus)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Verify encryption status does not change
 	if encryptionStatus != loadedEncryptionStatus {
-		return errors.New(
+		return false, errors.New(
 			"cannot load database with different encryption status")
 	} else if !encryptionStatus {
 		jww.WARN.Printf("IndexedDb encryption disabled!")
 	}
 
-	return nil
+	return storage.IndexedDbEncryptionStatusConfirmed(databaseName)
 }
@@ -17,14 +17,28 @@ const (
 	NewWASMEventModelTag   worker.Tag = "NewWASMEventModel"
 	EventUpdateCallbackTag worker.Tag = "EventUpdateCallback"
 
-	JoinChannelTag         worker.Tag = "JoinChannel"
-	LeaveChannelTag        worker.Tag = "LeaveChannel"
-	ReceiveMessageTag      worker.Tag = "ReceiveMessage"
-	ReceiveReplyTag        worker.Tag = "ReceiveReply"
-	ReceiveReactionTag     worker.Tag = "ReceiveReaction"
-	UpdateFromUUIDTag      worker.Tag = "UpdateFromUUID"
-	UpdateFromMessageIDTag worker.Tag = "UpdateFromMessageID"
-	GetMessageTag          worker.Tag = "GetMessage"
-	DeleteMessageTag       worker.Tag = "DeleteMessage"
-	MuteUserTag            worker.Tag = "MuteUser"
+	JoinChannelTag          worker.Tag = "JoinChannel"
+	LeaveChannelTag         worker.Tag = "LeaveChannel"
+	ReceiveMessageTag       worker.Tag = "ReceiveMessage"
+	ReceiveReplyTag         worker.Tag = "ReceiveReply"
+	ReceiveReactionTag      worker.Tag = "ReceiveReaction"
+	ReceiveBatchTag         worker.Tag = "ReceiveBatch"
+	UpdateFromUUIDTag       worker.Tag = "UpdateFromUUID"
+	UpdateFromMessageIDTag  worker.Tag = "UpdateFromMessageID"
+	GetMessageTag           worker.Tag = "GetMessage"
+	DeleteMessageTag        worker.Tag = "DeleteMessage"
+	MuteUserTag             worker.Tag = "MuteUser"
+	QueryMessagesTag        worker.Tag = "QueryMessages"
+	SearchMessagesTag       worker.Tag = "SearchMessages"
+	SetRetentionPolicyTag   worker.Tag = "SetRetentionPolicy"
+	RotateDatabaseKeyTag    worker.Tag = "RotateDatabaseKey"
+	ExportChannelHistoryTag worker.Tag = "ExportChannelHistory"
+	ImportHistoryTag        worker.Tag = "ImportHistory"
+	MarkReadTag             worker.Tag = "MarkRead"
+	GetUnreadCountsTag      worker.Tag = "GetUnreadCounts"
+	SaveDraftTag            worker.Tag = "SaveDraft"
+	GetDraftTag             worker.Tag = "GetDraft"
+	ClearDraftTag           worker.Tag = "ClearDraft"
+	LockCipherTag           worker.Tag = "LockCipher"
+	UnlockCipherTag         worker.Tag = "UnlockCipher"
 )
@@ -0,0 +1,88 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package dm
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+)
+
+// SaveDraftMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SaveDraft].
+type SaveDraftMessage struct {
+	PubKey ed25519.PublicKey `json:"pubKey"`
+	Draft  impl.Draft        `json:"draft"`
+}
+
+// GetDraftResult is JSON marshalled and received from the worker for
+// [wasmModel.GetDraft].
+type GetDraftResult struct {
+	Draft impl.Draft `json:"draft"`
+	Error string     `json:"error,omitempty"`
+}
+
+// SaveDraft stores the draft of the conversation with the partner, replacing
+// any stored draft. A zero draft clears the stored draft.
+func (w *wasmModel) SaveDraft(
+	partnerPubKey ed25519.PublicKey, draft impl.Draft) error {
+	data, err := json.Marshal(
+		SaveDraftMessage{PubKey: partnerPubKey, Draft: draft})
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for SaveDraft: %+v", err)
+	}
+
+	response, err := w.wh.SendMessage(SaveDraftTag, data)
+	if err != nil {
+		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", SaveDraftTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// GetDraft returns the draft of the conversation with the partner. Returns a
+// zero draft if none is stored.
+func (w *wasmModel) GetDraft(
+	partnerPubKey ed25519.PublicKey) (impl.Draft, error) {
+	response, err := w.wh.SendMessage(GetDraftTag, partnerPubKey)
+	if err != nil {
+		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", GetDraftTag, err)
+	}
+
+	var result GetDraftResult
+	if err = json.Unmarshal(response, &result); err != nil {
+		return impl.Draft{}, errors.Wrapf(err, "[DM] Could not JSON "+
+			"unmarshal response to %q", GetDraftTag)
+	} else if result.Error != "" {
+		return impl.Draft{}, errors.New(result.Error)
+	}
+
+	return result.Draft, nil
+}
+
+// ClearDraft removes the draft of the conversation with the partner, if one is
+// stored.
+func (w *wasmModel) ClearDraft(partnerPubKey ed25519.PublicKey) error {
+	response, err := w.wh.SendMessage(ClearDraftTag, partnerPubKey)
+	if err != nil {
+		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", ClearDraftTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
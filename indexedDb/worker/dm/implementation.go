@@ -12,19 +12,38 @@ package dm
 import (
 	"crypto/ed25519"
 	"encoding/json"
+	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
+
 	"gitlab.com/elixxir/client/v4/cmix/rounds"
 	"gitlab.com/elixxir/client/v4/dm"
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
+	"gitlab.com/xx_network/primitives/id"
 )
 
 // wasmModel implements dm.EventModel interface, which uses the channels system
 // passed an object that adheres to in order to get events on the channel.
 type wasmModel struct {
-	wh *worker.Manager
+	wh           *worker.Manager
+	databaseName string
+
+	// encryption is the cipher of the database, sent to the worker again when
+	// the session is unlocked.
+	encryption idbCrypto.Cipher
+
+	// rotation is the cipher that an unfinished key rotation is moving the
+	// database to.
+	rotation idbCrypto.Cipher
+
+	// rotating is true while a key rotation is in progress.
+	rotating  bool
+	cipherMux sync.Mutex
 }
 
 // TransferMessage is JSON marshalled and sent to the worker.
@@ -275,3 +294,245 @@ func (w *wasmModel) GetConversations() []dm.ModelConversation {
 
 	return result
 }
+
+// ModelMessage is a stored DM message with its content decrypted.
+type ModelMessage struct {
+	UUID               uint64            `json:"uuid"`
+	MessageID          message.ID        `json:"messageID"`
+	ConversationPubKey ed25519.PublicKey `json:"conversationPubKey"`
+	ParentMessageID    message.ID        `json:"parentMessageID"`
+	Timestamp          time.Time         `json:"timestamp"`
+	SenderPubKey       ed25519.PublicKey `json:"senderPubKey"`
+	CodesetVersion     uint8             `json:"codesetVersion"`
+	Status             dm.Status         `json:"status"`
+	Content            []byte            `json:"content"`
+	Type               dm.MessageType    `json:"type"`
+	Round              id.Round          `json:"round"`
+}
+
+// GetConversationMessagesMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetConversationMessages].
+type GetConversationMessagesMessage struct {
+	PartnerPubKey ed25519.PublicKey `json:"partnerPubKey"`
+	Before        uint64            `json:"before,omitempty"`
+	Limit         int               `json:"limit,omitempty"`
+}
+
+// MessagesResult is JSON marshalled and received from the worker for
+// [wasmModel.GetConversationMessages].
+type MessagesResult struct {
+	Messages []ModelMessage `json:"messages"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// GetConversationMessages returns up to limit messages in the conversation
+// with the partner, newest first, with their content decrypted. If before is
+// set, only messages with a UUID lower than it are returned. If limit is zero,
+// up to 100 messages are returned.
+func (w *wasmModel) GetConversationMessages(partnerPubKey ed25519.PublicKey,
+	before uint64, limit int) ([]ModelMessage, error) {
+	msg := GetConversationMessagesMessage{
+		PartnerPubKey: partnerPubKey,
+		Before:        before,
+		Limit:         limit,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf("could not JSON marshal payload for "+
+			"GetConversationMessages: %+v", err)
+	}
+
+	response, err := w.wh.SendMessage(GetConversationMessagesTag, data)
+	if err != nil {
+		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v",
+			GetConversationMessagesTag, err)
+	}
+
+	var result MessagesResult
+	if err = json.Unmarshal(response, &result); err != nil {
+		return nil, errors.Wrapf(err, "[DM] Could not JSON unmarshal "+
+			"response to %q", GetConversationMessagesTag)
+	}
+
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return result.Messages, nil
+}
+
+// GetMessageMessage is JSON marshalled and received from the worker for
+// [wasmModel.GetMessageByID].
+type GetMessageMessage struct {
+	Message ModelMessage `json:"message"`
+	Error   string       `json:"error"`
+}
+
+// GetMessageByID returns the message with the given [message.ID] with its
+// content decrypted.
+func (w *wasmModel) GetMessageByID(messageID message.ID) (ModelMessage, error) {
+	response, err := w.wh.SendMessage(GetMessageByIDTag, messageID.Marshal())
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[DM] Failed to send to %q: %+v", GetMessageByIDTag, err)
+	}
+
+	var msg GetMessageMessage
+	if err = json.Unmarshal(response, &msg); err != nil {
+		return ModelMessage{}, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", GetMessageByIDTag)
+	}
+
+	if msg.Error != "" {
+		return ModelMessage{}, errors.New(msg.Error)
+	}
+
+	return msg.Message, nil
+}
+
+// SearchMessagesMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SearchMessages].
+type SearchMessagesMessage struct {
+	// Query is the text to search for. Messages must contain every term.
+	Query string `json:"query"`
+
+	// PartnerPubKey, if set, restricts results to a single conversation.
+	PartnerPubKey ed25519.PublicKey `json:"partnerPubKey,omitempty"`
+
+	// Limit is the maximum number of messages returned. Defaults to 100 if
+	// zero.
+	Limit int `json:"limit,omitempty"`
+}
+
+// SearchMessagesResult is JSON marshalled and received from the worker for
+// [wasmModel.SearchMessages].
+type SearchMessagesResult struct {
+	// Messages are the matching messages with decrypted content, newest
+	// first.
+	Messages []ModelMessage `json:"messages"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// SearchMessages returns the messages containing every term in the query with
+// their content decrypted.
+func (w *wasmModel) SearchMessages(
+	msg SearchMessagesMessage) ([]ModelMessage, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"could not JSON marshal payload for SearchMessages: %+v", err)
+	}
+
+	response, err := w.wh.SendMessage(SearchMessagesTag, data)
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[DM] Failed to send to %q: %+v", SearchMessagesTag, err)
+	}
+
+	var result SearchMessagesResult
+	if err = json.Unmarshal(response, &result); err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", SearchMessagesTag)
+	}
+
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return result.Messages, nil
+}
+
+// SetRetentionPolicyMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SetRetentionPolicy].
+type SetRetentionPolicyMessage struct {
+	PartnerPubKey ed25519.PublicKey    `json:"partnerPubKey"`
+	Policy        impl.RetentionPolicy `json:"policy"`
+}
+
+// SetRetentionPolicy sets the retention policy of the conversation with the
+// partner and deletes the messages that it does not keep. A zero policy keeps
+// every message.
+func (w *wasmModel) SetRetentionPolicy(
+	partnerPubKey ed25519.PublicKey, policy impl.RetentionPolicy) error {
+	msg := SetRetentionPolicyMessage{
+		PartnerPubKey: partnerPubKey,
+		Policy:        policy,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for SetRetentionPolicy: %+v", err)
+	}
+
+	response, err := w.wh.SendMessage(SetRetentionPolicyTag, data)
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[DM] Failed to send to %q: %+v", SetRetentionPolicyTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// RotateDatabaseKeyMessage is JSON marshalled and sent to the worker for each
+// batch of [wasmModel.RotateDatabaseKey].
+type RotateDatabaseKeyMessage struct {
+	EncryptionJSON string `json:"encryptionJSON"`
+
+	// Resume is true if only an unfinished rotation may be resumed.
+	Resume bool `json:"resume"`
+}
+
+// RotateDatabaseKeyResult is JSON marshalled and received from the worker for
+// each batch of [wasmModel.RotateDatabaseKey].
+type RotateDatabaseKeyResult struct {
+	Progress impl.KeyRotationProgress `json:"progress"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// RotateDatabaseKey re-encrypts every message with the new cipher. Each batch
+// is a separate message to the worker, so other calls are handled between
+// batches, and progress is called after each one. If resume is true, returns
+// an error if there is no unfinished rotation.
+func (w *wasmModel) RotateDatabaseKey(encryption idbCrypto.Cipher,
+	resume bool, progress func(impl.KeyRotationProgress)) error {
+	encryptionJSON, err := json.Marshal(encryption)
+	if err != nil {
+		return errors.Errorf("could not JSON marshal Cipher: %+v", err)
+	}
+	w.setRotation(encryption, true)
+	data, err := json.Marshal(RotateDatabaseKeyMessage{
+		EncryptionJSON: string(encryptionJSON),
+		Resume:         resume,
+	})
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for RotateDatabaseKey: %+v", err)
+	}
+
+	for {
+		response, err := w.wh.SendMessage(RotateDatabaseKeyTag, data)
+		if err != nil {
+			jww.FATAL.Panicf(
+				"[DM] Failed to send to %q: %+v", RotateDatabaseKeyTag, err)
+		}
+
+		var result RotateDatabaseKeyResult
+		if err = json.Unmarshal(response, &result); err != nil {
+			return errors.Wrapf(err, "[DM] Could not JSON unmarshal "+
+				"response to %q", RotateDatabaseKeyTag)
+		} else if result.Error != "" {
+			return errors.New(result.Error)
+		}
+
+		progress(result.Progress)
+		if result.Progress.Done {
+			w.cipherMux.Lock()
+			w.encryption, w.rotation, w.rotating = encryption, nil, false
+			w.cipherMux.Unlock()
+			return nil
+		}
+	}
+}
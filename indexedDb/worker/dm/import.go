@@ -0,0 +1,195 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package dm
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// ExportVersion is the version of the JSON schema of a conversation history
+// archive ([ConversationHistory]). It changes whenever the schema changes in a
+// way that is not backwards compatible.
+const ExportVersion = 1
+
+// ConversationHistory is the JSON schema of the archive of a DM conversation.
+// Messages are in timestamp order. Reactions are not listed as messages; they
+// are listed on the message they react to.
+//
+// Example JSON:
+//
+//	{
+//	  "version": 1,
+//	  "conversation": {
+//	    "pubKey": "KXZ6VDzxIzFdBy6nPjnCfD6wN5WnpSyEn4nrWDxtwNk=",
+//	    "nickname": "bob",
+//	    "token": 3215482911,
+//	    "codesetVersion": 0
+//	  },
+//	  "exportedAt": "2023-06-01T09:21:08.551Z",
+//	  "messages": [
+//	    {
+//	      "messageID": "M7Yh8SJ3CP6fuNGP1UV5VhN8c5kqL5iG8Kx+q9zkmGE=",
+//	      "type": 1,
+//	      "senderPubKey": "V93pXwmNqNdkTvS7XaC8RzvqJiyjdDlUk6G2tnd7Lss=",
+//	      "codesetVersion": 0,
+//	      "timestamp": "2023-05-12T15:03:42.197Z",
+//	      "round": 1234,
+//	      "status": 2,
+//	      "text": "Hello, Bob!",
+//	      "reactions": [
+//	        {
+//	          "messageID": "hOgzNUh4oBbGp2QXJPq6GLdHKTcz6C3XnUHdJQ6W4gk=",
+//	          "replyTo": "M7Yh8SJ3CP6fuNGP1UV5VhN8c5kqL5iG8Kx+q9zkmGE=",
+//	          "type": 3,
+//	          "senderPubKey": "KXZ6VDzxIzFdBy6nPjnCfD6wN5WnpSyEn4nrWDxtwNk=",
+//	          "codesetVersion": 0,
+//	          "timestamp": "2023-05-12T15:04:10.002Z",
+//	          "round": 1236,
+//	          "status": 2,
+//	          "text": "👍"
+//	        }
+//	      ]
+//	    }
+//	  ]
+//	}
+type ConversationHistory struct {
+	Version      int                  `json:"version"`
+	Conversation ExportedConversation `json:"conversation"`
+	ExportedAt   time.Time            `json:"exportedAt"`
+	Messages     []ExportedMessage    `json:"messages"`
+}
+
+// ExportedConversation is the conversation of a [ConversationHistory].
+type ExportedConversation struct {
+	PubKey         ed25519.PublicKey `json:"pubKey"`
+	Nickname       string            `json:"nickname"`
+	Token          uint32            `json:"token"`
+	CodesetVersion uint8             `json:"codesetVersion"`
+}
+
+// ExportedMessage is a single decrypted message in a [ConversationHistory].
+type ExportedMessage struct {
+	MessageID message.ID `json:"messageID"`
+
+	// ReplyTo is the ID of the message that this message replies or reacts
+	// to, if any.
+	ReplyTo *message.ID `json:"replyTo,omitempty"`
+
+	Type           dm.MessageType    `json:"type"`
+	SenderPubKey   ed25519.PublicKey `json:"senderPubKey"`
+	CodesetVersion uint8             `json:"codesetVersion"`
+	Timestamp      time.Time         `json:"timestamp"`
+	Round          id.Round          `json:"round"`
+	Status         dm.Status         `json:"status"`
+	Text           string            `json:"text"`
+
+	// Reactions are the reactions to the message, in timestamp order.
+	Reactions []ExportedMessage `json:"reactions,omitempty"`
+}
+
+// ImportHistoryMessage is JSON marshalled and sent to the worker for each batch
+// of [wasmModel.ImportHistory].
+type ImportHistoryMessage struct {
+	Conversation ExportedConversation `json:"conversation"`
+
+	// Messages are the messages of the batch. Reactions are listed separately
+	// after the message they react to.
+	Messages []ExportedMessage `json:"messages"`
+}
+
+// ImportHistoryResult is JSON marshalled and received from the worker for each
+// batch of [wasmModel.ImportHistory].
+type ImportHistoryResult struct {
+	// Progress holds the counts and conflicts of the batch only.
+	Progress impl.ImportProgress `json:"progress"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// ImportHistory imports the messages of the conversation history in batches of
+// impl.ImportBatchSize. Each batch is a separate message to the worker, so
+// other calls are handled between batches, and progress is called after each.
+// Messages already stored are skipped, so an interrupted import can be run
+// again.
+func (w *wasmModel) ImportHistory(history ConversationHistory,
+	progress func(impl.ImportProgress)) (impl.ImportProgress, error) {
+	messages := flattenHistory(history.Messages)
+	total := impl.ImportProgress{Total: len(messages)}
+
+	// At least one batch is sent so that the conversation is created
+	for start := 0; start == 0 || start < len(messages); {
+		end := start + impl.ImportBatchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		data, err := json.Marshal(ImportHistoryMessage{
+			Conversation: history.Conversation,
+			Messages:     messages[start:end],
+		})
+		if err != nil {
+			return total, errors.Errorf(
+				"could not JSON marshal payload for ImportHistory: %+v", err)
+		}
+
+		response, err := w.wh.SendMessage(ImportHistoryTag, data)
+		if err != nil {
+			jww.FATAL.Panicf(
+				"[DM] Failed to send to %q: %+v", ImportHistoryTag, err)
+		}
+
+		var result ImportHistoryResult
+		if err = json.Unmarshal(response, &result); err != nil {
+			return total, errors.Wrapf(err, "[DM] Could not JSON unmarshal "+
+				"response to %q", ImportHistoryTag)
+		} else if result.Error != "" {
+			return total, errors.New(result.Error)
+		}
+
+		total.Add(result.Progress)
+		total.Done = end == len(messages)
+		progress(total)
+		if total.Done {
+			return total, nil
+		}
+		start = end
+	}
+
+	return total, nil
+}
+
+// flattenHistory returns the messages with the reactions of each listed after
+// it. Each reaction is given the ID of the message it reacts to, if missing.
+func flattenHistory(messages []ExportedMessage) []ExportedMessage {
+	flat := make([]ExportedMessage, 0, len(messages))
+	for _, msg := range messages {
+		reactions := msg.Reactions
+		msg.Reactions = nil
+		flat = append(flat, msg)
+		for _, reaction := range reactions {
+			if reaction.ReplyTo == nil {
+				parentID := msg.MessageID
+				reaction.ReplyTo = &parentID
+			}
+			reaction.Reactions = nil
+			flat = append(flat, reaction)
+		}
+	}
+	return flat
+}
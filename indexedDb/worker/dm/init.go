@@ -12,6 +12,8 @@ package dm
 import (
 	"crypto/ed25519"
 	"encoding/json"
+	"slices"
+	"sync"
 
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -19,6 +21,8 @@ import (
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/dm"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/logging"
 	"gitlab.com/elixxir/xxdk-wasm/storage"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
@@ -27,6 +31,10 @@ import (
 // databaseSuffix is the suffix to be appended to the name of the database.
 const databaseSuffix = "_speakeasy_dm"
 
+// DatabaseVersion is the current schema version of the DM indexedDb
+// database. It is recorded in the database registry.
+const DatabaseVersion uint = 6
+
 // MessageReceivedCallback is called any time a message is received or updated.
 //
 // messageUpdate is true if the Message already exists and was edited.
@@ -39,6 +47,10 @@ type MessageReceivedCallback func(uuid uint64, pubKey ed25519.PublicKey,
 type NewWASMEventModelMessage struct {
 	DatabaseName   string `json:"databaseName"`
 	EncryptionJSON string `json:"encryptionJSON"`
+
+	// ProbeEncryption is true if the stored encryption status of the database
+	// is unconfirmed and must be checked against its rows.
+	ProbeEncryption bool `json:"probeEncryption"`
 }
 
 // NewWASMEventModel returns a [channels.EventModel] backed by a wasmModel.
@@ -64,15 +76,21 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 			"between DM indexedDb worker and logger")
 	}
 
-	// Store the database name
-	err = storage.StoreIndexedDb(databaseName)
+	// Store the database in the registry
+	err = storage.RegisterIndexedDb(storage.DatabaseInfo{
+		Name:      databaseName,
+		Kind:      storage.DmDatabase,
+		Identity:  path,
+		Version:   DatabaseVersion,
+		Encrypted: encryption != nil,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Check that the encryption status
 	encryptionStatus := encryption != nil
-	err = checkDbEncryptionStatus(databaseName, encryptionStatus)
+	confirmed, err := checkDbEncryptionStatus(databaseName, encryptionStatus)
 	if err != nil {
 		return nil, err
 	}
@@ -83,8 +101,9 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 	}
 
 	msg := NewWASMEventModelMessage{
-		DatabaseName:   databaseName,
-		EncryptionJSON: string(encryptionJSON),
+		DatabaseName:    databaseName,
+		EncryptionJSON:  string(encryptionJSON),
+		ProbeEncryption: !confirmed,
 	}
 
 	payload, err := json.Marshal(msg)
@@ -100,7 +119,326 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 		return nil, errors.New(string(response))
 	}
 
-	return &wasmModel{wh}, nil
+	// The worker found that the rows match the encryption status
+	if !confirmed {
+		err = storage.SetIndexedDbEncryptionStatus(
+			databaseName, encryptionStatus)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	model := &wasmModel{
+		wh:           wh,
+		databaseName: databaseName,
+		encryption:   encryption,
+	}
+	models.Lock()
+	models.m[path] = model
+	models.Unlock()
+	wh.RegisterStopCallback(func() { removeModel(path, model) })
+
+	return model, nil
+}
+
+// models are the open event models keyed on their path.
+var models = struct {
+	m map[string]*wasmModel
+	sync.Mutex
+}{m: make(map[string]*wasmModel)}
+
+// removeModel forgets the event model opened for the path once its worker
+// is stopped, unless another event model has since been opened for it.
+func removeModel(path string, model *wasmModel) {
+	models.Lock()
+	defer models.Unlock()
+	if models.m[path] == model {
+		delete(models.m, path)
+	}
+}
+
+// PurgeHandler returns the function, for [storage.RegisterPurgeHandler], that
+// stops the worker of every open event model whose database is about to be
+// purged. This closes the database so that it can be deleted, and the event
+// model is forgotten.
+func PurgeHandler() func(databaseNames []string) {
+	return func(databaseNames []string) {
+		for _, model := range openModels() {
+			if !slices.Contains(databaseNames, model.databaseName) {
+				continue
+			}
+			if err := model.wh.Stop(); err != nil {
+				jww.ERROR.Printf("[DM] Failed to stop worker of purged "+
+					"database %q: %+v", model.databaseName, err)
+			}
+		}
+	}
+}
+
+// GetConversationMessages returns up to limit messages in the conversation
+// with the partner from the event model opened for the path, newest first. The
+// message content is decrypted. Pass the UUID of the last message of a page as
+// before to get the next page.
+//
+// Returns an error if no event model has been opened for the path.
+func GetConversationMessages(path string, partnerPubKey ed25519.PublicKey,
+	before uint64, limit int) ([]ModelMessage, error) {
+	model, err := getModel(path)
+	if err != nil {
+		return nil, err
+	}
+	return model.GetConversationMessages(partnerPubKey, before, limit)
+}
+
+// GetMessageByID returns the message with the given [message.ID] from the
+// event model opened for the path. The message content is decrypted.
+//
+// Returns an error if no event model has been opened for the path.
+func GetMessageByID(path string, messageID message.ID) (ModelMessage, error) {
+	model, err := getModel(path)
+	if err != nil {
+		return ModelMessage{}, err
+	}
+	return model.GetMessageByID(messageID)
+}
+
+// SearchMessages returns the messages containing every term in the query from
+// the event model opened for the path, newest first. The message content is
+// decrypted.
+//
+// Returns an error if no event model has been opened for the path.
+func SearchMessages(
+	path string, msg SearchMessagesMessage) ([]ModelMessage, error) {
+	model, err := getModel(path)
+	if err != nil {
+		return nil, err
+	}
+	return model.SearchMessages(msg)
+}
+
+// SetRetentionPolicy sets the retention policy of the conversation with the
+// partner in the event model opened for the path and deletes the messages that
+// it does not keep.
+//
+// Returns an error if no event model has been opened for the path.
+func SetRetentionPolicy(path string, partnerPubKey ed25519.PublicKey,
+	policy impl.RetentionPolicy) error {
+	model, err := getModel(path)
+	if err != nil {
+		return err
+	}
+	return model.SetRetentionPolicy(partnerPubKey, policy)
+}
+
+// RotateDatabaseKey re-encrypts every message in the encrypted event model
+// opened for the path with the new cipher. progress is called after each
+// batch. If the rotation is interrupted, the event model must be opened with
+// the new cipher, which reads messages encrypted with either cipher, and the
+// rotation resumes when called again with the same cipher.
+//
+// The new cipher must be made from a new password; a cipher with the same key
+// as the current one is rejected.
+//
+// Returns an error if no event model has been opened for the path or the
+// database is not encrypted.
+func RotateDatabaseKey(path string, encryption idbCrypto.Cipher,
+	progress func(impl.KeyRotationProgress)) error {
+	if encryption == nil {
+		return errors.New("cannot rotate to a nil cipher; use DecryptDatabase")
+	}
+	return migrateDatabase(path, true, encryption, progress)
+}
+
+// EncryptDatabase encrypts every message in the unencrypted event model opened
+// for the path with the cipher. progress is called after each batch. If the
+// migration is interrupted, the event model must be opened with the cipher
+// once the first batch is encrypted, and without it before then, and it
+// resumes when called again with the same cipher.
+//
+// Returns an error if no event model has been opened for the path or the
+// database is already encrypted and has no unfinished migration.
+func EncryptDatabase(path string, encryption idbCrypto.Cipher,
+	progress func(impl.KeyRotationProgress)) error {
+	if encryption == nil {
+		return errors.New("cannot encrypt with a nil cipher")
+	}
+	return migrateDatabase(path, false, encryption, progress)
+}
+
+// DecryptDatabase decrypts every message in the encrypted event model opened
+// for the path. progress is called after each batch. If the migration is
+// interrupted, the event model must be opened with the old cipher, and it
+// resumes when called again. Once done, the database is recorded as
+// unencrypted and must be opened without a cipher.
+//
+// Returns an error if no event model has been opened for the path or the
+// database is not encrypted.
+func DecryptDatabase(
+	path string, progress func(impl.KeyRotationProgress)) error {
+	return migrateDatabase(path, true, nil, progress)
+}
+
+// ImportHistory imports the messages of a [ConversationHistory] archive into
+// the event model opened for the path. progress is called after each batch.
+// Returns the final progress, which summarises the duplicates and conflicts.
+//
+// Returns an error if no event model has been opened for the path or the
+// archive is invalid.
+func ImportHistory(path string, archive []byte,
+	progress func(impl.ImportProgress)) (impl.ImportProgress, error) {
+	model, err := getModel(path)
+	if err != nil {
+		return impl.ImportProgress{}, err
+	}
+
+	var history ConversationHistory
+	if err = json.Unmarshal(archive, &history); err != nil {
+		return impl.ImportProgress{},
+			errors.Wrap(err, "could not JSON unmarshal conversation history")
+	} else if history.Version > ExportVersion {
+		return impl.ImportProgress{}, errors.Errorf("unsupported "+
+			"conversation history version %d (maximum %d)",
+			history.Version, ExportVersion)
+	} else if len(history.Conversation.PubKey) != ed25519.PublicKeySize {
+		return impl.ImportProgress{},
+			errors.New("conversation history has no valid partner public key")
+	}
+
+	return model.ImportHistory(history, progress)
+}
+
+// MarkRead moves the read marker of the conversation with the partner in the
+// event model opened for the path to the message with the UUID, or past every
+// message if the UUID is 0.
+//
+// Returns an error if no event model has been opened for the path or the
+// message is not in the conversation.
+func MarkRead(path string, partnerPubKey ed25519.PublicKey, uuid uint64) error {
+	model, err := getModel(path)
+	if err != nil {
+		return err
+	}
+	return model.MarkRead(partnerPubKey, uuid)
+}
+
+// GetUnreadCounts returns the read marker and the number of unread messages of
+// every conversation in the event model opened for the path.
+//
+// Returns an error if no event model has been opened for the path.
+func GetUnreadCounts(path string) ([]UnreadCount, error) {
+	model, err := getModel(path)
+	if err != nil {
+		return nil, err
+	}
+	return model.GetUnreadCounts()
+}
+
+// SaveDraft stores the draft of the conversation with the partner in the event
+// model opened for the path, with its text encrypted with the cipher of the
+// event model. A zero draft clears the stored draft.
+//
+// Returns an error if no event model has been opened for the path.
+func SaveDraft(
+	path string, partnerPubKey ed25519.PublicKey, draft impl.Draft) error {
+	model, err := getModel(path)
+	if err != nil {
+		return err
+	}
+	return model.SaveDraft(partnerPubKey, draft)
+}
+
+// GetDraft returns the draft of the conversation with the partner in the event
+// model opened for the path, or a zero draft if none is stored.
+//
+// Returns an error if no event model has been opened for the path.
+func GetDraft(
+	path string, partnerPubKey ed25519.PublicKey) (impl.Draft, error) {
+	model, err := getModel(path)
+	if err != nil {
+		return impl.Draft{}, err
+	}
+	return model.GetDraft(partnerPubKey)
+}
+
+// ClearDraft removes the draft of the conversation with the partner in the
+// event model opened for the path, if one is stored.
+//
+// Returns an error if no event model has been opened for the path.
+func ClearDraft(path string, partnerPubKey ed25519.PublicKey) error {
+	model, err := getModel(path)
+	if err != nil {
+		return err
+	}
+	return model.ClearDraft(partnerPubKey)
+}
+
+// migrateDatabase re-encrypts every message in the event model opened for the
+// path with the cipher, or decrypts them if it is nil, and then records the
+// new encryption status. Returns an error if the stored encryption status of
+// the database is not the expected one.
+func migrateDatabase(path string, encrypted bool,
+	encryption idbCrypto.Cipher, progress func(impl.KeyRotationProgress)) error {
+	model, err := getModel(path)
+	if err != nil {
+		return err
+	}
+
+	databaseName := path + databaseSuffix
+	loadedEncryptionStatus, err := storedEncryptionStatus(databaseName, model)
+	if err != nil {
+		return err
+	}
+
+	// An encryption interrupted after its first batch is resumed in a database
+	// that was opened with the cipher and so is recorded as encrypted
+	resume := !encrypted && loadedEncryptionStatus
+	if loadedEncryptionStatus != encrypted && !resume {
+		return errors.Errorf("database encryption status is %t; expected %t",
+			loadedEncryptionStatus, encrypted)
+	}
+
+	// Until the migration is done, the rows may match either status, so the
+	// status is checked against the rows if the database is opened before then
+	if loadedEncryptionStatus != (encryption != nil) {
+		err = storage.UnconfirmIndexedDbEncryptionStatus(databaseName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = model.RotateDatabaseKey(encryption, resume, progress); err != nil {
+		return err
+	}
+
+	return storage.SetIndexedDbEncryptionStatus(databaseName, encryption != nil)
+}
+
+// storedEncryptionStatus returns the stored encryption status of the database
+// of the event model. A status that is unconfirmed while the event model is
+// open is of a migration that was interrupted since it was opened, so the
+// status of the event model is returned instead.
+func storedEncryptionStatus(
+	databaseName string, model *wasmModel) (bool, error) {
+	confirmed, err := storage.IndexedDbEncryptionStatusConfirmed(databaseName)
+	if err != nil {
+		return false, err
+	} else if !confirmed {
+		model.cipherMux.Lock()
+		defer model.cipherMux.Unlock()
+		return model.encryption != nil, nil
+	}
+	return storage.GetIndexedDbEncryptionStatus(databaseName)
+}
+
+// getModel returns the event model opened for the path.
+func getModel(path string) (*wasmModel, error) {
+	models.Lock()
+	defer models.Unlock()
+	model, exists := models.m[path]
+	if !exists {
+		return nil, errors.Errorf("no DM event model open for path %q", path)
+	}
+	return model, nil
 }
 
 // EventUpdateCallbackMessage is JSON marshalled and received from the worker
@@ -127,22 +465,25 @@ func eventUpdateCallbackHandler(
 }
 
 // checkDbEncryptionStatus returns an error if the encryption status provided
-// does not match the stored status for this database name.
-func checkDbEncryptionStatus(databaseName string, encryptionStatus bool) error {
+// does not match the stored status for this database name. Returns false if
+// the stored status was stored by an older version and is unconfirmed, in which
+// case the status provided must be checked against the rows of the database.
+func checkDbEncryptionStatus(
+	databaseName string, encryptionStatus bool) (bool, error) {
 	// Pass message values to storage
 	loadedEncryptionStatus, err := storage.StoreIndexedDbEncryptionStatus(
 		databaseName, encryptionStatus)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Verify encryption status does not change
 	if encryptionStatus != loadedEncryptionStatus {
-		return errors.New(
+		return false, errors.New(
 			"cannot load database with different encryption status")
 	} else if !encryptionStatus {
 		jww.WARN.Printf("IndexedDb encryption disabled!")
 	}
 
-	return nil
+	return storage.IndexedDbEncryptionStatusConfirmed(databaseName)
 }
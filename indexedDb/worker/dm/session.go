@@ -0,0 +1,148 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package dm
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
+)
+
+// UnlockCipherMessage is JSON marshalled and sent to the worker when the
+// session is unlocked.
+type UnlockCipherMessage struct {
+	EncryptionJSON string `json:"encryptionJSON"`
+
+	// Rotating is true if a key rotation to the cipher in RotationJSON is
+	// unfinished and must be resumed.
+	Rotating     bool   `json:"rotating"`
+	RotationJSON string `json:"rotationJSON"`
+}
+
+// SessionHandler returns the [storage.SessionHandler] that makes the worker of
+// every open event model drop its copy of the database cipher when the session
+// locks, and sends it the cipher again when the session unlocks.
+//
+// It must be registered after the handler of the [wasm.DbCipher] objects, so
+// their keys are re-derived before being sent, and before [worker.Tracker], so
+// the workers are paused before they drop the cipher and receive it again
+// before the paused messages.
+func SessionHandler() storage.SessionHandler {
+	return sessionHandler{}
+}
+
+// sessionHandler adheres to the [storage.SessionHandler] interface.
+type sessionHandler struct{}
+
+// Lock makes the worker of every open event model drop its cipher.
+func (sessionHandler) Lock() {
+	for _, model := range openModels() {
+		if err := model.lockCipher(); err != nil {
+			jww.ERROR.Printf("[DM] Failed to lock cipher: %+v", err)
+		}
+	}
+}
+
+// Unlock sends the cipher to the worker of every open event model.
+func (sessionHandler) Unlock([]byte) error {
+	for _, model := range openModels() {
+		if err := model.unlockCipher(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openModels returns every open event model.
+func openModels() []*wasmModel {
+	models.Lock()
+	defer models.Unlock()
+	list := make([]*wasmModel, 0, len(models.m))
+	for _, model := range models.m {
+		list = append(list, model)
+	}
+	return list
+}
+
+// lockCipher makes the worker drop its cipher, if the database is encrypted.
+func (w *wasmModel) lockCipher() error {
+	if !w.encrypted() {
+		return nil
+	}
+
+	response, err := w.wh.SendMessageWhilePaused(LockCipherTag, nil)
+	if err != nil {
+		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", LockCipherTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// unlockCipher sends the cipher, and the cipher of any unfinished key
+// rotation, to the worker, if the database is encrypted.
+func (w *wasmModel) unlockCipher() error {
+	if !w.encrypted() {
+		return nil
+	}
+
+	w.cipherMux.Lock()
+	encryption, rotation, rotating := w.encryption, w.rotation, w.rotating
+	w.cipherMux.Unlock()
+
+	encryptionJSON, err := json.Marshal(encryption)
+	if err != nil {
+		return errors.Errorf("could not JSON marshal Cipher: %+v", err)
+	}
+	rotationJSON, err := json.Marshal(rotation)
+	if err != nil {
+		return errors.Errorf("could not JSON marshal Cipher: %+v", err)
+	}
+	data, err := json.Marshal(UnlockCipherMessage{
+		EncryptionJSON: string(encryptionJSON),
+		Rotating:       rotating,
+		RotationJSON:   string(rotationJSON),
+	})
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for UnlockCipher: %+v", err)
+	}
+
+	response, err := w.wh.SendMessageWhilePaused(UnlockCipherTag, data)
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[DM] Failed to send to %q: %+v", UnlockCipherTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// encrypted returns true if the worker holds a cipher, either of the database
+// or of a key rotation.
+func (w *wasmModel) encrypted() bool {
+	w.cipherMux.Lock()
+	defer w.cipherMux.Unlock()
+	return w.encryption != nil || w.rotating
+}
+
+// setRotation records the cipher of the key rotation that is in progress, or
+// that no rotation is in progress.
+func (w *wasmModel) setRotation(rotation idbCrypto.Cipher, rotating bool) {
+	w.cipherMux.Lock()
+	defer w.cipherMux.Unlock()
+	w.rotation, w.rotating = rotation, rotating
+}
@@ -26,4 +26,18 @@ const (
 
 	GetConversationTag  worker.Tag = "GetConversation"
 	GetConversationsTag worker.Tag = "GetConversations"
+
+	GetConversationMessagesTag worker.Tag = "GetConversationMessages"
+	GetMessageByIDTag          worker.Tag = "GetMessageByID"
+	SearchMessagesTag          worker.Tag = "SearchMessages"
+	SetRetentionPolicyTag      worker.Tag = "SetRetentionPolicy"
+	RotateDatabaseKeyTag       worker.Tag = "RotateDatabaseKey"
+	ImportHistoryTag           worker.Tag = "ImportHistory"
+	MarkReadTag                worker.Tag = "MarkRead"
+	GetUnreadCountsTag         worker.Tag = "GetUnreadCounts"
+	SaveDraftTag               worker.Tag = "SaveDraft"
+	GetDraftTag                worker.Tag = "GetDraft"
+	ClearDraftTag              worker.Tag = "ClearDraft"
+	LockCipherTag              worker.Tag = "LockCipher"
+	UnlockCipherTag            worker.Tag = "UnlockCipher"
 )
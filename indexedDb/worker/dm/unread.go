@@ -0,0 +1,105 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package dm
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// UnreadCountChanged is the event type sent on the EventUpdate callback when
+// the read marker or the number of unread messages of a conversation changes.
+// The data is the JSON of [UnreadCount]. It is outside the range of the event
+// types of the bindings package.
+const UnreadCountChanged int64 = 10000
+
+// UnreadCount is the read marker and the number of unread messages of a
+// conversation. Messages from the partner with a timestamp after the read
+// marker are unread, except for reactions.
+//
+// Example JSON:
+//
+//	{
+//	  "pubKey": "tRPPKvmaVqjvTrabjiUyxGYcFq8ql/sHOTM4UFKoY58=",
+//	  "unreadCount": 3,
+//	  "lastReadUUID": 42,
+//	  "lastReadTimestamp": "2023-05-12T15:03:42.197Z"
+//	}
+type UnreadCount struct {
+	PubKey      ed25519.PublicKey `json:"pubKey"`
+	UnreadCount int               `json:"unreadCount"`
+
+	// LastReadUUID is the UUID of the message marked as read. It is 0 if the
+	// conversation was marked as read up to a time instead of a message.
+	LastReadUUID uint64 `json:"lastReadUUID"`
+
+	// LastReadTimestamp is the time up to which messages are read.
+	LastReadTimestamp time.Time `json:"lastReadTimestamp"`
+}
+
+// MarkReadMessage is JSON marshalled and sent to the worker for
+// [wasmModel.MarkRead].
+type MarkReadMessage struct {
+	PubKey ed25519.PublicKey `json:"pubKey"`
+	UUID   uint64            `json:"uuid"`
+}
+
+// GetUnreadCountsResult is JSON marshalled and received from the worker for
+// [wasmModel.GetUnreadCounts].
+type GetUnreadCountsResult struct {
+	UnreadCounts []UnreadCount `json:"unreadCounts"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// MarkRead moves the read marker of the conversation with the partner to the
+// message with the UUID and recounts the unread messages. If the UUID is 0,
+// every message received so far is marked as read.
+func (w *wasmModel) MarkRead(
+	partnerPubKey ed25519.PublicKey, uuid uint64) error {
+	data, err := json.Marshal(
+		MarkReadMessage{PubKey: partnerPubKey, UUID: uuid})
+	if err != nil {
+		return errors.Errorf(
+			"could not JSON marshal payload for MarkRead: %+v", err)
+	}
+
+	response, err := w.wh.SendMessage(MarkReadTag, data)
+	if err != nil {
+		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", MarkReadTag, err)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// GetUnreadCounts returns the read marker and the number of unread messages of
+// every stored conversation.
+func (w *wasmModel) GetUnreadCounts() ([]UnreadCount, error) {
+	response, err := w.wh.SendMessage(GetUnreadCountsTag, nil)
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[DM] Failed to send to %q: %+v", GetUnreadCountsTag, err)
+	}
+
+	var result GetUnreadCountsResult
+	if err = json.Unmarshal(response, &result); err != nil {
+		return nil, errors.Wrapf(err, "[DM] Could not JSON unmarshal "+
+			"response to %q", GetUnreadCountsTag)
+	} else if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	return result.UnreadCounts, nil
+}
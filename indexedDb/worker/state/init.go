@@ -24,6 +24,10 @@ import (
 // databaseSuffix is the suffix to be appended to the name of the database.
 const databaseSuffix = "_speakeasy_state"
 
+// DatabaseVersion is the current schema version of the state indexedDb
+// database. It is recorded in the database registry.
+const DatabaseVersion uint = 1
+
 // NewStateMessage is JSON marshalled and sent to the worker for
 // [NewState].
 type NewStateMessage struct {
@@ -56,8 +60,13 @@ func NewState(path, wasmJsPath string) (impl.WebState, error) {
 			"between state indexedDb worker and logger")
 	}
 
-	// Store the database name
-	err = storage.StoreIndexedDb(databaseName)
+	// Store the database in the registry
+	err = storage.RegisterIndexedDb(storage.DatabaseInfo{
+		Name:     databaseName,
+		Kind:     storage.StateDatabase,
+		Identity: path,
+		Version:  DatabaseVersion,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -19,6 +19,8 @@ import (
 	jww "github.com/spf13/jwalterweatherman"
 
 	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
 	"gitlab.com/elixxir/xxdk-wasm/logging"
 	"gitlab.com/elixxir/xxdk-wasm/storage"
 	"gitlab.com/elixxir/xxdk-wasm/wasm"
@@ -56,6 +58,19 @@ var wasmCmd = &cobra.Command{
 			jww.FATAL.Panicf("WASM binary version error: %+v", err)
 		}
 
+		// Drop key material and pause database workers when the session locks.
+		// Handlers are locked in reverse order, so the workers are paused
+		// before their ciphers are dropped, and unlocked in this order, so
+		// the workers resume once their ciphers are restored.
+		storage.RegisterSessionHandler(wasm.DbCipherSessionHandler())
+		storage.RegisterSessionHandler(channels.SessionHandler())
+		storage.RegisterSessionHandler(dm.SessionHandler())
+		storage.RegisterSessionHandler(worker.Tracker)
+
+		// Close the databases of event models before they are purged
+		storage.RegisterPurgeHandler(channels.PurgeHandler())
+		storage.RegisterPurgeHandler(dm.PurgeHandler())
+
 		// Enable all top level bindings functions
 		setGlobals()
 
@@ -95,8 +110,57 @@ func setGlobals() {
 		js.FuncOf(storage.ChangeExternalPassword))
 	js.Global().Set("VerifyPassword", js.FuncOf(storage.VerifyPassword))
 
+	// storage/passwordAttempts.go
+	js.Global().Set("GetPasswordLockout", js.FuncOf(storage.GetPasswordLockout))
+	js.Global().Set("SetPasswordWipePolicy",
+		js.FuncOf(storage.SetPasswordWipePolicy))
+
+	// storage/paramsUpgrade.go
+	js.Global().Set("RegisterPasswordUpgradeCallback",
+		js.FuncOf(storage.RegisterPasswordUpgradeCallback))
+
+	// storage/recoveryKey.go
+	js.Global().Set("GenerateRecoveryKey",
+		js.FuncOf(storage.GenerateRecoveryKey))
+	js.Global().Set("UnlockWithRecoveryKey",
+		js.FuncOf(storage.UnlockWithRecoveryKey))
+	js.Global().Set("ResetPasswordWithRecoveryKey",
+		js.FuncOf(storage.ResetPasswordWithRecoveryKey))
+
+	// storage/keyProvider.go
+	js.Global().Set("EnrollKeyProvider", js.FuncOf(storage.EnrollKeyProvider))
+	js.Global().Set("UnlockWithKeyProvider",
+		js.FuncOf(storage.UnlockWithKeyProvider))
+	js.Global().Set("ListKeyProviders", js.FuncOf(storage.ListKeyProviders))
+	js.Global().Set("RevokeKeyProvider", js.FuncOf(storage.RevokeKeyProvider))
+
 	// storage/purge.go
 	js.Global().Set("Purge", js.FuncOf(storage.Purge))
+	js.Global().Set("PurgeIdentity", js.FuncOf(storage.PurgeIdentity))
+
+	// storage/indexedDbList.go
+	js.Global().Set("ListDatabases", js.FuncOf(storage.ListDatabases))
+
+	// storage/usage.go
+	js.Global().Set("GetStorageUsage", js.FuncOf(storage.GetStorageUsage))
+	js.Global().Set("SetStorageQuotaWarning",
+		js.FuncOf(storage.SetStorageQuotaWarning))
+
+	// storage/localState.go
+	js.Global().Set("ExportLocalState", js.FuncOf(storage.ExportLocalState))
+	js.Global().Set("ImportLocalState", js.FuncOf(storage.ImportLocalState))
+
+	// storage/session.go
+	js.Global().Set("Lock", js.FuncOf(storage.Lock))
+	js.Global().Set("Unlock", js.FuncOf(storage.Unlock))
+	js.Global().Set("SetSessionIdleTimeout",
+		js.FuncOf(storage.SetSessionIdleTimeout))
+	js.Global().Set("TouchSession", js.FuncOf(storage.TouchSession))
+	js.Global().Set("SetSessionCallback", js.FuncOf(storage.SetSessionCallback))
+	js.Global().Set("IsSessionLocked", js.FuncOf(storage.IsSessionLocked))
+
+	// storage/profile.go
+	js.Global().Set("ListProfiles", js.FuncOf(storage.ListProfiles))
 
 	// utils/array.go
 	js.Global().Set("Uint8ArrayToBase64", js.FuncOf(utils.Uint8ArrayToBase64))
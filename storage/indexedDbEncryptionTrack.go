@@ -12,24 +12,40 @@ package storage
 import (
 	"github.com/pkg/errors"
 	"os"
-
-	"gitlab.com/elixxir/wasm-utils/storage"
 )
 
 // Key to store if the database is encrypted or not
 const databaseEncryptionToggleKey = "xxdkWasmDatabaseEncryptionToggle/"
 
+// encryptionToggleVersion is appended to the stored encryption status. Older
+// versions stored a single byte of 1 for every database, encrypted or not, so
+// such a status is unconfirmed.
+const encryptionToggleVersion = 1
+
+// Error messages.
+const (
+	// GetIndexedDbEncryptionStatus
+	encryptionStatusUnconfirmedErr = "encryption status of %q was stored by " +
+		"an older version and has not been confirmed"
+)
+
 // StoreIndexedDbEncryptionStatus stores the encryption status if it has not
-// been previously saved. If it has, then it returns its value.
+// been previously saved. If it has, then it returns its value. The status is
+// saved to the active profile (see [ActiveProfile]).
+//
+// If the stored status is unconfirmed (see
+// [IndexedDbEncryptionStatusConfirmed]), the given status is returned and not
+// stored. It must be confirmed against the rows of the database and then
+// stored with [SetIndexedDbEncryptionStatus].
 func StoreIndexedDbEncryptionStatus(
 	databaseName string, encryptionStatus bool) (
 	loadedEncryptionStatus bool, err error) {
-	ls := storage.GetLocalStorage()
+	ls := activeStorage()
 	data, err := ls.Get(databaseEncryptionToggleKey + databaseName)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			keyName := databaseEncryptionToggleKey + databaseName
-			if err = ls.Set(keyName, []byte{1}); err != nil {
+			if err = ls.Set(keyName, encryptionToggle(encryptionStatus)); err != nil {
 				return false,
 					errors.Wrapf(err, "localStorage: failed to set %q", keyName)
 			}
@@ -39,5 +55,96 @@ func StoreIndexedDbEncryptionStatus(
 		}
 	}
 
-	return data[0] == 1, nil
+	loadedEncryptionStatus, confirmed := parseEncryptionToggle(data)
+	if !confirmed {
+		return encryptionStatus, nil
+	}
+	return loadedEncryptionStatus, nil
+}
+
+// IndexedDbEncryptionStatusConfirmed returns false if the stored encryption
+// status of the database was stored by an older version, which recorded every
+// database as encrypted. Returns an error if none has been stored.
+func IndexedDbEncryptionStatusConfirmed(databaseName string) (bool, error) {
+	data, err := activeStorage().Get(databaseEncryptionToggleKey + databaseName)
+	if err != nil {
+		return false, err
+	}
+
+	_, confirmed := parseEncryptionToggle(data)
+	return confirmed, nil
+}
+
+// GetIndexedDbEncryptionStatus returns the stored encryption status of the
+// database. Returns an error if none has been stored or if it is unconfirmed.
+func GetIndexedDbEncryptionStatus(databaseName string) (bool, error) {
+	data, err := activeStorage().Get(databaseEncryptionToggleKey + databaseName)
+	if err != nil {
+		return false, err
+	}
+
+	encryptionStatus, confirmed := parseEncryptionToggle(data)
+	if !confirmed {
+		return false,
+			errors.Errorf(encryptionStatusUnconfirmedErr, databaseName)
+	}
+	return encryptionStatus, nil
+}
+
+// SetIndexedDbEncryptionStatus overwrites the stored encryption status of the
+// database and its registry entry, if it has one. It must only be called once
+// every row of the database has been migrated to, or confirmed to have, the
+// new status.
+func SetIndexedDbEncryptionStatus(
+	databaseName string, encryptionStatus bool) error {
+	ls := activeStorage()
+	keyName := databaseEncryptionToggleKey + databaseName
+	if err := ls.Set(keyName, encryptionToggle(encryptionStatus)); err != nil {
+		return errors.Wrapf(err, "localStorage: failed to set %q", keyName)
+	}
+
+	registry, err := loadIndexedDbRegistry(ls)
+	if err != nil {
+		return err
+	}
+	if info, exists := registry[databaseName]; exists {
+		info.Encrypted = encryptionStatus
+		registry[databaseName] = info
+		return storeIndexedDbRegistry(registry, ls)
+	}
+
+	return nil
+}
+
+// UnconfirmIndexedDbEncryptionStatus marks the stored encryption status of the
+// database as unconfirmed (see [IndexedDbEncryptionStatusConfirmed]), so that
+// it is checked against the rows of the database when it is next opened. It
+// must be called before a migration that changes the encryption status changes
+// any row, since until the new status is set, the rows may match either
+// status.
+func UnconfirmIndexedDbEncryptionStatus(databaseName string) error {
+	keyName := databaseEncryptionToggleKey + databaseName
+	if err := activeStorage().Set(keyName, []byte{1}); err != nil {
+		return errors.Wrapf(err, "localStorage: failed to set %q", keyName)
+	}
+	return nil
+}
+
+// encryptionToggle returns the stored value of the encryption status.
+func encryptionToggle(encryptionStatus bool) []byte {
+	if encryptionStatus {
+		return []byte{1, encryptionToggleVersion}
+	}
+	return []byte{0, encryptionToggleVersion}
+}
+
+// parseEncryptionToggle returns the encryption status stored in the data and
+// whether it is confirmed. A status without a version is only confirmed if it
+// is unencrypted, since older versions stored every database as encrypted.
+func parseEncryptionToggle(data []byte) (encryptionStatus, confirmed bool) {
+	if len(data) == 0 {
+		return false, false
+	}
+	encryptionStatus = data[0] == 1
+	return encryptionStatus, len(data) > 1 || !encryptionStatus
 }
@@ -38,3 +38,191 @@ func TestStoreIndexedDbEncryptionStatus(t *testing.T) {
 			true, encryptionStatus)
 	}
 }
+
+// Tests that StoreIndexedDbEncryptionStatus stores a disabled encryption
+// status as disabled.
+func TestStoreIndexedDbEncryptionStatus_Disabled(t *testing.T) {
+	databaseName := "databaseDisabled"
+
+	for i := 0; i < 2; i++ {
+		encryptionStatus, err :=
+			StoreIndexedDbEncryptionStatus(databaseName, false)
+		if err != nil {
+			t.Errorf("Failed to store/get encryption status (%d): %+v", i, err)
+		}
+
+		if encryptionStatus != false {
+			t.Errorf("Incorrect encryption values (%d)."+
+				"\nexpected: %t\nreceived: %t", i, false, encryptionStatus)
+		}
+	}
+}
+
+// Tests that SetIndexedDbEncryptionStatus overwrites the stored encryption
+// status and the status in the registry entry.
+func TestSetIndexedDbEncryptionStatus(t *testing.T) {
+	databaseName := "databaseMigrated"
+	err := RegisterIndexedDb(DatabaseInfo{Name: databaseName, Encrypted: false})
+	if err != nil {
+		t.Fatalf("Failed to register database: %+v", err)
+	}
+	defer func() {
+		if err = RemoveIndexedDbs(databaseName); err != nil {
+			t.Errorf("Failed to remove database: %+v", err)
+		}
+	}()
+	if _, err = StoreIndexedDbEncryptionStatus(databaseName, false); err != nil {
+		t.Fatalf("Failed to store encryption status: %+v", err)
+	}
+
+	if err = SetIndexedDbEncryptionStatus(databaseName, true); err != nil {
+		t.Fatalf("Failed to set encryption status: %+v", err)
+	}
+
+	encryptionStatus, err := GetIndexedDbEncryptionStatus(databaseName)
+	if err != nil {
+		t.Errorf("Failed to get encryption status: %+v", err)
+	} else if encryptionStatus != true {
+		t.Errorf("Incorrect encryption values.\nexpected: %t\nreceived: %t",
+			true, encryptionStatus)
+	}
+
+	registry, err := GetIndexedDbRegistry()
+	if err != nil {
+		t.Fatalf("Failed to get registry: %+v", err)
+	}
+	if !registry[databaseName].Encrypted {
+		t.Errorf("Registry entry not updated: %+v", registry[databaseName])
+	}
+}
+
+// Tests that a database whose encryption migration was interrupted after
+// UnconfirmIndexedDbEncryptionStatus can be opened with either status, so that
+// it can be opened with whichever status its rows have, and that the registry
+// entry is unchanged until the new status is set.
+func TestUnconfirmIndexedDbEncryptionStatus(t *testing.T) {
+	databaseName := "databaseInterrupted"
+	err := RegisterIndexedDb(DatabaseInfo{Name: databaseName, Encrypted: false})
+	if err != nil {
+		t.Fatalf("Failed to register database: %+v", err)
+	}
+	defer func() {
+		if err = RemoveIndexedDbs(databaseName); err != nil {
+			t.Errorf("Failed to remove database: %+v", err)
+		}
+	}()
+	_, err = StoreIndexedDbEncryptionStatus(databaseName, false)
+	if err != nil {
+		t.Fatalf("Failed to store encryption status: %+v", err)
+	}
+
+	// The migration is interrupted after the status is unconfirmed
+	err = UnconfirmIndexedDbEncryptionStatus(databaseName)
+	if err != nil {
+		t.Fatalf("Failed to unconfirm encryption status: %+v", err)
+	}
+
+	confirmed, err := IndexedDbEncryptionStatusConfirmed(databaseName)
+	if err != nil {
+		t.Errorf("Failed to get if status is confirmed: %+v", err)
+	} else if confirmed {
+		t.Errorf("Encryption status is confirmed.")
+	}
+	for _, expected := range []bool{true, false} {
+		encryptionStatus, err :=
+			StoreIndexedDbEncryptionStatus(databaseName, expected)
+		if err != nil {
+			t.Errorf("Failed to store/get encryption status: %+v", err)
+		} else if encryptionStatus != expected {
+			t.Errorf("Incorrect encryption values."+
+				"\nexpected: %t\nreceived: %t", expected, encryptionStatus)
+		}
+	}
+
+	registry, err := GetIndexedDbRegistry()
+	if err != nil {
+		t.Fatalf("Failed to get registry: %+v", err)
+	}
+	if registry[databaseName].Encrypted {
+		t.Errorf("Registry entry changed: %+v", registry[databaseName])
+	}
+
+	// Opening the database confirms the status of its rows
+	if err = SetIndexedDbEncryptionStatus(databaseName, true); err != nil {
+		t.Fatalf("Failed to set encryption status: %+v", err)
+	}
+	encryptionStatus, err := GetIndexedDbEncryptionStatus(databaseName)
+	if err != nil {
+		t.Errorf("Failed to get encryption status: %+v", err)
+	} else if encryptionStatus != true {
+		t.Errorf("Incorrect encryption values.\nexpected: %t\nreceived: %t",
+			true, encryptionStatus)
+	}
+}
+
+// Tests that a status stored by an older version, which stored 1 for every
+// database, is unconfirmed, that StoreIndexedDbEncryptionStatus returns the
+// given status for it without storing it, and that SetIndexedDbEncryptionStatus
+// confirms it.
+func TestStoreIndexedDbEncryptionStatus_Legacy(t *testing.T) {
+	databaseName := "databaseLegacy"
+	keyName := databaseEncryptionToggleKey + databaseName
+	if err := activeStorage().Set(keyName, []byte{1}); err != nil {
+		t.Fatalf("Failed to set legacy encryption status: %+v", err)
+	}
+
+	confirmed, err := IndexedDbEncryptionStatusConfirmed(databaseName)
+	if err != nil {
+		t.Errorf("Failed to get if status is confirmed: %+v", err)
+	} else if confirmed {
+		t.Errorf("Legacy encryption status is confirmed.")
+	}
+	if _, err = GetIndexedDbEncryptionStatus(databaseName); err == nil {
+		t.Errorf("Did not get error for unconfirmed encryption status.")
+	}
+
+	for i := 0; i < 2; i++ {
+		encryptionStatus, err :=
+			StoreIndexedDbEncryptionStatus(databaseName, false)
+		if err != nil {
+			t.Errorf("Failed to store/get encryption status (%d): %+v", i, err)
+		} else if encryptionStatus != false {
+			t.Errorf("Incorrect encryption values (%d)."+
+				"\nexpected: %t\nreceived: %t", i, false, encryptionStatus)
+		}
+	}
+
+	if err = SetIndexedDbEncryptionStatus(databaseName, false); err != nil {
+		t.Fatalf("Failed to set encryption status: %+v", err)
+	}
+	confirmed, err = IndexedDbEncryptionStatusConfirmed(databaseName)
+	if err != nil {
+		t.Errorf("Failed to get if status is confirmed: %+v", err)
+	} else if !confirmed {
+		t.Errorf("Encryption status not confirmed after it was set.")
+	}
+	encryptionStatus, err := StoreIndexedDbEncryptionStatus(databaseName, true)
+	if err != nil {
+		t.Errorf("Failed to store/get encryption status: %+v", err)
+	} else if encryptionStatus != false {
+		t.Errorf("Incorrect encryption values.\nexpected: %t\nreceived: %t",
+			false, encryptionStatus)
+	}
+}
+
+// Tests that an unencrypted status stored by an older version, which never
+// stored 0, is confirmed.
+func TestIndexedDbEncryptionStatusConfirmed_LegacyDisabled(t *testing.T) {
+	databaseName := "databaseLegacyDisabled"
+	keyName := databaseEncryptionToggleKey + databaseName
+	if err := activeStorage().Set(keyName, []byte{0}); err != nil {
+		t.Fatalf("Failed to set legacy encryption status: %+v", err)
+	}
+
+	confirmed, err := IndexedDbEncryptionStatusConfirmed(databaseName)
+	if err != nil {
+		t.Errorf("Failed to get if status is confirmed: %+v", err)
+	} else if !confirmed {
+		t.Errorf("Unencrypted encryption status is unconfirmed.")
+	}
+}
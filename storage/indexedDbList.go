@@ -12,18 +12,125 @@ package storage
 import (
 	"encoding/json"
 	"os"
+	"sort"
+	"syscall/js"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
 )
 
+// indexedDbListKey is the key of the legacy set of database names. It is
+// migrated to the registry on the first write.
 const indexedDbListKey = "xxDkWasmIndexedDbList"
 
-// GetIndexedDbList returns the list of stored indexedDb databases.
-func GetIndexedDbList() (map[string]struct{}, error) {
+// indexedDbRegistryKey is the key used to store the map of database names to
+// their DatabaseInfo.
+const indexedDbRegistryKey = "xxDkWasmIndexedDbRegistry"
+
+// DatabaseKind describes what is stored in an indexedDb database.
+type DatabaseKind string
+
+// Database kinds.
+const (
+	UnknownDatabase  DatabaseKind = ""
+	ChannelsDatabase DatabaseKind = "channels"
+	DmDatabase       DatabaseKind = "dm"
+	StateDatabase    DatabaseKind = "state"
+)
+
+// DatabaseInfo is the registry entry for a single indexedDb database. Entries
+// migrated from the legacy list only have their name and encryption status
+// set until the database is next opened.
+//
+// Example JSON:
+//
+//	{
+//	  "name": "U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI_speakeasy",
+//	  "kind": "channels",
+//	  "identity": "U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI",
+//	  "version": 1,
+//	  "encrypted": true,
+//	  "created": "2023-05-12T15:03:42.197Z",
+//	  "lastOpened": "2023-06-01T09:21:08.551Z"
+//	}
+type DatabaseInfo struct {
+	Name       string       `json:"name"`
+	Kind       DatabaseKind `json:"kind"`
+	Identity   string       `json:"identity"`
+	Version    uint         `json:"version"`
+	Encrypted  bool         `json:"encrypted"`
+	Created    time.Time    `json:"created"`
+	LastOpened time.Time    `json:"lastOpened"`
+}
+
+// ListDatabases returns the registry entry of every indexedDb database created
+// by this WASM binary for the profile, sorted by name.
+//
+// Parameters:
+//   - args[0] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns:
+//   - JSON of an array of [DatabaseInfo] (Uint8Array).
+//   - Throws an error if the profile is invalid or the registry cannot be
+//     loaded.
+func ListDatabases(_ js.Value, args []js.Value) any {
+	_, ls, err := profileArg(args, 0)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	registry, err := loadIndexedDbRegistry(ls)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	list := make([]DatabaseInfo, 0, len(registry))
+	for _, info := range registry {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	listJSON, err := json.Marshal(list)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return utils.CopyBytesToJS(listJSON)
+}
+
+// GetIndexedDbRegistry returns the registry of stored indexedDb databases of
+// the active profile keyed on database name. If only the legacy list exists,
+// its entries are returned.
+func GetIndexedDbRegistry() (map[string]DatabaseInfo, error) {
+	return loadIndexedDbRegistry(activeStorage())
+}
+
+// loadIndexedDbRegistry returns the registry saved in the local storage of a
+// profile.
+func loadIndexedDbRegistry(
+	ls storage.LocalStorage) (map[string]DatabaseInfo, error) {
+	registry := make(map[string]DatabaseInfo)
+	registryBytes, err := ls.Get(indexedDbRegistryKey)
+	if err == nil {
+		if err = json.Unmarshal(registryBytes, &registry); err != nil {
+			return nil, err
+		}
+		return registry, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// Fall back to the legacy list of names
 	list := make(map[string]struct{})
-	listBytes, err := storage.GetLocalStorage().Get(indexedDbListKey)
+	listBytes, err := ls.Get(indexedDbListKey)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	} else if err == nil {
@@ -33,28 +140,99 @@ func GetIndexedDbList() (map[string]struct{}, error) {
 		}
 	}
 
+	for databaseName := range list {
+		info := DatabaseInfo{Name: databaseName}
+		data, err := ls.Get(databaseEncryptionToggleKey + databaseName)
+		if err == nil {
+			info.Encrypted, _ = parseEncryptionToggle(data)
+		}
+		registry[databaseName] = info
+	}
+
+	return registry, nil
+}
+
+// GetIndexedDbList returns the list of stored indexedDb databases of the
+// active profile.
+func GetIndexedDbList() (map[string]struct{}, error) {
+	registry, err := GetIndexedDbRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make(map[string]struct{}, len(registry))
+	for databaseName := range registry {
+		list[databaseName] = struct{}{}
+	}
+
 	return list, nil
 }
 
 // StoreIndexedDb saved the indexedDb database name to storage.
 func StoreIndexedDb(databaseName string) error {
-	list, err := GetIndexedDbList()
+	return RegisterIndexedDb(DatabaseInfo{Name: databaseName})
+}
+
+// RegisterIndexedDb adds or updates the registry entry for the database in the
+// active profile and sets its last-open time to now. The creation time of an
+// existing entry is preserved.
+func RegisterIndexedDb(info DatabaseInfo) error {
+	ls := activeStorage()
+	registry, err := loadIndexedDbRegistry(ls)
 	if err != nil {
 		return err
 	}
 
-	list[databaseName] = struct{}{}
+	now := time.Now()
+	if existing, exists := registry[info.Name]; exists &&
+		!existing.Created.IsZero() {
+		info.Created = existing.Created
+	} else {
+		info.Created = now
+	}
+	info.LastOpened = now
+
+	registry[info.Name] = info
+
+	return storeIndexedDbRegistry(registry, ls)
+}
+
+// RemoveIndexedDbs removes the indexedDb database names from the registry of
+// the active profile.
+func RemoveIndexedDbs(databaseNames ...string) error {
+	return removeIndexedDbs(activeStorage(), databaseNames...)
+}
+
+// removeIndexedDbs removes the indexedDb database names from the registry
+// saved in the local storage of a profile.
+func removeIndexedDbs(ls storage.LocalStorage, databaseNames ...string) error {
+	registry, err := loadIndexedDbRegistry(ls)
+	if err != nil {
+		return err
+	}
+
+	for _, databaseName := range databaseNames {
+		delete(registry, databaseName)
+	}
+
+	return storeIndexedDbRegistry(registry, ls)
+}
 
-	listBytes, err := json.Marshal(list)
+// storeIndexedDbRegistry saves the registry to local storage and removes the
+// legacy list.
+func storeIndexedDbRegistry(
+	registry map[string]DatabaseInfo, ls storage.LocalStorage) error {
+	registryBytes, err := json.Marshal(registry)
 	if err != nil {
 		return err
 	}
 
-	err = storage.GetLocalStorage().Set(indexedDbListKey, listBytes)
+	err = ls.Set(indexedDbRegistryKey, registryBytes)
 	if err != nil {
 		return errors.Wrapf(err,
-			"localStorage: failed to set %q", indexedDbListKey)
+			"localStorage: failed to set %q", indexedDbRegistryKey)
 	}
+	ls.RemoveItem(indexedDbListKey)
 
 	return nil
 }
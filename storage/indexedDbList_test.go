@@ -12,6 +12,8 @@ package storage
 import (
 	"reflect"
 	"testing"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
 )
 
 // Tests that three indexedDb database names stored with StoreIndexedDb are
@@ -36,3 +38,121 @@ func TestStoreIndexedDb_GetIndexedDbList(t *testing.T) {
 			expected, list)
 	}
 }
+
+// Tests that RemoveIndexedDbs removes only the given database names from the
+// list.
+func TestRemoveIndexedDbs(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	for _, name := range []string{"db1", "db2", "db3"} {
+		if err := StoreIndexedDb(name); err != nil {
+			t.Fatalf("Failed to store database name %q: %+v", name, err)
+		}
+	}
+
+	if err := RemoveIndexedDbs("db1", "db3", "db4"); err != nil {
+		t.Fatalf("Failed to remove database names: %+v", err)
+	}
+
+	list, err := GetIndexedDbList()
+	if err != nil {
+		t.Errorf("Failed to get database list: %+v", err)
+	}
+
+	expected := map[string]struct{}{"db2": {}}
+	if !reflect.DeepEqual(expected, list) {
+		t.Errorf("Did not get expected list.\nexpected: %s\nreceived: %s",
+			expected, list)
+	}
+}
+
+// Tests that GetIndexedDbRegistry returns the entries of the legacy list and
+// that RegisterIndexedDb replaces the legacy list with the registry.
+func TestGetIndexedDbRegistry_LegacyList(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	err := ls.Set(indexedDbListKey, []byte(`{"db1":{},"db2":{}}`))
+	if err != nil {
+		t.Fatalf("Failed to set legacy list: %+v", err)
+	}
+	if err = ls.Set(databaseEncryptionToggleKey+"db1", []byte{1}); err != nil {
+		t.Fatalf("Failed to set encryption status: %+v", err)
+	}
+
+	registry, err := GetIndexedDbRegistry()
+	if err != nil {
+		t.Fatalf("Failed to get registry: %+v", err)
+	}
+	expected := map[string]DatabaseInfo{
+		"db1": {Name: "db1", Encrypted: true},
+		"db2": {Name: "db2"},
+	}
+	if !reflect.DeepEqual(expected, registry) {
+		t.Errorf("Unexpected registry.\nexpected: %+v\nreceived: %+v",
+			expected, registry)
+	}
+
+	err = RegisterIndexedDb(DatabaseInfo{Name: "db3", Kind: DmDatabase})
+	if err != nil {
+		t.Fatalf("Failed to register database: %+v", err)
+	}
+
+	if _, err = ls.Get(indexedDbListKey); err == nil {
+		t.Errorf("Legacy list not removed after registry was saved.")
+	}
+
+	list, err := GetIndexedDbList()
+	if err != nil {
+		t.Errorf("Failed to get database list: %+v", err)
+	}
+	expectedList := map[string]struct{}{"db1": {}, "db2": {}, "db3": {}}
+	if !reflect.DeepEqual(expectedList, list) {
+		t.Errorf("Did not get expected list.\nexpected: %s\nreceived: %s",
+			expectedList, list)
+	}
+}
+
+// Tests that RegisterIndexedDb preserves the creation time of an existing
+// entry and updates its last-open time and other fields.
+func TestRegisterIndexedDb_Update(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	info := DatabaseInfo{
+		Name:      "id_speakeasy",
+		Kind:      ChannelsDatabase,
+		Identity:  "id",
+		Version:   1,
+		Encrypted: true,
+	}
+	if err := RegisterIndexedDb(info); err != nil {
+		t.Fatalf("Failed to register database: %+v", err)
+	}
+	registry, err := GetIndexedDbRegistry()
+	if err != nil {
+		t.Fatalf("Failed to get registry: %+v", err)
+	}
+	first := registry[info.Name]
+	if first.Created.IsZero() || !first.Created.Equal(first.LastOpened) {
+		t.Errorf("Unexpected times for new entry: %+v", first)
+	}
+
+	info.Version = 2
+	if err = RegisterIndexedDb(info); err != nil {
+		t.Fatalf("Failed to register database: %+v", err)
+	}
+	registry, err = GetIndexedDbRegistry()
+	if err != nil {
+		t.Fatalf("Failed to get registry: %+v", err)
+	}
+	second := registry[info.Name]
+	if !second.Created.Equal(first.Created) {
+		t.Errorf("Creation time changed.\nexpected: %s\nreceived: %s",
+			first.Created, second.Created)
+	}
+	if second.LastOpened.Before(first.LastOpened) {
+		t.Errorf("Last-open time not updated.\nfirst: %s\nsecond: %s",
+			first.LastOpened, second.LastOpened)
+	}
+	if second.Version != 2 || second.Kind != ChannelsDatabase ||
+		second.Identity != "id" || !second.Encrypted {
+		t.Errorf("Unexpected updated entry: %+v", second)
+	}
+}
@@ -0,0 +1,644 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"syscall/js"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Key provider types.
+const (
+	// PasswordKeyProviderType is the type of the KeyProvider that derives its
+	// key from a user-supplied password using Argon2.
+	PasswordKeyProviderType = "password"
+
+	// SecretKeyProviderType is the type of the KeyProvider that uses a 32-byte
+	// secret supplied by Javascript (e.g., a WebAuthn PRF output).
+	SecretKeyProviderType = "secret"
+)
+
+const (
+	// keyEnrollmentsKey is the key used to store the list of KeyEnrollment in
+	// local storage. The password enrollment is not included in this list; it
+	// is stored under saltKey, argonParamsKey, and passwordKey.
+	keyEnrollmentsKey = "xxKeyProviderEnrollments"
+
+	// passwordEnrollmentID is the ID of the password enrollment.
+	passwordEnrollmentID = PasswordKeyProviderType
+
+	// enrollmentIDLen is the number of random bytes in an enrollment ID.
+	enrollmentIDLen = 8
+
+	// secretLen is the required length of the secret for the
+	// SecretKeyProviderType.
+	secretLen = 32
+)
+
+// Error messages.
+const (
+	// unlockWithKeyProvider
+	noEnrollmentErr     = "no enrollments found for key provider type %q"
+	unwrapEnrollmentErr = "could not decrypt internal password with key provider %q"
+
+	// enrollKeyProvider
+	passwordEnrolledErr = "password already enrolled; use ChangeExternalPassword"
+
+	// revokeKeyProvider
+	revokeLastErr         = "cannot revoke the last enrolled key provider"
+	enrollmentNotFoundErr = "no enrollment found with ID %q"
+
+	// newKeyProvider
+	unknownProviderTypeErr = "unknown key provider type %q"
+	secretLenErr           = "secret must be %d bytes, received %d bytes"
+)
+
+// KeyProvider is a source of key material used to encrypt and decrypt the
+// internal password.
+type KeyProvider interface {
+	// Type returns the name of the kind of key provider.
+	Type() string
+
+	// NewParams generates the parameters saved alongside the encrypted
+	// internal password, such as a salt. They are passed to DeriveKey.
+	NewParams(csprng io.Reader) ([]byte, error)
+
+	// DeriveKey returns the key used to encrypt and decrypt the internal
+	// password for the given parameters.
+	DeriveKey(params []byte) ([]byte, error)
+}
+
+// KeyEnrollment is the internal password encrypted with the key from a single
+// enrolled KeyProvider.
+type KeyEnrollment struct {
+	KeyEnrollmentInfo
+	Params  []byte `json:"params"`
+	Wrapped []byte `json:"wrapped"`
+}
+
+// KeyEnrollmentInfo describes an enrolled KeyProvider. It is JSON marshalled
+// and returned by [ListKeyProviders].
+//
+// Example JSON:
+//
+//	{
+//	  "id": "5a2e1ee0b4c5d9f1",
+//	  "type": "secret",
+//	  "label": "Security key",
+//	  "created": "2023-05-12T15:03:42.197Z"
+//	}
+type KeyEnrollmentInfo struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+}
+
+// KeyProviderJSON describes a KeyProvider supplied by Javascript.
+//
+// Example JSON:
+//
+//	{"type": "password", "password": "hunter2"}
+//	{"type": "secret", "secret": "9Bm1hxZvX0g2nYWh4ufQr9iI6tq0d7yZ8OezNYfFyDc="}
+type KeyProviderJSON struct {
+	Type     string `json:"type"`
+	Password string `json:"password,omitempty"`
+	Secret   []byte `json:"secret,omitempty"`
+}
+
+// EnrollKeyProvider enrolls a new key provider that can be used to unlock the
+// internal password. An existing enrolled key provider is required to unlock
+// the internal password.
+//
+// Only one password can be enrolled. It is used by [GetOrInitPassword].
+//
+// Parameters:
+//   - args[0] - JSON of the [KeyProviderJSON] for an enrolled key provider
+//     (Uint8Array).
+//   - args[1] - JSON of the [KeyProviderJSON] for the new key provider
+//     (Uint8Array).
+//   - args[2] - A label for the new enrollment shown to the user (string).
+//   - args[3] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns a promise:
+//   - The ID of the new enrollment (string).
+//   - Throws TypeError if unlocking or enrollment fails.
+func EnrollKeyProvider(_ js.Value, args []js.Value) any {
+	currentJSON := utils.CopyBytesToGo(args[0])
+	newJSON := utils.CopyBytesToGo(args[1])
+	label := args[2].String()
+	_, ls, profileErr := profileArg(args, 3)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		}
+
+		current, err := newKeyProvider(currentJSON)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		kp, err := newKeyProvider(newJSON)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		internalPassword, err := unlockWithKeyProvider(current, ls)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		id, err := enrollKeyProvider(
+			internalPassword, kp, label, ls, csprng.NewSystemRNG())
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(id)
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// UnlockWithKeyProvider returns the 256-bit internal password using any
+// enrolled key provider. On success, the profile becomes the active profile
+// (see [ActiveProfile]).
+//
+// As with [GetOrInitPassword], the returned internal password is zeroed when
+// the session is locked, and this returns an error while the session is
+// locked.
+//
+// Parameters:
+//   - args[0] - JSON of the [KeyProviderJSON] (Uint8Array).
+//   - args[1] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns a promise:
+//   - Internal password (Uint8Array).
+//   - Throws TypeError if no enrollment for the key provider can be unlocked.
+func UnlockWithKeyProvider(_ js.Value, args []js.Value) any {
+	providerJSON := utils.CopyBytesToGo(args[0])
+	profile, ls, profileErr := profileArg(args, 1)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		} else if SessionLocked() {
+			reject(exception.NewTrace(errors.New(sessionLockedErr)))
+			return
+		}
+
+		kp, err := newKeyProvider(providerJSON)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		internalPassword, err := unlockWithKeyProvider(kp, ls)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		if err = addProfile(profile, storage.GetLocalStorage()); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		setActiveProfile(profile)
+
+		resolve(session.issue(internalPassword))
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ListKeyProviders returns a list of all enrolled key providers.
+//
+// Parameters:
+//   - args[0] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns:
+//   - JSON of an array of [KeyEnrollmentInfo] (Uint8Array).
+//   - Throws an error if the list cannot be loaded.
+func ListKeyProviders(_ js.Value, args []js.Value) any {
+	_, ls, err := profileArg(args, 0)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	enrollments, err := loadAllEnrollments(ls)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	list := make([]KeyEnrollmentInfo, len(enrollments))
+	for i, e := range enrollments {
+		list[i] = e.KeyEnrollmentInfo
+	}
+
+	listJSON, err := json.Marshal(list)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return utils.CopyBytesToJS(listJSON)
+}
+
+// RevokeKeyProvider removes an enrolled key provider so that it can no longer
+// unlock the internal password. An enrolled key provider is required to
+// authorise the revocation. The last enrollment cannot be revoked.
+//
+// Parameters:
+//   - args[0] - JSON of the [KeyProviderJSON] for an enrolled key provider
+//     (Uint8Array).
+//   - args[1] - The ID of the enrollment to revoke (string).
+//   - args[2] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Throws TypeError if unlocking or revocation fails.
+func RevokeKeyProvider(_ js.Value, args []js.Value) any {
+	currentJSON := utils.CopyBytesToGo(args[0])
+	id := args[1].String()
+	_, ls, profileErr := profileArg(args, 2)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		}
+
+		current, err := newKeyProvider(currentJSON)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		if _, err = unlockWithKeyProvider(current, ls); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		if err = revokeKeyProvider(id, ls); err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// newKeyProvider returns the KeyProvider described by the KeyProviderJSON.
+func newKeyProvider(providerJSON []byte) (KeyProvider, error) {
+	var kpj KeyProviderJSON
+	if err := json.Unmarshal(providerJSON, &kpj); err != nil {
+		return nil, errors.Wrapf(err, "failed to JSON unmarshal %T", kpj)
+	}
+
+	switch kpj.Type {
+	case PasswordKeyProviderType:
+		return newPasswordKeyProvider(kpj.Password, defaultParams()), nil
+	case SecretKeyProviderType:
+		return newSecretKeyProvider(kpj.Secret)
+	default:
+		return nil, errors.Errorf(unknownProviderTypeErr, kpj.Type)
+	}
+}
+
+// unlockWithKeyProvider attempts to decrypt the internal password with every
+// enrollment matching the type of the key provider. Passwords are checked with
+// getInternalPasswordLimited, so they count towards the lockout.
+func unlockWithKeyProvider(
+	kp KeyProvider, localStorage storage.LocalStorage) ([]byte, error) {
+	if pkp, ok := kp.(*passwordKeyProvider); ok {
+		internalPassword, err :=
+			getInternalPasswordLimited(pkp.password, localStorage)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Errorf(noEnrollmentErr, kp.Type())
+		}
+		return internalPassword, err
+	}
+
+	enrollments, err := loadAllEnrollments(localStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	var found bool
+	for _, e := range enrollments {
+		if e.Type != kp.Type() {
+			continue
+		}
+		found = true
+
+		internalPassword, err := e.unwrap(kp)
+		if err == nil {
+			return internalPassword, nil
+		}
+	}
+
+	if !found {
+		return nil, errors.Errorf(noEnrollmentErr, kp.Type())
+	}
+	return nil, errors.Errorf(unwrapEnrollmentErr, kp.Type())
+}
+
+// enrollKeyProvider encrypts the internal password with the key from the key
+// provider and saves it to local storage. Returns the ID of the new
+// enrollment.
+//
+// A password is saved to the password enrollment so that it can be used by
+// GetOrInitPassword. An error is returned if a password is already enrolled.
+func enrollKeyProvider(internalPassword []byte, kp KeyProvider, label string,
+	localStorage storage.LocalStorage, csprng io.Reader) (string, error) {
+	if pkp, ok := kp.(*passwordKeyProvider); ok {
+		if _, err := loadPasswordEnrollment(localStorage); err == nil {
+			return "", errors.New(passwordEnrolledErr)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		err := rewrapInternalPassword(internalPassword, pkp.password,
+			localStorage, csprng, pkp.params)
+		if err != nil {
+			return "", err
+		}
+		return passwordEnrollmentID, nil
+	}
+
+	enrollments, err := loadEnrollments(localStorage)
+	if err != nil {
+		return "", err
+	}
+
+	idBytes := make([]byte, enrollmentIDLen)
+	if _, err = io.ReadFull(csprng, idBytes); err != nil {
+		return "", errors.Wrap(err, "could not generate enrollment ID")
+	}
+
+	params, err := kp.NewParams(csprng)
+	if err != nil {
+		return "", err
+	}
+	key, err := kp.DeriveKey(params)
+	if err != nil {
+		return "", err
+	}
+
+	e := KeyEnrollment{
+		KeyEnrollmentInfo: KeyEnrollmentInfo{
+			ID:      hex.EncodeToString(idBytes),
+			Type:    kp.Type(),
+			Label:   label,
+			Created: time.Now(),
+		},
+		Params:  params,
+		Wrapped: encryptPassword(internalPassword, key, csprng),
+	}
+
+	// Confirm the enrollment can be decrypted before saving it
+	if _, err = e.unwrap(kp); err != nil {
+		return "", err
+	}
+
+	enrollments = append(enrollments, e)
+	if err = storeEnrollments(enrollments, localStorage); err != nil {
+		return "", err
+	}
+
+	return e.ID, nil
+}
+
+// revokeKeyProvider deletes the enrollment with the given ID. Returns an error
+// if it is the last enrollment.
+func revokeKeyProvider(id string, localStorage storage.LocalStorage) error {
+	all, err := loadAllEnrollments(localStorage)
+	if err != nil {
+		return err
+	}
+
+	var found bool
+	for _, e := range all {
+		if e.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf(enrollmentNotFoundErr, id)
+	} else if len(all) == 1 {
+		return errors.New(revokeLastErr)
+	}
+
+	if id == passwordEnrollmentID {
+		for _, key := range []string{saltKey, argonParamsKey, passwordKey} {
+			localStorage.RemoveItem(key)
+		}
+		return nil
+	}
+
+	enrollments, err := loadEnrollments(localStorage)
+	if err != nil {
+		return err
+	}
+	for i, e := range enrollments {
+		if e.ID == id {
+			enrollments = append(enrollments[:i], enrollments[i+1:]...)
+			break
+		}
+	}
+
+	return storeEnrollments(enrollments, localStorage)
+}
+
+// unwrap decrypts the internal password using the key from the KeyProvider.
+func (e KeyEnrollment) unwrap(kp KeyProvider) ([]byte, error) {
+	key, err := kp.DeriveKey(e.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptPassword(e.Wrapped, key)
+}
+
+// hasEnrollments returns true if any key provider is enrolled.
+func hasEnrollments(localStorage storage.LocalStorage) (bool, error) {
+	enrollments, err := loadAllEnrollments(localStorage)
+	if err != nil {
+		return false, err
+	}
+	return len(enrollments) > 0, nil
+}
+
+// loadAllEnrollments returns the password enrollment, if it exists, followed
+// by all other enrollments.
+func loadAllEnrollments(
+	localStorage storage.LocalStorage) ([]KeyEnrollment, error) {
+	enrollments, err := loadEnrollments(localStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := loadPasswordEnrollment(localStorage)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return enrollments, nil
+		}
+		return nil, err
+	}
+
+	return append([]KeyEnrollment{e}, enrollments...), nil
+}
+
+// loadEnrollments loads the list of enrollments, excluding the password
+// enrollment, from local storage.
+func loadEnrollments(
+	localStorage storage.LocalStorage) ([]KeyEnrollment, error) {
+	var enrollments []KeyEnrollment
+	data, err := localStorage.Get(keyEnrollmentsKey)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return enrollments, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &enrollments); err != nil {
+		return nil, errors.Wrapf(err, "failed to JSON unmarshal enrollments")
+	}
+
+	return enrollments, nil
+}
+
+// storeEnrollments saves the list of enrollments, excluding the password
+// enrollment, to local storage.
+func storeEnrollments(
+	enrollments []KeyEnrollment, localStorage storage.LocalStorage) error {
+	data, err := json.Marshal(enrollments)
+	if err != nil {
+		return err
+	}
+
+	err = localStorage.Set(keyEnrollmentsKey, data)
+	if err != nil {
+		return errors.Wrapf(err,
+			"localStorage: failed to set %q", keyEnrollmentsKey)
+	}
+
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Password Key Provider                                                      //
+////////////////////////////////////////////////////////////////////////////////
+
+// passwordKeyProvider is a KeyProvider that derives a key from a user-supplied
+// password using Argon2.
+type passwordKeyProvider struct {
+	password string
+
+	// params are the Argon2 parameters used when generating new parameters.
+	params argonParams
+}
+
+// passwordProviderParams are the JSON marshalled parameters of the
+// passwordKeyProvider.
+type passwordProviderParams struct {
+	Salt  []byte      `json:"salt"`
+	Argon argonParams `json:"argon"`
+}
+
+// newPasswordKeyProvider returns a new passwordKeyProvider for the password.
+func newPasswordKeyProvider(
+	password string, params argonParams) *passwordKeyProvider {
+	return &passwordKeyProvider{password: password, params: params}
+}
+
+// Type returns PasswordKeyProviderType.
+func (p *passwordKeyProvider) Type() string { return PasswordKeyProviderType }
+
+// NewParams generates a new salt and returns it with the Argon2 parameters.
+func (p *passwordKeyProvider) NewParams(csprng io.Reader) ([]byte, error) {
+	salt, err := makeSalt(csprng)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(passwordProviderParams{Salt: salt, Argon: p.params})
+}
+
+// DeriveKey derives the key from the password using the salt and Argon2
+// parameters.
+func (p *passwordKeyProvider) DeriveKey(params []byte) ([]byte, error) {
+	var pp passwordProviderParams
+	if err := json.Unmarshal(params, &pp); err != nil {
+		return nil, errors.Errorf(paramsUnmarshalErr, err)
+	}
+
+	return deriveKey(p.password, pp.Salt, pp.Argon), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Secret Key Provider                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+// secretKeyProvider is a KeyProvider that uses a 32-byte secret computed by
+// the application, such as a WebAuthn PRF output.
+type secretKeyProvider struct {
+	secret []byte
+}
+
+// newSecretKeyProvider returns a new secretKeyProvider. Returns an error if the
+// secret is not the correct length.
+func newSecretKeyProvider(secret []byte) (*secretKeyProvider, error) {
+	if len(secret) != secretLen {
+		return nil, errors.Errorf(secretLenErr, secretLen, len(secret))
+	}
+	return &secretKeyProvider{secret: secret}, nil
+}
+
+// Type returns SecretKeyProviderType.
+func (s *secretKeyProvider) Type() string { return SecretKeyProviderType }
+
+// NewParams generates a new salt.
+func (s *secretKeyProvider) NewParams(csprng io.Reader) ([]byte, error) {
+	return makeSalt(csprng)
+}
+
+// DeriveKey hashes the secret with the salt.
+func (s *secretKeyProvider) DeriveKey(params []byte) ([]byte, error) {
+	h, err := blake2b.New256(params)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(s.secret)
+	return h.Sum(nil), nil
+}
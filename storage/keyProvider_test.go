@@ -0,0 +1,218 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that a secret key provider enrolled with enrollKeyProvider unlocks the
+// same internal password as the password and is returned in the list of
+// enrollments.
+func Test_enrollKeyProvider_unlockWithKeyProvider(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	rng := csprng.NewSystemRNG()
+	internalPassword, err :=
+		initInternalPassword("myPassword", ls, rng, testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	kp := newTestSecretKeyProvider(t, rng)
+	id, err := enrollKeyProvider(internalPassword, kp, "label", ls, rng)
+	if err != nil {
+		t.Fatalf("Failed to enroll key provider: %+v", err)
+	}
+
+	loaded, err := unlockWithKeyProvider(kp, ls)
+	if err != nil {
+		t.Fatalf("Failed to unlock with key provider: %+v", err)
+	}
+	if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password from key provider does not match "+
+			"original.\nexpected: %v\nreceived: %v", internalPassword, loaded)
+	}
+
+	enrollments, err := loadAllEnrollments(ls)
+	if err != nil {
+		t.Fatalf("Failed to load enrollments: %+v", err)
+	}
+	if len(enrollments) != 2 {
+		t.Fatalf("Unexpected number of enrollments."+
+			"\nexpected: %d\nreceived: %d", 2, len(enrollments))
+	}
+	if enrollments[0].ID != passwordEnrollmentID {
+		t.Errorf("Unexpected first enrollment ID."+
+			"\nexpected: %q\nreceived: %q",
+			passwordEnrollmentID, enrollments[0].ID)
+	}
+	if enrollments[1].ID != id || enrollments[1].Label != "label" ||
+		enrollments[1].Type != SecretKeyProviderType {
+		t.Errorf("Unexpected second enrollment: %+v",
+			enrollments[1].KeyEnrollmentInfo)
+	}
+}
+
+// Tests that unlockWithKeyProvider returns an error for a secret that does not
+// match any enrollment.
+func Test_unlockWithKeyProvider_WrongSecret(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	rng := csprng.NewSystemRNG()
+	internalPassword, err :=
+		initInternalPassword("myPassword", ls, rng, testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	_, err = enrollKeyProvider(internalPassword,
+		newTestSecretKeyProvider(t, rng), "", ls, rng)
+	if err != nil {
+		t.Fatalf("Failed to enroll key provider: %+v", err)
+	}
+
+	expectedErr := strings.Split(unwrapEnrollmentErr, "%")[0]
+	_, err = unlockWithKeyProvider(newTestSecretKeyProvider(t, rng), ls)
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for wrong secret."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+}
+
+// Tests that a password can be enrolled after it has been revoked and that
+// getOrInit does not overwrite the internal password in the meantime.
+func Test_revokeKeyProvider_Password(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	rng := csprng.NewSystemRNG()
+	internalPassword, err :=
+		initInternalPassword("myPassword", ls, rng, testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	kp := newTestSecretKeyProvider(t, rng)
+	if _, err = enrollKeyProvider(internalPassword, kp, "", ls, rng); err != nil {
+		t.Fatalf("Failed to enroll key provider: %+v", err)
+	}
+
+	if err = revokeKeyProvider(passwordEnrollmentID, ls); err != nil {
+		t.Fatalf("Failed to revoke password: %+v", err)
+	}
+
+	if _, err = getOrInit("newPassword", ls); err == nil ||
+		err.Error() != noPasswordEnrolledErr {
+		t.Errorf("Unexpected error when no password is enrolled."+
+			"\nexpected: %s\nreceived: %+v", noPasswordEnrolledErr, err)
+	}
+
+	pkp := newPasswordKeyProvider("newPassword", testParams())
+	id, err := enrollKeyProvider(internalPassword, pkp, "", ls, rng)
+	if err != nil {
+		t.Fatalf("Failed to enroll password: %+v", err)
+	} else if id != passwordEnrollmentID {
+		t.Errorf("Unexpected password enrollment ID."+
+			"\nexpected: %q\nreceived: %q", passwordEnrollmentID, id)
+	}
+
+	loaded, err := getInternalPassword("newPassword", ls)
+	if err != nil {
+		t.Fatalf("Failed to get internal password: %+v", err)
+	}
+	if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password does not match original."+
+			"\nexpected: %v\nreceived: %v", internalPassword, loaded)
+	}
+
+	if _, err = enrollKeyProvider(internalPassword, pkp, "", ls, rng); err == nil ||
+		err.Error() != passwordEnrolledErr {
+		t.Errorf("Unexpected error when password is already enrolled."+
+			"\nexpected: %s\nreceived: %+v", passwordEnrolledErr, err)
+	}
+}
+
+// Error path: Tests that revokeKeyProvider refuses to revoke the last
+// enrollment.
+func Test_revokeKeyProvider_LastEnrollmentError(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	err = revokeKeyProvider(passwordEnrollmentID, ls)
+	if err == nil || err.Error() != revokeLastErr {
+		t.Errorf("Unexpected error when revoking last enrollment."+
+			"\nexpected: %s\nreceived: %+v", revokeLastErr, err)
+	}
+
+	if _, err = getInternalPassword("myPassword", ls); err != nil {
+		t.Errorf("Password no longer works after failed revoke: %+v", err)
+	}
+}
+
+// Tests that newKeyProvider returns the correct KeyProvider for each type and
+// an error for invalid descriptors.
+func Test_newKeyProvider(t *testing.T) {
+	kp, err := newKeyProvider([]byte(`{"type":"password","password":"pw"}`))
+	if err != nil {
+		t.Fatalf("Failed to create password key provider: %+v", err)
+	} else if kp.Type() != PasswordKeyProviderType {
+		t.Errorf("Unexpected type.\nexpected: %q\nreceived: %q",
+			PasswordKeyProviderType, kp.Type())
+	}
+
+	secretJSON := []byte(`{"type":"secret",` +
+		`"secret":"9Bm1hxZvX0g2nYWh4ufQr9iI6tq0d7yZ8OezNYfFyDc="}`)
+	kp, err = newKeyProvider(secretJSON)
+	if err != nil {
+		t.Fatalf("Failed to create secret key provider: %+v", err)
+	} else if kp.Type() != SecretKeyProviderType {
+		t.Errorf("Unexpected type.\nexpected: %q\nreceived: %q",
+			SecretKeyProviderType, kp.Type())
+	}
+
+	expectedErr := strings.Split(secretLenErr, "%")[0]
+	_, err = newKeyProvider([]byte(`{"type":"secret","secret":"AAAA"}`))
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for short secret."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	expectedErr = strings.Split(unknownProviderTypeErr, "%")[0]
+	_, err = newKeyProvider([]byte(`{"type":"unknown"}`))
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for unknown type."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+}
+
+// newTestSecretKeyProvider returns a secretKeyProvider with a random secret.
+func newTestSecretKeyProvider(
+	t testing.TB, rng io.Reader) *secretKeyProvider {
+	secret := make([]byte, secretLen)
+	if _, err := io.ReadFull(rng, secret); err != nil {
+		t.Fatalf("Failed to generate secret: %+v", err)
+	}
+	kp, err := newSecretKeyProvider(secret)
+	if err != nil {
+		t.Fatalf("Failed to create secret key provider: %+v", err)
+	}
+	return kp
+}
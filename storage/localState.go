@@ -0,0 +1,330 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// localStateArchiveVersion is the version of the localStateArchive format.
+const localStateArchiveVersion = 1
+
+// Error messages.
+const (
+	// decryptArchive
+	archiveUnmarshalErr = "failed to unmarshal local state archive: %+v"
+	archiveDecryptErr   = "could not decrypt local state archive: %+v"
+	archiveParamsErr    = "local state archive has invalid Argon2 parameters %+v; the maximum is %+v"
+
+	// restoreArchive
+	archiveVersionErr  = "unsupported local state archive version %d"
+	archiveNewerErr    = "local state archive was exported by xxDK %s v%s, which is newer than this binary (v%s)"
+	archiveNotEmptyErr = "cannot import local state into a browser that already has xxDK data; purge it first"
+	archiveRestoreErr  = "failed to restore database %q: %+v"
+)
+
+// localStateArchive contains all local storage and indexedDb databases saved by
+// this WASM binary. It is JSON marshalled and encrypted by
+// [ExportLocalState].
+type localStateArchive struct {
+	ArchiveVersion int                 `json:"archiveVersion"`
+	WasmVersion    string              `json:"wasmVersion"`
+	ClientVersion  string              `json:"clientVersion"`
+	Created        time.Time           `json:"created"`
+	LocalStorage   map[string][]byte   `json:"localStorage"`
+	Databases      []impl.DatabaseDump `json:"databases"`
+}
+
+// maxArchiveParams are the highest Argon2 costs accepted from an imported
+// archive. They are well above the costs used by ExportLocalState, but stop a
+// crafted archive from using all the memory or time of the browser to derive
+// its key.
+var maxArchiveParams = argonParams{
+	Time:    16,
+	Memory:  512 * 1024, // ~512 MB
+	Threads: 16,
+}
+
+// encryptedArchive is the encrypted localStateArchive with the parameters
+// needed to derive its key from the password.
+type encryptedArchive struct {
+	Salt       []byte      `json:"salt"`
+	Params     argonParams `json:"params"`
+	Ciphertext []byte      `json:"ciphertext"`
+}
+
+// ExportLocalState exports all local storage and every indexedDb database
+// saved by this WASM binary for the profile, including the version markers,
+// into a single archive encrypted with the user's password. The archive can be
+// imported into another browser with [ImportLocalState].
+//
+// Parameters:
+//   - args[0] - The user-supplied password (string).
+//   - args[1] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns a promise:
+//   - The encrypted archive (Uint8Array).
+//   - Throws TypeError if the password is incorrect or the export fails.
+func ExportLocalState(_ js.Value, args []js.Value) any {
+	externalPassword := args[0].String()
+	_, ls, profileErr := profileArg(args, 1)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		} else if !verifyPassword(externalPassword, ls) {
+			reject(exception.NewTrace(errors.New(invalidPasswordErr)))
+			return
+		}
+
+		archive, err := buildArchive(
+			ls, impl.DumpDatabase, SEMVER, bindings.GetVersion())
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		data, err := encryptArchive(archive, externalPassword,
+			csprng.NewSystemRNG(), defaultParams())
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(data))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ImportLocalState restores an archive created by [ExportLocalState] into the
+// profile. It must be called before [wasm.LoadCmix] for a profile with no
+// existing xxDK data. After the data is restored, any migrations between the
+// exported version and the current version are run.
+//
+// Parameters:
+//   - args[0] - The encrypted archive (Uint8Array).
+//   - args[1] - The password used to export the archive (string).
+//   - args[2] - The profile ID to import into (string). Optional; omit to use
+//     the default profile.
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Throws TypeError if the password is incorrect, the archive was exported
+//     by a newer version, the browser already has data, or any cMix follower
+//     is running.
+func ImportLocalState(_ js.Value, args []js.Value) any {
+	data := utils.CopyBytesToGo(args[0])
+	externalPassword := args[1].String()
+	profile, ls, profileErr := profileArg(args, 2)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		} else if err := checkClientsStopped(); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		archive, err := decryptArchive(data, externalPassword)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = restoreArchive(archive, ls, impl.RestoreDatabase,
+			deleteDatabase, SEMVER, bindings.GetVersion())
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else if err = addProfile(profile, storage.GetLocalStorage()); err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// buildArchive collects all local storage keys of the profile and dumps every
+// database in its registry.
+func buildArchive(ls storage.LocalStorage,
+	dumpDb func(databaseName string) (impl.DatabaseDump, error),
+	wasmVer, clientVer string) (localStateArchive, error) {
+	archive := localStateArchive{
+		ArchiveVersion: localStateArchiveVersion,
+		WasmVersion:    wasmVer,
+		ClientVersion:  clientVer,
+		Created:        time.Now(),
+		LocalStorage:   make(map[string][]byte),
+	}
+
+	for _, keyName := range ls.Keys() {
+		// Failed attempts belong to this browser
+		if keyName == passwordAttemptsKey {
+			continue
+		}
+
+		value, err := ls.Get(keyName)
+		if err != nil {
+			return archive, errors.Wrapf(err, "failed to get %q", keyName)
+		}
+		archive.LocalStorage[keyName] = value
+	}
+
+	registry, err := loadIndexedDbRegistry(ls)
+	if err != nil {
+		return archive, err
+	}
+	names := make([]string, 0, len(registry))
+	for databaseName := range registry {
+		names = append(names, databaseName)
+	}
+	sort.Strings(names)
+
+	archive.Databases = make([]impl.DatabaseDump, len(names))
+	for i, databaseName := range names {
+		if archive.Databases[i], err = dumpDb(databaseName); err != nil {
+			return archive, err
+		}
+	}
+
+	return archive, nil
+}
+
+// encryptArchive JSON marshals the archive and encrypts it with a key derived
+// from the password.
+func encryptArchive(archive localStateArchive, externalPassword string,
+	csprng io.Reader, params argonParams) ([]byte, error) {
+	data, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := makeSalt(csprng)
+	if err != nil {
+		return nil, err
+	}
+
+	key := deriveKey(externalPassword, salt, params)
+
+	return json.Marshal(encryptedArchive{
+		Salt:       salt,
+		Params:     params,
+		Ciphertext: encryptPassword(data, key, csprng),
+	})
+}
+
+// decryptArchive decrypts and unmarshals an archive created by encryptArchive.
+func decryptArchive(
+	data []byte, externalPassword string) (localStateArchive, error) {
+	var archive localStateArchive
+	var ea encryptedArchive
+	if err := json.Unmarshal(data, &ea); err != nil {
+		return archive, errors.Errorf(archiveUnmarshalErr, err)
+	}
+
+	// Argon2 panics on zero time or threads
+	if ea.Params.Time == 0 || ea.Params.Threads == 0 ||
+		maxArchiveParams.weakerThan(ea.Params) {
+		return archive,
+			errors.Errorf(archiveParamsErr, ea.Params, maxArchiveParams)
+	}
+
+	key := deriveKey(externalPassword, ea.Salt, ea.Params)
+	plaintext, err := decryptPassword(ea.Ciphertext, key)
+	if err != nil {
+		return archive, errors.Errorf(archiveDecryptErr, err)
+	}
+
+	if err = json.Unmarshal(plaintext, &archive); err != nil {
+		return archive, errors.Errorf(archiveUnmarshalErr, err)
+	}
+
+	return archive, nil
+}
+
+// restoreArchive validates the archive versions, restores every database and
+// local storage key, and then runs any required migrations. If a database
+// cannot be restored, the databases already restored are deleted.
+func restoreArchive(archive localStateArchive, ls storage.LocalStorage,
+	restoreDb func(dump impl.DatabaseDump) error,
+	deleteDb func(databaseName string) error,
+	currentWasmVer, currentClientVer string) error {
+	if archive.ArchiveVersion != localStateArchiveVersion {
+		return errors.Errorf(archiveVersionErr, archive.ArchiveVersion)
+	}
+	if c, err := compareSemver(archive.WasmVersion, currentWasmVer); err != nil {
+		return err
+	} else if c > 0 {
+		return errors.Errorf(
+			archiveNewerErr, "WASM", archive.WasmVersion, currentWasmVer)
+	}
+	if c, err :=
+		compareSemver(archive.ClientVersion, currentClientVer); err != nil {
+		return err
+	} else if c > 0 {
+		return errors.Errorf(
+			archiveNewerErr, "client", archive.ClientVersion, currentClientVer)
+	}
+
+	// Refuse to overwrite an existing account
+	if _, err := loadPasswordEnrollment(ls); err == nil {
+		return errors.New(archiveNotEmptyErr)
+	}
+	if registry, err := loadIndexedDbRegistry(ls); err != nil {
+		return err
+	} else if len(registry) > 0 {
+		return errors.New(archiveNotEmptyErr)
+	}
+
+	for i, dump := range archive.Databases {
+		if err := restoreDb(dump); err != nil {
+			for _, restored := range archive.Databases[:i] {
+				if err2 := deleteDb(restored.Name); err2 != nil {
+					jww.ERROR.Printf("Failed to delete partially imported "+
+						"database %q: %+v", restored.Name, err2)
+				}
+			}
+			return errors.Errorf(archiveRestoreErr, dump.Name, err)
+		}
+	}
+
+	for keyName, value := range archive.LocalStorage {
+		if err := ls.Set(keyName, value); err != nil {
+			return errors.Wrapf(err, "localStorage: failed to set %q", keyName)
+		}
+	}
+
+	// The archive includes the version markers of the exporting binary, so
+	// this runs the migrations between it and the current version
+	return checkAndStoreVersions(currentWasmVer, currentClientVer, ls)
+}
+
+// deleteDatabase deletes the indexedDb database with the given name.
+func deleteDatabase(databaseName string) error {
+	_, err := idb.Global().DeleteDatabase(databaseName)
+	return err
+}
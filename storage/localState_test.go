@@ -0,0 +1,218 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that an archive built by buildArchive, encrypted, decrypted, and
+// restored into empty storage contains the same local storage and databases.
+func Test_buildArchive_restoreArchive(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	internalPassword, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err = checkAndStoreVersions("0.3.21", "4.7.0", ls); err != nil {
+		t.Fatalf("Failed to store versions: %+v", err)
+	}
+	for _, name := range []string{"b_speakeasy", "a_speakeasy"} {
+		if err = StoreIndexedDb(name); err != nil {
+			t.Fatalf("Failed to store database name %q: %+v", name, err)
+		}
+	}
+	if err = recordFailedAttempt(ls, time.Now(), nil); err != nil {
+		t.Fatalf("Failed to record attempt: %+v", err)
+	}
+
+	dumps := map[string]impl.DatabaseDump{}
+	dumpDb := func(name string) (impl.DatabaseDump, error) {
+		return impl.DatabaseDump{Name: name, Version: 1}, nil
+	}
+	archive, err := buildArchive(ls, dumpDb, "0.3.21", "4.7.0")
+	if err != nil {
+		t.Fatalf("Failed to build archive: %+v", err)
+	}
+	if _, exists := archive.LocalStorage[passwordAttemptsKey]; exists {
+		t.Errorf("Failed attempts included in archive.")
+	}
+
+	data, err := encryptArchive(
+		archive, "myPassword", csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("Failed to encrypt archive: %+v", err)
+	}
+
+	// Restore into empty storage
+	ls.Clear()
+	decrypted, err := decryptArchive(data, "myPassword")
+	if err != nil {
+		t.Fatalf("Failed to decrypt archive: %+v", err)
+	}
+	restoreDb := func(dump impl.DatabaseDump) error {
+		dumps[dump.Name] = dump
+		return nil
+	}
+	err = restoreArchive(decrypted, ls, restoreDb, nil, "0.3.22", "4.7.0")
+	if err != nil {
+		t.Fatalf("Failed to restore archive: %+v", err)
+	}
+
+	expected := map[string]impl.DatabaseDump{
+		"a_speakeasy": {Name: "a_speakeasy", Version: 1},
+		"b_speakeasy": {Name: "b_speakeasy", Version: 1},
+	}
+	if !reflect.DeepEqual(expected, dumps) {
+		t.Errorf("Unexpected restored databases."+
+			"\nexpected: %+v\nreceived: %+v", expected, dumps)
+	}
+
+	loaded, err := getInternalPassword("myPassword", ls)
+	if err != nil {
+		t.Fatalf("Failed to get internal password after import: %+v", err)
+	} else if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password does not match after import."+
+			"\nexpected: %v\nreceived: %v", internalPassword, loaded)
+	}
+
+	storedWasmVer, err := ls.Get(semverKey)
+	if err != nil || string(storedWasmVer) != "0.3.22" {
+		t.Errorf("WASM version not upgraded after import: %s, %+v",
+			storedWasmVer, err)
+	}
+}
+
+// Error path: Tests that decryptArchive returns an error for an incorrect
+// password.
+func Test_decryptArchive_InvalidPassword(t *testing.T) {
+	data, err := encryptArchive(localStateArchive{}, "myPassword",
+		csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("Failed to encrypt archive: %+v", err)
+	}
+
+	expectedErr := strings.Split(archiveDecryptErr, "%")[0]
+	_, err = decryptArchive(data, "wrong")
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for incorrect password."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+}
+
+// Error path: Tests that decryptArchive refuses Argon2 parameters above
+// maxArchiveParams, or with no time or threads, before deriving the key.
+func Test_decryptArchive_InvalidParams(t *testing.T) {
+	tests := []argonParams{
+		{Time: maxArchiveParams.Time + 1, Memory: 1, Threads: 1},
+		{Time: 1, Memory: maxArchiveParams.Memory + 1, Threads: 1},
+		{Time: 1, Memory: 1, Threads: maxArchiveParams.Threads + 1},
+		{Time: 0, Memory: 1, Threads: 1},
+		{Time: 1, Memory: 1, Threads: 0},
+	}
+
+	expectedErr := strings.Split(archiveParamsErr, "%")[0]
+	for i, params := range tests {
+		data, err := json.Marshal(encryptedArchive{
+			Salt: make([]byte, saltLen), Params: params})
+		if err != nil {
+			t.Fatalf("Failed to marshal archive #%d: %+v", i, err)
+		}
+
+		_, err = decryptArchive(data, "myPassword")
+		if err == nil || !strings.Contains(err.Error(), expectedErr) {
+			t.Errorf("Unexpected error for parameters %+v (%d)."+
+				"\nexpected: %s\nreceived: %+v", params, i, expectedErr, err)
+		}
+	}
+}
+
+// Error path: Tests that restoreArchive refuses an archive exported by a newer
+// version and an import into storage that already has an account.
+func Test_restoreArchive_Errors(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	archive := localStateArchive{
+		ArchiveVersion: localStateArchiveVersion,
+		WasmVersion:    "0.4.0",
+		ClientVersion:  "4.7.0",
+	}
+
+	expectedErr := strings.Split(archiveNewerErr, "%")[0]
+	err := restoreArchive(archive, ls, nil, nil, "0.3.22", "4.7.0")
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for newer archive."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	_, err = initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	archive.WasmVersion = "0.3.22"
+	err = restoreArchive(archive, ls, nil, nil, "0.3.22", "4.7.0")
+	if err == nil || err.Error() != archiveNotEmptyErr {
+		t.Errorf("Unexpected error for non-empty storage."+
+			"\nexpected: %s\nreceived: %+v", archiveNotEmptyErr, err)
+	}
+}
+
+// Error path: Tests that restoreArchive deletes the databases already restored
+// when a later database fails.
+func Test_restoreArchive_DatabaseFailure(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	archive := localStateArchive{
+		ArchiveVersion: localStateArchiveVersion,
+		WasmVersion:    "0.3.22",
+		ClientVersion:  "4.7.0",
+		LocalStorage:   map[string][]byte{"key": []byte("value")},
+		Databases:      []impl.DatabaseDump{{Name: "a"}, {Name: "b"}},
+	}
+
+	var deleted []string
+	restoreDb := func(dump impl.DatabaseDump) error {
+		if dump.Name == "b" {
+			return errors.New("restore failed")
+		}
+		return nil
+	}
+	deleteDb := func(name string) error {
+		deleted = append(deleted, name)
+		return nil
+	}
+
+	expectedErr := strings.Split(archiveRestoreErr, "%")[0]
+	err := restoreArchive(archive, ls, restoreDb, deleteDb, "0.3.22", "4.7.0")
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for failed database."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	if !reflect.DeepEqual([]string{"a"}, deleted) {
+		t.Errorf("Unexpected deleted databases: %s", deleted)
+	}
+	if _, err = ls.Get("key"); err == nil {
+		t.Errorf("Local storage restored after database failure.")
+	}
+}
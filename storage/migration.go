@@ -0,0 +1,300 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// migrationProgressKey is the key used to store the migrationProgress of an
+// upgrade that has not yet completed.
+const migrationProgressKey = "xxdkWasmMigrationProgress"
+
+// Error messages.
+const (
+	// runMigrations
+	downgradeErr     = "stored data was written by xxDK %s v%s, which is newer than this binary (v%s); refusing to start to avoid corrupting it"
+	migrationErr     = "migration %q failed: %+v"
+	saveProgressErr  = "failed to save migration progress after %q: %+v"
+	loadProgressErr  = "failed to load migration progress: %+v"
+	parseVersionErr  = "invalid semantic version %q: %+v"
+	duplicateIDErr   = "migration with ID %q already registered"
+	noVersionErr     = "migration %q must specify a WASM or client version"
+	noMigrationFnErr = "migration %q has no function"
+)
+
+// Migration is a single data migration step. It runs once when upgrading from
+// a stored version older than its WasmVersion or ClientVersion to a current
+// version that is the same or newer.
+type Migration struct {
+	// ID uniquely identifies the migration. It is recorded once the migration
+	// completes so that an interrupted upgrade does not run it twice.
+	ID string
+
+	// WasmVersion is the xxDK WASM version that requires the migration. Leave
+	// empty if the migration only depends on the client version.
+	WasmVersion string
+
+	// ClientVersion is the xxDK client version that requires the migration.
+	// Leave empty if the migration only depends on the WASM version.
+	ClientVersion string
+
+	// Run performs the migration. It must be safe to run again if it was
+	// interrupted before completing.
+	Run func(ls storage.LocalStorage) error
+}
+
+// migrationProgress is saved to local storage while an upgrade is running. It
+// records the target versions and the completed migrations.
+type migrationProgress struct {
+	WasmVersion   string   `json:"wasmVersion"`
+	ClientVersion string   `json:"clientVersion"`
+	Completed     []string `json:"completed"`
+}
+
+// migrations is the ordered registry of all migrations.
+var migrations struct {
+	list []Migration
+	sync.Mutex
+}
+
+// RegisterMigration adds a migration to the registry. Migrations run in the
+// order they are registered, so they must be registered in version order. All
+// migrations must be registered before [CheckAndStoreVersions] is called.
+func RegisterMigration(m Migration) error {
+	if m.WasmVersion == "" && m.ClientVersion == "" {
+		return errors.Errorf(noVersionErr, m.ID)
+	} else if m.Run == nil {
+		return errors.Errorf(noMigrationFnErr, m.ID)
+	}
+
+	migrations.Lock()
+	defer migrations.Unlock()
+	for _, existing := range migrations.list {
+		if existing.ID == m.ID {
+			return errors.Errorf(duplicateIDErr, m.ID)
+		}
+	}
+	migrations.list = append(migrations.list, m)
+
+	return nil
+}
+
+// registeredMigrations returns a copy of the registered migrations.
+func registeredMigrations() []Migration {
+	migrations.Lock()
+	defer migrations.Unlock()
+	return append([]Migration{}, migrations.list...)
+}
+
+// runMigrations runs, in order, every migration required to upgrade from the
+// stored versions to the current versions. Progress is saved after each
+// migration so that an interrupted upgrade resumes where it stopped.
+//
+// Returns an error if either stored version is newer than the current version.
+func runMigrations(list []Migration, storedWasmVer, currentWasmVer,
+	storedClientVer, currentClientVer string, ls storage.LocalStorage) error {
+	// Refuse to run on data written by a newer binary
+	if c, err := compareSemver(storedWasmVer, currentWasmVer); err != nil {
+		return err
+	} else if c > 0 {
+		return errors.Errorf(
+			downgradeErr, "WASM", storedWasmVer, currentWasmVer)
+	}
+	if c, err := compareSemver(storedClientVer, currentClientVer); err != nil {
+		return err
+	} else if c > 0 {
+		return errors.Errorf(
+			downgradeErr, "client", storedClientVer, currentClientVer)
+	}
+
+	progress, err := loadMigrationProgress(ls)
+	if err != nil {
+		return err
+	}
+	if progress.WasmVersion != currentWasmVer ||
+		progress.ClientVersion != currentClientVer {
+		// Progress for a different target is discarded; the migrations it
+		// completed are still in range and were written to be re-runnable
+		progress = migrationProgress{
+			WasmVersion:   currentWasmVer,
+			ClientVersion: currentClientVer,
+		}
+	}
+	completed := make(map[string]bool, len(progress.Completed))
+	for _, id := range progress.Completed {
+		completed[id] = true
+	}
+
+	for _, m := range list {
+		required, err := m.required(storedWasmVer, currentWasmVer,
+			storedClientVer, currentClientVer)
+		if err != nil {
+			return err
+		} else if !required {
+			continue
+		} else if completed[m.ID] {
+			jww.INFO.Printf("Skipping completed migration %q", m.ID)
+			continue
+		}
+
+		jww.INFO.Printf("Running migration %q", m.ID)
+		if err = m.Run(ls); err != nil {
+			return errors.Errorf(migrationErr, m.ID, err)
+		}
+
+		progress.Completed = append(progress.Completed, m.ID)
+		if err = storeMigrationProgress(progress, ls); err != nil {
+			return errors.Errorf(saveProgressErr, m.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// required returns true if the migration must run to upgrade from the stored
+// versions to the current versions.
+func (m Migration) required(storedWasmVer, currentWasmVer, storedClientVer,
+	currentClientVer string) (bool, error) {
+	if m.WasmVersion != "" {
+		inRange, err :=
+			versionInRange(m.WasmVersion, storedWasmVer, currentWasmVer)
+		if err != nil || inRange {
+			return inRange, err
+		}
+	}
+	if m.ClientVersion != "" {
+		return versionInRange(
+			m.ClientVersion, storedClientVer, currentClientVer)
+	}
+	return false, nil
+}
+
+// versionInRange returns true if stored < v <= current.
+func versionInRange(v, stored, current string) (bool, error) {
+	lower, err := compareSemver(stored, v)
+	if err != nil {
+		return false, err
+	}
+	upper, err := compareSemver(v, current)
+	if err != nil {
+		return false, err
+	}
+	return lower < 0 && upper <= 0, nil
+}
+
+// loadMigrationProgress loads the progress of an interrupted upgrade. Returns
+// an empty migrationProgress if none is saved.
+func loadMigrationProgress(ls storage.LocalStorage) (migrationProgress, error) {
+	var progress migrationProgress
+	data, err := ls.Get(migrationProgressKey)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return progress, nil
+		}
+		return progress, errors.Errorf(loadProgressErr, err)
+	}
+
+	if err = json.Unmarshal(data, &progress); err != nil {
+		return progress, errors.Errorf(loadProgressErr, err)
+	}
+
+	return progress, nil
+}
+
+// storeMigrationProgress saves the progress of the current upgrade.
+func storeMigrationProgress(
+	progress migrationProgress, ls storage.LocalStorage) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	err = ls.Set(migrationProgressKey, data)
+	if err != nil {
+		return errors.Wrapf(
+			err, "localStorage: failed to set %q", migrationProgressKey)
+	}
+
+	return nil
+}
+
+// compareSemver compares two semantic versions. It returns -1 if a < b, 0 if
+// a == b, and +1 if a > b. A leading "v" and build metadata are ignored,
+// missing minor or patch numbers are treated as zero, and a version with a
+// pre-release suffix is lower than the same version without one.
+func compareSemver(a, b string) (int, error) {
+	aNums, aPre, err := parseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	bNums, bPre, err := parseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range aNums {
+		if aNums[i] < bNums[i] {
+			return -1, nil
+		} else if aNums[i] > bNums[i] {
+			return 1, nil
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0, nil
+	case aPre == "":
+		return 1, nil
+	case bPre == "":
+		return -1, nil
+	case aPre < bPre:
+		return -1, nil
+	default:
+		return 1, nil
+	}
+}
+
+// parseSemver returns the major, minor, and patch numbers and the pre-release
+// suffix of the version.
+func parseSemver(v string) ([3]uint64, string, error) {
+	var nums [3]uint64
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var pre string
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, pre = s[:i], s[i+1:]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return nums, "", errors.Errorf(parseVersionErr, v, "too many parts")
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nums, "", errors.Errorf(parseVersionErr, v, err)
+		}
+		nums[i] = n
+	}
+
+	return nums, pre, nil
+}
@@ -0,0 +1,151 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// Tests that runMigrations only runs the migrations between the stored and
+// current versions and runs them in order.
+func Test_runMigrations(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	var ran []string
+	newMigration := func(id, wasmVer, clientVer string) Migration {
+		return Migration{ID: id, WasmVersion: wasmVer, ClientVersion: clientVer,
+			Run: func(storage.LocalStorage) error {
+				ran = append(ran, id)
+				return nil
+			}}
+	}
+	list := []Migration{
+		newMigration("old", "0.3.0", ""),
+		newMigration("wasm1", "0.3.21", ""),
+		newMigration("client1", "", "4.7.0"),
+		newMigration("wasm2", "0.3.22", ""),
+		newMigration("future", "0.4.0", "5.0.0"),
+	}
+
+	err := runMigrations(list, "0.3.20", "0.3.22", "4.6.3", "4.7.0", ls)
+	if err != nil {
+		t.Fatalf("Failed to run migrations: %+v", err)
+	}
+
+	expected := []string{"wasm1", "client1", "wasm2"}
+	if !reflect.DeepEqual(expected, ran) {
+		t.Errorf("Unexpected migrations run.\nexpected: %s\nreceived: %s",
+			expected, ran)
+	}
+}
+
+// Tests that an interrupted upgrade resumes after the last completed
+// migration.
+func Test_runMigrations_Resume(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	var ran []string
+	fail := true
+	list := []Migration{
+		{ID: "first", WasmVersion: "1.1.0", Run: func(storage.LocalStorage) error {
+			ran = append(ran, "first")
+			return nil
+		}},
+		{ID: "second", WasmVersion: "1.2.0", Run: func(storage.LocalStorage) error {
+			if fail {
+				return errors.New("interrupted")
+			}
+			ran = append(ran, "second")
+			return nil
+		}},
+	}
+
+	err := runMigrations(list, "1.0.0", "1.2.0", "4.0.0", "4.0.0", ls)
+	expectedErr := strings.Split(migrationErr, "%")[0]
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("Unexpected error for failed migration."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	fail = false
+	err = runMigrations(list, "1.0.0", "1.2.0", "4.0.0", "4.0.0", ls)
+	if err != nil {
+		t.Fatalf("Failed to resume migrations: %+v", err)
+	}
+
+	expected := []string{"first", "second"}
+	if !reflect.DeepEqual(expected, ran) {
+		t.Errorf("Unexpected migrations run.\nexpected: %s\nreceived: %s",
+			expected, ran)
+	}
+}
+
+// Error path: Tests that checkAndStoreVersions refuses to run when the stored
+// WASM version is newer than the current version and does not overwrite it.
+func Test_checkAndStoreVersions_DowngradeError(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	if err := checkAndStoreVersions("0.4.0", "4.7.0", ls); err != nil {
+		t.Fatalf("CheckAndStoreVersions error: %+v", err)
+	}
+
+	err := checkAndStoreVersions("0.3.22", "4.7.0", ls)
+	expectedErr := strings.Split(downgradeErr, "%")[0]
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for downgrade."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	storedWasmVer, err := ls.Get(semverKey)
+	if err != nil {
+		t.Fatalf("Failed to get WASM version from storage: %+v", err)
+	}
+	if string(storedWasmVer) != "0.4.0" {
+		t.Errorf("Stored WASM version overwritten on downgrade."+
+			"\nexpected: %s\nreceived: %s", "0.4.0", storedWasmVer)
+	}
+}
+
+// Tests that compareSemver correctly orders versions.
+func Test_compareSemver(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"0.3.22", "0.3.22", 0},
+		{"0.3.9", "0.3.22", -1},
+		{"1.0", "0.9.9", 1},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.3-rc1", "1.2.3", -1},
+		{"1.2.3+build5", "1.2.3", 0},
+		{"4.7.5", "4.10.0", -1},
+	}
+
+	for i, tt := range tests {
+		c, err := compareSemver(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("Failed to compare %q and %q (%d): %+v", tt.a, tt.b, i, err)
+		} else if c != tt.expected {
+			t.Errorf("Unexpected comparison of %q and %q (%d)."+
+				"\nexpected: %d\nreceived: %d", tt.a, tt.b, i, tt.expected, c)
+		}
+	}
+
+	if _, err := compareSemver("1.x", "1.0"); err == nil {
+		t.Errorf("Did not receive an error for an invalid version.")
+	}
+}
@@ -0,0 +1,110 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"syscall/js"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// ParamsUpgradeEvent is JSON marshalled and passed to the callback registered
+// with [RegisterPasswordUpgradeCallback] when the Argon2 parameters used to
+// encrypt the internal password are upgraded.
+type ParamsUpgradeEvent struct {
+	Old argonParams `json:"old"`
+	New argonParams `json:"new"`
+}
+
+// paramsUpgradeCB is called when the Argon2 parameters are upgraded.
+var paramsUpgradeCB struct {
+	cb func(event ParamsUpgradeEvent)
+	sync.Mutex
+}
+
+// RegisterPasswordUpgradeCallback registers a callback that is called every
+// time the stored Argon2 parameters are raised to the current defaults after
+// a successful call to [GetOrInitPassword] or [VerifyPassword]. Previously
+// registered callbacks are overwritten.
+//
+// Parameters:
+//   - args[0] - A function that accepts the JSON of [ParamsUpgradeEvent]. It
+//     must be of the form func(Uint8Array).
+//
+// Example event JSON:
+//
+//	{
+//	  "old": {"Time": 1, "Memory": 32768, "Threads": 4},
+//	  "new": {"Time": 1, "Memory": 65536, "Threads": 4}
+//	}
+func RegisterPasswordUpgradeCallback(_ js.Value, args []js.Value) any {
+	invoke := args[0].Invoke
+	setParamsUpgradeCallback(func(event ParamsUpgradeEvent) {
+		eventJSON, err := json.Marshal(event)
+		if err != nil {
+			jww.ERROR.Printf(
+				"Failed to JSON marshal %T for callback: %+v", event, err)
+			return
+		}
+		invoke(utils.CopyBytesToJS(eventJSON))
+	})
+	return nil
+}
+
+// setParamsUpgradeCallback sets the callback called on parameter upgrade.
+func setParamsUpgradeCallback(cb func(event ParamsUpgradeEvent)) {
+	paramsUpgradeCB.Lock()
+	defer paramsUpgradeCB.Unlock()
+	paramsUpgradeCB.cb = cb
+}
+
+// upgradeParams re-encrypts the internal password with a fresh salt if the
+// parameters in storage are weaker than the target. Each parameter is raised to
+// that of the target and none is lowered. It must only be called after the
+// external password has been verified.
+//
+// Failure to upgrade is logged and does not affect the stored password; the
+// existing parameters remain in use until the next successful unlock.
+func upgradeParams(internalPassword []byte, externalPassword string,
+	localStorage storage.LocalStorage, csprng io.Reader, target argonParams) {
+	stored, err := loadParams(localStorage)
+	if err != nil {
+		jww.WARN.Printf("Failed to load Argon2 parameters to check for "+
+			"upgrade: %+v", err)
+		return
+	} else if !stored.weakerThan(target) {
+		return
+	}
+	upgraded := stored.atLeast(target)
+
+	err = rewrapInternalPassword(
+		internalPassword, externalPassword, localStorage, csprng, upgraded)
+	if err != nil {
+		jww.ERROR.Printf("Failed to upgrade Argon2 parameters from %+v to "+
+			"%+v: %+v", stored, upgraded, err)
+		return
+	}
+
+	jww.INFO.Printf("Upgraded Argon2 parameters for internal password from "+
+		"%+v to %+v", stored, upgraded)
+
+	paramsUpgradeCB.Lock()
+	cb := paramsUpgradeCB.cb
+	paramsUpgradeCB.Unlock()
+	if cb != nil {
+		go cb(ParamsUpgradeEvent{Old: stored, New: upgraded})
+	}
+}
@@ -0,0 +1,180 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that upgradeParams re-encrypts the internal password with the target
+// parameters when the stored parameters are weaker and that the registered
+// callback is called with the old and new parameters.
+func Test_upgradeParams(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	externalPassword := "myPassword"
+	weak := testParams()
+	target := argonParams{Time: 2, Memory: 2, Threads: 1}
+
+	internalPassword, err := initInternalPassword(
+		externalPassword, ls, csprng.NewSystemRNG(), weak)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	oldSalt, err := ls.Get(saltKey)
+	if err != nil {
+		t.Fatalf("Failed to get salt: %+v", err)
+	}
+
+	eventChan := make(chan ParamsUpgradeEvent, 1)
+	setParamsUpgradeCallback(func(e ParamsUpgradeEvent) { eventChan <- e })
+	defer setParamsUpgradeCallback(nil)
+
+	upgradeParams(
+		internalPassword, externalPassword, ls, csprng.NewSystemRNG(), target)
+
+	params, err := loadParams(ls)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if params != target {
+		t.Errorf("Parameters not upgraded.\nexpected: %+v\nreceived: %+v",
+			target, params)
+	}
+
+	salt, err := ls.Get(saltKey)
+	if err != nil {
+		t.Fatalf("Failed to get salt: %+v", err)
+	}
+	if bytes.Equal(oldSalt, salt) {
+		t.Errorf("Salt not changed on upgrade.")
+	}
+
+	loaded, err := getInternalPassword(externalPassword, ls)
+	if err != nil {
+		t.Errorf("%+v", err)
+	} else if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password changed on upgrade."+
+			"\nexpected: %v\nreceived: %v", internalPassword, loaded)
+	}
+
+	select {
+	case e := <-eventChan:
+		expected := ParamsUpgradeEvent{Old: weak, New: target}
+		if e != expected {
+			t.Errorf("Unexpected event.\nexpected: %+v\nreceived: %+v",
+				expected, e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Timed out waiting for upgrade callback.")
+	}
+}
+
+// Tests that upgradeParams does not modify storage when the stored parameters
+// are not weaker than the target.
+func Test_upgradeParams_NoUpgrade(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	externalPassword := "myPassword"
+	params := argonParams{Time: 2, Memory: 2, Threads: 1}
+
+	internalPassword, err := initInternalPassword(
+		externalPassword, ls, csprng.NewSystemRNG(), params)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	backup, err := backupPasswordEntries(ls)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	upgradeParams(internalPassword, externalPassword, ls,
+		csprng.NewSystemRNG(), testParams())
+
+	for key, expected := range backup {
+		value, err := ls.Get(key)
+		if err != nil {
+			t.Errorf("Failed to get %q: %+v", key, err)
+		} else if !bytes.Equal(expected, value) {
+			t.Errorf("%q modified when parameters are not weaker."+
+				"\nexpected: %v\nreceived: %v", key, expected, value)
+		}
+	}
+}
+
+// Tests that argonParams.weakerThan only reports parameters with a lower time
+// cost, memory cost, or number of threads as weaker.
+func Test_argonParams_weakerThan(t *testing.T) {
+	target := argonParams{Time: 2, Memory: 64, Threads: 4}
+	tests := []struct {
+		params argonParams
+		weaker bool
+	}{
+		{argonParams{Time: 2, Memory: 64, Threads: 4}, false},
+		{argonParams{Time: 1, Memory: 64, Threads: 4}, true},
+		{argonParams{Time: 2, Memory: 32, Threads: 4}, true},
+		{argonParams{Time: 2, Memory: 64, Threads: 1}, true},
+		{argonParams{Time: 1, Memory: 128, Threads: 4}, true},
+		{argonParams{Time: 3, Memory: 128, Threads: 4}, false},
+	}
+
+	for i, tt := range tests {
+		if weaker := tt.params.weakerThan(target); weaker != tt.weaker {
+			t.Errorf("Unexpected result for %+v (%d)."+
+				"\nexpected: %t\nreceived: %t", tt.params, i, tt.weaker, weaker)
+		}
+	}
+}
+
+// Tests that upgradeParams raises only the weaker parameters to the target and
+// keeps the stronger ones.
+func Test_upgradeParams_PerField(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	externalPassword := "myPassword"
+	stored := argonParams{Time: 3, Memory: 1, Threads: 1}
+	target := argonParams{Time: 2, Memory: 2, Threads: 1}
+
+	internalPassword, err := initInternalPassword(
+		externalPassword, ls, csprng.NewSystemRNG(), stored)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	upgradeParams(
+		internalPassword, externalPassword, ls, csprng.NewSystemRNG(), target)
+
+	params, err := loadParams(ls)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := argonParams{Time: 3, Memory: 2, Threads: 1}
+	if params != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, params)
+	}
+}
+
+// Tests that argonParams.atLeast returns the greater of each parameter.
+func Test_argonParams_atLeast(t *testing.T) {
+	p := argonParams{Time: 3, Memory: 32, Threads: 1}
+	target := argonParams{Time: 2, Memory: 64, Threads: 4}
+	expected := argonParams{Time: 3, Memory: 64, Threads: 4}
+
+	if upgraded := p.atLeast(target); upgraded != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, upgraded)
+	}
+}
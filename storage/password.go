@@ -10,6 +10,7 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/cipher"
 	"encoding/json"
 	"io"
@@ -64,6 +65,9 @@ const (
 	readInternalPasswordErr     = "could not generate"
 	internalPasswordNumBytesErr = "expected %d bytes for internal password, found %d bytes"
 
+	// getOrInit
+	noPasswordEnrolledErr = "no password enrolled; unlock with an enrolled key provider and enroll a password"
+
 	// getInternalPassword
 	getPasswordStorageErr = "could not retrieve encrypted internal password from storage: %+v"
 	getSaltStorageErr     = "could not retrieve salt from storage: %+v"
@@ -71,6 +75,12 @@ const (
 	paramsUnmarshalErr    = "failed to unmarshal encryption parameters loaded from storage: %+v"
 	decryptPasswordErr    = "could not decrypt internal password: %+v"
 
+	// rewrapInternalPassword
+	rewrapMismatchErr = "re-encrypted internal password does not match original"
+	backupEntryErr    = "could not back up %q from storage: %+v"
+	restoreEntryErr   = "could not restore %q to storage: %+v; " +
+		"re-encryption failed: %+v"
+
 	// decryptPassword
 	readNonceLenErr        = "read %d bytes, too short to decrypt"
 	decryptWithPasswordErr = "cannot decrypt with password: %+v"
@@ -90,21 +100,46 @@ const (
 // Any password saved to local storage is encrypted using the user-provided
 // password.
 //
+// Each profile has its own internal password. On success, the profile becomes
+// the active profile (see [ActiveProfile]) and new indexedDb databases are
+// registered to it.
+//
+// The returned internal password is zeroed when the session is locked. While
+// the session is locked, this returns an error; use [Unlock] instead.
+//
 // Parameters:
 //   - args[0] - The user supplied password (string).
+//   - args[1] - The profile ID (string). Optional; omit to use the default
+//     profile.
 //
 // Returns a promise:
 //   - Internal password (Uint8Array).
 //   - Throws TypeError on failure.
 func GetOrInitPassword(_ js.Value, args []js.Value) any {
 	externalPassword := args[0].String()
+	profile, ls, profileErr := profileArg(args, 1)
 	promiseFn := func(resolve, reject func(args ...any) js.Value) {
-		internalPassword, err := getOrInit(externalPassword)
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		} else if SessionLocked() {
+			reject(exception.NewTrace(errors.New(sessionLockedErr)))
+			return
+		}
+
+		internalPassword, err := getOrInit(externalPassword, ls)
 		if err != nil {
 			reject(exception.NewTrace(err))
-		} else {
-			resolve(utils.CopyBytesToJS(internalPassword))
+			return
 		}
+
+		if err = addProfile(profile, storage.GetLocalStorage()); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		setActiveProfile(profile)
+
+		resolve(session.issue(internalPassword))
 	}
 
 	return utils.CreatePromise(promiseFn)
@@ -112,14 +147,26 @@ func GetOrInitPassword(_ js.Value, args []js.Value) any {
 
 // ChangeExternalPassword allows a user to change their external password.
 //
+// The internal password is not changed; it is re-encrypted with a key derived
+// from the new password. If any step fails, the previously stored password
+// data is restored and the old password remains valid.
+//
 // Parameters:
 //   - args[0] - The user's old password (string).
 //   - args[1] - The user's new password (string).
+//   - args[2] - The profile ID (string). Optional; omit to use the default
+//     profile.
 //
 // Returns:
 //   - Throws TypeError on failure.
 func ChangeExternalPassword(_ js.Value, args []js.Value) any {
-	err := changeExternalPassword(args[0].String(), args[1].String())
+	_, ls, err := profileArg(args, 2)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	err = changeExternalPassword(args[0].String(), args[1].String(), ls)
 	if err != nil {
 		exception.ThrowTrace(err)
 		return nil
@@ -130,22 +177,44 @@ func ChangeExternalPassword(_ js.Value, args []js.Value) any {
 
 // VerifyPassword determines if the user-provided password is correct.
 //
+// Incorrect passwords are counted as failed attempts and, after several
+// failures, further attempts are locked out for an increasing amount of time.
+// While locked out, false is returned without checking the password. See
+// [GetPasswordLockout].
+//
 // Parameters:
 //   - args[0] - The user supplied password (string).
+//   - args[1] - The profile ID (string). Optional; omit to use the default
+//     profile.
 //
 // Returns:
-//   - True if the password is correct and false if it is incorrect (boolean).
+//   - True if the password is correct and false if it is incorrect or the
+//     profile is invalid (boolean).
 func VerifyPassword(_ js.Value, args []js.Value) any {
-	return verifyPassword(args[0].String())
+	_, ls, err := profileArg(args, 1)
+	if err != nil {
+		return false
+	}
+
+	return verifyPassword(args[0].String(), ls)
 }
 
 // getOrInit is the private function for GetOrInitPassword that is used for
 // testing.
-func getOrInit(externalPassword string) ([]byte, error) {
-	localStorage := storage.GetLocalStorage()
-	internalPassword, err := getInternalPassword(externalPassword, localStorage)
+func getOrInit(
+	externalPassword string, localStorage storage.LocalStorage) ([]byte, error) {
+	internalPassword, err :=
+		getInternalPasswordLimited(externalPassword, localStorage)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
+			// Do not replace an internal password that can be unlocked by
+			// another key provider
+			if enrolled, err2 := hasEnrollments(localStorage); err2 != nil {
+				return nil, err2
+			} else if enrolled {
+				return nil, errors.New(noPasswordEnrolledErr)
+			}
+
 			rng := csprng.NewSystemRNG()
 			return initInternalPassword(
 				externalPassword, localStorage, rng, defaultParams())
@@ -154,46 +223,139 @@ func getOrInit(externalPassword string) ([]byte, error) {
 		return nil, err
 	}
 
+	upgradeParams(internalPassword, externalPassword, localStorage,
+		csprng.NewSystemRNG(), defaultParams())
+
 	return internalPassword, nil
 }
 
 // changeExternalPassword is the private function for ChangeExternalPassword
 // that is used for testing.
-func changeExternalPassword(oldExternalPassword, newExternalPassword string) error {
-	// NOTE: the following no longer works in synchronized environments, so
-	// disabled in produciton.
-	jww.FATAL.Panicf("cannot change password, unimplemented")
-	localStorage := storage.GetLocalStorage()
-	internalPassword, err := getInternalPassword(
-		oldExternalPassword, localStorage)
+func changeExternalPassword(oldExternalPassword, newExternalPassword string,
+	localStorage storage.LocalStorage) error {
+	internalPassword, err :=
+		getInternalPasswordLimited(oldExternalPassword, localStorage)
 	if err != nil {
 		return err
 	}
 
-	salt, err := makeSalt(csprng.NewSystemRNG())
+	return rewrapInternalPassword(internalPassword, newExternalPassword,
+		localStorage, csprng.NewSystemRNG(), defaultParams())
+}
+
+// rewrapInternalPassword encrypts the internal password with a key derived
+// from the new external password using a fresh salt and the given parameters.
+//
+// The salt, parameters, and encrypted internal password are replaced together.
+// If any write fails or the new values cannot be used to decrypt the internal
+// password, the values that were in storage before the call are restored.
+func rewrapInternalPassword(internalPassword []byte, newExternalPassword string,
+	localStorage storage.LocalStorage, csprng io.Reader,
+	params argonParams) error {
+	// Generate all new values before touching storage
+	salt, err := makeSalt(csprng)
 	if err != nil {
 		return err
 	}
-	if err = localStorage.Set(saltKey, salt); err != nil {
-		return errors.Wrapf(err, "localStorage: failed to set %q", saltKey)
+
+	paramsData, err := json.Marshal(params)
+	if err != nil {
+		return err
 	}
 
-	key := deriveKey(newExternalPassword, salt, defaultParams())
+	key := deriveKey(newExternalPassword, salt, params)
+	encryptedInternalPassword := encryptPassword(internalPassword, key, csprng)
 
-	encryptedInternalPassword := encryptPassword(
-		internalPassword, key, csprng.NewSystemRNG())
-	if err = localStorage.Set(passwordKey, encryptedInternalPassword); err != nil {
-		return errors.Wrapf(err, "localStorage: failed to set %q", passwordKey)
+	// Save the current values so that they can be restored on failure
+	backup, err := backupPasswordEntries(localStorage)
+	if err != nil {
+		return err
+	}
+
+	entries := []struct {
+		key   string
+		value []byte
+	}{
+		{saltKey, salt},
+		{argonParamsKey, paramsData},
+		{passwordKey, encryptedInternalPassword},
+	}
+	for _, e := range entries {
+		if err = localStorage.Set(e.key, e.value); err != nil {
+			err = errors.Wrapf(err, "localStorage: failed to set %q", e.key)
+			return restorePasswordEntries(backup, localStorage, err)
+		}
+	}
+
+	// Confirm the new entries decrypt to the same internal password
+	loaded, err := getInternalPassword(newExternalPassword, localStorage)
+	if err != nil {
+		return restorePasswordEntries(backup, localStorage, err)
+	} else if !bytes.Equal(loaded, internalPassword) {
+		return restorePasswordEntries(
+			backup, localStorage, errors.New(rewrapMismatchErr))
 	}
 
 	return nil
 }
 
+// backupPasswordEntries returns the current value of each local storage entry
+// used to store the encrypted internal password. Entries that do not exist are
+// set to nil.
+func backupPasswordEntries(
+	localStorage storage.LocalStorage) (map[string][]byte, error) {
+	backup := make(map[string][]byte, 3)
+	for _, key := range []string{saltKey, argonParamsKey, passwordKey} {
+		value, err := localStorage.Get(key)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, errors.Errorf(backupEntryErr, key, err)
+			}
+			value = nil
+		}
+		backup[key] = value
+	}
+
+	return backup, nil
+}
+
+// restorePasswordEntries writes the backed up entries back to local storage.
+// Entries that did not exist in the backup are removed. It returns the cause
+// of the rollback or, if an entry could not be restored, an error containing
+// both.
+func restorePasswordEntries(backup map[string][]byte,
+	localStorage storage.LocalStorage, cause error) error {
+	jww.ERROR.Printf("Failed to re-encrypt internal password, restoring "+
+		"previous password entries: %+v", cause)
+	var restoreErr error
+	for key, value := range backup {
+		if value == nil {
+			localStorage.RemoveItem(key)
+		} else if err := localStorage.Set(key, value); err != nil {
+			restoreErr = errors.Errorf(restoreEntryErr, key, err, cause)
+		}
+	}
+
+	if restoreErr != nil {
+		return restoreErr
+	}
+	return cause
+}
+
 // verifyPassword is the private function for VerifyPassword that is used for
 // testing.
-func verifyPassword(externalPassword string) bool {
-	_, err := getInternalPassword(externalPassword, storage.GetLocalStorage())
-	return err == nil
+func verifyPassword(
+	externalPassword string, localStorage storage.LocalStorage) bool {
+	internalPassword, err :=
+		getInternalPasswordLimited(externalPassword, localStorage)
+	if err != nil {
+		return false
+	}
+
+	upgradeParams(internalPassword, externalPassword, localStorage,
+		csprng.NewSystemRNG(), defaultParams())
+
+	return true
 }
 
 // initInternalPassword generates a new internal password, stores an encrypted
@@ -255,36 +417,71 @@ func initInternalPassword(externalPassword string,
 // decrypts it, and returns it.
 func getInternalPassword(
 	externalPassword string, localStorage storage.LocalStorage) ([]byte, error) {
+	e, err := loadPasswordEnrollment(localStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptedInternalPassword, err :=
+		e.unwrap(newPasswordKeyProvider(externalPassword, defaultParams()))
+	if err != nil {
+		return nil, errors.Errorf(decryptPasswordErr, err)
+	}
+
+	return decryptedInternalPassword, nil
+}
+
+// loadPasswordEnrollment loads the salt, Argon2 parameters, and encrypted
+// internal password from local storage and returns them as the KeyEnrollment
+// for the passwordKeyProvider.
+func loadPasswordEnrollment(
+	localStorage storage.LocalStorage) (KeyEnrollment, error) {
 	encryptedInternalPassword, err := localStorage.Get(passwordKey)
 	if err != nil {
-		return nil, errors.WithMessage(err, getPasswordStorageErr)
+		return KeyEnrollment{}, errors.WithMessage(err, getPasswordStorageErr)
 	}
 
 	salt, err := localStorage.Get(saltKey)
 	if err != nil {
-		return nil, errors.WithMessage(err, getSaltStorageErr)
+		return KeyEnrollment{}, errors.WithMessage(err, getSaltStorageErr)
 	}
 
-	paramsData, err := localStorage.Get(argonParamsKey)
+	params, err := loadParams(localStorage)
 	if err != nil {
-		return nil, errors.WithMessage(err, getParamsStorageErr)
+		return KeyEnrollment{}, err
 	}
 
-	var params argonParams
-	err = json.Unmarshal(paramsData, &params)
+	providerParams, err :=
+		json.Marshal(passwordProviderParams{Salt: salt, Argon: params})
 	if err != nil {
-		return nil, errors.Errorf(paramsUnmarshalErr, err)
+		return KeyEnrollment{}, err
 	}
 
-	key := deriveKey(externalPassword, salt, params)
+	return KeyEnrollment{
+		KeyEnrollmentInfo: KeyEnrollmentInfo{
+			ID:   passwordEnrollmentID,
+			Type: PasswordKeyProviderType,
+		},
+		Params:  providerParams,
+		Wrapped: encryptedInternalPassword,
+	}, nil
+}
 
-	decryptedInternalPassword, err :=
-		decryptPassword(encryptedInternalPassword, key)
+// loadParams loads the Argon2 parameters used to encrypt the internal password
+// from local storage.
+func loadParams(localStorage storage.LocalStorage) (argonParams, error) {
+	paramsData, err := localStorage.Get(argonParamsKey)
 	if err != nil {
-		return nil, errors.Errorf(decryptPasswordErr, err)
+		return argonParams{}, errors.WithMessage(err, getParamsStorageErr)
 	}
 
-	return decryptedInternalPassword, nil
+	var params argonParams
+	err = json.Unmarshal(paramsData, &params)
+	if err != nil {
+		return argonParams{}, errors.Errorf(paramsUnmarshalErr, err)
+	}
+
+	return params, nil
 }
 
 // encryptPassword encrypts the data for a shared URL using XChaCha20-Poly1305.
@@ -342,6 +539,23 @@ func defaultParams() argonParams {
 	}
 }
 
+// weakerThan returns true if the time cost, memory cost, or number of threads
+// of p is lower than that of target.
+func (p argonParams) weakerThan(target argonParams) bool {
+	return p.Time < target.Time || p.Memory < target.Memory ||
+		p.Threads < target.Threads
+}
+
+// atLeast returns the parameters with each field set to the greater of p and
+// target, so that no cost is lowered.
+func (p argonParams) atLeast(target argonParams) argonParams {
+	return argonParams{
+		Time:    max(p.Time, target.Time),
+		Memory:  max(p.Memory, target.Memory),
+		Threads: max(p.Threads, target.Threads),
+	}
+}
+
 // deriveKey derives a key from a user supplied password and a salt via the
 // Argon2 algorithm.
 func deriveKey(password string, salt []byte, params argonParams) []byte {
@@ -0,0 +1,407 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"syscall/js"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// Storage keys.
+const (
+	// passwordAttemptsKey is the key used to store the passwordAttempts.
+	passwordAttemptsKey = "xxPasswordAttempts"
+
+	// passwordWipePolicyKey is the key used to store the number of failed
+	// attempts after which all storage is wiped.
+	passwordWipePolicyKey = "xxPasswordWipePolicy"
+)
+
+// Back-off parameters.
+const (
+	// freeAttempts is the number of failed attempts allowed before the
+	// lockout begins.
+	freeAttempts = 3
+
+	// baseLockout is the lockout after the first failure past freeAttempts. It
+	// doubles on every subsequent failure.
+	baseLockout = time.Second
+
+	// maxLockout is the longest lockout.
+	maxLockout = time.Hour
+
+	// maxWipeAfter is the largest number of failed attempts accepted for the
+	// wipe policy.
+	maxWipeAfter = 1_000_000
+)
+
+// Error messages.
+const (
+	// checkLockout
+	lockedOutErr = "too many failed password attempts; try again in %s"
+
+	// setWipePolicy
+	invalidPasswordErr = "invalid password"
+
+	// parseWipeAfter
+	invalidWipeAfterErr = "number of failed attempts must be a whole number " +
+		"from 0 to %d: %s"
+
+	// getInternalPasswordLimited
+	wipeDeferredErr = "wipe policy reached but storage was not wiped; it " +
+		"is wiped on the next failed attempt after all cMix followers stop"
+)
+
+// passwordAttempts records failed password attempts in local storage so that
+// they persist across page reloads.
+type passwordAttempts struct {
+	Failures    uint      `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// PasswordLockoutStatus is JSON marshalled and returned by
+// [GetPasswordLockout].
+//
+// Example JSON:
+//
+//	{
+//	  "failures": 5,
+//	  "remainingMS": 3512,
+//	  "wipeAfter": 10
+//	}
+type PasswordLockoutStatus struct {
+	// Failures is the number of consecutive failed attempts.
+	Failures uint `json:"failures"`
+
+	// RemainingMS is the number of milliseconds until the next attempt is
+	// allowed. It is zero if an attempt is currently allowed.
+	RemainingMS int64 `json:"remainingMS"`
+
+	// WipeAfter is the number of consecutive failed attempts after which all
+	// storage is wiped. It is zero if the wipe policy is disabled.
+	WipeAfter uint `json:"wipeAfter"`
+}
+
+// GetPasswordLockout returns the number of failed password attempts and the
+// time remaining until another attempt is allowed.
+//
+// Failed attempts made with every function that takes the user-supplied
+// password are counted, including [VerifyPassword], [GetOrInitPassword],
+// [ChangeExternalPassword], [GenerateRecoveryKey], [UnlockWithKeyProvider],
+// [Purge], and [PurgeIdentity]. After three consecutive failures, each
+// further failure locks out password attempts for twice as long as the last,
+// starting at one second and up to one hour. A successful attempt resets the
+// count. Each profile counts its failures separately.
+//
+// Parameters:
+//   - args[0] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns:
+//   - JSON of [PasswordLockoutStatus] (Uint8Array).
+//   - Throws an error if the profile is invalid or the status cannot be
+//     loaded.
+func GetPasswordLockout(_ js.Value, args []js.Value) any {
+	_, ls, err := profileArg(args, 0)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	attempts, err := loadPasswordAttempts(ls)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+	wipeAfter, err := loadWipePolicy(ls)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	status := PasswordLockoutStatus{
+		Failures:    attempts.Failures,
+		RemainingMS: attempts.remaining(time.Now()).Milliseconds(),
+		WipeAfter:   wipeAfter,
+	}
+
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return utils.CopyBytesToJS(statusJSON)
+}
+
+// SetPasswordWipePolicy sets the number of consecutive failed password
+// attempts after which all local storage and indexedDb databases of the
+// profile are wiped, as with [Purge]. The policy persists across page reloads.
+//
+// Parameters:
+//   - args[0] - The user-supplied password (string).
+//   - args[1] - The number of failed attempts that triggers the wipe. Set to 0
+//     to disable wiping (number).
+//   - args[2] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns:
+//   - Throws an error if the number of attempts is negative or not a whole
+//     number, the password is incorrect, or the policy cannot be saved.
+func SetPasswordWipePolicy(_ js.Value, args []js.Value) any {
+	_, ls, err := profileArg(args, 2)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	wipeAfter, err := parseWipeAfter(args[1])
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	err = setWipePolicy(args[0].String(), wipeAfter, ls)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return nil
+}
+
+// parseWipeAfter returns the number of failed attempts of the wipe policy
+// passed from Javascript. Returns an error if it is not a whole number from 0
+// to maxWipeAfter.
+func parseWipeAfter(value js.Value) (uint, error) {
+	if value.Type() != js.TypeNumber {
+		return 0, errors.Errorf(invalidWipeAfterErr, maxWipeAfter, value)
+	}
+	wipeAfter := value.Float()
+	if wipeAfter < 0 || wipeAfter > maxWipeAfter ||
+		wipeAfter != math.Trunc(wipeAfter) {
+		return 0, errors.Errorf(invalidWipeAfterErr, maxWipeAfter, value)
+	}
+	return uint(wipeAfter), nil
+}
+
+// setWipePolicy is the private function for SetPasswordWipePolicy that is used
+// for testing.
+func setWipePolicy(
+	externalPassword string, wipeAfter uint, ls storage.LocalStorage) error {
+	if !verifyPassword(externalPassword, ls) {
+		return errors.New(invalidPasswordErr)
+	}
+
+	data, err := json.Marshal(wipeAfter)
+	if err != nil {
+		return err
+	}
+
+	if err = ls.Set(passwordWipePolicyKey, data); err != nil {
+		return errors.Wrapf(
+			err, "localStorage: failed to set %q", passwordWipePolicyKey)
+	}
+
+	return nil
+}
+
+// getInternalPasswordLimited wraps getInternalPassword with brute-force
+// protection. It returns an error without trying the password if attempts are
+// locked out. An incorrect password is recorded as a failed attempt, which can
+// trigger the wipe policy, which purges the profile of the local storage.
+// Errors loading the stored password are not counted.
+//
+// As with Purge, the profile is not wiped while cMix followers are running.
+// The failure is still counted and the returned error says so, so the wipe
+// happens on the next failed attempt after they stop.
+func getInternalPasswordLimited(externalPassword string,
+	ls storage.LocalStorage) ([]byte, error) {
+	now := time.Now()
+	if err := checkLockout(ls, now); err != nil {
+		return nil, err
+	}
+
+	// Missing or corrupt password entries are not a failed attempt
+	if _, err := loadPasswordEnrollment(ls); err != nil {
+		return nil, err
+	}
+
+	internalPassword, err := getInternalPassword(externalPassword, ls)
+	if err != nil {
+		wipe := func() error {
+			if err2 := checkClientsStopped(); err2 != nil {
+				return errors.Wrap(err2, wipeDeferredErr)
+			}
+			return purgeProfile(ls)
+		}
+		if err2 := recordFailedAttempt(ls, now, wipe); err2 != nil {
+			jww.ERROR.Printf(
+				"Failed to record failed password attempt: %+v", err2)
+			return nil, errors.WithMessage(err, err2.Error())
+		}
+		return nil, err
+	}
+
+	if err = resetPasswordAttempts(ls); err != nil {
+		jww.ERROR.Printf("Failed to reset password attempts: %+v", err)
+	}
+
+	return internalPassword, nil
+}
+
+// checkLockout returns an error if password attempts are locked out.
+func checkLockout(ls storage.LocalStorage, now time.Time) error {
+	attempts, err := loadPasswordAttempts(ls)
+	if err != nil {
+		return err
+	}
+
+	if remaining := attempts.remaining(now); remaining > 0 {
+		return errors.Errorf(lockedOutErr, remaining.Round(time.Second))
+	}
+
+	return nil
+}
+
+// recordFailedAttempt increments the failure count and sets the lockout. If the
+// wipe policy is reached, wipe is called. If wipe fails, the failure is still
+// recorded so that the wipe is tried again on the next failure.
+func recordFailedAttempt(ls storage.LocalStorage, now time.Time,
+	wipe func() error) error {
+	attempts, err := loadPasswordAttempts(ls)
+	if err != nil {
+		return err
+	}
+	wipeAfter, err := loadWipePolicy(ls)
+	if err != nil {
+		return err
+	}
+
+	attempts.Failures++
+	attempts.LastFailure = now
+	attempts.LockedUntil = now.Add(lockoutDuration(attempts.Failures))
+
+	if wipeAfter > 0 && attempts.Failures >= wipeAfter {
+		jww.WARN.Printf("%d failed password attempts; wiping all storage",
+			attempts.Failures)
+		if err = wipe(); err == nil {
+			return nil
+		}
+		if err2 := storePasswordAttempts(attempts, ls); err2 != nil {
+			return errors.Wrapf(err, "failed to store attempts: %+v", err2)
+		}
+		return err
+	}
+
+	return storePasswordAttempts(attempts, ls)
+}
+
+// resetPasswordAttempts deletes the record of failed attempts.
+func resetPasswordAttempts(ls storage.LocalStorage) error {
+	attempts, err := loadPasswordAttempts(ls)
+	if err != nil {
+		return err
+	} else if attempts.Failures > 0 {
+		ls.RemoveItem(passwordAttemptsKey)
+	}
+	return nil
+}
+
+// lockoutDuration returns the lockout after the given number of consecutive
+// failures.
+func lockoutDuration(failures uint) time.Duration {
+	if failures < freeAttempts {
+		return 0
+	}
+
+	lockout := baseLockout
+	for i := uint(freeAttempts); i < failures; i++ {
+		lockout *= 2
+		if lockout >= maxLockout {
+			return maxLockout
+		}
+	}
+
+	return lockout
+}
+
+// remaining returns the time until the lockout ends.
+func (pa passwordAttempts) remaining(now time.Time) time.Duration {
+	if remaining := pa.LockedUntil.Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// loadPasswordAttempts loads the passwordAttempts from local storage. Returns
+// an empty passwordAttempts if none are saved.
+func loadPasswordAttempts(ls storage.LocalStorage) (passwordAttempts, error) {
+	var attempts passwordAttempts
+	data, err := ls.Get(passwordAttemptsKey)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return attempts, nil
+		}
+		return attempts, err
+	}
+
+	if err = json.Unmarshal(data, &attempts); err != nil {
+		return attempts, errors.Wrap(err, "failed to unmarshal password attempts")
+	}
+
+	return attempts, nil
+}
+
+// storePasswordAttempts saves the passwordAttempts to local storage.
+func storePasswordAttempts(
+	attempts passwordAttempts, ls storage.LocalStorage) error {
+	data, err := json.Marshal(attempts)
+	if err != nil {
+		return err
+	}
+
+	if err = ls.Set(passwordAttemptsKey, data); err != nil {
+		return errors.Wrapf(
+			err, "localStorage: failed to set %q", passwordAttemptsKey)
+	}
+
+	return nil
+}
+
+// loadWipePolicy loads the number of failed attempts after which storage is
+// wiped. Returns 0 if no policy is set.
+func loadWipePolicy(ls storage.LocalStorage) (uint, error) {
+	data, err := ls.Get(passwordWipePolicyKey)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var wipeAfter uint
+	if err = json.Unmarshal(data, &wipeAfter); err != nil {
+		return 0, errors.Wrap(err, "failed to unmarshal password wipe policy")
+	}
+
+	return wipeAfter, nil
+}
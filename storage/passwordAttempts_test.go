@@ -0,0 +1,258 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"math"
+	"strings"
+	"syscall/js"
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that getInternalPasswordLimited locks out attempts after too many
+// failures, even with the correct password, and that a success after the
+// lockout resets the count.
+func Test_getInternalPasswordLimited_Lockout(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for i := 0; i < freeAttempts; i++ {
+		if _, err = getInternalPasswordLimited("wrong", ls); err == nil {
+			t.Fatalf("No error for incorrect password (%d).", i)
+		}
+	}
+
+	expectedErr := strings.Split(lockedOutErr, "%")[0]
+	_, err = getInternalPasswordLimited("myPassword", ls)
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error while locked out."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	// Expire the lockout
+	attempts, err := loadPasswordAttempts(ls)
+	if err != nil {
+		t.Fatalf("Failed to load attempts: %+v", err)
+	} else if attempts.Failures != freeAttempts {
+		t.Errorf("Unexpected number of failures."+
+			"\nexpected: %d\nreceived: %d", freeAttempts, attempts.Failures)
+	}
+	attempts.LockedUntil = time.Now().Add(-time.Second)
+	if err = storePasswordAttempts(attempts, ls); err != nil {
+		t.Fatalf("Failed to store attempts: %+v", err)
+	}
+
+	if _, err = getInternalPasswordLimited("myPassword", ls); err != nil {
+		t.Fatalf("Failed to get password after lockout: %+v", err)
+	}
+
+	attempts, err = loadPasswordAttempts(ls)
+	if err != nil {
+		t.Fatalf("Failed to load attempts: %+v", err)
+	} else if attempts.Failures != 0 {
+		t.Errorf("Failures not reset after success: %d", attempts.Failures)
+	}
+}
+
+// Tests that changeExternalPassword, unlockWithKeyProvider with a password, and
+// generateRecoveryKey count failed attempts and are locked out after the free
+// attempts, even with the correct password.
+func Test_passwordFunctions_Lockout(t *testing.T) {
+	tests := map[string]func(password string, ls storage.LocalStorage) error{
+		"changeExternalPassword": func(
+			password string, ls storage.LocalStorage) error {
+			return changeExternalPassword(password, "newPassword", ls)
+		},
+		"unlockWithKeyProvider": func(
+			password string, ls storage.LocalStorage) error {
+			kp := newPasswordKeyProvider(password, testParams())
+			_, err := unlockWithKeyProvider(kp, ls)
+			return err
+		},
+		"generateRecoveryKey": func(
+			password string, ls storage.LocalStorage) error {
+			_, err := generateRecoveryKey(password, ls, csprng.NewSystemRNG())
+			return err
+		},
+	}
+
+	expectedErr := strings.Split(lockedOutErr, "%")[0]
+	for name, fn := range tests {
+		ls := storage.GetLocalStorage()
+		ls.Clear()
+		_, err := initInternalPassword(
+			"myPassword", ls, csprng.NewSystemRNG(), testParams())
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		for i := 0; i < freeAttempts; i++ {
+			if err = fn("wrong", ls); err == nil {
+				t.Fatalf("No error for incorrect password with %s (%d).",
+					name, i)
+			}
+		}
+
+		err = fn("myPassword", ls)
+		if err == nil || !strings.Contains(err.Error(), expectedErr) {
+			t.Errorf("Unexpected error while locked out with %s."+
+				"\nexpected: %s\nreceived: %+v", name, expectedErr, err)
+		}
+	}
+}
+
+// Tests that getInternalPasswordLimited does not wipe storage when the wipe
+// policy is reached while a cMix follower is running, and that it wipes on the
+// next failure after the follower stops.
+func Test_getInternalPasswordLimited_WipeClientsRunning(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err = setWipePolicy("myPassword", 1, ls); err != nil {
+		t.Fatalf("Failed to set wipe policy: %+v", err)
+	}
+
+	IncrementNumClientsRunning()
+	_, err = getInternalPasswordLimited("wrong", ls)
+	DecrementNumClientsRunning()
+	if err == nil || !strings.Contains(err.Error(), wipeDeferredErr) {
+		t.Errorf("Unexpected error with cMix follower running."+
+			"\nexpected: %s\nreceived: %+v", wipeDeferredErr, err)
+	}
+	if _, err = loadPasswordEnrollment(ls); err != nil {
+		t.Fatalf("Storage wiped while cMix follower running: %+v", err)
+	}
+
+	// Expire the lockout
+	attempts, err := loadPasswordAttempts(ls)
+	if err != nil {
+		t.Fatalf("Failed to load attempts: %+v", err)
+	} else if attempts.Failures != 1 {
+		t.Errorf("Failure not recorded: %d", attempts.Failures)
+	}
+	attempts.LockedUntil = time.Now().Add(-time.Second)
+	if err = storePasswordAttempts(attempts, ls); err != nil {
+		t.Fatalf("Failed to store attempts: %+v", err)
+	}
+
+	if _, err = getInternalPasswordLimited("wrong", ls); err == nil {
+		t.Errorf("No error for incorrect password.")
+	}
+	if _, err = loadPasswordEnrollment(ls); err == nil {
+		t.Errorf("Storage not wiped after cMix follower stopped.")
+	}
+}
+
+// Tests that recordFailedAttempt calls the wipe function once the wipe policy
+// is reached.
+func Test_recordFailedAttempt_Wipe(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err = setWipePolicy("myPassword", 2, ls); err != nil {
+		t.Fatalf("Failed to set wipe policy: %+v", err)
+	}
+
+	var wiped bool
+	wipe := func() error { wiped = true; return nil }
+
+	if err = recordFailedAttempt(ls, time.Now(), wipe); err != nil {
+		t.Fatalf("Failed to record attempt: %+v", err)
+	} else if wiped {
+		t.Errorf("Wiped after first failure.")
+	}
+
+	if err = recordFailedAttempt(ls, time.Now(), wipe); err != nil {
+		t.Fatalf("Failed to record attempt: %+v", err)
+	} else if !wiped {
+		t.Errorf("Did not wipe after reaching policy.")
+	}
+}
+
+// Error path: Tests that setWipePolicy returns an error for an incorrect
+// password and does not save the policy.
+func Test_setWipePolicy_InvalidPassword(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	err = setWipePolicy("wrong", 1, ls)
+	if err == nil || err.Error() != invalidPasswordErr {
+		t.Errorf("Unexpected error for incorrect password."+
+			"\nexpected: %s\nreceived: %+v", invalidPasswordErr, err)
+	}
+
+	if wipeAfter, err := loadWipePolicy(ls); err != nil || wipeAfter != 0 {
+		t.Errorf("Policy saved with incorrect password: %d, %+v",
+			wipeAfter, err)
+	}
+}
+
+// Tests that parseWipeAfter accepts whole numbers from 0 to maxWipeAfter and
+// rejects negative, fractional, too large, and non-number values.
+func Test_parseWipeAfter(t *testing.T) {
+	for _, n := range []float64{0, 1, 10, maxWipeAfter} {
+		wipeAfter, err := parseWipeAfter(js.ValueOf(n))
+		if err != nil {
+			t.Errorf("Failed to parse %v: %+v", n, err)
+		} else if wipeAfter != uint(n) {
+			t.Errorf("Unexpected policy.\nexpected: %v\nreceived: %d",
+				n, wipeAfter)
+		}
+	}
+
+	for _, v := range []any{-1, -0.5, 1.5, maxWipeAfter + 1, math.NaN(),
+		math.Inf(1), "5", nil} {
+		if _, err := parseWipeAfter(js.ValueOf(v)); err == nil {
+			t.Errorf("Did not get error for invalid policy %v.", v)
+		}
+	}
+}
+
+// Tests that lockoutDuration doubles after the free attempts and is capped at
+// maxLockout.
+func Test_lockoutDuration(t *testing.T) {
+	tests := map[uint]time.Duration{
+		0:                 0,
+		freeAttempts - 1:  0,
+		freeAttempts:      baseLockout,
+		freeAttempts + 1:  2 * baseLockout,
+		freeAttempts + 3:  8 * baseLockout,
+		freeAttempts + 50: maxLockout,
+	}
+
+	for failures, expected := range tests {
+		if d := lockoutDuration(failures); d != expected {
+			t.Errorf("Unexpected lockout for %d failures."+
+				"\nexpected: %s\nreceived: %s", failures, expected, d)
+		}
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
+
 	"gitlab.com/elixxir/wasm-utils/storage"
 	"gitlab.com/xx_network/crypto/csprng"
 )
@@ -24,13 +26,14 @@ import (
 // Tests that running getOrInit twice returns the same internal password both
 // times.
 func Test_getOrInit(t *testing.T) {
+	ls := storage.GetLocalStorage()
 	externalPassword := "myPassword"
-	internalPassword, err := getOrInit(externalPassword)
+	internalPassword, err := getOrInit(externalPassword, ls)
 	if err != nil {
 		t.Errorf("%+v", err)
 	}
 
-	loadedInternalPassword, err := getOrInit(externalPassword)
+	loadedInternalPassword, err := getOrInit(externalPassword, ls)
 	if err != nil {
 		t.Errorf("%+v", err)
 	}
@@ -44,53 +47,123 @@ func Test_getOrInit(t *testing.T) {
 
 // Tests that changeExternalPassword correctly changes the password and updates
 // the encryption.
-// func Test_changeExternalPassword(t *testing.T) {
-// 	oldExternalPassword := "myPassword"
-// 	newExternalPassword := "hunter2"
-// 	oldInternalPassword, err := getOrInit(oldExternalPassword)
-// 	if err != nil {
-// 		t.Errorf("%+v", err)
-// 	}
+func Test_changeExternalPassword(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	oldExternalPassword := "myPassword"
+	newExternalPassword := "hunter2"
+	oldInternalPassword, err := getOrInit(oldExternalPassword, ls)
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
 
-// 	err = changeExternalPassword(oldExternalPassword, newExternalPassword)
-// 	if err != nil {
-// 		t.Errorf("%+v", err)
-// 	}
+	err = changeExternalPassword(
+		oldExternalPassword, newExternalPassword, ls)
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
 
-// 	newInternalPassword, err := getOrInit(newExternalPassword)
-// 	if err != nil {
-// 		t.Errorf("%+v", err)
-// 	}
+	newInternalPassword, err := getOrInit(newExternalPassword, ls)
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
 
-// 	if !bytes.Equal(oldInternalPassword, newInternalPassword) {
-// 		t.Errorf("Internal password was not changed in storage. Old and new "+
-// 			"should be different.\nold: %+v\nnew: %+v",
-// 			oldInternalPassword, newInternalPassword)
-// 	}
+	if !bytes.Equal(oldInternalPassword, newInternalPassword) {
+		t.Errorf("Internal password changed in storage. Old and new should "+
+			"be the same.\nold: %+v\nnew: %+v",
+			oldInternalPassword, newInternalPassword)
+	}
 
-// 	_, err = getOrInit(oldExternalPassword)
-// 	expectedErr := strings.Split(decryptWithPasswordErr, "%")[0]
-// 	if err == nil || !strings.Contains(err.Error(), expectedErr) {
-// 		t.Errorf("Unexpected error when trying to get internal password with "+
-// 			"old external password.\nexpected: %s\nreceived: %+v", expectedErr, err)
-// 	}
-// }
+	if verifyPassword(oldExternalPassword, ls) {
+		t.Errorf("Old password %q still decrypts the internal password.",
+			oldExternalPassword)
+	}
+}
+
+// Tests that changeExternalPassword returns an error for an incorrect old
+// password and leaves storage unchanged.
+func Test_changeExternalPassword_InvalidPassword(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	externalPassword := "myPassword"
+	if _, err := getOrInit(externalPassword, ls); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	expectedErr := strings.Split(decryptPasswordErr, "%")[0]
+	err := changeExternalPassword("wrong password", "hunter2", ls)
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for incorrect password."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	if !verifyPassword(externalPassword, ls) {
+		t.Errorf("Password %q no longer valid.", externalPassword)
+	}
+}
+
+// Tests that rewrapInternalPassword restores the salt, parameters, and
+// encrypted internal password when one of the writes fails.
+func Test_rewrapInternalPassword_Rollback(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	externalPassword := "myPassword"
+	internalPassword, err := initInternalPassword(
+		externalPassword, ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	backup, err := backupPasswordEntries(ls)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for _, key := range []string{saltKey, argonParamsKey, passwordKey} {
+		fls := &failingLocalStorage{ls, key}
+		err = rewrapInternalPassword(internalPassword, "hunter2", fls,
+			csprng.NewSystemRNG(), testParams())
+		if err == nil {
+			t.Errorf("No error when setting %q fails.", key)
+		}
+
+		for k, expected := range backup {
+			value, err2 := ls.Get(k)
+			if err2 != nil {
+				t.Errorf("Failed to get %q: %+v", k, err2)
+			} else if !bytes.Equal(expected, value) {
+				t.Errorf("%q not restored after failure setting %q."+
+					"\nexpected: %v\nreceived: %v", k, key, expected, value)
+			}
+		}
+
+		loaded, err := getInternalPassword(externalPassword, ls)
+		if err != nil {
+			t.Errorf("Failed to get internal password after failure setting "+
+				"%q: %+v", key, err)
+		} else if !bytes.Equal(internalPassword, loaded) {
+			t.Errorf("Internal password changed after failure setting %q."+
+				"\nexpected: %v\nreceived: %v", key, internalPassword, loaded)
+		}
+	}
+}
 
 // Tests that verifyPassword returns true for a valid password and false for an
 // invalid password
 func Test_verifyPassword(t *testing.T) {
-	storage.GetLocalStorage().Clear()
+	ls := storage.GetLocalStorage()
+	ls.Clear()
 	externalPassword := "myPassword"
 
-	if _, err := getOrInit(externalPassword); err != nil {
+	if _, err := getOrInit(externalPassword, ls); err != nil {
 		t.Errorf("%+v", err)
 	}
 
-	if !verifyPassword(externalPassword) {
+	if !verifyPassword(externalPassword, ls) {
 		t.Errorf("Password %q is incorrect.", externalPassword)
 	}
 
-	if verifyPassword("wrong password") {
+	if verifyPassword("wrong password", ls) {
 		t.Error("Incorrect password found to be correct.")
 	}
 }
@@ -386,6 +459,20 @@ func Test_makeSalt_ReadNumBytesError(t *testing.T) {
 	}
 }
 
+// failingLocalStorage wraps a storage.LocalStorage and returns an error when
+// setting the key failKey.
+type failingLocalStorage struct {
+	storage.LocalStorage
+	failKey string
+}
+
+func (fls *failingLocalStorage) Set(key string, value []byte) error {
+	if key == fls.failKey {
+		return errors.Errorf("failed to set %q", key)
+	}
+	return fls.LocalStorage.Set(key, value)
+}
+
 // testParams returns params used in testing that are quick.
 func testParams() argonParams {
 	return argonParams{
@@ -0,0 +1,339 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// DefaultProfile is the ID of the profile used when no profile is specified.
+// Its keys are stored without a namespace so that data saved before profiles
+// existed belongs to it.
+const DefaultProfile = ""
+
+// Storage keys.
+const (
+	// profileKeyPrefix prefixes the namespace of every non-default profile.
+	// The keys of profile "alice" are saved under "xxProfile/alice/".
+	profileKeyPrefix = "xxProfile/"
+
+	// profileListKey is the key used to store the map of non-default profile
+	// IDs to their ProfileInfo. It does not belong to any profile.
+	profileListKey = "xxProfileList"
+)
+
+// Error messages.
+const (
+	// getProfileStorage
+	invalidProfileIDErr = "invalid profile ID %q: must be 1 to 64 letters, " +
+		"digits, hyphens, or underscores"
+)
+
+// profileIDRegex matches a valid non-default profile ID.
+var profileIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ProfileInfo describes a password-protected profile. Each profile has its own
+// password, version state, and database registry.
+//
+// Example JSON:
+//
+//	{
+//	  "id": "work",
+//	  "created": "2023-05-12T15:03:42.197Z"
+//	}
+type ProfileInfo struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+// ListProfiles returns every profile that has a password, sorted by ID. The
+// default profile has an empty ID.
+//
+// Returns:
+//   - JSON of an array of [ProfileInfo] (Uint8Array).
+//   - Throws an error if the list cannot be loaded.
+func ListProfiles(js.Value, []js.Value) any {
+	list, err := listProfiles(storage.GetLocalStorage())
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	listJSON, err := json.Marshal(list)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return utils.CopyBytesToJS(listJSON)
+}
+
+// activeProfile is the profile whose internal password was last returned to
+// Javascript. Databases opened by the workers are registered to it.
+var activeProfile struct {
+	id string
+	sync.Mutex
+}
+
+// ActiveProfile returns the ID of the profile that was last unlocked with
+// [GetOrInitPassword], [UnlockWithKeyProvider], or [UnlockWithRecoveryKey].
+// Returns [DefaultProfile] if no profile has been unlocked.
+func ActiveProfile() string {
+	activeProfile.Lock()
+	defer activeProfile.Unlock()
+	return activeProfile.id
+}
+
+// setActiveProfile sets the profile used by storage functions that are not
+// given a profile.
+func setActiveProfile(profile string) {
+	activeProfile.Lock()
+	defer activeProfile.Unlock()
+	activeProfile.id = profile
+}
+
+// activeStorage returns the local storage of the active profile.
+func activeStorage() storage.LocalStorage {
+	return newProfileStorage(storage.GetLocalStorage(), ActiveProfile())
+}
+
+// profileArg returns the local storage of the profile passed at the given
+// index of the arguments. If the argument is omitted, undefined, or null, the
+// default profile is used.
+func profileArg(args []js.Value, i int) (string, storage.LocalStorage, error) {
+	profile := DefaultProfile
+	if len(args) > i && !args[i].IsUndefined() && !args[i].IsNull() {
+		profile = args[i].String()
+	}
+
+	ls, err := getProfileStorage(profile)
+	return profile, ls, err
+}
+
+// getProfileStorage returns the local storage namespaced to the profile.
+// Returns an error if the profile ID is invalid.
+func getProfileStorage(profile string) (storage.LocalStorage, error) {
+	if profile != DefaultProfile && !profileIDRegex.MatchString(profile) {
+		return nil, errors.Errorf(invalidProfileIDErr, profile)
+	}
+
+	return newProfileStorage(storage.GetLocalStorage(), profile), nil
+}
+
+// listProfiles returns the default profile, if it has a password, followed by
+// every non-default profile sorted by ID.
+func listProfiles(root storage.LocalStorage) ([]ProfileInfo, error) {
+	profiles, err := loadProfiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]ProfileInfo, 0, len(profiles)+1)
+	_, err = loadPasswordEnrollment(newProfileStorage(root, DefaultProfile))
+	if err == nil {
+		list = append(list, ProfileInfo{ID: DefaultProfile})
+	}
+	for _, info := range profiles {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+// allProfileStorage returns the local storage of the default profile followed
+// by every non-default profile sorted by ID.
+func allProfileStorage(
+	root storage.LocalStorage) ([]storage.LocalStorage, error) {
+	profiles, err := loadProfiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(profiles))
+	for profile := range profiles {
+		ids = append(ids, profile)
+	}
+	sort.Strings(ids)
+
+	list := []storage.LocalStorage{newProfileStorage(root, DefaultProfile)}
+	for _, profile := range ids {
+		list = append(list, newProfileStorage(root, profile))
+	}
+
+	return list, nil
+}
+
+// addProfile adds the profile to the list of profiles if it is not already in
+// it. Does nothing for the default profile.
+func addProfile(profile string, root storage.LocalStorage) error {
+	if profile == DefaultProfile {
+		return nil
+	}
+
+	profiles, err := loadProfiles(root)
+	if err != nil {
+		return err
+	} else if _, exists := profiles[profile]; exists {
+		return nil
+	}
+
+	profiles[profile] = ProfileInfo{ID: profile, Created: time.Now()}
+	return storeProfiles(profiles, root)
+}
+
+// removeProfile removes the profile from the list of profiles. Does nothing
+// for the default profile.
+func removeProfile(profile string, root storage.LocalStorage) error {
+	if profile == DefaultProfile {
+		return nil
+	}
+
+	profiles, err := loadProfiles(root)
+	if err != nil {
+		return err
+	}
+
+	delete(profiles, profile)
+	return storeProfiles(profiles, root)
+}
+
+// loadProfiles loads the map of non-default profiles. Returns an empty map if
+// none are saved.
+func loadProfiles(root storage.LocalStorage) (map[string]ProfileInfo, error) {
+	profiles := make(map[string]ProfileInfo)
+	data, err := root.Get(profileListKey)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return profiles, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &profiles); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal profile list")
+	}
+
+	return profiles, nil
+}
+
+// storeProfiles saves the map of non-default profiles.
+func storeProfiles(
+	profiles map[string]ProfileInfo, root storage.LocalStorage) error {
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		return err
+	}
+
+	if err = root.Set(profileListKey, data); err != nil {
+		return errors.Wrapf(err, "localStorage: failed to set %q", profileListKey)
+	}
+
+	return nil
+}
+
+// profileStorage is a [storage.LocalStorage] that namespaces all keys to a
+// single profile. The default profile uses unprefixed keys but excludes the
+// keys of every other profile.
+type profileStorage struct {
+	storage.LocalStorage
+	id     string
+	prefix string
+}
+
+// newProfileStorage returns the storage namespaced to the profile. The profile
+// ID must already be valid.
+func newProfileStorage(
+	root storage.LocalStorage, profile string) *profileStorage {
+	ps := &profileStorage{LocalStorage: root, id: profile}
+	if profile != DefaultProfile {
+		ps.prefix = profileKeyPrefix + profile + "/"
+	}
+	return ps
+}
+
+// Get returns the value of the key in the profile.
+func (ps *profileStorage) Get(keyName string) ([]byte, error) {
+	return ps.LocalStorage.Get(ps.prefix + keyName)
+}
+
+// Set sets the value of the key in the profile.
+func (ps *profileStorage) Set(keyName string, keyValue []byte) error {
+	return ps.LocalStorage.Set(ps.prefix+keyName, keyValue)
+}
+
+// RemoveItem removes the key from the profile.
+func (ps *profileStorage) RemoveItem(keyName string) {
+	ps.LocalStorage.RemoveItem(ps.prefix + keyName)
+}
+
+// Clear removes all keys in the profile. Returns the number of keys cleared.
+func (ps *profileStorage) Clear() int {
+	return ps.ClearPrefix("")
+}
+
+// ClearPrefix removes all keys in the profile with the given prefix. Returns
+// the number of keys cleared.
+func (ps *profileStorage) ClearPrefix(prefix string) int {
+	var n int
+	for _, keyName := range ps.Keys() {
+		if strings.HasPrefix(keyName, prefix) {
+			ps.RemoveItem(keyName)
+			n++
+		}
+	}
+	return n
+}
+
+// Key returns the name of the nth key in the profile. Returns os.ErrNotExist
+// if the key does not exist.
+func (ps *profileStorage) Key(n int) (string, error) {
+	keys := ps.Keys()
+	if n < 0 || n >= len(keys) {
+		return "", os.ErrNotExist
+	}
+	return keys[n], nil
+}
+
+// Keys returns the names of all keys in the profile with the profile prefix
+// removed.
+func (ps *profileStorage) Keys() []string {
+	all := ps.LocalStorage.Keys()
+	keys := make([]string, 0, len(all))
+	for _, keyName := range all {
+		if ps.prefix == "" {
+			if !strings.HasPrefix(keyName, profileKeyPrefix) &&
+				keyName != profileListKey {
+				keys = append(keys, keyName)
+			}
+		} else if strings.HasPrefix(keyName, ps.prefix) {
+			keys = append(keys, strings.TrimPrefix(keyName, ps.prefix))
+		}
+	}
+	return keys
+}
+
+// Length returns the number of keys in the profile.
+func (ps *profileStorage) Length() int {
+	return len(ps.Keys())
+}
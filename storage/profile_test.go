@@ -0,0 +1,148 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// Tests that the keys of each profile are separate and that clearing one
+// profile does not affect the others.
+func Test_profileStorage(t *testing.T) {
+	root := storage.GetLocalStorage()
+	root.Clear()
+
+	defaultLs := newProfileStorage(root, DefaultProfile)
+	aliceLs := newProfileStorage(root, "alice")
+	bobLs := newProfileStorage(root, "bob")
+
+	for _, ls := range []storage.LocalStorage{defaultLs, aliceLs, bobLs} {
+		for _, keyName := range []string{"a", "b"} {
+			if err := ls.Set(keyName, []byte(keyName)); err != nil {
+				t.Fatalf("Failed to set %q: %+v", keyName, err)
+			}
+		}
+	}
+	if err := addProfile("alice", root); err != nil {
+		t.Fatalf("Failed to add profile: %+v", err)
+	}
+
+	for i, ls := range []storage.LocalStorage{defaultLs, aliceLs, bobLs} {
+		keys := ls.Keys()
+		sort.Strings(keys)
+		if !reflect.DeepEqual([]string{"a", "b"}, keys) {
+			t.Errorf("Unexpected keys for profile #%d: %q", i, keys)
+		}
+	}
+
+	if n := aliceLs.Clear(); n != 2 {
+		t.Errorf("Unexpected number of keys cleared.\nexpected: %d\nreceived: %d",
+			2, n)
+	}
+	if aliceLs.Length() != 0 {
+		t.Errorf("Profile not cleared: %q", aliceLs.Keys())
+	}
+	if defaultLs.Length() != 2 || bobLs.Length() != 2 {
+		t.Errorf("Other profiles modified by clear.\ndefault: %q\nbob:     %q",
+			defaultLs.Keys(), bobLs.Keys())
+	}
+	if _, err := root.Get(profileListKey); err != nil {
+		t.Errorf("Profile list removed by clear: %+v", err)
+	}
+}
+
+// Tests that addProfile and removeProfile update the list returned by
+// listProfiles.
+func Test_addProfile_listProfiles_removeProfile(t *testing.T) {
+	root := storage.GetLocalStorage()
+	root.Clear()
+
+	for _, profile := range []string{"work", DefaultProfile, "home", "work"} {
+		if err := addProfile(profile, root); err != nil {
+			t.Fatalf("Failed to add profile %q: %+v", profile, err)
+		}
+	}
+
+	list, err := listProfiles(root)
+	if err != nil {
+		t.Fatalf("Failed to list profiles: %+v", err)
+	}
+	var ids []string
+	for _, info := range list {
+		ids = append(ids, info.ID)
+	}
+	if !reflect.DeepEqual([]string{"home", "work"}, ids) {
+		t.Errorf("Unexpected profiles: %q", ids)
+	}
+
+	if err = removeProfile("work", root); err != nil {
+		t.Fatalf("Failed to remove profile: %+v", err)
+	}
+	profiles, err := loadProfiles(root)
+	if err != nil {
+		t.Fatalf("Failed to load profiles: %+v", err)
+	}
+	if _, exists := profiles["work"]; exists || len(profiles) != 1 {
+		t.Errorf("Profile not removed: %+v", profiles)
+	}
+}
+
+// Tests that purgeProfile only deletes the storage and databases of its own
+// profile.
+func Test_purgeProfile(t *testing.T) {
+	root := storage.GetLocalStorage()
+	root.Clear()
+
+	defaultLs := newProfileStorage(root, DefaultProfile)
+	aliceLs := newProfileStorage(root, "alice")
+	if err := addProfile("alice", root); err != nil {
+		t.Fatalf("Failed to add profile: %+v", err)
+	}
+	for _, ls := range []storage.LocalStorage{defaultLs, aliceLs} {
+		if err := ls.Set("key", []byte("value")); err != nil {
+			t.Fatalf("Failed to set key: %+v", err)
+		}
+	}
+
+	if err := purgeProfile(aliceLs); err != nil {
+		t.Fatalf("Failed to purge profile: %+v", err)
+	}
+
+	if aliceLs.Length() != 0 {
+		t.Errorf("Profile not purged: %q", aliceLs.Keys())
+	}
+	if _, err := defaultLs.Get("key"); err != nil {
+		t.Errorf("Default profile modified by purge: %+v", err)
+	}
+	if profiles, err := loadProfiles(root); err != nil {
+		t.Fatalf("Failed to load profiles: %+v", err)
+	} else if len(profiles) != 0 {
+		t.Errorf("Profile not removed from list: %+v", profiles)
+	}
+}
+
+// Error path: Tests that getProfileStorage returns an error for invalid
+// profile IDs.
+func Test_getProfileStorage_InvalidID(t *testing.T) {
+	expectedErr := strings.Split(invalidProfileIDErr, "%")[0]
+	for _, profile := range []string{"a/b", "with space", "é",
+		strings.Repeat("a", 65)} {
+		_, err := getProfileStorage(profile)
+		if err == nil || !strings.Contains(err.Error(), expectedErr) {
+			t.Errorf("Unexpected error for profile %q."+
+				"\nexpected: %s\nreceived: %+v", profile, expectedErr, err)
+		}
+	}
+}
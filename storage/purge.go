@@ -10,14 +10,21 @@
 package storage
 
 import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall/js"
+	"time"
 
 	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 
 	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
 )
 
 // numClientsRunning is an atomic that tracks the current number of Cmix
@@ -39,58 +46,352 @@ func DecrementNumClientsRunning() {
 	atomic.AddUint64(&numClientsRunning, ^uint64(0))
 }
 
+// purgeHandlers are called with the names of the databases that a purge is
+// about to delete.
+var purgeHandlers = struct {
+	h []func(databaseNames []string)
+	sync.Mutex
+}{}
+
+// RegisterPurgeHandler adds a function that is called with the names of the
+// indexedDb databases that [Purge] or [PurgeIdentity] is about to delete, so
+// that anything holding them open can close them first.
+func RegisterPurgeHandler(h func(databaseNames []string)) {
+	purgeHandlers.Lock()
+	defer purgeHandlers.Unlock()
+	purgeHandlers.h = append(purgeHandlers.h, h)
+}
+
+// notifyPurge calls every registered purge handler with the database names.
+func notifyPurge(databaseNames []string) {
+	purgeHandlers.Lock()
+	handlers := purgeHandlers.h
+	purgeHandlers.Unlock()
+	for _, h := range handlers {
+		h(databaseNames)
+	}
+}
+
+// identityDatabaseSuffixes are the suffixes appended to the storage tag of an
+// identity to name its channel, DM, and state databases. They must match the
+// databaseSuffix of each package in indexedDb/worker.
+var identityDatabaseSuffixes = []string{
+	"_speakeasy", "_speakeasy_dm", "_speakeasy_state"}
+
+// Error messages.
+const (
+	// checkClientsStopped
+	clientsRunningErr = "%d cMix followers running; all need to be stopped"
+)
+
+// checkClientsStopped returns an error if any cMix followers are running.
+func checkClientsStopped() error {
+	if n := atomic.LoadUint64(&numClientsRunning); n != 0 {
+		return errors.Errorf(clientsRunningErr, n)
+	}
+	return nil
+}
+
 // Purge clears all local storage and indexedDb databases saved by this WASM
-// binary. This can only occur when no cMix followers are running. The user's
-// password is required.
+// binary for the profile and deletes the profile. This can only occur when no
+// cMix followers are running. The user's password is required.
+//
+// Purging the default profile also clears all local storage that does not
+// belong to a profile, including the cMix storage of every profile. The data of
+// other profiles is left intact.
 //
 // Parameters:
 //   - args[0] - The user-supplied password (string). This is the same password
 //     passed into [wasm.NewCmix].
+//   - args[1] - The profile ID (string). Optional; omit to use the default
+//     profile.
 //
 // Returns:
 //   - Throws an error if the password is incorrect or if not all cMix followers
 //     have been stopped.
 func Purge(_ js.Value, args []js.Value) any {
 	userPassword := args[0].String()
+	_, ls, err := profileArg(args, 1)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	// Check that password attempts are not locked out
+	if err = checkLockout(ls, time.Now()); err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
 
 	// Check the password
-	if !verifyPassword(userPassword) {
+	if !verifyPassword(userPassword, ls) {
 		exception.Throwf("invalid password")
 		return nil
 	}
 
 	// Verify all Cmix followers are stopped
-	if n := atomic.LoadUint64(&numClientsRunning); n != 0 {
-		exception.Throwf("%d cMix followers running; all need to be stopped", n)
+	if err = checkClientsStopped(); err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	if err = purgeProfile(ls); err != nil {
+		exception.ThrowTrace(err)
 		return nil
 	}
 
+	return nil
+}
+
+// purgeProfile deletes all indexedDb databases registered to the profile,
+// clears all of its local storage, and removes it from the list of profiles.
+func purgeProfile(ls storage.LocalStorage) error {
 	// Get all indexedDb database names
-	databaseList, err := GetIndexedDbList()
+	registry, err := loadIndexedDbRegistry(ls)
 	if err != nil {
-		exception.Throwf(
-			"failed to get list of indexedDb database names: %+v", err)
-		return nil
+		return errors.Wrap(err, "failed to get list of indexedDb database names")
+	}
+	jww.DEBUG.Printf("[PURGE] Found %d databases to delete", len(registry))
+
+	databaseNames := make([]string, 0, len(registry))
+	for dbName := range registry {
+		databaseNames = append(databaseNames, dbName)
 	}
-	jww.DEBUG.Printf("[PURGE] Found %d databases to delete: %s",
-		len(databaseList), databaseList)
+	notifyPurge(databaseNames)
 
 	// Delete each database
-	for dbName := range databaseList {
+	for _, dbName := range databaseNames {
 		_, err = idb.Global().DeleteDatabase(dbName)
 		if err != nil {
-			exception.Throwf(
-				"failed to delete indexedDb database %q: %+v", dbName, err)
-			return nil
+			return errors.Wrapf(err,
+				"failed to delete indexedDb database %q", dbName)
 		}
 	}
 
-	// Get local storage
-	ls := storage.GetLocalStorage()
-
-	// Clear all local storage saved by this WASM project
+	// Clear all local storage saved by this WASM project for the profile
 	n := ls.Clear()
 	jww.DEBUG.Printf("[PURGE] Cleared %d WASM keys in local storage", n)
 
+	if ps, ok := ls.(*profileStorage); ok {
+		if err = removeProfile(ps.id, ps.LocalStorage); err != nil {
+			return err
+		}
+		if ActiveProfile() == ps.id {
+			setActiveProfile(DefaultProfile)
+		}
+	}
+
+	return nil
+}
+
+// PurgeReport lists the storage belonging to a single identity that is deleted
+// by [PurgeIdentity].
+//
+// Example JSON:
+//
+//	{
+//	  "databases": [
+//	    "U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI_speakeasy",
+//	    "U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI_speakeasy_dm"
+//	  ],
+//	  "localStorageKeys": [
+//	    "xxdkWasmDatabaseEncryptionToggle/U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI_speakeasy",
+//	    "xxdkWasmDatabaseEncryptionToggle/U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI_speakeasy_dm",
+//	    "myStorageDir/key1"
+//	  ],
+//	  "dryRun": true
+//	}
+type PurgeReport struct {
+	Databases        []string `json:"databases"`
+	LocalStorageKeys []string `json:"localStorageKeys"`
+	DryRun           bool     `json:"dryRun"`
+}
+
+// PurgeIdentity deletes the indexedDb databases and local storage belonging to
+// a single identity, leaving the storage of all other identities intact. This
+// can only occur when no cMix followers are running. The user's password is
+// required.
+//
+// The channel, DM, and state databases of an identity are registered with the
+// storage tag as their identity and are named with the storage tag followed by
+// "_speakeasy", "_speakeasy_dm", or "_speakeasy_state". All databases
+// registered to the identity or with one of these names are deleted along with
+// their encryption status. If a storage directory is supplied, all local
+// storage keys in it are also deleted.
+//
+// In dry-run mode, nothing is deleted; the report lists what would be deleted.
+// Local storage keys are reported by their full name, including the profile
+// namespace.
+//
+// Parameters:
+//   - args[0] - The storage tag of the identity that prefixes its database
+//     names (string).
+//   - args[1] - The storage directory passed into [wasm.NewCmix] for the
+//     identity, or an empty string to leave cMix storage intact (string).
+//   - args[2] - The user-supplied password (string).
+//   - args[3] - Set to true to only list what would be deleted (boolean).
+//   - args[4] - The profile ID that the identity's databases are registered to
+//     (string). Optional; omit to use the default profile.
+//
+// Returns:
+//   - JSON of [PurgeReport] (Uint8Array).
+//   - Throws an error if the password is incorrect, if not all cMix followers
+//     have been stopped, or if deletion fails.
+func PurgeIdentity(_ js.Value, args []js.Value) any {
+	storageTag := args[0].String()
+	storageDir := args[1].String()
+	userPassword := args[2].String()
+	dryRun := args[3].Bool()
+	_, ls, err := profileArg(args, 4)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	// Check that password attempts are not locked out
+	if err = checkLockout(ls, time.Now()); err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	// Check the password
+	if !verifyPassword(userPassword, ls) {
+		exception.Throwf("invalid password")
+		return nil
+	}
+
+	report, err := identityPurgeTargets(storageTag, storageDir, ls)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+	report.DryRun = dryRun
+
+	if !dryRun {
+		// Verify all Cmix followers are stopped
+		if err = checkClientsStopped(); err != nil {
+			exception.ThrowTrace(err)
+			return nil
+		}
+
+		jww.DEBUG.Printf("[PURGE] Found %d databases to delete for identity "+
+			"%q: %s", len(report.Databases), storageTag, report.Databases)
+		notifyPurge(report.Databases)
+
+		// Delete each database
+		for _, dbName := range report.Databases {
+			_, err = idb.Global().DeleteDatabase(dbName)
+			if err != nil {
+				exception.Throwf(
+					"failed to delete indexedDb database %q: %+v", dbName, err)
+				return nil
+			}
+		}
+
+		if err = purgeIdentityStorage(report, ls); err != nil {
+			exception.ThrowTrace(err)
+			return nil
+		}
+		jww.DEBUG.Printf("[PURGE] Cleared %d WASM keys in local storage for "+
+			"identity %q", len(report.LocalStorageKeys), storageTag)
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return utils.CopyBytesToJS(reportJSON)
+}
+
+// identityPurgeTargets returns the databases and local storage keys belonging
+// to the identity with the given storage tag and storage directory. The
+// databases are looked up in the registry of the profile. Because cMix storage
+// is not namespaced to a profile, keys are returned by their full name in the
+// local storage shared by all profiles.
+func identityPurgeTargets(storageTag, storageDir string,
+	localStorage storage.LocalStorage) (PurgeReport, error) {
+	report := PurgeReport{
+		Databases:        []string{},
+		LocalStorageKeys: []string{},
+	}
+	if storageTag == "" && storageDir == "" {
+		return report, errors.New("a storage tag or storage directory is " +
+			"required to purge an identity")
+	}
+
+	if storageTag != "" {
+		registry, err := loadIndexedDbRegistry(localStorage)
+		if err != nil {
+			return report, errors.Wrap(err,
+				"failed to get list of indexedDb database names")
+		}
+
+		for dbName, info := range registry {
+			if info.Identity == storageTag ||
+				isIdentityDatabase(dbName, storageTag) {
+				report.Databases = append(report.Databases, dbName)
+			}
+		}
+		sort.Strings(report.Databases)
+	}
+
+	root, prefix := localStorage, ""
+	if ps, ok := localStorage.(*profileStorage); ok {
+		root, prefix = ps.LocalStorage, ps.prefix
+	}
+
+	keys := make(map[string]struct{})
+	for _, dbName := range report.Databases {
+		keyName := prefix + databaseEncryptionToggleKey + dbName
+		if _, err := root.Get(keyName); err == nil {
+			keys[keyName] = struct{}{}
+		}
+	}
+	if storageDir != "" {
+		dirPrefix := strings.TrimSuffix(storageDir, "/") + "/"
+		for _, keyName := range root.Keys() {
+			if strings.HasPrefix(keyName, dirPrefix) {
+				keys[keyName] = struct{}{}
+			}
+		}
+	}
+	for keyName := range keys {
+		report.LocalStorageKeys = append(report.LocalStorageKeys, keyName)
+	}
+	sort.Strings(report.LocalStorageKeys)
+
+	return report, nil
+}
+
+// isIdentityDatabase returns true if the database name is the storage tag
+// followed by one of the identityDatabaseSuffixes.
+func isIdentityDatabase(dbName, storageTag string) bool {
+	for _, suffix := range identityDatabaseSuffixes {
+		if dbName == storageTag+suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeIdentityStorage removes the databases in the report from the registry
+// of the profile and deletes the local storage keys in the report.
+func purgeIdentityStorage(
+	report PurgeReport, localStorage storage.LocalStorage) error {
+	err := removeIndexedDbs(localStorage, report.Databases...)
+	if err != nil {
+		return errors.Wrap(err, "failed to remove database names from list")
+	}
+
+	root := localStorage
+	if ps, ok := localStorage.(*profileStorage); ok {
+		root = ps.LocalStorage
+	}
+	for _, keyName := range report.LocalStorageKeys {
+		root.RemoveItem(keyName)
+	}
+
 	return nil
 }
@@ -0,0 +1,122 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// Tests that identityPurgeTargets only returns the databases and local storage
+// keys of the given identity and that purgeIdentityStorage deletes only them.
+func Test_identityPurgeTargets_purgeIdentityStorage(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	for _, dbName := range []string{"alice_speakeasy", "alice_speakeasy_dm",
+		"alice2_speakeasy", "alice_x_speakeasy", "bob_speakeasy"} {
+		if err := StoreIndexedDb(dbName); err != nil {
+			t.Fatalf("Failed to store database name %q: %+v", dbName, err)
+		}
+		if _, err := StoreIndexedDbEncryptionStatus(dbName, true); err != nil {
+			t.Fatalf("Failed to store encryption status for %q: %+v",
+				dbName, err)
+		}
+	}
+	for _, keyName := range []string{
+		"aliceDir/a", "aliceDir/b", "aliceDir2/a", "bobDir/a"} {
+		if err := ls.Set(keyName, []byte("value")); err != nil {
+			t.Fatalf("Failed to set %q: %+v", keyName, err)
+		}
+	}
+
+	report, err := identityPurgeTargets("alice", "aliceDir", ls)
+	if err != nil {
+		t.Fatalf("Failed to get purge targets: %+v", err)
+	}
+
+	expected := PurgeReport{
+		Databases: []string{"alice_speakeasy", "alice_speakeasy_dm"},
+		LocalStorageKeys: []string{
+			"aliceDir/a",
+			"aliceDir/b",
+			databaseEncryptionToggleKey + "alice_speakeasy",
+			databaseEncryptionToggleKey + "alice_speakeasy_dm",
+		},
+	}
+	if !reflect.DeepEqual(expected, report) {
+		t.Errorf("Unexpected purge report.\nexpected: %+v\nreceived: %+v",
+			expected, report)
+	}
+
+	if err = purgeIdentityStorage(report, ls); err != nil {
+		t.Fatalf("Failed to purge identity storage: %+v", err)
+	}
+
+	list, err := GetIndexedDbList()
+	if err != nil {
+		t.Fatalf("Failed to get database list: %+v", err)
+	}
+	expectedList := map[string]struct{}{"alice2_speakeasy": {},
+		"alice_x_speakeasy": {}, "bob_speakeasy": {}}
+	if !reflect.DeepEqual(expectedList, list) {
+		t.Errorf("Unexpected database list after purge."+
+			"\nexpected: %s\nreceived: %s", expectedList, list)
+	}
+
+	for _, keyName := range report.LocalStorageKeys {
+		if _, err = ls.Get(keyName); err == nil {
+			t.Errorf("Key %q not deleted.", keyName)
+		}
+	}
+	for _, keyName := range []string{"aliceDir2/a", "bobDir/a",
+		databaseEncryptionToggleKey + "alice_x_speakeasy",
+		databaseEncryptionToggleKey + "bob_speakeasy"} {
+		if _, err = ls.Get(keyName); err != nil {
+			t.Errorf("Key %q of other identity deleted: %+v", keyName, err)
+		}
+	}
+}
+
+// Error path: Tests that identityPurgeTargets returns an error when neither a
+// storage tag nor a storage directory is provided.
+func Test_identityPurgeTargets_NoIdentityError(t *testing.T) {
+	_, err := identityPurgeTargets("", "", storage.GetLocalStorage())
+	if err == nil {
+		t.Error("Did not receive an error when no identity is specified.")
+	}
+}
+
+// Tests that notifyPurge calls every handler registered with
+// RegisterPurgeHandler, in order, with the database names.
+func Test_notifyPurge(t *testing.T) {
+	defer func() { purgeHandlers.h = nil }()
+
+	expected := []string{"alice_speakeasy", "alice_speakeasy_dm"}
+	var received [][]string
+	for i := 0; i < 2; i++ {
+		i := i
+		RegisterPurgeHandler(func(databaseNames []string) {
+			if len(received) != i {
+				t.Errorf("Purge handler %d called out of order.", i)
+			}
+			received = append(received, databaseNames)
+		})
+	}
+
+	notifyPurge(expected)
+
+	if !reflect.DeepEqual([][]string{expected, expected}, received) {
+		t.Errorf("Unexpected databases passed to purge handlers."+
+			"\nexpected: %s\nreceived: %s", expected, received)
+	}
+}
@@ -0,0 +1,243 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"io"
+	"strings"
+	"syscall/js"
+
+	"github.com/pkg/errors"
+	"github.com/tyler-smith/go-bip39"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// recoveryKeyLen is the length of the entropy used to generate the recovery
+// phrase. 256 bits of entropy produces a 24-word phrase.
+const recoveryKeyLen = 32
+
+// Key used to store the internal password encrypted with the recovery key in
+// local storage.
+const recoveryPasswordKey = "xxRecoveryEncryptedInternalPassword"
+
+// Error messages.
+const (
+	// generateRecoveryKey
+	readRecoveryKeyErr     = "could not generate recovery key: %+v"
+	recoveryKeyNumBytesErr = "expected %d bytes for recovery key, found %d bytes"
+	newMnemonicErr         = "could not generate recovery phrase: %+v"
+
+	// unlockWithRecoveryKey
+	invalidMnemonicErr     = "invalid recovery phrase: %+v"
+	getRecoveryStorageErr  = "could not retrieve recovery encrypted internal password from storage"
+	decryptWithRecoveryErr = "could not decrypt internal password with recovery phrase: %+v"
+)
+
+// GenerateRecoveryKey generates a new recovery phrase that can be used to
+// unlock the internal password if the user-provided password is forgotten.
+// The internal password is encrypted with the recovery key and saved to local
+// storage. Generating a new recovery phrase invalidates any previous one.
+//
+// The phrase is only returned once; it is the responsibility of the caller to
+// present it to the user for safekeeping.
+//
+// Parameters:
+//   - args[0] - The user supplied password (string).
+//   - args[1] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns a promise:
+//   - The recovery phrase, a BIP39 mnemonic of 24 space-separated words
+//     (string).
+//   - Throws TypeError if the password is incorrect or generation fails.
+func GenerateRecoveryKey(_ js.Value, args []js.Value) any {
+	externalPassword := args[0].String()
+	_, ls, profileErr := profileArg(args, 1)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		}
+
+		mnemonic, err :=
+			generateRecoveryKey(externalPassword, ls, csprng.NewSystemRNG())
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(mnemonic)
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// UnlockWithRecoveryKey returns the 256-bit internal password using the
+// recovery phrase instead of the user-provided password. On success, the
+// profile becomes the active profile (see [ActiveProfile]).
+//
+// As with [GetOrInitPassword], the returned internal password is zeroed when
+// the session is locked, and this returns an error while the session is
+// locked.
+//
+// Parameters:
+//   - args[0] - The recovery phrase returned by [GenerateRecoveryKey]
+//     (string).
+//   - args[1] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns a promise:
+//   - Internal password (Uint8Array).
+//   - Throws TypeError if the phrase is invalid or no recovery key exists.
+func UnlockWithRecoveryKey(_ js.Value, args []js.Value) any {
+	mnemonic := args[0].String()
+	profile, ls, profileErr := profileArg(args, 1)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		} else if SessionLocked() {
+			reject(exception.NewTrace(errors.New(sessionLockedErr)))
+			return
+		}
+
+		internalPassword, err := unlockWithRecoveryKey(mnemonic, ls)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		if err = addProfile(profile, storage.GetLocalStorage()); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		setActiveProfile(profile)
+
+		resolve(session.issue(internalPassword))
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ResetPasswordWithRecoveryKey sets a new user-provided password using the
+// recovery phrase. The internal password is not changed; it is re-encrypted
+// with the new password. The recovery phrase remains valid.
+//
+// Parameters:
+//   - args[0] - The recovery phrase returned by [GenerateRecoveryKey]
+//     (string).
+//   - args[1] - The new user supplied password (string).
+//   - args[2] - The profile ID (string). Optional; omit to use the default
+//     profile.
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Throws TypeError if the phrase is invalid or the reset fails.
+func ResetPasswordWithRecoveryKey(_ js.Value, args []js.Value) any {
+	mnemonic := args[0].String()
+	newExternalPassword := args[1].String()
+	_, ls, profileErr := profileArg(args, 2)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if profileErr != nil {
+			reject(exception.NewTrace(profileErr))
+			return
+		}
+
+		err := resetPasswordWithRecoveryKey(mnemonic, newExternalPassword,
+			ls, csprng.NewSystemRNG(), defaultParams())
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// generateRecoveryKey is the private function for GenerateRecoveryKey that is
+// used for testing.
+func generateRecoveryKey(externalPassword string,
+	localStorage storage.LocalStorage, csprng io.Reader) (string, error) {
+	internalPassword, err :=
+		getInternalPasswordLimited(externalPassword, localStorage)
+	if err != nil {
+		return "", err
+	}
+
+	recoveryKey := make([]byte, recoveryKeyLen)
+	n, err := csprng.Read(recoveryKey)
+	if err != nil {
+		return "", errors.Errorf(readRecoveryKeyErr, err)
+	} else if n != recoveryKeyLen {
+		return "", errors.Errorf(recoveryKeyNumBytesErr, recoveryKeyLen, n)
+	}
+
+	mnemonic, err := bip39.NewMnemonic(recoveryKey)
+	if err != nil {
+		return "", errors.Errorf(newMnemonicErr, err)
+	}
+
+	encryptedInternalPassword :=
+		encryptPassword(internalPassword, recoveryKey, csprng)
+	err = localStorage.Set(recoveryPasswordKey, encryptedInternalPassword)
+	if err != nil {
+		return "", errors.Wrapf(
+			err, "localStorage: failed to set %q", recoveryPasswordKey)
+	}
+
+	return mnemonic, nil
+}
+
+// unlockWithRecoveryKey is the private function for UnlockWithRecoveryKey that
+// is used for testing.
+func unlockWithRecoveryKey(
+	mnemonic string, localStorage storage.LocalStorage) ([]byte, error) {
+	recoveryKey, err := bip39.EntropyFromMnemonic(normalizeMnemonic(mnemonic))
+	if err != nil {
+		return nil, errors.Errorf(invalidMnemonicErr, err)
+	}
+
+	encryptedInternalPassword, err := localStorage.Get(recoveryPasswordKey)
+	if err != nil {
+		return nil, errors.WithMessage(err, getRecoveryStorageErr)
+	}
+
+	internalPassword, err :=
+		decryptPassword(encryptedInternalPassword, recoveryKey)
+	if err != nil {
+		return nil, errors.Errorf(decryptWithRecoveryErr, err)
+	}
+
+	return internalPassword, nil
+}
+
+// resetPasswordWithRecoveryKey is the private function for
+// ResetPasswordWithRecoveryKey that is used for testing.
+func resetPasswordWithRecoveryKey(mnemonic, newExternalPassword string,
+	localStorage storage.LocalStorage, csprng io.Reader,
+	params argonParams) error {
+	internalPassword, err := unlockWithRecoveryKey(mnemonic, localStorage)
+	if err != nil {
+		return err
+	}
+
+	return rewrapInternalPassword(internalPassword, newExternalPassword,
+		localStorage, csprng, params)
+}
+
+// normalizeMnemonic lowercases the phrase and collapses all whitespace between
+// words to a single space.
+func normalizeMnemonic(mnemonic string) string {
+	return strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+}
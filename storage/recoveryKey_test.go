@@ -0,0 +1,167 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that the recovery phrase returned by generateRecoveryKey unlocks the
+// same internal password as the user-provided password.
+func Test_generateRecoveryKey_unlockWithRecoveryKey(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	externalPassword := "myPassword"
+	internalPassword, err := initInternalPassword(
+		externalPassword, ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	mnemonic, err :=
+		generateRecoveryKey(externalPassword, ls, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to generate recovery key: %+v", err)
+	}
+
+	if words := strings.Fields(mnemonic); len(words) != 24 {
+		t.Errorf("Unexpected number of words in recovery phrase."+
+			"\nexpected: %d\nreceived: %d", 24, len(words))
+	}
+
+	// Extra whitespace and capitalisation should be ignored
+	loaded, err := unlockWithRecoveryKey(
+		"  "+strings.ToUpper(mnemonic)+"\n", ls)
+	if err != nil {
+		t.Fatalf("Failed to unlock with recovery key: %+v", err)
+	}
+
+	if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password from recovery key does not match "+
+			"original.\nexpected: %v\nreceived: %v", internalPassword, loaded)
+	}
+}
+
+// Tests that generateRecoveryKey returns an error for an incorrect password.
+func Test_generateRecoveryKey_InvalidPassword(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	expectedErr := strings.Split(decryptPasswordErr, "%")[0]
+	_, err = generateRecoveryKey("wrong password", ls, csprng.NewSystemRNG())
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for incorrect password."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+}
+
+// Tests that generating a new recovery phrase invalidates the previous one.
+func Test_generateRecoveryKey_Regenerate(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	externalPassword := "myPassword"
+	_, err := initInternalPassword(
+		externalPassword, ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	oldMnemonic, err :=
+		generateRecoveryKey(externalPassword, ls, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, err = generateRecoveryKey(externalPassword, ls, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	expectedErr := strings.Split(decryptWithRecoveryErr, "%")[0]
+	_, err = unlockWithRecoveryKey(oldMnemonic, ls)
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for old recovery phrase."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+}
+
+// Tests that unlockWithRecoveryKey returns an error for a phrase with an
+// invalid checksum and when no recovery key has been generated.
+func Test_unlockWithRecoveryKey_Errors(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	expectedErr := strings.Split(invalidMnemonicErr, "%")[0]
+	_, err := unlockWithRecoveryKey("abandon abandon abandon", ls)
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for invalid phrase."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	mnemonic := strings.TrimSpace(strings.Repeat("abandon ", 23) + "art")
+	_, err = unlockWithRecoveryKey(mnemonic, ls)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error when no recovery key exists."+
+			"\nexpected: %v\nreceived: %+v", os.ErrNotExist, err)
+	}
+}
+
+// Tests that resetPasswordWithRecoveryKey sets a new password that unlocks the
+// original internal password and that the old password no longer works.
+func Test_resetPasswordWithRecoveryKey(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	oldExternalPassword := "myPassword"
+	newExternalPassword := "hunter2"
+	internalPassword, err := initInternalPassword(
+		oldExternalPassword, ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	mnemonic, err :=
+		generateRecoveryKey(oldExternalPassword, ls, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	err = resetPasswordWithRecoveryKey(mnemonic, newExternalPassword, ls,
+		csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("Failed to reset password: %+v", err)
+	}
+
+	loaded, err := getInternalPassword(newExternalPassword, ls)
+	if err != nil {
+		t.Errorf("Failed to unlock with new password: %+v", err)
+	} else if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password changed on reset."+
+			"\nexpected: %v\nreceived: %v", internalPassword, loaded)
+	}
+
+	if _, err = getInternalPassword(oldExternalPassword, ls); err == nil {
+		t.Errorf("Old password still unlocks the internal password.")
+	}
+
+	if _, err = unlockWithRecoveryKey(mnemonic, ls); err != nil {
+		t.Errorf("Recovery phrase no longer valid after reset: %+v", err)
+	}
+}
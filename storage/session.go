@@ -0,0 +1,314 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"sync"
+	"syscall/js"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// Error messages.
+const (
+	// GetOrInitPassword, UnlockWithKeyProvider, UnlockWithRecoveryKey
+	sessionLockedErr = "session is locked; call Unlock with the password"
+
+	// Session.Unlock
+	sessionHandlerErr = "failed to unlock session: %+v"
+
+	// Session.SetIdleTimeout
+	negativeIdleTimeoutErr = "idle timeout cannot be negative: %s"
+)
+
+// SessionHandler is notified when the session locks and unlocks. Handlers hold
+// key material derived from the internal password and must drop it on Lock and
+// re-derive it on Unlock.
+type SessionHandler interface {
+	// Lock drops all key material and stops all reads and writes.
+	Lock()
+
+	// Unlock re-derives key material from the internal password and resumes
+	// reads and writes. The internal password is zeroed after all handlers
+	// return, so it must not be retained.
+	Unlock(internalPassword []byte) error
+}
+
+// Session tracks whether the internal password is available. When locked,
+// every copy of the internal password handed to Javascript is zeroed, every
+// registered SessionHandler is locked, and the password must be entered again
+// to unlock.
+type Session struct {
+	locked   bool
+	handlers []SessionHandler
+
+	// issued are the Uint8Array copies of the internal password returned to
+	// Javascript. They are zeroed on lock.
+	issued []js.Value
+
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+
+	// callback is called with true when the session locks and false when it
+	// unlocks.
+	callback func(locked bool)
+
+	mux sync.Mutex
+}
+
+// session is the Session for this WASM instance.
+var session = &Session{}
+
+// RegisterSessionHandler adds a SessionHandler that is called when the session
+// locks and unlocks. Handlers are unlocked in the order they are registered and
+// locked in the reverse order, so a handler can rely on the handlers registered
+// before it for as long as it is unlocked. If the session is currently locked,
+// the handler is locked immediately.
+func RegisterSessionHandler(h SessionHandler) {
+	session.mux.Lock()
+	defer session.mux.Unlock()
+	session.handlers = append(session.handlers, h)
+	if session.locked {
+		h.Lock()
+	}
+}
+
+// SessionLocked returns true if the session is locked.
+func SessionLocked() bool {
+	session.mux.Lock()
+	defer session.mux.Unlock()
+	return session.locked
+}
+
+// Lock locks the session. All copies of the internal password returned by
+// [GetOrInitPassword], [UnlockWithKeyProvider], [UnlockWithRecoveryKey], and
+// [Unlock] are overwritten with zeros, the database workers are paused until
+// the session is unlocked, the workers drop their copies of the database
+// ciphers, and the key of every [wasm.DbCipher] is replaced by a random key.
+// Calls to the database workers made while locked block until [Unlock] is
+// called.
+//
+// Does nothing if the session is already locked.
+func Lock(js.Value, []js.Value) any {
+	session.Lock()
+	return nil
+}
+
+// Unlock verifies the password of the active profile (see [ActiveProfile]),
+// re-derives all key material, and resumes the database workers. It counts as
+// a password attempt for the brute-force protection described in
+// [GetPasswordLockout].
+//
+// If the session is not locked, the password is verified and the internal
+// password is returned.
+//
+// Parameters:
+//   - args[0] - The user-supplied password (string).
+//
+// Returns a promise:
+//   - Internal password (Uint8Array).
+//   - Throws TypeError if the password is incorrect or unlocking fails.
+func Unlock(_ js.Value, args []js.Value) any {
+	externalPassword := args[0].String()
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		internalPassword, err :=
+			session.Unlock(externalPassword, activeStorage())
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(session.issue(internalPassword))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SetSessionIdleTimeout sets the time after which the session is locked if
+// [TouchSession] is not called. The timer is restarted on every call to
+// [TouchSession] and [Unlock].
+//
+// Parameters:
+//   - args[0] - The idle timeout, in milliseconds. Set to 0 to disable
+//     (number).
+//
+// Returns:
+//   - Throws an error if the timeout is negative.
+func SetSessionIdleTimeout(_ js.Value, args []js.Value) any {
+	timeout := time.Duration(args[0].Int()) * time.Millisecond
+	if err := session.SetIdleTimeout(timeout); err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return nil
+}
+
+// TouchSession records user activity and restarts the idle timer set by
+// [SetSessionIdleTimeout]. Does nothing if the session is locked.
+func TouchSession(js.Value, []js.Value) any {
+	session.Touch()
+	return nil
+}
+
+// SetSessionCallback registers a callback that is called when the session
+// locks or unlocks. Previously registered callbacks are replaced.
+//
+// Parameters:
+//   - args[0] - A function that is called with true when the session locks
+//     and false when it unlocks. It must be of the form func(boolean).
+func SetSessionCallback(_ js.Value, args []js.Value) any {
+	invoke := args[0].Invoke
+	session.mux.Lock()
+	defer session.mux.Unlock()
+	session.callback = func(locked bool) { invoke(locked) }
+	return nil
+}
+
+// IsSessionLocked returns true if the session is locked.
+//
+// Returns:
+//   - True if locked (boolean).
+func IsSessionLocked(js.Value, []js.Value) any {
+	return SessionLocked()
+}
+
+// Lock zeroes all issued copies of the internal password and locks every
+// handler in the reverse order of registration.
+func (s *Session) Lock() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.locked {
+		return
+	}
+
+	for _, internalPassword := range s.issued {
+		internalPassword.Call("fill", 0)
+	}
+	s.issued = nil
+
+	lockHandlers(s.handlers)
+
+	s.stopIdleTimer()
+	s.locked = true
+	jww.INFO.Printf("Session locked")
+
+	if s.callback != nil {
+		go s.callback(true)
+	}
+}
+
+// Unlock verifies the password and unlocks every handler with the internal
+// password in the order of registration. If a handler fails, the handlers
+// already unlocked are locked again and the session remains locked.
+func (s *Session) Unlock(
+	externalPassword string, ls storage.LocalStorage) ([]byte, error) {
+	internalPassword, err := getInternalPasswordLimited(externalPassword, ls)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.locked {
+		return internalPassword, nil
+	}
+
+	for i, h := range s.handlers {
+		if err = h.Unlock(internalPassword); err != nil {
+			lockHandlers(s.handlers[:i])
+			zero(internalPassword)
+			return nil, errors.Errorf(sessionHandlerErr, err)
+		}
+	}
+
+	s.locked = false
+	s.resetIdleTimer()
+	jww.INFO.Printf("Session unlocked")
+
+	if s.callback != nil {
+		go s.callback(false)
+	}
+
+	return internalPassword, nil
+}
+
+// SetIdleTimeout sets the idle timeout and restarts the timer. A timeout of
+// zero disables it.
+func (s *Session) SetIdleTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return errors.Errorf(negativeIdleTimeoutErr, timeout)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.idleTimeout = timeout
+	if !s.locked {
+		s.resetIdleTimer()
+	}
+	return nil
+}
+
+// Touch restarts the idle timer if the session is unlocked.
+func (s *Session) Touch() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.locked {
+		s.resetIdleTimer()
+	}
+}
+
+// issue copies the internal password to Javascript and records the copy so it
+// can be zeroed on lock. The Go copy is zeroed.
+func (s *Session) issue(internalPassword []byte) js.Value {
+	internalPasswordJS := utils.CopyBytesToJS(internalPassword)
+	zero(internalPassword)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.issued = append(s.issued, internalPasswordJS)
+	return internalPasswordJS
+}
+
+// resetIdleTimer stops the current idle timer and starts a new one if a
+// timeout is set. The mutex must be held.
+func (s *Session) resetIdleTimer() {
+	s.stopIdleTimer()
+	if s.idleTimeout > 0 {
+		s.idleTimer = time.AfterFunc(s.idleTimeout, s.Lock)
+	}
+}
+
+// stopIdleTimer stops the idle timer. The mutex must be held.
+func (s *Session) stopIdleTimer() {
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+}
+
+// lockHandlers locks the handlers in reverse order.
+func lockHandlers(handlers []SessionHandler) {
+	for i := len(handlers) - 1; i >= 0; i-- {
+		handlers[i].Lock()
+	}
+}
+
+// zero overwrites the byte slice with zeros.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,214 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// testSessionHandler records calls to Lock and Unlock.
+type testSessionHandler struct {
+	locked    bool
+	password  []byte
+	unlockErr error
+
+	// calls, if set, records the name of the handler followed by the call.
+	name  string
+	calls *[]string
+}
+
+func (h *testSessionHandler) Lock() {
+	h.locked = true
+	if h.calls != nil {
+		*h.calls = append(*h.calls, h.name+".Lock")
+	}
+}
+func (h *testSessionHandler) Unlock(internalPassword []byte) error {
+	if h.unlockErr != nil {
+		return h.unlockErr
+	}
+	if h.calls != nil {
+		*h.calls = append(*h.calls, h.name+".Unlock")
+	}
+	h.locked = false
+	h.password = append([]byte{}, internalPassword...)
+	return nil
+}
+
+// Tests that Session.Lock zeroes issued passwords and locks every handler and
+// that Session.Unlock unlocks them with the internal password.
+func TestSession_Lock_Unlock(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	internalPassword, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	s := &Session{}
+	h := &testSessionHandler{}
+	s.handlers = []SessionHandler{h}
+	events := make(chan bool, 2)
+	s.callback = func(locked bool) { events <- locked }
+
+	issued := s.issue(append([]byte{}, internalPassword...))
+	s.Lock()
+	if !h.locked {
+		t.Errorf("Handler not locked.")
+	}
+	if b := utils.CopyBytesToGo(issued); !bytes.Equal(
+		make([]byte, len(internalPassword)), b) {
+		t.Errorf("Issued password not zeroed: %v", b)
+	}
+
+	loaded, err := s.Unlock("myPassword", ls)
+	if err != nil {
+		t.Fatalf("Failed to unlock: %+v", err)
+	}
+	if h.locked || !bytes.Equal(internalPassword, h.password) {
+		t.Errorf("Handler not unlocked with internal password.")
+	}
+	if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Unexpected internal password."+
+			"\nexpected: %v\nreceived: %v", internalPassword, loaded)
+	}
+
+	for _, expected := range []bool{true, false} {
+		select {
+		case locked := <-events:
+			if locked != expected {
+				t.Errorf("Unexpected event.\nexpected: %t\nreceived: %t",
+					expected, locked)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %t.", expected)
+		}
+	}
+}
+
+// Error path: Tests that Session.Unlock keeps the session locked when the
+// password is incorrect or a handler fails.
+func TestSession_Unlock_Error(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	s := &Session{}
+	h1, h2 := &testSessionHandler{}, &testSessionHandler{}
+	s.handlers = []SessionHandler{h1, h2}
+	s.Lock()
+
+	if _, err = s.Unlock("wrongPassword", ls); err == nil {
+		t.Errorf("Unlocked with incorrect password.")
+	} else if !s.locked || !h1.locked || !h2.locked {
+		t.Errorf("Session unlocked after incorrect password.")
+	}
+
+	h2.unlockErr = errors.New("unlock failed")
+	expectedErr := strings.Split(sessionHandlerErr, "%")[0]
+	_, err = s.Unlock("myPassword", ls)
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for failed handler."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+	if !s.locked || !h1.locked {
+		t.Errorf("Session unlocked after failed handler.")
+	}
+}
+
+// Tests that Session.Lock locks the handlers in the reverse order of
+// registration and that Session.Unlock unlocks them in the order of
+// registration, including when locking them again after a failed handler.
+func TestSession_Lock_Unlock_Order(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	_, err := initInternalPassword(
+		"myPassword", ls, csprng.NewSystemRNG(), testParams())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var calls []string
+	s := &Session{}
+	for _, name := range []string{"a", "b", "c"} {
+		s.handlers = append(s.handlers,
+			&testSessionHandler{name: name, calls: &calls})
+	}
+
+	s.Lock()
+	if _, err = s.Unlock("myPassword", ls); err != nil {
+		t.Fatalf("Failed to unlock: %+v", err)
+	}
+	expected := []string{"c.Lock", "b.Lock", "a.Lock",
+		"a.Unlock", "b.Unlock", "c.Unlock"}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("Unexpected order of calls.\nexpected: %q\nreceived: %q",
+			expected, calls)
+	}
+
+	calls = nil
+	s.Lock()
+	s.handlers[2].(*testSessionHandler).unlockErr = errors.New("failed")
+	if _, err = s.Unlock("myPassword", ls); err == nil {
+		t.Fatalf("Unlocked with failing handler.")
+	}
+	expected = []string{"c.Lock", "b.Lock", "a.Lock",
+		"a.Unlock", "b.Unlock", "b.Lock", "a.Lock"}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("Unexpected order of calls after failed handler."+
+			"\nexpected: %q\nreceived: %q", expected, calls)
+	}
+}
+
+// Tests that the session locks after the idle timeout and that Session.Touch
+// delays it.
+func TestSession_SetIdleTimeout(t *testing.T) {
+	s := &Session{}
+	if err := s.SetIdleTimeout(50 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to set idle timeout: %+v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	s.Touch()
+	time.Sleep(30 * time.Millisecond)
+	s.mux.Lock()
+	if s.locked {
+		t.Errorf("Session locked before timeout after touch.")
+	}
+	s.mux.Unlock()
+
+	time.Sleep(60 * time.Millisecond)
+	s.mux.Lock()
+	if !s.locked {
+		t.Errorf("Session not locked after idle timeout.")
+	}
+	s.mux.Unlock()
+
+	expectedErr := strings.Split(negativeIdleTimeoutErr, "%")[0]
+	err := s.SetIdleTimeout(-time.Second)
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for negative timeout."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+}
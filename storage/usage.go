@@ -0,0 +1,306 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+)
+
+// StorageEstimate is the origin-wide usage and quota reported by the browser
+// through navigator.storage.estimate().
+type StorageEstimate struct {
+	Usage uint64 `json:"usage"`
+	Quota uint64 `json:"quota"`
+}
+
+// DatabaseUsage is the estimated size of a single indexedDb database.
+type DatabaseUsage struct {
+	DatabaseInfo
+	Stores []impl.StoreStats `json:"stores"`
+	Rows   uint              `json:"rows"`
+	Bytes  uint64            `json:"bytes"`
+
+	// Error is set if the database could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// StorageUsage is JSON marshalled and returned by [GetStorageUsage].
+//
+// Example JSON:
+//
+//	{
+//	  "estimate": {"usage": 5242880, "quota": 1073741824},
+//	  "databases": [
+//	    {
+//	      "name": "U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI_speakeasy",
+//	      "kind": "channels",
+//	      "identity": "U4x/lrFkvxuXu59LtHLon1sUhPJSCcnZND6SugndnVI",
+//	      "version": 1,
+//	      "encrypted": true,
+//	      "created": "2023-05-12T15:03:42.197Z",
+//	      "lastOpened": "2023-06-01T09:21:08.551Z",
+//	      "stores": [
+//	        {"name": "messages", "rows": 1024, "bytes": 1572864},
+//	        {"name": "channels", "rows": 3, "bytes": 1410}
+//	      ],
+//	      "rows": 1027,
+//	      "bytes": 1574274
+//	    }
+//	  ],
+//	  "localStorageKeys": 412,
+//	  "localStorageBytes": 98304
+//	}
+type StorageUsage struct {
+	Estimate  StorageEstimate `json:"estimate"`
+	Databases []DatabaseUsage `json:"databases"`
+
+	// LocalStorageKeys and LocalStorageBytes describe the local storage used
+	// by this WASM binary, which includes the cMix key-value store.
+	LocalStorageKeys  int    `json:"localStorageKeys"`
+	LocalStorageBytes uint64 `json:"localStorageBytes"`
+}
+
+// GetStorageUsage returns the browser's storage estimate along with the
+// estimated size of every registered indexedDb database and of local storage.
+//
+// Database sizes are estimated by walking every row of every object store, so
+// this call can be slow for large databases. A database that cannot be read is
+// reported with an error instead of failing the entire call.
+//
+// Returns a promise:
+//   - JSON of [StorageUsage] (Uint8Array).
+//   - Throws TypeError if the estimate or registry cannot be loaded.
+func GetStorageUsage(js.Value, []js.Value) any {
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		usage, err := getStorageUsage()
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		usageJSON, err := json.Marshal(usage)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(usageJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SetStorageQuotaWarning registers a callback that is called when the
+// browser's reported usage rises above the given fraction of the quota. The
+// usage is checked at the given interval and on every call to
+// [GetStorageUsage]. The callback is called once each time the threshold is
+// crossed; it is called again only after usage drops below the threshold and
+// crosses it again. Previously registered callbacks are stopped and replaced.
+//
+// Parameters:
+//   - args[0] - Fraction of the quota, between 0 and 1, at which the callback
+//     is called (number).
+//   - args[1] - Interval, in milliseconds, to check the usage (number).
+//   - args[2] - A function that accepts the JSON of [StorageEstimate]. It must
+//     be of the form func(Uint8Array).
+//
+// Returns:
+//   - Throws an error if the fraction or interval is invalid.
+func SetStorageQuotaWarning(_ js.Value, args []js.Value) any {
+	fraction := args[0].Float()
+	interval := time.Duration(args[1].Int()) * time.Millisecond
+	invoke := args[2].Invoke
+
+	err := quotaWarning.start(fraction, interval, func(e StorageEstimate) {
+		estimateJSON, err := json.Marshal(e)
+		if err != nil {
+			jww.ERROR.Printf(
+				"Failed to JSON marshal %T for callback: %+v", e, err)
+			return
+		}
+		invoke(utils.CopyBytesToJS(estimateJSON))
+	}, getStorageEstimate)
+	if err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return nil
+}
+
+// getStorageUsage builds the StorageUsage for the registered databases of
+// every profile.
+func getStorageUsage() (StorageUsage, error) {
+	estimate, err := getStorageEstimate()
+	if err != nil {
+		return StorageUsage{}, err
+	}
+	quotaWarning.check(estimate)
+
+	profiles, err := allProfileStorage(storage.GetLocalStorage())
+	if err != nil {
+		return StorageUsage{}, err
+	}
+	registry := make(map[string]DatabaseInfo)
+	for _, ls := range profiles {
+		profileRegistry, err := loadIndexedDbRegistry(ls)
+		if err != nil {
+			return StorageUsage{}, err
+		}
+		for databaseName, info := range profileRegistry {
+			registry[databaseName] = info
+		}
+	}
+
+	usage := StorageUsage{
+		Estimate:  estimate,
+		Databases: make([]DatabaseUsage, 0, len(registry)),
+	}
+	for _, info := range registry {
+		dbUsage := DatabaseUsage{DatabaseInfo: info}
+		dbUsage.Stores, err = impl.GetDatabaseStats(info.Name)
+		if err != nil {
+			jww.WARN.Printf("Failed to get usage of database %s: %+v",
+				info.Name, err)
+			dbUsage.Error = err.Error()
+		}
+		for _, s := range dbUsage.Stores {
+			dbUsage.Rows += s.Rows
+			dbUsage.Bytes += s.Bytes
+		}
+		usage.Databases = append(usage.Databases, dbUsage)
+	}
+	sort.Slice(usage.Databases, func(i, j int) bool {
+		return usage.Databases[i].Name < usage.Databases[j].Name
+	})
+
+	usage.LocalStorageKeys, usage.LocalStorageBytes =
+		localStorageUsage(storage.GetLocalStorage())
+
+	return usage, nil
+}
+
+// getStorageEstimate returns the result of navigator.storage.estimate().
+func getStorageEstimate() (StorageEstimate, error) {
+	storageManager := js.Global().Get("navigator").Get("storage")
+	if storageManager.IsUndefined() {
+		return StorageEstimate{},
+			errors.New("navigator.storage is not supported in this context")
+	}
+
+	result, awaitErr := utils.Await(storageManager.Call("estimate"))
+	if awaitErr != nil {
+		return StorageEstimate{}, js.Error{Value: awaitErr[0]}
+	}
+
+	return StorageEstimate{
+		Usage: uint64(result[0].Get("usage").Float()),
+		Quota: uint64(result[0].Get("quota").Float()),
+	}, nil
+}
+
+// localStorageUsage returns the number of local storage keys and the size of
+// their names and values.
+func localStorageUsage(localStorage storage.LocalStorage) (int, uint64) {
+	keys := localStorage.Keys()
+	var size uint64
+	for _, keyName := range keys {
+		size += uint64(len(keyName))
+		if value, err := localStorage.Get(keyName); err == nil {
+			size += uint64(len(value))
+		}
+	}
+	return len(keys), size
+}
+
+// quotaWarning is the monitor started by SetStorageQuotaWarning.
+var quotaWarning quotaMonitor
+
+// quotaMonitor periodically checks the storage estimate and calls its callback
+// when usage crosses the threshold.
+type quotaMonitor struct {
+	fraction float64
+	cb       func(e StorageEstimate)
+	exceeded bool
+	stop     chan struct{}
+	mux      sync.Mutex
+}
+
+// start replaces the threshold and callback and starts polling the estimate
+// with the given function at the interval. Any previous polling is stopped.
+func (m *quotaMonitor) start(fraction float64, interval time.Duration,
+	cb func(e StorageEstimate), estimate func() (StorageEstimate, error)) error {
+	if fraction <= 0 || fraction > 1 {
+		return errors.Errorf(
+			"quota fraction must be in the range (0, 1], received %f", fraction)
+	} else if interval <= 0 {
+		return errors.Errorf(
+			"interval must be greater than zero, received %s", interval)
+	}
+
+	m.mux.Lock()
+	if m.stop != nil {
+		close(m.stop)
+	}
+	stop := make(chan struct{})
+	m.fraction, m.cb, m.exceeded, m.stop = fraction, cb, false, stop
+	m.mux.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e, err := estimate()
+				if err != nil {
+					jww.WARN.Printf(
+						"Failed to get storage estimate: %+v", err)
+					continue
+				}
+				m.check(e)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// check calls the callback if the usage has risen above the threshold since
+// the last check. Returns true if the callback was called.
+func (m *quotaMonitor) check(e StorageEstimate) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.cb == nil || e.Quota == 0 {
+		return false
+	}
+
+	above := float64(e.Usage) >= m.fraction*float64(e.Quota)
+	crossed := above && !m.exceeded
+	m.exceeded = above
+	if crossed {
+		go m.cb(e)
+	}
+
+	return crossed
+}
@@ -0,0 +1,106 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// Tests that quotaMonitor.check only calls the callback when usage rises above
+// the threshold and calls it again after usage has dropped below it.
+func Test_quotaMonitor_check(t *testing.T) {
+	called := make(chan StorageEstimate, 10)
+	m := quotaMonitor{
+		fraction: 0.8,
+		cb:       func(e StorageEstimate) { called <- e },
+	}
+
+	tests := []struct {
+		usage    uint64
+		expected bool
+	}{
+		{10, false}, {79, false}, {80, true}, {95, false}, {50, false},
+		{90, true},
+	}
+	for i, tt := range tests {
+		crossed := m.check(StorageEstimate{Usage: tt.usage, Quota: 100})
+		if crossed != tt.expected {
+			t.Errorf("Unexpected result for usage %d (%d)."+
+				"\nexpected: %t\nreceived: %t", tt.usage, i, tt.expected, crossed)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-called:
+		case <-time.After(50 * time.Millisecond):
+			t.Fatalf("Timed out waiting for callback %d.", i)
+		}
+	}
+}
+
+// Tests that quotaMonitor.start polls the estimate function and calls the
+// callback when the threshold is crossed.
+func Test_quotaMonitor_start(t *testing.T) {
+	var m quotaMonitor
+	called := make(chan StorageEstimate, 1)
+	estimate := func() (StorageEstimate, error) {
+		return StorageEstimate{Usage: 90, Quota: 100}, nil
+	}
+	err := m.start(0.5, time.Millisecond,
+		func(e StorageEstimate) { called <- e }, estimate)
+	if err != nil {
+		t.Fatalf("Failed to start monitor: %+v", err)
+	}
+	defer close(m.stop)
+
+	select {
+	case e := <-called:
+		if e.Usage != 90 || e.Quota != 100 {
+			t.Errorf("Unexpected estimate: %+v", e)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Timed out waiting for callback.")
+	}
+}
+
+// Error path: Tests that quotaMonitor.start rejects invalid fractions.
+func Test_quotaMonitor_start_InvalidFraction(t *testing.T) {
+	var m quotaMonitor
+	for _, fraction := range []float64{0, -0.5, 1.5} {
+		err := m.start(fraction, time.Second, func(StorageEstimate) {}, nil)
+		if err == nil {
+			t.Errorf("No error for invalid fraction %f.", fraction)
+		}
+	}
+}
+
+// Tests that localStorageUsage counts the size of all keys and values.
+func Test_localStorageUsage(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	if err := ls.Set("key1", []byte("value1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.Set("key22", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	n, size := localStorageUsage(ls)
+	if n != 2 {
+		t.Errorf("Unexpected number of keys.\nexpected: %d\nreceived: %d", 2, n)
+	}
+	if size != 16 {
+		t.Errorf("Unexpected size.\nexpected: %d\nreceived: %d", 16, size)
+	}
+}
@@ -33,10 +33,30 @@ const (
 // current version and if not, upgrades it. It also stored the current xxDK
 // client to storage.
 //
+// When upgrading, all registered migrations between the stored and current
+// versions are run in order (see [RegisterMigration]). Returns an error if the
+// stored data was written by a newer version of xxDK WASM or client.
+//
+// Each profile has its own stored versions, so the check and migrations are
+// run for every profile. The old versions reported by [GetOldWasmSemVersion]
+// and [GetOldClientSemVersion] are those of the default profile.
+//
 // On first load, only the xxDK WASM and xxDK client versions are stored.
 func CheckAndStoreVersions() error {
-	return checkAndStoreVersions(
-		SEMVER, bindings.GetVersion(), storage.GetLocalStorage())
+	profiles, err := allProfileStorage(storage.GetLocalStorage())
+	if err != nil {
+		return err
+	}
+
+	// Check the default profile last so that its old versions are kept
+	for i := len(profiles) - 1; i >= 0; i-- {
+		err = checkAndStoreVersions(SEMVER, bindings.GetVersion(), profiles[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func checkAndStoreVersions(
@@ -74,7 +94,12 @@ func checkAndStoreVersions(
 		jww.INFO.Printf("xxDK WASM version is current: v%s", storedWasmVer)
 	}
 
-	// Upgrade path code goes here
+	// Run all migrations between the stored and current versions
+	err = runMigrations(registeredMigrations(), storedWasmVer, currentWasmVer,
+		storedClientVer, currentClientVer, ls)
+	if err != nil {
+		return err
+	}
 
 	// Save current versions
 	if err = ls.Set(clientVerKey, []byte(currentClientVer)); err != nil {
@@ -84,6 +109,9 @@ func checkAndStoreVersions(
 		return errors.Wrapf(err, "localStorage: failed to set %q", semverKey)
 	}
 
+	// The upgrade is complete, so its progress is no longer needed
+	ls.RemoveItem(migrationProgressKey)
+
 	return nil
 }
 
@@ -16,11 +16,15 @@ import (
 	"sync"
 	"syscall/js"
 
+	jww "github.com/spf13/jwalterweatherman"
+
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/channels"
 	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	channelsDb "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/id"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -80,6 +84,21 @@ func newChannelsManagerJS(api *bindings.ChannelsManager) map[string]any {
 		// Channel Receiving Logic and Callback Registration
 		"RegisterReceiveHandler": js.FuncOf(cm.RegisterReceiveHandler),
 
+		// Message Storage
+		"QueryMessages":        js.FuncOf(cm.QueryMessages),
+		"SearchMessages":       js.FuncOf(cm.SearchMessages),
+		"SetRetentionPolicy":   js.FuncOf(cm.SetRetentionPolicy),
+		"ExportChannelHistory": js.FuncOf(cm.ExportChannelHistory),
+		"ImportHistory":        js.FuncOf(cm.ImportHistory),
+		"MarkRead":             js.FuncOf(cm.MarkRead),
+		"GetUnreadCounts":      js.FuncOf(cm.GetUnreadCounts),
+		"SaveDraft":            js.FuncOf(cm.SaveDraft),
+		"GetDraft":             js.FuncOf(cm.GetDraft),
+		"ClearDraft":           js.FuncOf(cm.ClearDraft),
+		"RotateDatabaseKey":    js.FuncOf(cm.RotateDatabaseKey),
+		"EncryptDatabase":      js.FuncOf(cm.EncryptDatabase),
+		"DecryptDatabase":      js.FuncOf(cm.DecryptDatabase),
+
 		// Notifications
 		"GetNotificationLevel":  js.FuncOf(cm.GetNotificationLevel),
 		"GetNotificationStatus": js.FuncOf(cm.GetNotificationStatus),
@@ -401,6 +420,7 @@ func NewChannelsManagerWithIndexedDb(_ js.Value, args []js.Value) any {
 // new private identity ([channel.PrivateIdentity]) and using indexedDb as a
 // backend to manage the event model. However, the data is written in plain text
 // and not encrypted. It is recommended that you do not use this in production.
+// To encrypt the data later, use [ChannelsManager.EncryptDatabase].
 //
 // This is for creating a manager for an identity for the first time. For
 // generating a new one channel identity, use [GenerateChannelIdentity]. To
@@ -1110,6 +1130,7 @@ func (cm *ChannelsManager) SendMessage(_ js.Value, args []js.Value) any {
 		if err != nil {
 			reject(exception.NewTrace(err))
 		} else {
+			cm.clearSentDraft(marshalledChanId)
 			resolve(utils.CopyBytesToJS(sendReport))
 		}
 	}
@@ -1171,6 +1192,7 @@ func (cm *ChannelsManager) SendReply(_ js.Value, args []js.Value) any {
 		if err != nil {
 			reject(exception.NewTrace(err))
 		} else {
+			cm.clearSentDraft(marshalledChanId)
 			resolve(utils.CopyBytesToJS(sendReport))
 		}
 	}
@@ -1675,6 +1697,651 @@ func (cm *ChannelsManager) GetMutedUsers(_ js.Value, args []js.Value) any {
 	return utils.CopyBytesToJS(mutedUsers)
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Message Storage                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// QueryMessages returns a page of messages stored in the indexedDb event model
+// of this [ChannelsManager] that match the query. The message content is
+// decrypted. Only available for managers created or loaded with indexedDb
+// (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// To get the next page, pass the returned "nextCursor" as the "cursor" of the
+// same query. When "nextCursor" is empty, there are no more messages.
+//
+// Parameters:
+//   - args[0] - JSON of [channelsDb.MessageQuery] (Uint8Array). All fields are
+//     optional.
+//
+// Returns a promise:
+//   - Resolves to the JSON of [channelsDb.MessageQueryResult] (Uint8Array).
+//   - Rejected with an error if the query is invalid or the manager does not
+//     use indexedDb.
+//
+// Example query:
+//
+//	{
+//	  "channelID": "ouFTjrB6vJ8MDRrZ9KR3cVUbQY2cC0ek8gGW4jKTWPQD",
+//	  "types": [1],
+//	  "start": "2023-05-01T00:00:00Z",
+//	  "limit": 50,
+//	  "descending": true
+//	}
+func (cm *ChannelsManager) QueryMessages(_ js.Value, args []js.Value) any {
+	queryJSON := utils.CopyBytesToGo(args[0])
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		var query channelsDb.MessageQuery
+		if err := json.Unmarshal(queryJSON, &query); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		result, err := channelsDb.QueryMessages(storageTag, query)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(resultJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SearchMessages returns the messages stored in the indexedDb event model of
+// this [ChannelsManager] that contain every term in the query, newest first.
+// The message content is decrypted. Only available for managers created or
+// loaded with indexedDb (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Terms are runs of letters and digits and are matched whole and without
+// regard to case. Terms shorter than two characters are ignored. Reactions are
+// not searchable.
+//
+// Parameters:
+//   - args[0] - The search query (string).
+//   - args[1] - Marshalled bytes of the channel [id.ID] to search in
+//     (Uint8Array). Pass null to search every channel.
+//   - args[2] - The maximum number of messages to return. Set to 0 for the
+//     default of 100 (int).
+//
+// Returns a promise:
+//   - Resolves to the JSON of a list of [channels.ModelMessage] (Uint8Array).
+//   - Rejected with an error if the channel ID is invalid, searching fails, or
+//     the manager does not use indexedDb.
+func (cm *ChannelsManager) SearchMessages(_ js.Value, args []js.Value) any {
+	msg := channelsDb.SearchMessagesMessage{
+		Query: args[0].String(),
+		Limit: args[2].Int(),
+	}
+	var channelIdBytes []byte
+	if !args[1].IsNull() && !args[1].IsUndefined() {
+		channelIdBytes = utils.CopyBytesToGo(args[1])
+	}
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if channelIdBytes != nil {
+			channelID, err := id.Unmarshal(channelIdBytes)
+			if err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+			msg.ChannelID = channelID
+		}
+
+		messages, err := channelsDb.SearchMessages(storageTag, msg)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		messagesJSON, err := json.Marshal(messages)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(messagesJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SetRetentionPolicy sets the retention policy of a channel stored in the
+// indexedDb event model of this [ChannelsManager]. Messages that the policy
+// does not keep are deleted now and then periodically in the background; a
+// [bindings.MessageDeleted] event is sent for each. Pinned messages are always
+// kept. Only available for managers created or loaded with indexedDb (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel [id.ID] (Uint8Array).
+//   - args[1] - JSON of [impl.RetentionPolicy] (Uint8Array). An empty object
+//     removes the policy.
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Rejected with an error if the channel ID or policy is invalid, deleting
+//     messages fails, or the manager does not use indexedDb.
+//
+// Example policy (keep at most 500 messages from the last 30 days):
+//
+//	{
+//	  "maxAge": 2592000000000000,
+//	  "maxCount": 500
+//	}
+func (cm *ChannelsManager) SetRetentionPolicy(_ js.Value, args []js.Value) any {
+	channelIdBytes := utils.CopyBytesToGo(args[0])
+	policyJSON := utils.CopyBytesToGo(args[1])
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		channelID, err := id.Unmarshal(channelIdBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		var policy impl.RetentionPolicy
+		if err = json.Unmarshal(policyJSON, &policy); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = channelsDb.SetRetentionPolicy(storageTag, channelID, policy)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ExportChannelHistory exports the history of a channel stored in the
+// indexedDb event model of this [ChannelsManager]. Messages are decrypted and
+// written in timestamp order with their replies, reactions, file references,
+// nicknames, and timestamps. The output is passed to the callback in chunks, so
+// large channels are not held in memory at once. Only available for managers
+// created or loaded with indexedDb (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel [id.ID] (Uint8Array).
+//   - args[1] - The output format (string). One of "json" (JSON of
+//     [channelsDb.ChannelHistory]), "markdown", or "html" (a self-contained
+//     page).
+//   - args[2] - JSON of [channelsDb.ExportRange] (Uint8Array). An empty object
+//     exports every message.
+//   - args[3] - Javascript object that has functions that implement the
+//     callback `Callback(chunk)`. It is called with each part of the output
+//     (Uint8Array), in order. The output is the concatenation of every chunk.
+//
+// Returns a promise:
+//   - Resolves once the last chunk is passed to the callback.
+//   - Rejected with an error if the channel ID, format, or range is invalid,
+//     reading messages fails, or the manager does not use indexedDb.
+//
+// Example range (messages from May 2023):
+//
+//	{
+//	  "start": "2023-05-01T00:00:00Z",
+//	  "end": "2023-06-01T00:00:00Z"
+//	}
+func (cm *ChannelsManager) ExportChannelHistory(_ js.Value, args []js.Value) any {
+	channelIdBytes := utils.CopyBytesToGo(args[0])
+	format := channelsDb.ExportFormat(args[1].String())
+	rangeJSON := utils.CopyBytesToGo(args[2])
+	callback := utils.WrapCB(args[3], "Callback")
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		channelID, err := id.Unmarshal(channelIdBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		var r channelsDb.ExportRange
+		if err = json.Unmarshal(rangeJSON, &r); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = channelsDb.ExportChannelHistory(storageTag, channelID, format, r,
+			func(chunk []byte) { callback(utils.CopyBytesToJS(chunk)) })
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ImportHistory imports a channel history exported with
+// [ChannelsManager.ExportChannelHistory] in the "json" format into the
+// indexedDb event model of this [ChannelsManager]. Messages keep their original
+// timestamps and statuses and are encrypted with the key of the database. The
+// channel is added to the database if it is missing, but it is not joined.
+// Messages are imported in batches between other database operations, and the
+// progress is reported after each batch. Only available for managers created
+// or loaded with indexedDb (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Messages that are already stored are skipped, so an interrupted import can
+// be run again. A message stored in another channel is reported as a conflict.
+//
+// Parameters:
+//   - args[0] - JSON of [channelsDb.ChannelHistory] (Uint8Array).
+//   - args[1] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.ImportProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves to the JSON of the final [impl.ImportProgress] (Uint8Array),
+//     which summarises the duplicates and conflicts.
+//   - Rejected with an error if the archive is invalid or of a newer version,
+//     storing messages fails, or the manager does not use indexedDb.
+func (cm *ChannelsManager) ImportHistory(_ js.Value, args []js.Value) any {
+	archive := utils.CopyBytesToGo(args[0])
+	progress := importProgress(utils.WrapCB(args[1], "Callback"))
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		result, err := channelsDb.ImportHistory(storageTag, archive, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(resultJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// MarkRead moves the read marker of a channel stored in the indexedDb event
+// model of this [ChannelsManager] to a message, and recounts the unread
+// messages after it. Messages sent by the user move the marker automatically.
+// Only available for managers created or loaded with indexedDb (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// When the marker or the number of unread messages of a channel changes, the
+// event model callback is called with the event type
+// [channelsDb.UnreadCountChanged] (10000) and the JSON of
+// [channelsDb.UnreadCount].
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel [id.ID] (Uint8Array).
+//   - args[1] - The UUID of the newest read message. Set to 0 to mark every
+//     message received so far as read (int).
+//
+// Returns a promise:
+//   - Resolves once the marker is stored.
+//   - Rejected with an error if the channel ID is invalid, the channel or
+//     message is not stored, the message is in another channel, or the manager
+//     does not use indexedDb.
+func (cm *ChannelsManager) MarkRead(_ js.Value, args []js.Value) any {
+	channelIdBytes := utils.CopyBytesToGo(args[0])
+	uuid := uint64(args[1].Int())
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		channelID, err := id.Unmarshal(channelIdBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = channelsDb.MarkRead(storageTag, channelID, uuid)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetUnreadCounts returns the read marker and the number of unread messages of
+// every channel stored in the indexedDb event model of this [ChannelsManager].
+// Reactions, hidden messages, and messages sent by the user are never unread.
+// Only available for managers created or loaded with indexedDb (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// Returns a promise:
+//   - Resolves to the JSON of a list of [channelsDb.UnreadCount] (Uint8Array).
+//   - Rejected with an error if reading fails or the manager does not use
+//     indexedDb.
+func (cm *ChannelsManager) GetUnreadCounts(js.Value, []js.Value) any {
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		counts, err := channelsDb.GetUnreadCounts(storageTag)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		countsJSON, err := json.Marshal(counts)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(countsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SaveDraft stores the draft of a message being written in a channel in the
+// indexedDb event model of this [ChannelsManager], with its text encrypted with
+// the key of the database. It replaces any stored draft. The draft is cleared
+// when a message is sent to the channel with [ChannelsManager.SendMessage] or
+// [ChannelsManager.SendReply]. Only available for managers created or loaded
+// with indexedDb (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel [id.ID] (Uint8Array).
+//   - args[1] - JSON of [impl.Draft] (Uint8Array). The update time is set
+//     when it is stored. A draft without text, reply target, or files clears
+//     the stored draft.
+//
+// Returns a promise:
+//   - Resolves once the draft is stored.
+//   - Rejected with an error if the channel ID or draft is invalid, storing
+//     fails, or the manager does not use indexedDb.
+func (cm *ChannelsManager) SaveDraft(_ js.Value, args []js.Value) any {
+	channelIdBytes := utils.CopyBytesToGo(args[0])
+	draftJSON := utils.CopyBytesToGo(args[1])
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		channelID, err := id.Unmarshal(channelIdBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		var draft impl.Draft
+		if err = json.Unmarshal(draftJSON, &draft); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = channelsDb.SaveDraft(storageTag, channelID, draft)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetDraft returns the draft of a message being written in a channel from the
+// indexedDb event model of this [ChannelsManager]. Only available for managers
+// created or loaded with indexedDb (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel [id.ID] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves to the JSON of [impl.Draft] (Uint8Array). The draft has no
+//     text, reply target, or files if none is stored.
+//   - Rejected with an error if the channel ID is invalid, reading fails, or
+//     the manager does not use indexedDb.
+func (cm *ChannelsManager) GetDraft(_ js.Value, args []js.Value) any {
+	channelIdBytes := utils.CopyBytesToGo(args[0])
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		channelID, err := id.Unmarshal(channelIdBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		draft, err := channelsDb.GetDraft(storageTag, channelID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		draftJSON, err := json.Marshal(draft)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(draftJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ClearDraft removes the draft of a message being written in a channel from
+// the indexedDb event model of this [ChannelsManager]. Only available for
+// managers created or loaded with indexedDb (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel [id.ID] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once the draft is removed, or if none is stored.
+//   - Rejected with an error if the channel ID is invalid, deleting fails, or
+//     the manager does not use indexedDb.
+func (cm *ChannelsManager) ClearDraft(_ js.Value, args []js.Value) any {
+	channelIdBytes := utils.CopyBytesToGo(args[0])
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		channelID, err := id.Unmarshal(channelIdBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = channelsDb.ClearDraft(storageTag, channelID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// clearSentDraft removes the draft of the channel once a message is sent to
+// it. Managers that do not use indexedDb have no drafts, so errors are only
+// logged.
+func (cm *ChannelsManager) clearSentDraft(channelIdBytes []byte) {
+	channelID, err := id.Unmarshal(channelIdBytes)
+	if err != nil {
+		return
+	}
+	err = channelsDb.ClearDraft(cm.api.GetStorageTag(), channelID)
+	if err != nil {
+		jww.DEBUG.Printf(
+			"Did not clear draft of channel %s: %+v", channelID, err)
+	}
+}
+
+// importProgress returns a function that JSON marshals the progress of a
+// history import and passes it to the callback.
+func importProgress(
+	callback func(args ...any) js.Value) func(impl.ImportProgress) {
+	return func(progress impl.ImportProgress) {
+		progressJSON, err := json.Marshal(progress)
+		if err != nil {
+			jww.ERROR.Printf("Failed to JSON marshal %T: %+v", progress, err)
+			return
+		}
+		callback(utils.CopyBytesToJS(progressJSON))
+	}
+}
+
+// RotateDatabaseKey re-encrypts every message stored in the indexedDb event
+// model of this [ChannelsManager] with a new [DbCipher]. Messages are
+// re-encrypted in batches between other database operations, and the progress
+// is reported after each batch. The search index is rebuilt once every message
+// is re-encrypted. Only available for managers created or loaded with
+// indexedDb (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// If the rotation is interrupted (e.g., the page is closed), the manager must
+// be loaded with the new key, which reads messages encrypted with either key,
+// and the rotation is resumed by calling this again with the same key. After
+// the rotation, the manager must be loaded with the new key.
+//
+// The new [DbCipher] must be made from a new password. [NewDatabaseCipher]
+// derives the key from the password and a salt stored with the cMix client, so
+// a cipher made from the current password has the same key and is rejected.
+//
+// Parameters:
+//   - args[0] - ID of the new [DbCipher] object in tracker (int). Create this
+//     object with [NewDatabaseCipher] and get its id with [DbCipher.GetID].
+//   - args[1] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.KeyRotationProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once every message is re-encrypted.
+//   - Rejected with an error if the cipher does not exist or is locked, the
+//     new key is the same as the current one, an unfinished rotation is to a
+//     different key, re-encryption fails, the database is not encrypted, or
+//     the manager does not use indexedDb.
+func (cm *ChannelsManager) RotateDatabaseKey(_ js.Value, args []js.Value) any {
+	cipherID := args[0].Int()
+	progress := keyRotationProgress(utils.WrapCB(args[1], "Callback"))
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		cipher, err := dbCipherTrackerSingleton.get(cipherID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		encryption, err := cipher.unlockedAPI()
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = channelsDb.RotateDatabaseKey(storageTag, encryption, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// EncryptDatabase encrypts every message stored in the unencrypted indexedDb
+// event model of this [ChannelsManager] with a [DbCipher]. It migrates a
+// database created with [NewChannelsManagerWithIndexedDbUnsafe] so that it is
+// encrypted. Messages are encrypted in batches between other database
+// operations, and the progress is reported after each batch.
+//
+// If the migration is interrupted (e.g., the page is closed), the manager must
+// be loaded with the key once the first batch is encrypted, and without it
+// before then, and the migration is resumed by calling this again with the
+// same key.
+//
+// Parameters:
+//   - args[0] - ID of the [DbCipher] object in tracker (int). Create this
+//     object with [NewDatabaseCipher] and get its id with [DbCipher.GetID].
+//   - args[1] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.KeyRotationProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once every message is encrypted.
+//   - Rejected with an error if the cipher does not exist or is locked, an
+//     unfinished migration is to a different key, encryption fails, the
+//     database is already encrypted and has no unfinished migration, or the
+//     manager does not use indexedDb.
+func (cm *ChannelsManager) EncryptDatabase(_ js.Value, args []js.Value) any {
+	cipherID := args[0].Int()
+	progress := keyRotationProgress(utils.WrapCB(args[1], "Callback"))
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		cipher, err := dbCipherTrackerSingleton.get(cipherID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		encryption, err := cipher.unlockedAPI()
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = channelsDb.EncryptDatabase(storageTag, encryption, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// DecryptDatabase decrypts every message stored in the encrypted indexedDb
+// event model of this [ChannelsManager]. Messages are decrypted in batches
+// between other database operations, and the progress is reported after each
+// batch. It is recommended that you do not use this in production.
+//
+// If the migration is interrupted (e.g., the page is closed), the manager must
+// be loaded with the old key, and the migration is resumed by calling this
+// again. Once every message is decrypted, the database is recorded as
+// unencrypted, and the manager must be loaded with
+// [LoadChannelsManagerWithIndexedDbUnsafe] from then on.
+//
+// Parameters:
+//   - args[0] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.KeyRotationProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once every message is decrypted.
+//   - Rejected with an error if an unfinished migration is to an encrypted
+//     database, decryption fails, the database is not encrypted, or the
+//     manager does not use indexedDb.
+func (cm *ChannelsManager) DecryptDatabase(_ js.Value, args []js.Value) any {
+	progress := keyRotationProgress(utils.WrapCB(args[0], "Callback"))
+	storageTag := cm.api.GetStorageTag()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := channelsDb.DecryptDatabase(storageTag, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Notifications                                                              //
 ////////////////////////////////////////////////////////////////////////////////
@@ -10,17 +10,30 @@
 package wasm
 
 import (
+	"encoding/json"
+	"io"
 	"sync"
 	"syscall/js"
 
 	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/storage/utility"
 	"gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
 )
 
+// cipherLockedErr is returned when a DbCipher is used while the session is
+// locked.
+const cipherLockedErr = "cannot use DbCipher while the session is locked"
+
+// lockPasswordLen is the length of the random password that the key of a
+// DbCipher is derived from while the session is locked.
+const lockPasswordLen = 32
+
 // dbCipherTrackerSingleton is used to track DbCipher objects
 // so that they can be referenced by ID back over the bindings.
 var dbCipherTrackerSingleton = &DbCipherTracker{
@@ -37,9 +50,17 @@ type DbCipherTracker struct {
 	mux     sync.RWMutex
 }
 
+// DbCipherSessionHandler returns the tracker of all DbCipher objects so that
+// their keys are replaced when the session is locked.
+func DbCipherSessionHandler() storage.SessionHandler {
+	return dbCipherTrackerSingleton
+}
+
 // create creates a DbCipher from a [indexedDb.Cipher], assigns it a unique
-// ID, and adds it to the DbCipherTracker.
-func (ct *DbCipherTracker) create(c indexedDb.Cipher) *DbCipher {
+// ID, and adds it to the DbCipherTracker. The salt, block size, and RNG are
+// kept so the cipher can be re-derived when the session is unlocked.
+func (ct *DbCipherTracker) create(c indexedDb.Cipher, salt []byte,
+	blockSize int, rng io.Reader) *DbCipher {
 	ct.mux.Lock()
 	defer ct.mux.Unlock()
 
@@ -47,13 +68,42 @@ func (ct *DbCipherTracker) create(c indexedDb.Cipher) *DbCipher {
 	ct.count++
 
 	ct.tracked[chID] = &DbCipher{
-		api: c,
-		id:  chID,
+		api:       c,
+		salt:      salt,
+		blockSize: blockSize,
+		rng:       rng,
+		id:        chID,
 	}
 
 	return ct.tracked[chID]
 }
 
+// Lock replaces the key of every tracked DbCipher. This adheres to the
+// [storage.SessionHandler] interface.
+func (ct *DbCipherTracker) Lock() {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+
+	for _, c := range ct.tracked {
+		c.lock()
+	}
+}
+
+// Unlock re-derives the key of every tracked DbCipher from the internal
+// password. This adheres to the [storage.SessionHandler] interface.
+func (ct *DbCipherTracker) Unlock(internalPassword []byte) error {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+
+	for id, c := range ct.tracked {
+		if err := c.unlock(internalPassword); err != nil {
+			return errors.Wrapf(err, "failed to unlock DbCipher %d", id)
+		}
+	}
+
+	return nil
+}
+
 // get an DbCipher from the DbCipherTracker given its ID.
 func (ct *DbCipherTracker) get(id int) (*DbCipher, error) {
 	ct.mux.RLock()
@@ -79,9 +129,15 @@ func (ct *DbCipherTracker) delete(id int) {
 // DbCipher wraps the [indexedDb.Cipher] object so its methods
 // can be wrapped to be Javascript compatible.
 type DbCipher struct {
-	api  indexedDb.Cipher
-	salt []byte
-	id   int
+	api       indexedDb.Cipher
+	salt      []byte
+	blockSize int
+	rng       io.Reader
+	id        int
+
+	// locked is true when the key of api has been replaced by a random key.
+	locked bool
+	mux    sync.RWMutex
 }
 
 // newDbCipherJS creates a new Javascript compatible object
@@ -108,10 +164,18 @@ func newDbCipherJS(c *DbCipher) map[string]any {
 //     into [DbCipher.Encrypt] that is larger than this value will result
 //     in an error (int).
 //
+// The key of the cipher is replaced by a random key when the session is
+// locked (see [storage.Lock]) and re-derived when it is unlocked.
+//
 // Returns:
 //   - JavaScript representation of the [DbCipher] object.
-//   - Throws an error if creating the cipher fails.
+//   - Throws an error if creating the cipher fails or the session is locked.
 func NewDatabaseCipher(_ js.Value, args []js.Value) any {
+	if storage.SessionLocked() {
+		exception.ThrowTrace(errors.New(cipherLockedErr))
+		return nil
+	}
+
 	cmixId := args[0].Int()
 	password := utils.CopyBytesToGo(args[1])
 	plaintTextBlockSize := args[2].Int()
@@ -137,13 +201,15 @@ func NewDatabaseCipher(_ js.Value, args []js.Value) any {
 	// Construct a cipher
 	c, err := indexedDb.NewCipher(
 		password, salt, plaintTextBlockSize, stream)
+	zeroBytes(password)
 	if err != nil {
 		exception.ThrowTrace(err)
 		return nil
 	}
 
 	// Add to singleton and return
-	return newDbCipherJS(dbCipherTrackerSingleton.create(c))
+	return newDbCipherJS(dbCipherTrackerSingleton.create(
+		c, salt, plaintTextBlockSize, stream))
 }
 
 // GetID returns the ID for this [DbCipher] in the
@@ -167,6 +233,13 @@ func (c *DbCipher) GetID(js.Value, []js.Value) any {
 //   - The ciphertext of the plaintext passed in (String).
 //   - Throws an error if it fails to encrypt the plaintext.
 func (c *DbCipher) Encrypt(_ js.Value, args []js.Value) any {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if c.locked {
+		exception.ThrowTrace(errors.New(cipherLockedErr))
+		return nil
+	}
+
 	ciphertext, err := c.api.Encrypt(utils.CopyBytesToGo(args[0]))
 	if err != nil {
 		exception.ThrowTrace(err)
@@ -188,6 +261,13 @@ func (c *DbCipher) Encrypt(_ js.Value, args []js.Value) any {
 //   - The plaintext of the ciphertext passed in (Uint8Array).
 //   - Throws an error if it fails to encrypt the plaintext.
 func (c *DbCipher) Decrypt(_ js.Value, args []js.Value) any {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if c.locked {
+		exception.ThrowTrace(errors.New(cipherLockedErr))
+		return nil
+	}
+
 	plaintext, err := c.api.Decrypt(args[0].String())
 	if err != nil {
 		exception.ThrowTrace(err)
@@ -203,6 +283,13 @@ func (c *DbCipher) Decrypt(_ js.Value, args []js.Value) any {
 //   - JSON of the cipher (Uint8Array).
 //   - Throws an error if marshalling fails.
 func (c *DbCipher) MarshalJSON(js.Value, []js.Value) any {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if c.locked {
+		exception.ThrowTrace(errors.New(cipherLockedErr))
+		return nil
+	}
+
 	data, err := c.api.MarshalJSON()
 	if err != nil {
 		exception.ThrowTrace(err)
@@ -224,6 +311,13 @@ func (c *DbCipher) MarshalJSON(js.Value, []js.Value) any {
 //   - JSON of the cipher (Uint8Array).
 //   - Throws an error if marshalling fails.
 func (c *DbCipher) UnmarshalJSON(_ js.Value, args []js.Value) any {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.locked {
+		exception.ThrowTrace(errors.New(cipherLockedErr))
+		return nil
+	}
+
 	err := c.api.UnmarshalJSON(utils.CopyBytesToGo(args[0]))
 	if err != nil {
 		exception.ThrowTrace(err)
@@ -231,3 +325,93 @@ func (c *DbCipher) UnmarshalJSON(_ js.Value, args []js.Value) any {
 	}
 	return nil
 }
+
+// unlockedAPI returns the [indexedDb.Cipher] of the DbCipher. Returns an error
+// if the session is locked.
+func (c *DbCipher) unlockedAPI() (indexedDb.Cipher, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if c.locked {
+		return nil, errors.New(cipherLockedErr)
+	}
+	return c.api, nil
+}
+
+// keyRotationProgress returns a function that calls the Javascript callback
+// with the JSON of each [impl.KeyRotationProgress] (Uint8Array).
+func keyRotationProgress(
+	callback func(args ...any) js.Value) func(impl.KeyRotationProgress) {
+	return func(progress impl.KeyRotationProgress) {
+		progressJSON, err := json.Marshal(progress)
+		if err != nil {
+			jww.ERROR.Printf(
+				"Failed to JSON marshal %T: %+v", progress, err)
+			return
+		}
+		callback(utils.CopyBytesToJS(progressJSON))
+	}
+}
+
+// lock replaces the key of the cipher in place with a random key, so any event
+// model holding the cipher can no longer use it. The [indexedDb.Cipher] does
+// not expose its key, so the old key cannot be overwritten; it is dropped.
+func (c *DbCipher) lock() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.locked {
+		return
+	}
+
+	random := make([]byte, lockPasswordLen)
+	if _, err := io.ReadFull(c.rng, random); err != nil {
+		jww.FATAL.Panicf("Failed to generate random key: %+v", err)
+	}
+	defer zeroBytes(random)
+	if err := c.setKey(random); err != nil {
+		jww.FATAL.Panicf("Failed to replace key of DbCipher: %+v", err)
+	}
+
+	c.locked = true
+}
+
+// unlock re-derives the key from the internal password and writes it into the
+// existing cipher so that references held by event models remain valid.
+func (c *DbCipher) unlock(internalPassword []byte) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.locked {
+		return nil
+	}
+
+	if err := c.setKey(internalPassword); err != nil {
+		return err
+	}
+
+	c.locked = false
+	return nil
+}
+
+// setKey derives a key from the password and writes it into the existing
+// cipher. The mutex must be held.
+func (c *DbCipher) setKey(password []byte) error {
+	derived, err :=
+		indexedDb.NewCipher(password, c.salt, c.blockSize, c.rng)
+	if err != nil {
+		return err
+	}
+
+	data, err := derived.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(data)
+
+	return c.api.UnmarshalJSON(data)
+}
+
+// zeroBytes overwrites the byte slice with zeros.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -19,8 +19,10 @@ import (
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/dm"
 	"gitlab.com/elixxir/crypto/codename"
+	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	indexDB "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
 )
 
@@ -55,6 +57,21 @@ func newDMClientJS(api *bindings.DMClient) map[string]any {
 		"GetBlockedPartners":    js.FuncOf(cm.GetBlockedPartners),
 		"GetDatabaseName":       js.FuncOf(cm.GetDatabaseName),
 
+		// Message Storage
+		"GetConversationMessages": js.FuncOf(cm.GetConversationMessages),
+		"GetMessageByID":          js.FuncOf(cm.GetMessageByID),
+		"SearchMessages":          js.FuncOf(cm.SearchMessages),
+		"SetRetentionPolicy":      js.FuncOf(cm.SetRetentionPolicy),
+		"ImportHistory":           js.FuncOf(cm.ImportHistory),
+		"MarkRead":                js.FuncOf(cm.MarkRead),
+		"GetUnreadCounts":         js.FuncOf(cm.GetUnreadCounts),
+		"SaveDraft":               js.FuncOf(cm.SaveDraft),
+		"GetDraft":                js.FuncOf(cm.GetDraft),
+		"ClearDraft":              js.FuncOf(cm.ClearDraft),
+		"RotateDatabaseKey":       js.FuncOf(cm.RotateDatabaseKey),
+		"EncryptDatabase":         js.FuncOf(cm.EncryptDatabase),
+		"DecryptDatabase":         js.FuncOf(cm.DecryptDatabase),
+
 		// Share URL
 		"GetShareURL": js.FuncOf(cm.GetShareURL),
 
@@ -185,7 +202,8 @@ func NewDMClientWithIndexedDb(_ js.Value, args []js.Value) any {
 // NewDMClientWithIndexedDbUnsafe creates a new [DMClient] from a private
 // identity ([codename.PrivateIdentity]) and an indexedDbWorker as a backend
 // to manage the event model. However, the data is written in plain text and not
-// encrypted. It is recommended that you do not use this in production.
+// encrypted. It is recommended that you do not use this in production. To
+// encrypt the data later, use [DMClient.EncryptDatabase].
 //
 // This is for instantiating a manager for an identity. For generating
 // a new identity, use [codename.GenerateIdentity]. You should instantiate
@@ -436,6 +454,7 @@ func (dmc *DMClient) SendText(_ js.Value, args []js.Value) any {
 		if err != nil {
 			reject(exception.NewTrace(err))
 		} else {
+			dmc.clearSentDraft(partnerPubKeyBytes)
 			resolve(utils.CopyBytesToJS(sendReport))
 		}
 	}
@@ -494,6 +513,7 @@ func (dmc *DMClient) SendReply(_ js.Value, args []js.Value) any {
 		if err != nil {
 			reject(exception.NewTrace(err))
 		} else {
+			dmc.clearSentDraft(partnerPubKeyBytes)
 			resolve(utils.CopyBytesToJS(sendReport))
 		}
 	}
@@ -731,6 +751,558 @@ func (dmc *DMClient) GetDatabaseName(js.Value, []js.Value) any {
 		"_speakeasy_dm"
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Message Storage                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// GetConversationMessages returns a page of messages in the conversation with
+// the partner stored in the indexedDb event model of this [DMClient], newest
+// first. The message content is decrypted. Only available for clients created
+// with indexedDb (e.g., [NewDMClientWithIndexedDb]).
+//
+// To get the next page, pass the UUID of the last message returned as args[1].
+// When fewer messages than the limit are returned, there are no more messages.
+//
+// Parameters:
+//   - args[0] - The partner's [ed25519.PublicKey] (Uint8Array).
+//   - args[1] - Only messages stored before the message with this UUID are
+//     returned. Set to 0 to start from the newest message (int).
+//   - args[2] - The maximum number of messages to return. Set to 0 for the
+//     default of 100 (int).
+//
+// Returns a promise:
+//   - Resolves to the JSON of a list of [indexDB.ModelMessage] (Uint8Array).
+//   - Rejected with an error if reading fails or the client does not use
+//     indexedDb.
+func (dmc *DMClient) GetConversationMessages(_ js.Value, args []js.Value) any {
+	partnerPubKey := utils.CopyBytesToGo(args[0])
+	before := uint64(args[1].Int())
+	limit := args[2].Int()
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		messages, err := indexDB.GetConversationMessages(
+			dmPath, partnerPubKey, before, limit)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		messagesJSON, err := json.Marshal(messages)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(messagesJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetMessageByID returns the message with the given [message.ID] stored in the
+// indexedDb event model of this [DMClient]. The message content is decrypted.
+// Only available for clients created with indexedDb (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - The bytes of the [message.ID] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves to the JSON of [indexDB.ModelMessage] (Uint8Array).
+//   - Rejected with an error if the message does not exist or the client does
+//     not use indexedDb.
+func (dmc *DMClient) GetMessageByID(_ js.Value, args []js.Value) any {
+	messageIdBytes := utils.CopyBytesToGo(args[0])
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		messageID, err := message.UnmarshalID(messageIdBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		msg, err := indexDB.GetMessageByID(dmPath, messageID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		msgJSON, err := json.Marshal(msg)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(msgJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SearchMessages returns the messages stored in the indexedDb event model of
+// this [DMClient] that contain every term in the query, newest first. The
+// message content is decrypted. Only available for clients created with
+// indexedDb (e.g., [NewDMClientWithIndexedDb]).
+//
+// Terms are runs of letters and digits and are matched whole and without
+// regard to case. Terms shorter than two characters are ignored. Reactions are
+// not searchable.
+//
+// Parameters:
+//   - args[0] - The search query (string).
+//   - args[1] - The partner's [ed25519.PublicKey] to search the conversation
+//     with (Uint8Array). Pass null to search every conversation.
+//   - args[2] - The maximum number of messages to return. Set to 0 for the
+//     default of 100 (int).
+//
+// Returns a promise:
+//   - Resolves to the JSON of a list of [indexDB.ModelMessage] (Uint8Array).
+//   - Rejected with an error if searching fails or the client does not use
+//     indexedDb.
+func (dmc *DMClient) SearchMessages(_ js.Value, args []js.Value) any {
+	msg := indexDB.SearchMessagesMessage{
+		Query: args[0].String(),
+		Limit: args[2].Int(),
+	}
+	if !args[1].IsNull() && !args[1].IsUndefined() {
+		msg.PartnerPubKey = utils.CopyBytesToGo(args[1])
+	}
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		messages, err := indexDB.SearchMessages(dmPath, msg)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		messagesJSON, err := json.Marshal(messages)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(messagesJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SetRetentionPolicy sets the retention policy of the conversation with the
+// partner stored in the indexedDb event model of this [DMClient]. Messages that
+// the policy does not keep are deleted now and then periodically in the
+// background; a [bindings.DmMessageDeleted] event is sent for each. DMs cannot
+// be pinned, so "pinnedOnly" deletes every message. Only available for clients
+// created with indexedDb (e.g., [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - The partner's [ed25519.PublicKey] (Uint8Array).
+//   - args[1] - JSON of [impl.RetentionPolicy] (Uint8Array). An empty object
+//     removes the policy.
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Rejected with an error if the policy is invalid, deleting messages
+//     fails, or the client does not use indexedDb.
+//
+// Example policy (keep the newest 1000 messages):
+//
+//	{
+//	  "maxCount": 1000
+//	}
+func (dmc *DMClient) SetRetentionPolicy(_ js.Value, args []js.Value) any {
+	partnerPubKey := utils.CopyBytesToGo(args[0])
+	policyJSON := utils.CopyBytesToGo(args[1])
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		var policy impl.RetentionPolicy
+		if err := json.Unmarshal(policyJSON, &policy); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err := indexDB.SetRetentionPolicy(dmPath, partnerPubKey, policy)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ImportHistory imports the archive of a DM conversation into the indexedDb
+// event model of this [DMClient]. Messages keep their original timestamps and
+// statuses and are encrypted with the key of the database. The conversation is
+// added if it is missing. Messages are imported in batches between other
+// database operations, and the progress is reported after each batch. Only
+// available for clients created with indexedDb (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// Messages that are already stored are skipped, so an interrupted import can
+// be run again. A message stored in another conversation is reported as a
+// conflict.
+//
+// Parameters:
+//   - args[0] - JSON of [indexDB.ConversationHistory] (Uint8Array).
+//   - args[1] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.ImportProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves to the JSON of the final [impl.ImportProgress] (Uint8Array),
+//     which summarises the duplicates and conflicts.
+//   - Rejected with an error if the archive is invalid or of a newer version,
+//     storing messages fails, or the client does not use indexedDb.
+func (dmc *DMClient) ImportHistory(_ js.Value, args []js.Value) any {
+	archive := utils.CopyBytesToGo(args[0])
+	progress := importProgress(utils.WrapCB(args[1], "Callback"))
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		result, err := indexDB.ImportHistory(dmPath, archive, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(resultJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// MarkRead moves the read marker of the conversation with the partner stored
+// in the indexedDb event model of this [DMClient] to a message, and recounts
+// the unread messages after it. Messages sent by the user move the marker
+// automatically. Only available for clients created with indexedDb (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// When the marker or the number of unread messages of a conversation changes,
+// the event model callback is called with the event type
+// [indexDB.UnreadCountChanged] (10000) and the JSON of [indexDB.UnreadCount].
+//
+// Parameters:
+//   - args[0] - The partner's [ed25519.PublicKey] (Uint8Array).
+//   - args[1] - The UUID of the newest read message. Set to 0 to mark every
+//     message received so far as read (int).
+//
+// Returns a promise:
+//   - Resolves once the marker is stored.
+//   - Rejected with an error if the conversation or message is not stored, the
+//     message is in another conversation, or the client does not use
+//     indexedDb.
+func (dmc *DMClient) MarkRead(_ js.Value, args []js.Value) any {
+	partnerPubKey := utils.CopyBytesToGo(args[0])
+	uuid := uint64(args[1].Int())
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := indexDB.MarkRead(dmPath, partnerPubKey, uuid)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetUnreadCounts returns the read marker and the number of unread messages of
+// every conversation stored in the indexedDb event model of this [DMClient].
+// Reactions and messages sent by the user are never unread. Only available for
+// clients created with indexedDb (e.g., [NewDMClientWithIndexedDb]).
+//
+// Returns a promise:
+//   - Resolves to the JSON of a list of [indexDB.UnreadCount] (Uint8Array).
+//   - Rejected with an error if reading fails or the client does not use
+//     indexedDb.
+func (dmc *DMClient) GetUnreadCounts(js.Value, []js.Value) any {
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		counts, err := indexDB.GetUnreadCounts(dmPath)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		countsJSON, err := json.Marshal(counts)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(countsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SaveDraft stores the draft of a message being written to a partner in the
+// indexedDb event model of this [DMClient], with its text encrypted with the
+// key of the database. It replaces any stored draft. The draft is cleared when
+// a message is sent to the partner with [DMClient.SendText] or
+// [DMClient.SendReply]. Only available for clients created with indexedDb
+// (e.g., [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - The partner's [ed25519.PublicKey] (Uint8Array).
+//   - args[1] - JSON of [impl.Draft] (Uint8Array). The update time is set
+//     when it is stored. A draft without text, reply target, or files clears
+//     the stored draft.
+//
+// Returns a promise:
+//   - Resolves once the draft is stored.
+//   - Rejected with an error if the draft is invalid, storing fails, or the
+//     client does not use indexedDb.
+func (dmc *DMClient) SaveDraft(_ js.Value, args []js.Value) any {
+	partnerPubKey := utils.CopyBytesToGo(args[0])
+	draftJSON := utils.CopyBytesToGo(args[1])
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		var draft impl.Draft
+		if err := json.Unmarshal(draftJSON, &draft); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err := indexDB.SaveDraft(dmPath, partnerPubKey, draft)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetDraft returns the draft of a message being written to a partner from the
+// indexedDb event model of this [DMClient]. Only available for clients created
+// with indexedDb (e.g., [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - The partner's [ed25519.PublicKey] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves to the JSON of [impl.Draft] (Uint8Array). The draft has no
+//     text, reply target, or files if none is stored.
+//   - Rejected with an error if reading fails or the client does not use
+//     indexedDb.
+func (dmc *DMClient) GetDraft(_ js.Value, args []js.Value) any {
+	partnerPubKey := utils.CopyBytesToGo(args[0])
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		draft, err := indexDB.GetDraft(dmPath, partnerPubKey)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		draftJSON, err := json.Marshal(draft)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(draftJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// ClearDraft removes the draft of a message being written to a partner from
+// the indexedDb event model of this [DMClient]. Only available for clients
+// created with indexedDb (e.g., [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - The partner's [ed25519.PublicKey] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once the draft is removed, or if none is stored.
+//   - Rejected with an error if deleting fails or the client does not use
+//     indexedDb.
+func (dmc *DMClient) ClearDraft(_ js.Value, args []js.Value) any {
+	partnerPubKey := utils.CopyBytesToGo(args[0])
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := indexDB.ClearDraft(dmPath, partnerPubKey)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// clearSentDraft removes the draft of the conversation with the partner once a
+// message is sent to them. Clients that do not use indexedDb have no drafts,
+// so errors are only logged.
+func (dmc *DMClient) clearSentDraft(partnerPubKey []byte) {
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+	if err := indexDB.ClearDraft(dmPath, partnerPubKey); err != nil {
+		jww.DEBUG.Printf("Did not clear draft of conversation %s: %+v",
+			base64.StdEncoding.EncodeToString(partnerPubKey), err)
+	}
+}
+
+// RotateDatabaseKey re-encrypts every message stored in the indexedDb event
+// model of this [DMClient] with a new [DbCipher]. Messages are re-encrypted in
+// batches between other database operations, and the progress is reported
+// after each batch. The search index is rebuilt once every message is
+// re-encrypted. Only available for clients created with indexedDb (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// If the rotation is interrupted (e.g., the page is closed), the client must be
+// created with the new key, which reads messages encrypted with either key, and
+// the rotation is resumed by calling this again with the same key. After the
+// rotation, the client must be created with the new key.
+//
+// The new [DbCipher] must be made from a new password. [NewDatabaseCipher]
+// derives the key from the password and a salt stored with the cMix client, so
+// a cipher made from the current password has the same key and is rejected.
+//
+// Parameters:
+//   - args[0] - ID of the new [DbCipher] object in tracker (int). Create this
+//     object with [NewDatabaseCipher] and get its id with [DbCipher.GetID].
+//   - args[1] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.KeyRotationProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once every message is re-encrypted.
+//   - Rejected with an error if the cipher does not exist or is locked, the
+//     new key is the same as the current one, an unfinished rotation is to a
+//     different key, re-encryption fails, the database is not encrypted, or
+//     the client does not use indexedDb.
+func (dmc *DMClient) RotateDatabaseKey(_ js.Value, args []js.Value) any {
+	cipherID := args[0].Int()
+	progress := keyRotationProgress(utils.WrapCB(args[1], "Callback"))
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		cipher, err := dbCipherTrackerSingleton.get(cipherID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		encryption, err := cipher.unlockedAPI()
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = indexDB.RotateDatabaseKey(dmPath, encryption, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// EncryptDatabase encrypts every message stored in the unencrypted indexedDb
+// event model of this [DMClient] with a [DbCipher]. It migrates a database
+// created with [NewDMClientWithIndexedDbUnsafe] so that it is encrypted.
+// Messages are encrypted in batches between other database operations, and the
+// progress is reported after each batch.
+//
+// If the migration is interrupted (e.g., the page is closed), the client must
+// be created with the key once the first batch is encrypted, and without it
+// before then, and the migration is resumed by calling this again with the
+// same key.
+//
+// Parameters:
+//   - args[0] - ID of the [DbCipher] object in tracker (int). Create this
+//     object with [NewDatabaseCipher] and get its id with [DbCipher.GetID].
+//   - args[1] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.KeyRotationProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once every message is encrypted.
+//   - Rejected with an error if the cipher does not exist or is locked, an
+//     unfinished migration is to a different key, encryption fails, the
+//     database is already encrypted and has no unfinished migration, or the
+//     client does not use indexedDb.
+func (dmc *DMClient) EncryptDatabase(_ js.Value, args []js.Value) any {
+	cipherID := args[0].Int()
+	progress := keyRotationProgress(utils.WrapCB(args[1], "Callback"))
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		cipher, err := dbCipherTrackerSingleton.get(cipherID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		encryption, err := cipher.unlockedAPI()
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = indexDB.EncryptDatabase(dmPath, encryption, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// DecryptDatabase decrypts every message stored in the encrypted indexedDb
+// event model of this [DMClient]. Messages are decrypted in batches between
+// other database operations, and the progress is reported after each batch. It
+// is recommended that you do not use this in production.
+//
+// If the migration is interrupted (e.g., the page is closed), the client must
+// be created with the old key, and the migration is resumed by calling this
+// again. Once every message is decrypted, the database is recorded as
+// unencrypted, and the client must be created with
+// [NewDMClientWithIndexedDbUnsafe] from then on.
+//
+// Parameters:
+//   - args[0] - Javascript object that has functions that implement the
+//     callback `Callback(progressJSON)`. It is called after each batch with
+//     the JSON of [impl.KeyRotationProgress] (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves once every message is decrypted.
+//   - Rejected with an error if an unfinished migration is to an encrypted
+//     database, decryption fails, the database is not encrypted, or the
+//     client does not use indexedDb.
+func (dmc *DMClient) DecryptDatabase(_ js.Value, args []js.Value) any {
+	progress := keyRotationProgress(utils.WrapCB(args[0], "Callback"))
+	dmPath := base64.RawStdEncoding.EncodeToString(dmc.api.GetPublicKey())
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := indexDB.DecryptDatabase(dmPath, progress)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // DM Share URL                                                          //
 ////////////////////////////////////////////////////////////////////////////////
@@ -23,6 +23,12 @@ import (
 // autogenerated unique IDs, this is the initial ID to start at.
 const initID = uint64(0)
 
+// Error messages.
+const (
+	// Manager.waitWhilePaused
+	managerStoppedErr = "worker %q is stopped"
+)
+
 // Response timeouts.
 const (
 	// workerInitialConnectionTimeout is the time to wait to receive initial
@@ -37,6 +43,17 @@ type Manager struct {
 	// Wrapper of the Worker Javascript object.
 	// Doc: https://developer.mozilla.org/en-US/docs/Web/API/Worker
 	w Worker
+
+	// resume is closed when a paused Manager is resumed or stopped. It is nil
+	// when the Manager is not paused.
+	resume   chan struct{}
+	stopped  bool
+	pauseMux sync.Mutex
+
+	// onStop are called once the Manager is stopped.
+	onStop   []func()
+	stopOnce sync.Once
+	stopMux  sync.Mutex
 }
 
 // Keep track of all managers created so that they can be stopped
@@ -44,6 +61,7 @@ type Manager struct {
 type ManagersTracker struct {
 	tracked map[int]*Manager
 	count   int
+	paused  bool
 	mux     sync.Mutex
 }
 
@@ -56,6 +74,36 @@ func (mt *ManagersTracker) add(m *Manager) {
 	mt.count++
 
 	mt.tracked[id] = m
+
+	if mt.paused && !m.isLogger() {
+		m.Pause()
+	}
+}
+
+// Lock pauses all managers except logger. Managers added while locked are
+// paused until Unlock is called. This adheres to the storage.SessionHandler
+// interface.
+func (mt *ManagersTracker) Lock() {
+	mt.mux.Lock()
+	defer mt.mux.Unlock()
+	mt.paused = true
+	for _, m := range mt.tracked {
+		if !m.isLogger() {
+			m.Pause()
+		}
+	}
+}
+
+// Unlock resumes all managers. This adheres to the storage.SessionHandler
+// interface.
+func (mt *ManagersTracker) Unlock([]byte) error {
+	mt.mux.Lock()
+	defer mt.mux.Unlock()
+	mt.paused = false
+	for _, m := range mt.tracked {
+		m.Resume()
+	}
+	return nil
 }
 
 // Stop all managers except logger
@@ -63,8 +111,7 @@ func (mt *ManagersTracker) Stop() {
 	mt.mux.Lock()
 	defer mt.mux.Unlock()
 	for id, m := range mt.tracked {
-		name := m.Name()
-		if name == "xxdkLogFileWorker-main" {
+		if m.isLogger() {
 			// Don't stop the logfile manager
 			continue
 		}
@@ -143,32 +190,129 @@ func NewManagerFromScript(
 	return NewManager(objectURLStr, name, messageLogging)
 }
 
-// Stop closes the worker manager and terminates the worker.
+// Stop closes the worker manager, terminates the worker, and then calls the
+// functions registered with RegisterStopCallback. Messages waiting for a paused
+// Manager and messages sent afterwards fail with an error. Calling Stop again
+// does nothing.
 func (m *Manager) Stop() error {
-	m.mm.Stop()
+	var err error
+	m.stopOnce.Do(func() {
+		m.release()
+		m.mm.Stop()
+
+		// Terminate the worker
+		err = errors.Wrapf(m.w.Terminate(),
+			"failed to terminate worker %q", m.mm.name)
+
+		m.stopMux.Lock()
+		onStop := m.onStop
+		m.stopMux.Unlock()
+		for _, cb := range onStop {
+			cb()
+		}
+	})
+	return err
+}
 
-	// Terminate the worker
-	err := m.w.Terminate()
-	return errors.Wrapf(err, "failed to terminate worker %q", m.mm.name)
+// RegisterStopCallback registers a function that is called once the Manager is
+// stopped.
+func (m *Manager) RegisterStopCallback(cb func()) {
+	m.stopMux.Lock()
+	defer m.stopMux.Unlock()
+	m.onStop = append(m.onStop, cb)
+}
+
+// Pause blocks all messages sent to the worker until Resume is called.
+// Messages received from the worker are still handled. Does nothing if the
+// Manager is stopped.
+func (m *Manager) Pause() {
+	m.pauseMux.Lock()
+	defer m.pauseMux.Unlock()
+	if m.resume == nil && !m.stopped {
+		m.resume = make(chan struct{})
+	}
+}
+
+// Resume unblocks all messages waiting to be sent to the worker.
+func (m *Manager) Resume() {
+	m.pauseMux.Lock()
+	defer m.pauseMux.Unlock()
+	if m.resume != nil {
+		close(m.resume)
+		m.resume = nil
+	}
+}
+
+// release marks the Manager as stopped and unblocks all messages waiting to be
+// sent to the worker.
+func (m *Manager) release() {
+	m.pauseMux.Lock()
+	defer m.pauseMux.Unlock()
+	m.stopped = true
+	if m.resume != nil {
+		close(m.resume)
+		m.resume = nil
+	}
+}
+
+// waitWhilePaused blocks until the Manager is resumed or stopped. It returns
+// immediately if the Manager is not paused. Returns an error if the Manager is
+// stopped.
+func (m *Manager) waitWhilePaused() error {
+	m.pauseMux.Lock()
+	resume := m.resume
+	m.pauseMux.Unlock()
+	if resume != nil {
+		<-resume
+	}
+
+	m.pauseMux.Lock()
+	defer m.pauseMux.Unlock()
+	if m.stopped {
+		return errors.Errorf(managerStoppedErr, m.mm.name)
+	}
+	return nil
 }
 
 // SendMessage sends a message to the worker with the given tag and waits for a
-// response. An error is returned on failure to send or on timeout.
+// response. An error is returned on failure to send, on timeout, or if the
+// Manager is stopped. If the Manager is paused, it blocks until resumed before
+// sending.
 func (m *Manager) SendMessage(tag Tag, data []byte) (response []byte, err error) {
+	if err = m.waitWhilePaused(); err != nil {
+		return nil, err
+	}
+	return m.mm.Send(tag, data)
+}
+
+// SendMessageWhilePaused sends a message to the worker with the given tag and
+// waits for a response, without waiting for a paused Manager to be resumed. It
+// is used to lock and unlock the worker with the session while all other
+// messages are paused.
+func (m *Manager) SendMessageWhilePaused(
+	tag Tag, data []byte) (response []byte, err error) {
 	return m.mm.Send(tag, data)
 }
 
 // SendTimeout sends a message to the worker with the given tag and waits for a
-// response. An error is returned on failure to send or on the specified
-// timeout.
+// response. An error is returned on failure to send, on the specified timeout,
+// or if the Manager is stopped. The timeout starts once the Manager is not
+// paused.
 func (m *Manager) SendTimeout(
 	tag Tag, data []byte, timeout time.Duration) (response []byte, err error) {
+	if err = m.waitWhilePaused(); err != nil {
+		return nil, err
+	}
 	return m.mm.SendTimeout(tag, data, timeout)
 }
 
-// SendNoResponse sends a message to the worker with the given tag. It returns
-// immediately and does not wait for a response.
+// SendNoResponse sends a message to the worker with the given tag. It does not
+// wait for a response, but blocks while the Manager is paused. An error is
+// returned if the Manager is stopped.
 func (m *Manager) SendNoResponse(tag Tag, data []byte) error {
+	if err := m.waitWhilePaused(); err != nil {
+		return err
+	}
 	return m.mm.SendNoResponse(tag, data)
 }
 
@@ -186,6 +330,9 @@ func (m *Manager) GetWorker() js.Value { return safejs.Unsafe(m.w.Value) }
 // Name returns the name of the web worker object.
 func (m *Manager) Name() string { return m.mm.name }
 
+// isLogger returns true if this Manager is for the logfile worker.
+func (m *Manager) isLogger() bool { return m.Name() == "xxdkLogFileWorker-main" }
+
 ////////////////////////////////////////////////////////////////////////////////
 // Worker Wrapper                                                             //
 ////////////////////////////////////////////////////////////////////////////////
@@ -12,6 +12,7 @@ package worker
 import (
 	"syscall/js"
 	"testing"
+	"time"
 )
 
 // Tests that newWorkerOptions returns a Javascript object with the expected
@@ -48,3 +49,66 @@ func Test_newWorkerOptions(t *testing.T) {
 		}
 	}
 }
+
+// Tests that Manager.waitWhilePaused blocks after Manager.Pause is called and
+// returns once Manager.Resume is called.
+func TestManager_Pause_Resume(t *testing.T) {
+	m := &Manager{}
+	m.waitWhilePaused()
+
+	m.Pause()
+	done := make(chan struct{})
+	go func() {
+		m.waitWhilePaused()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("Did not block while paused.")
+	case <-time.After(25 * time.Millisecond):
+	}
+
+	m.Resume()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Timed out waiting for resume.")
+	}
+}
+
+// Tests that Manager.release unblocks Manager.waitWhilePaused with an error
+// and that a stopped Manager cannot be paused again.
+func TestManager_release(t *testing.T) {
+	m := &Manager{mm: &MessageManager{name: "TestManager_release"}}
+	m.Pause()
+	done := make(chan error)
+	go func() { done <- m.waitWhilePaused() }()
+
+	select {
+	case <-done:
+		t.Fatalf("Did not block while paused.")
+	case <-time.After(25 * time.Millisecond):
+	}
+
+	m.release()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("No error waiting on stopped Manager.")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for release.")
+	}
+
+	m.Pause()
+	go func() { done <- m.waitWhilePaused() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("No error waiting on stopped Manager.")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Blocked while stopped.")
+	}
+}